@@ -0,0 +1,198 @@
+package ai
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//a prompt can reference local files with @path/to/file and directories with @dir/. each reference is
+//expanded in its own labelled message sent before the prompt: the content of a file, or the listing of
+//a directory. the files are checked first, a missing, binary or too large file refuses the whole prompt
+
+// attachmentListingLimit is the maximum number of entries of an attached directory listing.
+const attachmentListingLimit = 200
+
+// attachmentTrailingPunctuation is removed from the end of a reference, like the comma in "read @main.go, then".
+const attachmentTrailingPunctuation = ",;:!?)\"'"
+
+// Attachment is a file or a directory referenced in a prompt with @path.
+type Attachment struct {
+	reference string // Path as written in the prompt, without the @
+	path      string // Path of the file or the directory on disk
+	directory bool   // Indicates if a directory listing is attached rather than a file
+	content   string // Content of the file, or listing of the directory
+}
+
+// GetReference returns the path as written in the prompt, without the @.
+func (a Attachment) GetReference() string {
+	return a.reference
+}
+
+// IsDirectory returns a boolean indicating if a directory listing is attached rather than a file.
+func (a Attachment) IsDirectory() bool {
+	return a.directory
+}
+
+// GetContent returns the content of the file, or the listing of the directory.
+func (a Attachment) GetContent() string {
+	return a.content
+}
+
+// message returns the labelled message the attachment is sent in.
+func (a Attachment) message() string {
+	if a.directory {
+		return fmt.Sprintf("Listing of the attached directory %s:\n```\n%s\n```", a.reference, a.content)
+	}
+
+	return fmt.Sprintf("Content of the attached file %s:\n```\n%s\n```", a.reference, a.content)
+}
+
+// FindAttachmentReferences returns the paths referenced with @ in the input, in order and without the @.
+//a reference starts a word and goes up to the next space, a word like user@host is not one. a word
+//which doesn't look like a path, like @bob, is only a reference when such a file exists
+func FindAttachmentReferences(input string) []string {
+	var references []string
+	for _, word := range strings.Fields(input) {
+		if !strings.HasPrefix(word, "@") {
+			continue
+		}
+		reference := strings.TrimRight(word[1:], attachmentTrailingPunctuation)
+		if reference == "" || strings.HasPrefix(reference, "@") || strings.HasPrefix(reference, "{") {
+			continue
+		}
+		if !strings.ContainsAny(reference, "/.~") {
+			if _, err := os.Stat(reference); err != nil {
+				continue
+			}
+		}
+		references = append(references, reference)
+	}
+
+	return references
+}
+
+// LoadAttachments reads the files and directories referenced in the input. each file can take up to
+//maxSize bytes and all of them up to maxTotalSize bytes, 0 meaning no limit. the error tells which
+//reference is refused and why
+func LoadAttachments(input string, maxSize int64, maxTotalSize int64) ([]Attachment, error) {
+	var (
+		attachments []Attachment
+		total       int64
+		seen        = map[string]bool{}
+	)
+	for _, reference := range FindAttachmentReferences(input) {
+		if seen[reference] {
+			continue
+		}
+		seen[reference] = true
+
+		attachment, err := loadAttachment(reference, maxSize)
+		if err != nil {
+			return nil, fmt.Errorf("cannot attach @%s: %w", reference, err)
+		}
+		total += int64(len(attachment.content))
+		if maxTotalSize > 0 && total > maxTotalSize {
+			return nil, fmt.Errorf("cannot attach @%s: the attachments take more than %s in total", reference, formatSize(maxTotalSize))
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, nil
+}
+
+// loadAttachment reads a single file or directory referenced in a prompt.
+func loadAttachment(reference string, maxSize int64) (Attachment, error) {
+	path := reference
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return Attachment{}, err
+		}
+		path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return Attachment{}, unwrapPathError(err)
+	}
+	attachment := Attachment{reference: reference, path: path, directory: info.IsDir()}
+
+	if attachment.directory {
+		attachment.content, err = listDirectory(path)
+		return attachment, unwrapPathError(err)
+	}
+
+	//the size is checked before reading, so a huge file is never loaded
+	if maxSize > 0 && info.Size() > maxSize {
+		return Attachment{}, fmt.Errorf("the file takes %s, over the limit of %s", formatSize(info.Size()), formatSize(maxSize))
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Attachment{}, unwrapPathError(err)
+	}
+	if IsBinaryInput(content) {
+		return Attachment{}, fmt.Errorf("the file is binary, only text files can be attached")
+	}
+	attachment.content = strings.TrimRight(string(content), "\n")
+
+	return attachment, nil
+}
+
+// listDirectory lists the entries of a directory, the directories with a trailing / and the files with their size.
+func listDirectory(path string) (string, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	var lines []string
+	for i, entry := range entries {
+		if i == attachmentListingLimit {
+			lines = append(lines, fmt.Sprintf("... and %d more entries", len(entries)-i))
+			break
+		}
+		if entry.IsDir() {
+			lines = append(lines, entry.Name()+"/")
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			lines = append(lines, entry.Name())
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s (%s)", entry.Name(), formatSize(info.Size())))
+	}
+	if len(lines) == 0 {
+		return "(empty)", nil
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// unwrapPathError drops the operation and the path from an error of the os package, they are already
+//in the message saying which reference is refused
+func unwrapPathError(err error) error {
+	if pathError, ok := err.(*os.PathError); ok {
+		return pathError.Err
+	}
+
+	return err
+}
+
+// formatSize formats a number of bytes for the messages, in B, KB or MB.
+func formatSize(size int64) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1fMB", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%.1fKB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%dB", size)
+	}
+}
@@ -0,0 +1,133 @@
+package ai
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAttachment tests the files and directories attached to a prompt with @path.
+func TestAttachment(t *testing.T) {
+	t.Run("FindReferences", testAttachmentFindReferences)
+	t.Run("Load", testAttachmentLoad)
+	t.Run("Refused", testAttachmentRefused)
+	t.Run("Engine", testAttachmentEngine)
+}
+
+// newAttachmentDir creates a directory holding a text file, a binary file and a sub directory.
+func newAttachmentDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("buy milk\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "image.png"), []byte{0x89, 'P', 'N', 'G', 0, 0}, 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "src"), 0755))
+
+	return dir
+}
+
+// testAttachmentFindReferences checks which words of a prompt are references to attach.
+func testAttachmentFindReferences(t *testing.T) {
+	references := FindAttachmentReferences("compare @./a.go, @src/ and @~/b.txt with ssh user@host @bob @{1} @@x")
+	assert.Equal(t, []string{"./a.go", "src/", "~/b.txt"}, references)
+}
+
+// testAttachmentLoad checks that a file is attached with its content and a directory with its listing.
+func testAttachmentLoad(t *testing.T) {
+	dir := newAttachmentDir(t)
+	file := filepath.Join(dir, "notes.txt")
+
+	attachments, err := LoadAttachments("read @"+file+" and @"+dir+"/ and @"+file, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, attachments, 2)
+
+	assert.False(t, attachments[0].IsDirectory())
+	assert.Equal(t, file, attachments[0].GetReference())
+	assert.Equal(t, "buy milk", attachments[0].GetContent())
+	assert.Equal(t, "Content of the attached file "+file+":\n```\nbuy milk\n```", attachments[0].message())
+
+	assert.True(t, attachments[1].IsDirectory())
+	assert.Equal(t, "image.png (6B)\nnotes.txt (9B)\nsrc/", attachments[1].GetContent())
+	assert.True(t, strings.HasPrefix(attachments[1].message(), "Listing of the attached directory "+dir+"/:"))
+}
+
+// testAttachmentRefused checks that the missing, binary and too large files are refused with the reason.
+func testAttachmentRefused(t *testing.T) {
+	dir := newAttachmentDir(t)
+	file := filepath.Join(dir, "notes.txt")
+
+	tests := []struct {
+		name         string
+		input        string
+		maxSize      int64
+		maxTotalSize int64
+		err          string
+	}{
+		{
+			name:  "Missing",
+			input: "@" + filepath.Join(dir, "missing.txt"),
+			err:   "cannot attach @" + filepath.Join(dir, "missing.txt") + ": no such file or directory",
+		},
+		{
+			name:  "Binary",
+			input: "@" + filepath.Join(dir, "image.png"),
+			err:   "cannot attach @" + filepath.Join(dir, "image.png") + ": the file is binary, only text files can be attached",
+		},
+		{
+			name:    "TooLarge",
+			input:   "@" + file,
+			maxSize: 4,
+			err:     "cannot attach @" + file + ": the file takes 9B, over the limit of 4B",
+		},
+		{
+			name:         "TotalTooLarge",
+			input:        "@" + file + " @" + dir,
+			maxTotalSize: 12,
+			err:          "cannot attach @" + dir + ": the attachments take more than 12B in total",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := LoadAttachments(test.input, test.maxSize, test.maxTotalSize)
+			assert.EqualError(t, err, test.err)
+		})
+	}
+}
+
+// testAttachmentEngine checks that the attachments are sent in their own messages before the prompt, and
+//that nothing is sent when one of them is refused
+func testAttachmentEngine(t *testing.T) {
+	dir := newAttachmentDir(t)
+	file := filepath.Join(dir, "notes.txt")
+
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, `{"cmd":"cat notes.txt","exp":"print the notes","exec":true}`)
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL}))
+	require.NoError(t, err)
+
+	_, err = engine.ExecCompletion("print @" + file)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	messages := requests[0].Messages
+	assert.Equal(t, "Content of the attached file "+file+":\n```\nbuy milk\n```", messages[len(messages)-2].Content)
+	assert.Equal(t, "print @"+file, messages[len(messages)-1].Content)
+
+	_, err = engine.ExecCompletion("print @" + filepath.Join(dir, "image.png"))
+	assert.ErrorContains(t, err, "the file is binary")
+	assert.Len(t, requests, 1)
+
+	//the command of a fix is not a prompt, its @ are not references
+	engine.AppendCommandResult("curl -d @"+file+" localhost", 7, "", "connection refused", false)
+	_, err = engine.FixCompletion("curl -d @" + file + " localhost")
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
+	for _, message := range requests[1].Messages[len(messages):] {
+		assert.NotContains(t, message.Content, "buy milk")
+	}
+}
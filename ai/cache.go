@@ -0,0 +1,82 @@
+package ai
+
+import (
+	"errors"
+
+	"github.com/akhilsharma90/terminal-assistant/cache"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+//the exec answers are cached on disk, keyed on the whole request: the model, the messages with the
+//rendered system prompt, and the sampling parameters. the offline mode only answers from the cache.
+//only the final answer of a turn is cached, once it was validated, under the key of the first request of
+//the turn: the malformed answers, the repairs and the probes asked for on the way are not
+
+// ErrOffline is returned in offline mode when the answer is not in the cache.
+var ErrOffline = errors.New("offline mode: no cached answer for this request")
+
+// SetCache sets the cache of the exec answers, nil disables it.
+func (e *Engine) SetCache(answers *cache.Cache) *Engine {
+	defer e.lock()()
+	e.cache = answers
+
+	return e
+}
+
+// SetOffline sets the offline mode, where nothing is sent and only the cached answers are used.
+func (e *Engine) SetOffline(offline bool) *Engine {
+	defer e.lock()()
+	e.offline = offline
+
+	return e
+}
+
+// IsOffline returns whether the engine only answers from the cache.
+func (e *Engine) IsOffline() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.offline
+}
+
+// getCachedAnswer returns the key of the request, and its cached answer if there is one the parser accepts.
+func (e *Engine) getCachedAnswer(request openai.ChatCompletionRequest, parse func(content string) error) (string, string, bool) {
+	if e.cache == nil {
+		return "", "", false
+	}
+	key, err := cache.Key(request)
+	if err != nil {
+		return "", "", false
+	}
+
+	//a broken cache is only a miss, the request is sent
+	content, err := e.cache.Get(key)
+	if err != nil || parse(content) != nil {
+		return key, "", false
+	}
+
+	return key, content, true
+}
+
+// cacheAnswer caches the answer of the request of the given key.
+func (e *Engine) cacheAnswer(key string, content string) {
+	if e.cache == nil || key == "" {
+		return
+	}
+
+	//the cache only saves requests, failing to write it must not fail the request
+	e.cache.Put(key, content)
+}
+
+// ForgetAnswer removes the last exec answer from the cache, so the next time the question is asked it
+//is sent again. it's called when the command of the answer was rejected or failed
+func (e *Engine) ForgetAnswer() *Engine {
+	defer e.lock()()
+	if e.cache != nil && e.answerKey != "" {
+		e.cache.Delete(e.answerKey)
+	}
+	e.answerKey = ""
+
+	return e
+}
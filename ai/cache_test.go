@@ -0,0 +1,223 @@
+package ai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akhilsharma90/terminal-assistant/cache"
+	"github.com/akhilsharma90/terminal-assistant/config"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCache tests the cache of the exec answers and the offline mode.
+func TestCache(t *testing.T) {
+	t.Run("Hit", testCacheHit)
+	t.Run("Key", testCacheKey)
+	t.Run("ForgetAnswer", testCacheForgetAnswer)
+	t.Run("Offline", testCacheOffline)
+	t.Run("Repaired", testCacheRepaired)
+	t.Run("Invalid", testCacheInvalid)
+	t.Run("Probe", testCacheProbe)
+}
+
+// newCachingEngine returns an exec engine answering through the given server, with the given cache.
+func newCachingEngine(t *testing.T, url string, answers *cache.Cache) *Engine {
+	t.Helper()
+
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": url}))
+	require.NoError(t, err)
+
+	return engine.SetCache(answers)
+}
+
+// newTestCache opens a cache in a temporary directory.
+func newTestCache(t *testing.T) *cache.Cache {
+	t.Helper()
+
+	answers, err := cache.NewCache(filepath.Join(t.TempDir(), "cache"), time.Hour, 0)
+	require.NoError(t, err)
+
+	return answers
+}
+
+// newCountedCache opens a cache in a temporary directory, along with a function counting its answers.
+func newCountedCache(t *testing.T) (*cache.Cache, func() int) {
+	t.Helper()
+
+	dir := filepath.Join(t.TempDir(), "cache")
+	answers, err := cache.NewCache(dir, time.Hour, 0)
+	require.NoError(t, err)
+
+	return answers, func() int {
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		return len(entries)
+	}
+}
+
+// testCacheHit checks that the same question in the same context is answered from the cache.
+func testCacheHit(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, `{"cmd":"du -sh *","exp":"disk usage by folder","exec":true}`)
+	answers := newTestCache(t)
+
+	output, err := newCachingEngine(t, server.URL, answers).ExecCompletion("show disk usage by folder")
+	require.NoError(t, err)
+	assert.Equal(t, "du -sh *", output.GetCommand())
+
+	engine := newCachingEngine(t, server.URL, answers)
+	output, err = engine.ExecCompletion("show disk usage by folder")
+	require.NoError(t, err)
+	assert.Equal(t, "du -sh *", output.GetCommand())
+	assert.Len(t, requests, 1)
+
+	//the cached answer is kept in the history like any other
+	assert.Len(t, engine.execMessages, 2)
+}
+
+// testCacheKey checks that another sampling or another context is not answered from the cache.
+func testCacheKey(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, `{"cmd":"du -sh *","exp":"disk usage by folder","exec":true}`)
+	answers := newTestCache(t)
+
+	_, err := newCachingEngine(t, server.URL, answers).ExecCompletion("show disk usage by folder")
+	require.NoError(t, err)
+
+	temperature := 1.0
+	engine := newCachingEngine(t, server.URL, answers).SetSampling(config.SamplingConfig{Temperature: &temperature})
+	_, err = engine.ExecCompletion("show disk usage by folder")
+	require.NoError(t, err)
+
+	engine = newCachingEngine(t, server.URL, answers).SetPipe("some input")
+	_, err = engine.ExecCompletion("show disk usage by folder")
+	require.NoError(t, err)
+
+	assert.Len(t, requests, 3)
+}
+
+// testCacheForgetAnswer checks that a forgotten answer, like a rejected command, is asked again.
+func testCacheForgetAnswer(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, `{"cmd":"du -sh *","exp":"disk usage by folder","exec":true}`)
+	answers := newTestCache(t)
+
+	engine := newCachingEngine(t, server.URL, answers)
+	_, err := engine.ExecCompletion("show disk usage by folder")
+	require.NoError(t, err)
+	engine.ForgetAnswer()
+
+	_, err = newCachingEngine(t, server.URL, answers).ExecCompletion("show disk usage by folder")
+	require.NoError(t, err)
+	assert.Len(t, requests, 2)
+}
+
+// testCacheOffline checks that the offline mode only answers from the cache.
+func testCacheOffline(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, `{"cmd":"du -sh *","exp":"disk usage by folder","exec":true}`)
+	answers := newTestCache(t)
+
+	_, err := newCachingEngine(t, server.URL, answers).ExecCompletion("show disk usage by folder")
+	require.NoError(t, err)
+
+	engine := newCachingEngine(t, server.URL, answers).SetOffline(true)
+	output, err := engine.ExecCompletion("show disk usage by folder")
+	require.NoError(t, err)
+	assert.Equal(t, "du -sh *", output.GetCommand())
+
+	_, err = newCachingEngine(t, server.URL, answers).SetOffline(true).ExecCompletion("list the files")
+	assert.ErrorIs(t, err, ErrOffline)
+
+	//the chat answers are not cached, the error is only returned
+	engine.SetMode(ChatEngineMode)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- engine.ChatStreamCompletion("What is 2+2 ?")
+	}()
+	select {
+	case <-engine.GetChannel():
+		assert.Fail(t, "Nothing should be sent on the channel.")
+	case err := <-errs:
+		assert.ErrorIs(t, err, ErrOffline)
+	}
+
+	assert.Len(t, requests, 1)
+}
+
+// testCacheRepaired checks that only the repaired answer is cached, under the key of the question, and
+//that forgetting it asks the question again.
+func testCacheRepaired(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests,
+		`{"cmd":"du -sh *"}`,
+		`{"cmd":"du -sh *","exp":"disk usage by folder","exec":true}`,
+	)
+	answers, cached := newCountedCache(t)
+
+	_, err := newCachingEngine(t, server.URL, answers).ExecCompletion("show disk usage by folder")
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
+	assert.Equal(t, 1, cached(), "Only the repaired answer should be cached.")
+
+	engine := newCachingEngine(t, server.URL, answers)
+	output, err := engine.ExecCompletion("show disk usage by folder")
+	require.NoError(t, err)
+	assert.Equal(t, "du -sh *", output.GetCommand())
+	assert.True(t, output.IsExecutable())
+	assert.Len(t, requests, 2)
+
+	engine.ForgetAnswer()
+	assert.Equal(t, 0, cached(), "The answer should be forgotten.")
+}
+
+// testCacheInvalid checks that an answer which could not be repaired is not cached.
+func testCacheInvalid(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, `not a json answer`)
+	answers, cached := newCountedCache(t)
+
+	output, err := newCachingEngine(t, server.URL, answers).ExecCompletion("show disk usage by folder")
+	require.NoError(t, err)
+	assert.False(t, output.IsExecutable())
+	assert.Equal(t, 0, cached())
+
+	_, err = newCachingEngine(t, server.URL, answers).SetOffline(true).ExecCompletion("show disk usage by folder")
+	assert.ErrorIs(t, err, ErrOffline)
+}
+
+// testCacheProbe checks that the answer given after a probe is cached under the key of the question, so
+//the probe is not run again.
+func testCacheProbe(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests,
+		`{"probe":"pwd"}`,
+		`{"cmd":"ls","exp":"list the files","exec":true}`,
+	)
+	answers, cached := newCountedCache(t)
+	newProbingEngine := func() *Engine {
+		engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{
+			"OPENAI_BASE_URL":   server.URL,
+			"OPENAI_MAX_PROBES": 3,
+		}))
+		require.NoError(t, err)
+		return engine.SetCache(answers)
+	}
+
+	output, err := newProbingEngine().ExecCompletion("list the files")
+	require.NoError(t, err)
+	require.Len(t, output.GetProbes(), 1)
+	require.Len(t, requests, 2)
+	assert.Equal(t, 1, cached(), "Only the final answer should be cached.")
+
+	output, err = newProbingEngine().SetOffline(true).ExecCompletion("list the files")
+	require.NoError(t, err)
+	assert.Equal(t, "ls", output.GetCommand())
+	assert.Empty(t, output.GetProbes())
+	assert.Len(t, requests, 2)
+}
@@ -0,0 +1,348 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+//a cassette records the HTTP exchanges with the API in a file, then replays them without any network.
+//it sits under the providers, so every backend is recorded the same way and the replayed answers
+//go through the same decoding as the real ones, streamed answers included. the keys and the system
+//prompt, which describes the machine of the user, are redacted before anything is written, so a cassette
+//can be committed along with the tests or shared for a demo. as the system prompt changes from a machine
+//to another, it is redacted as well before the requests are matched, so a cassette replays anywhere
+
+// Modes of the cassette, picked with OPENAI_CASSETTE_MODE in the config file.
+const (
+	CassetteRecordMode = "record" // the requests are sent and the exchanges are written to the cassette
+	CassetteReplayMode = "replay" // the answers come from the cassette, nothing is sent
+)
+
+// cassetteRedacted replaces the secrets of the recorded exchanges.
+const cassetteRedacted = "REDACTED"
+
+// cassetteRedactedHeaders are the headers carrying secrets, they are redacted when recording.
+var cassetteRedactedHeaders = []string{"Authorization", "X-Api-Key", "Api-Key", "Openai-Organization", "Cookie", "Set-Cookie"}
+
+// cassetteRedactedParameters are the query parameters and the body fields carrying secrets, they are
+//redacted when recording
+var cassetteRedactedParameters = []string{"key", "api_key", "api-key"}
+
+// CassetteRequest is a recorded request.
+type CassetteRequest struct {
+	Method  string      `json:"method"`
+	Url     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body"`
+}
+
+// CassetteResponse is a recorded answer, the body of a streamed answer holds all its chunks.
+type CassetteResponse struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body"`
+}
+
+// CassetteInteraction is a recorded request along with its answer.
+type CassetteInteraction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// Cassette holds the exchanges recorded in a file.
+type Cassette struct {
+	file         string                // File the exchanges are read from and written to
+	interactions []CassetteInteraction // Exchanges in the order they were recorded
+	replayed     []bool                // Indicates, for each exchange, if it was already replayed
+	mu           sync.Mutex            // Guards the exchanges, the requests can come from several goroutines
+}
+
+// cassetteFile is the content of a cassette file.
+type cassetteFile struct {
+	Interactions []CassetteInteraction `json:"interactions"`
+}
+
+// LoadCassette reads the exchanges recorded in the given file. a missing file is an empty cassette,
+//ready to be recorded
+func LoadCassette(file string) (*Cassette, error) {
+	cassette := &Cassette{file: file}
+
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return cassette, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var recorded cassetteFile
+	if err := json.Unmarshal(content, &recorded); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", file, err)
+	}
+	cassette.interactions = recorded.Interactions
+	cassette.replayed = make([]bool, len(recorded.Interactions))
+
+	return cassette, nil
+}
+
+// GetInteractions returns a copy of the recorded exchanges.
+func (c *Cassette) GetInteractions() []CassetteInteraction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]CassetteInteraction{}, c.interactions...)
+}
+
+// add records an exchange and writes the whole cassette, so it is complete even if the session crashes.
+func (c *Cassette) add(interaction CassetteInteraction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interactions = append(c.interactions, interaction)
+	c.replayed = append(c.replayed, false)
+
+	content, err := json.MarshalIndent(cassetteFile{Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(c.file, content, 0600)
+}
+
+// find returns the first exchange not replayed yet matching the method, the path and the redacted body
+//of a request. the host is not compared, so a cassette recorded against a server can be replayed elsewhere
+func (c *Cassette) find(method string, path string, body string) (CassetteInteraction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	body = redactBody(body)
+	for i, interaction := range c.interactions {
+		if c.replayed[i] || interaction.Request.Method != method {
+			continue
+		}
+		recorded, err := url.Parse(interaction.Request.Url)
+		if err != nil || recorded.Path != path {
+			continue
+		}
+		if redactBody(interaction.Request.Body) != body {
+			continue
+		}
+		c.replayed[i] = true
+		return interaction, nil
+	}
+
+	return CassetteInteraction{}, fmt.Errorf("no recorded answer in the cassette %s for %s %s", c.file, method, path)
+}
+
+// redactBody returns a JSON body compacted, with its fields sorted and the system prompt and the secrets
+//redacted: the system prompt is either a message of the system role or the system field of Anthropic.
+//a body which is not JSON is left as it is
+func redactBody(body string) string {
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil {
+		return body
+	}
+
+	redactFields(fields)
+	if _, ok := fields["system"]; ok {
+		fields["system"] = cassetteRedacted
+	}
+	messages, _ := fields["messages"].([]interface{})
+	for _, message := range messages {
+		message, ok := message.(map[string]interface{})
+		if ok && message["role"] == "system" {
+			message["content"] = cassetteRedacted
+		}
+	}
+
+	redacted, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+
+	return string(redacted)
+}
+
+// redactFields redacts the fields carrying secrets, in the given object and in the ones it holds.
+func redactFields(value interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for name, field := range value {
+			if isRedactedParameter(name) {
+				value[name] = cassetteRedacted
+				continue
+			}
+			redactFields(field)
+		}
+	case []interface{}:
+		for _, item := range value {
+			redactFields(item)
+		}
+	}
+}
+
+// isRedactedParameter indicates if a query parameter or a body field carries a secret.
+func isRedactedParameter(name string) bool {
+	for _, redacted := range cassetteRedactedParameters {
+		if strings.EqualFold(name, redacted) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactHeaders returns a copy of the headers, with the ones carrying secrets redacted.
+func redactHeaders(headers http.Header) http.Header {
+	redacted := headers.Clone()
+	for _, name := range cassetteRedactedHeaders {
+		if redacted.Get(name) != "" {
+			redacted.Set(name, cassetteRedacted)
+		}
+	}
+
+	return redacted
+}
+
+// redactUrl returns the URL, with the query parameters carrying secrets redacted.
+func redactUrl(requestUrl *url.URL) string {
+	redacted := *requestUrl
+	query := redacted.Query()
+	for _, name := range cassetteRedactedParameters {
+		if query.Has(name) {
+			query.Set(name, cassetteRedacted)
+		}
+	}
+	redacted.RawQuery = query.Encode()
+
+	return redacted.String()
+}
+
+// cassetteTransport is an http.RoundTripper recording the exchanges in a cassette, or replaying them.
+type cassetteTransport struct {
+	next     http.RoundTripper // Transport sending the requests when recording, unused when replaying
+	cassette *Cassette         // Cassette the exchanges are recorded in or replayed from
+	mode     string            // Either CassetteRecordMode or CassetteReplayMode
+}
+
+// newCassetteTransport creates the transport of the given cassette file and mode.
+func newCassetteTransport(next http.RoundTripper, file string, mode string) (*cassetteTransport, error) {
+	if mode != CassetteRecordMode && mode != CassetteReplayMode {
+		return nil, fmt.Errorf("unknown cassette mode %s", mode)
+	}
+	cassette, err := LoadCassette(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cassetteTransport{
+		next:     next,
+		cassette: cassette,
+		mode:     mode,
+	}, nil
+}
+
+// RoundTrip records or replays a request.
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if t.mode == CassetteReplayMode {
+		interaction, err := t.cassette.find(req.Method, req.URL.Path, string(body))
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Response.Headers.Clone(),
+			Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	//the answer is recorded once it was read, so a streamed answer still reaches the engine chunk by chunk
+	request := CassetteRequest{
+		Method:  req.Method,
+		Url:     redactUrl(req.URL),
+		Headers: redactHeaders(req.Header),
+		Body:    redactBody(string(body)),
+	}
+	resp.Body = &recordingBody{
+		body: resp.Body,
+		done: func(content []byte) {
+			//the cassette is only a recording, failing to write it must not fail the request
+			t.cassette.add(CassetteInteraction{
+				Request: request,
+				Response: CassetteResponse{
+					StatusCode: resp.StatusCode,
+					Headers:    redactHeaders(resp.Header),
+					Body:       string(content),
+				},
+			})
+		},
+	}
+
+	return resp, nil
+}
+
+// recordingBody keeps what is read from the body of an answer, and hands it over once the body is
+//read entirely or closed
+type recordingBody struct {
+	body    io.ReadCloser
+	content bytes.Buffer
+	done    func(content []byte)
+	once    sync.Once
+}
+
+// Read reads from the body, keeping what was read.
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.content.Write(p[:n])
+	if errors.Is(err, io.EOF) {
+		b.finish()
+	}
+
+	return n, err
+}
+
+// Close closes the body, recording what was read if it was not done yet.
+func (b *recordingBody) Close() error {
+	b.finish()
+
+	return b.body.Close()
+}
+
+// finish hands over what was read, only once.
+func (b *recordingBody) finish() {
+	b.once.Do(func() {
+		b.done(b.content.Bytes())
+	})
+}
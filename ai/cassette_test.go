@@ -0,0 +1,163 @@
+package ai
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCassette tests the recording and the replay of the exchanges with the API.
+func TestCassette(t *testing.T) {
+	t.Run("RecordReplay", testCassetteRecordReplay)
+	t.Run("RedactBody", testCassetteRedactBody)
+	t.Run("NoRecordedAnswer", testCassetteNoRecordedAnswer)
+	t.Run("UnknownMode", testCassetteUnknownMode)
+}
+
+// newCassetteServer starts a server answering like the given provider, with the chat answer to the
+//question of runCassetteSession and with the exec answer otherwise
+func newCassetteServer(t *testing.T, name string, exec string, chat string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if strings.Contains(string(body), "What is 2+2") {
+			testProviderServers[name](chat, true)(w, r)
+		} else {
+			testProviderServers[name](exec, true)(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// runCassetteSession asks a command then a question to the engines of the given config.
+func runCassetteSession(t *testing.T, values map[string]interface{}) (*EngineExecOutput, string) {
+	t.Helper()
+
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, values))
+	require.NoError(t, err)
+	output, err := engine.ExecCompletion("list all files in my home dir")
+	require.NoError(t, err)
+
+	engine.SetMode(ChatEngineMode)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- engine.ChatStreamCompletion("What is 2+2 ?")
+	}()
+	var received string
+	for chunk := range engine.GetChannel() {
+		received += chunk.GetContent()
+		if chunk.IsLast() {
+			break
+		}
+	}
+	require.NoError(t, <-errs)
+
+	return output, received
+}
+
+// testCassetteRecordReplay checks that a recorded session is replayed the same without any network,
+//whatever the provider is and whatever the system prompt is, and that neither the key nor the system
+//prompt are recorded
+func testCassetteRecordReplay(t *testing.T) {
+	exec := `{"cmd":"ls ~","exp":"list all files in your home dir","exec":true}`
+	chat := "The answer for `2+2` is `4`"
+
+	for name := range testProviderServers {
+		t.Run(name, func(t *testing.T) {
+			server := newCassetteServer(t, name, exec, chat)
+			file := filepath.Join(t.TempDir(), "cassette.json")
+			values := map[string]interface{}{
+				"OPENAI_KEY":           "secret_key",
+				"OPENAI_PROVIDER":      name,
+				"OPENAI_BASE_URL":      server.URL,
+				"OPENAI_CASSETTE":      file,
+				"OPENAI_CASSETTE_MODE": CassetteRecordMode,
+				"USER_PREFERENCES":     "answer in french",
+			}
+
+			recordedOutput, recordedChat := runCassetteSession(t, values)
+			assert.Equal(t, "ls ~", recordedOutput.GetCommand())
+			assert.Equal(t, chat, recordedChat)
+
+			content, err := os.ReadFile(file)
+			require.NoError(t, err)
+			assert.NotContains(t, string(content), "secret_key")
+			assert.NotContains(t, string(content), "answer in french")
+			cassette, err := LoadCassette(file)
+			require.NoError(t, err)
+			assert.Len(t, cassette.GetInteractions(), 2)
+
+			//the server is gone, the answers can only come from the cassette
+			server.Close()
+			values["OPENAI_CASSETTE_MODE"] = CassetteReplayMode
+			values["USER_PREFERENCES"] = "answer in english"
+			replayedOutput, replayedChat := runCassetteSession(t, values)
+			assert.Equal(t, recordedOutput, replayedOutput)
+			assert.Equal(t, recordedChat, replayedChat)
+		})
+	}
+}
+
+// testCassetteRedactBody checks that the system prompt and the secrets of a body are redacted, and that
+//the redacted bodies only differ by what was not redacted
+func testCassetteRedactBody(t *testing.T) {
+	body := `{"model": "gpt-4", "api_key": "secret_key", "messages": [` +
+		`{"role": "system", "content": "my home directory is /home/bob"}, {"role": "user", "content": "list my files"}]}`
+	assert.Equal(t,
+		`{"api_key":"REDACTED","messages":[{"content":"REDACTED","role":"system"},{"content":"list my files","role":"user"}],"model":"gpt-4"}`,
+		redactBody(body),
+	)
+	assert.Equal(t,
+		`{"max_tokens":100,"system":"REDACTED"}`,
+		redactBody(`{"system": "my home directory is /home/bob", "max_tokens": 100}`),
+	)
+	assert.Equal(t, "not json", redactBody("not json"))
+
+	other := strings.Replace(body, "/home/bob", "/home/alice", 1)
+	assert.Equal(t, redactBody(body), redactBody(other))
+	other = strings.Replace(body, "list my files", "list my folders", 1)
+	assert.NotEqual(t, redactBody(body), redactBody(other))
+}
+
+// testCassetteNoRecordedAnswer checks that a request which was not recorded fails without being sent.
+func testCassetteNoRecordedAnswer(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{
+		"OPENAI_BASE_URL": server.URL,
+		"OPENAI_CASSETTE": filepath.Join(t.TempDir(), "cassette.json"),
+	}))
+	require.NoError(t, err)
+
+	_, err = engine.ExecCompletion("list all files in my home dir")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no recorded answer in the cassette")
+	assert.Zero(t, requests)
+}
+
+// testCassetteUnknownMode checks that a cassette mode which doesn't exist is refused.
+func testCassetteUnknownMode(t *testing.T) {
+	_, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{
+		"OPENAI_CASSETTE":      filepath.Join(t.TempDir(), "cassette.json"),
+		"OPENAI_CASSETTE_MODE": "rewind",
+	}))
+	assert.EqualError(t, err, "unknown cassette mode rewind")
+}
@@ -0,0 +1,214 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+//the messages history grows at each turn of a session, and everything is sent with each request.
+//once the messages would go over the token budget, the older turns are compacted: either trimmed,
+//or summarised in a single message. the system prompt and the pipe are never compacted
+
+// Context strategies, picked with the openai_context_strategy setting
+const (
+	TrimContextStrategy      = "trim"      // drops the older turns
+	SummarizeContextStrategy = "summarize" // replaces the older turns with a summary of them
+)
+
+// messageTokenOverhead is the tokens taken by the role and the separators of every message.
+const messageTokenOverhead = 4
+
+// replyTokenOverhead is the tokens taken by the priming of the answer.
+const replyTokenOverhead = 3
+
+// summaryMaxTokens is the maximum size of the summary replacing the older turns.
+const summaryMaxTokens = 500
+
+// summaryPrompt asks the model to summarise the older turns of the conversation.
+const summaryPrompt = "Summarize the following conversation between a user and a terminal assistant in a few sentences. " +
+	"Keep the facts, commands and results needed to carry on the conversation."
+
+// summaryPrefix starts the message holding the summary of the older turns.
+const summaryPrefix = "Summary of the earlier conversation: "
+
+// modelTokenizer describes how a family of models counts tokens, models are matched on their name prefix.
+type modelTokenizer struct {
+	prefix        string
+	contextWindow int     // tokens the model accepts for the messages and the answer
+	charsPerToken float64 // average characters per token of its tokenizer
+}
+
+// modelTokenizers lists the known models, the longest prefixes first.
+var modelTokenizers = []modelTokenizer{
+	{prefix: "gpt-4o", contextWindow: 128000, charsPerToken: 4},
+	{prefix: "gpt-4-turbo", contextWindow: 128000, charsPerToken: 4},
+	{prefix: "gpt-4-1106", contextWindow: 128000, charsPerToken: 4},
+	{prefix: "gpt-4-0125", contextWindow: 128000, charsPerToken: 4},
+	{prefix: "gpt-4-32k", contextWindow: 32768, charsPerToken: 4},
+	{prefix: "gpt-4", contextWindow: 8192, charsPerToken: 4},
+	{prefix: "gpt-3.5-turbo-16k", contextWindow: 16385, charsPerToken: 4},
+	{prefix: "gpt-3.5-turbo-1106", contextWindow: 16385, charsPerToken: 4},
+	{prefix: "gpt-3.5-turbo-0125", contextWindow: 16385, charsPerToken: 4},
+	{prefix: "gpt-3.5-turbo", contextWindow: 4096, charsPerToken: 4},
+	{prefix: "claude", contextWindow: 200000, charsPerToken: 3.5},
+	{prefix: "llama3", contextWindow: 8192, charsPerToken: 4},
+	{prefix: "mistral", contextWindow: 32768, charsPerToken: 3.5},
+}
+
+// defaultTokenizer is used for the models missing from modelTokenizers.
+var defaultTokenizer = modelTokenizer{contextWindow: 4096, charsPerToken: 4}
+
+// getModelTokenizer returns how the given model counts tokens.
+func getModelTokenizer(model string) modelTokenizer {
+	model = strings.ToLower(model)
+	for _, tokenizer := range modelTokenizers {
+		if strings.HasPrefix(model, tokenizer.prefix) {
+			return tokenizer
+		}
+	}
+
+	return defaultTokenizer
+}
+
+// countTokens estimates the tokens the given text takes for the model.
+func (t modelTokenizer) countTokens(text string) int {
+	return int(math.Ceil(float64(utf8.RuneCountInString(text)) / t.charsPerToken))
+}
+
+// countMessageTokens estimates the tokens a single message takes for the model.
+func (t modelTokenizer) countMessageTokens(message openai.ChatCompletionMessage) int {
+	return t.countTokens(message.Content) + messageTokenOverhead
+}
+
+// countMessagesTokens estimates the tokens a whole request takes for the model.
+func (t modelTokenizer) countMessagesTokens(messages []openai.ChatCompletionMessage) int {
+	tokens := replyTokenOverhead
+	for _, message := range messages {
+		tokens += t.countMessageTokens(message)
+	}
+
+	return tokens
+}
+
+// getContextBudget returns the tokens the messages sent can use. unless set in the config, it is
+//what the context window of the model leaves once the answer is accounted for
+func (e *Engine) getContextBudget() int {
+	if budget := e.config.GetAiConfig().GetContextBudget(); budget > 0 {
+		return budget
+	}
+
+	tokenizer := getModelTokenizer(e.getModel())
+	budget := tokenizer.contextWindow - e.config.GetAiConfig().GetMaxTokens()
+	if budget <= 0 {
+		budget = tokenizer.contextWindow / 2
+	}
+
+	return budget
+}
+
+// compactMessages compacts the older turns of the history of the current mode when the messages to send
+//are over the budget. the latest message, the one being answered, is always kept. it returns true when
+//the history was compacted
+func (e *Engine) compactMessages(ctx context.Context) (bool, error) {
+	tokenizer := getModelTokenizer(e.getModel())
+	budget := e.getContextBudget()
+
+	messages := e.prepareCompletionMessages()
+	if tokenizer.countMessagesTokens(messages) <= budget {
+		return false, nil
+	}
+
+	//the offline mode can't ask for a summary, the older turns are trimmed instead
+	summarize := e.config.GetAiConfig().GetContextStrategy() == SummarizeContextStrategy && !e.offline
+	history := e.getMessages()
+	//the system prompt and the pipe are always sent, what's left of the budget goes to the history
+	available := budget - tokenizer.countMessagesTokens(messages[:len(messages)-len(history)])
+	if summarize {
+		available -= summaryMaxTokens + messageTokenOverhead
+	}
+
+	//the newest messages are kept as long as they fit, the answer being asked for is always kept
+	kept := 1
+	available -= tokenizer.countMessageTokens(history[len(history)-1])
+	for kept < len(history) {
+		tokens := tokenizer.countMessageTokens(history[len(history)-kept-1])
+		if tokens > available {
+			break
+		}
+		available -= tokens
+		kept++
+	}
+	//the history restarts on a question of the user, not in the middle of a turn
+	for kept > 1 && history[len(history)-kept].Role != openai.ChatMessageRoleUser {
+		kept--
+	}
+
+	dropped := history[:len(history)-kept]
+	if len(dropped) == 0 {
+		return false, nil
+	}
+	compacted := append([]openai.ChatCompletionMessage{}, history[len(history)-kept:]...)
+	if summarize {
+		summary, err := e.summarizeMessages(ctx, dropped)
+		if err != nil {
+			//if the summary could not be made for any other reason than the request being
+			//interrupted or timing out, the older turns are just trimmed
+			if ctx.Err() != nil {
+				return false, e.requestError(ctx, err)
+			}
+		} else {
+			compacted = append([]openai.ChatCompletionMessage{{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: summaryPrefix + summary,
+			}}, compacted...)
+		}
+	}
+
+	e.setMessages(compacted)
+
+	return true, nil
+}
+
+// summarizeMessages asks the model for a summary of the given messages.
+func (e *Engine) summarizeMessages(ctx context.Context, messages []openai.ChatCompletionMessage) (string, error) {
+	e.setStatus("summarizing older messages")
+	defer e.setStatus("")
+
+	var transcript strings.Builder
+	for _, message := range messages {
+		fmt.Fprintf(&transcript, "%s: %s\n\n", message.Role, message.Content)
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model:     e.getModel(),
+		MaxTokens: summaryMaxTokens,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: summaryPrompt,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: transcript.String(),
+			},
+		},
+	}
+	resp, err := e.provider.CreateCompletion(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 || strings.TrimSpace(resp.Choices[0].Message.Content) == "" {
+		e.recordUsage(request, resp.Usage, "")
+		return "", errors.New("the summary is empty")
+	}
+
+	e.recordUsage(request, resp.Usage, resp.Choices[0].Message.Content)
+
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
@@ -0,0 +1,135 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestContext tests the token counting and the compaction of the messages history.
+func TestContext(t *testing.T) {
+	t.Run("ModelTokenizer", testContextModelTokenizer)
+	t.Run("ContextBudget", testContextBudget)
+	t.Run("UnderBudget", testContextUnderBudget)
+	t.Run("Trim", testContextTrim)
+	t.Run("Summarize", testContextSummarize)
+}
+
+// testContextModelTokenizer checks that models are matched on the longest known prefix.
+func testContextModelTokenizer(t *testing.T) {
+	assert.Equal(t, 4096, getModelTokenizer(openai.GPT3Dot5Turbo).contextWindow)
+	assert.Equal(t, 16385, getModelTokenizer(openai.GPT3Dot5Turbo16K).contextWindow)
+	assert.Equal(t, 8192, getModelTokenizer(openai.GPT4).contextWindow)
+	assert.Equal(t, 128000, getModelTokenizer("gpt-4o-mini").contextWindow)
+	assert.Equal(t, 200000, getModelTokenizer("claude-3-haiku-20240307").contextWindow)
+	assert.Equal(t, defaultTokenizer, getModelTokenizer("unknown"))
+
+	tokenizer := getModelTokenizer(openai.GPT3Dot5Turbo)
+	assert.Equal(t, 4, tokenizer.countTokens("list all files"))
+	assert.Equal(t, 4+2*messageTokenOverhead+replyTokenOverhead, tokenizer.countMessagesTokens([]openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "list all files"},
+		{Role: openai.ChatMessageRoleAssistant, Content: ""},
+	}))
+}
+
+// testContextBudget checks that the budget comes from the config, or from the model context window.
+func testContextBudget(t *testing.T) {
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_CONTEXT_BUDGET": 1234}))
+	require.NoError(t, err)
+	assert.Equal(t, 1234, engine.getContextBudget())
+
+	engine, err = NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_MODEL": openai.GPT4}))
+	require.NoError(t, err)
+	assert.Equal(t, 8192-100, engine.getContextBudget())
+}
+
+// newCompactionTestEngine returns an engine with a history of two long turns, whose budget leaves
+//the given tokens to the history once the system prompt and the pipe are accounted for
+func newCompactionTestEngine(t *testing.T, url string, strategy string, available int) *Engine {
+	t.Helper()
+
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, nil))
+	require.NoError(t, err)
+	engine.SetPipe("some piped input")
+	fixed := getModelTokenizer("test_model").countMessagesTokens(engine.prepareCompletionMessages())
+
+	engine, err = NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{
+		"OPENAI_BASE_URL":         url,
+		"OPENAI_CONTEXT_BUDGET":   fixed + available,
+		"OPENAI_CONTEXT_STRATEGY": strategy,
+	}))
+	require.NoError(t, err)
+	engine.SetPipe("some piped input")
+	long := strings.Repeat("a", 1600)
+	engine.execMessages = []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "first " + long},
+		{Role: openai.ChatMessageRoleAssistant, Content: long},
+		{Role: openai.ChatMessageRoleUser, Content: "second " + long},
+		{Role: openai.ChatMessageRoleAssistant, Content: long},
+	}
+
+	return engine
+}
+
+// testContextUnderBudget checks that a history fitting in the budget is sent as it is.
+func testContextUnderBudget(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, `{"cmd":"ls","exp":"list files","exec":true}`)
+	engine := newCompactionTestEngine(t, server.URL, TrimContextStrategy, 2000)
+
+	output, err := engine.ExecCompletion("list files")
+	require.NoError(t, err)
+
+	assert.False(t, output.IsCompacted())
+	require.Len(t, requests, 1)
+	assert.Len(t, requests[0].Messages, 2+5)
+	assert.Len(t, engine.execMessages, 6)
+}
+
+// testContextTrim checks that the older turns are dropped, while the system prompt and the pipe are kept.
+func testContextTrim(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, `{"cmd":"ls","exp":"list files","exec":true}`)
+	engine := newCompactionTestEngine(t, server.URL, TrimContextStrategy, 500)
+
+	output, err := engine.ExecCompletion("list files")
+	require.NoError(t, err)
+
+	assert.True(t, output.IsCompacted())
+	require.Len(t, requests, 1)
+	messages := requests[0].Messages
+	require.Len(t, messages, 3)
+	assert.Equal(t, openai.ChatMessageRoleSystem, messages[0].Role)
+	assert.Contains(t, messages[1].Content, "some piped input")
+	assert.Equal(t, "list files", messages[2].Content)
+	assert.Len(t, engine.execMessages, 2)
+}
+
+// testContextSummarize checks that the older turns are replaced with a summary of them.
+func testContextSummarize(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests,
+		"the user asked two questions",
+		`{"cmd":"ls","exp":"list files","exec":true}`,
+	)
+	engine := newCompactionTestEngine(t, server.URL, SummarizeContextStrategy, 500+summaryMaxTokens+messageTokenOverhead)
+
+	output, err := engine.ExecCompletion("list files")
+	require.NoError(t, err)
+
+	assert.True(t, output.IsCompacted())
+	require.Len(t, requests, 2)
+	assert.Contains(t, requests[0].Messages[1].Content, "user: first")
+	assert.Contains(t, requests[0].Messages[1].Content, "user: second")
+
+	messages := requests[1].Messages
+	require.Len(t, messages, 4)
+	assert.Contains(t, messages[1].Content, "some piped input")
+	assert.Equal(t, openai.ChatMessageRoleSystem, messages[2].Role)
+	assert.Equal(t, summaryPrefix+"the user asked two questions", messages[2].Content)
+	assert.Equal(t, "list files", messages[3].Content)
+	assert.Len(t, engine.execMessages, 3)
+}
@@ -0,0 +1,90 @@
+package ai
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/akhilsharma90/terminal-assistant/config"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// API types of the openai providers that can be picked with OPENAI_API_TYPE in the config file.
+const (
+	OpenAiApiType  = "openai"
+	AzureApiType   = "azure"
+	AzureAdApiType = "azure-ad"
+)
+
+//Azure OpenAI exposes the OpenAI routes under a deployment of each model: the requests go to
+//{base url}/openai/deployments/{deployment}/chat/completions?api-version={version}, with the key in an
+//api-key header, or as a bearer token for Azure AD. go-openai builds those requests from its ClientConfig,
+//so everything the config says about the endpoint ends up there, except the extra headers which are
+//added by the http client shared by all backends
+
+// newOpenAiClientConfig creates the go-openai config of the API type, the base URL, the API version, the
+//deployments and the organization of the AI config
+func newOpenAiClientConfig(aiConfig config.AiConfig, httpClient *http.Client) (openai.ClientConfig, error) {
+	var clientConfig openai.ClientConfig
+	switch aiConfig.GetApiType() {
+	case "", OpenAiApiType:
+		clientConfig = openai.DefaultConfig(aiConfig.GetKey())
+		if aiConfig.GetBaseUrl() != "" {
+			clientConfig.BaseURL = aiConfig.GetBaseUrl()
+		}
+	case AzureApiType, AzureAdApiType:
+		//the base URL is the endpoint of the Azure resource, there is no default one
+		if aiConfig.GetBaseUrl() == "" {
+			return openai.ClientConfig{}, fmt.Errorf("api type %s requires a base url", aiConfig.GetApiType())
+		}
+		clientConfig = openai.DefaultAzureConfig(aiConfig.GetKey(), aiConfig.GetBaseUrl())
+		if aiConfig.GetApiType() == AzureAdApiType {
+			clientConfig.APIType = openai.APITypeAzureAD
+		}
+		if aiConfig.GetApiVersion() != "" {
+			clientConfig.APIVersion = aiConfig.GetApiVersion()
+		}
+
+		//a model without a deployment goes to the one named after it, like gpt-35-turbo for gpt-3.5-turbo
+		deployments := aiConfig.GetDeployments()
+		deploymentOf := clientConfig.AzureModelMapperFunc
+		clientConfig.AzureModelMapperFunc = func(model string) string {
+			if deployment, ok := deployments[strings.ToLower(model)]; ok {
+				return deployment
+			}
+			return deploymentOf(model)
+		}
+	default:
+		return openai.ClientConfig{}, fmt.Errorf("unknown api type %s", aiConfig.GetApiType())
+	}
+
+	clientConfig.OrgID = aiConfig.GetOrganization()
+	clientConfig.HTTPClient = httpClient
+
+	return clientConfig, nil
+}
+
+// hasDeployment returns true when the model is given a deployment in the config.
+func hasDeployment(aiConfig config.AiConfig, model string) bool {
+	_, ok := aiConfig.GetDeployments()[strings.ToLower(model)]
+
+	return ok
+}
+
+// headerTransport is a http.RoundTripper adding the headers of the config to every request, they win
+//over the ones set by the backend, so a gateway can be given its own authorization
+type headerTransport struct {
+	next    http.RoundTripper // Transport sending the requests
+	headers map[string]string // Headers added to every request
+}
+
+// RoundTrip sends a copy of the request holding the headers, a RoundTripper must not change the request.
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,193 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEndpoint tests the requests sent to an Azure OpenAI resource or through a gateway, against a stand-in server.
+func TestEndpoint(t *testing.T) {
+	t.Run("Azure", testEndpointAzure)
+	t.Run("AzureDefaultDeployment", testEndpointAzureDefaultDeployment)
+	t.Run("AzureAd", testEndpointAzureAd)
+	t.Run("AzureStreamOptions", testEndpointAzureStreamOptions)
+	t.Run("OrganizationAndHeaders", testEndpointOrganizationAndHeaders)
+	t.Run("CheckModels", testEndpointCheckModels)
+}
+
+// newEndpointServer starts a stand-in server answering the chat completions and the models, the requests
+//it receives are recorded
+func newEndpointServer(t *testing.T, requests *[]*http.Request) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r)
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `{"object":"list","data":[{"id":"gpt-4","object":"model"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"hello"}}]}`)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// testEndpointAzure checks that the requests go to the deployment of the model with the API version, the
+//key being sent in the api-key header along with the headers of the gateway
+func testEndpointAzure(t *testing.T) {
+	var requests []*http.Request
+	server := newEndpointServer(t, &requests)
+	cfg := newTestConfig(t, map[string]interface{}{
+		"OPENAI_API_TYPE":    AzureApiType,
+		"OPENAI_BASE_URL":    server.URL,
+		"OPENAI_API_VERSION": "2024-02-01",
+		"OPENAI_DEPLOYMENTS": map[string]string{"GPT-4": "prod-gpt4"},
+		"OPENAI_HEADERS":     map[string]string{"X-Gateway-Token": "gateway_secret"},
+		"OPENAI_MAX_RETRIES": 0,
+	})
+
+	provider, err := NewProvider(cfg.GetAiConfig())
+	require.NoError(t, err)
+	resp, err := provider.CreateCompletion(context.Background(), openai.ChatCompletionRequest{Model: "gpt-4"})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", resp.Choices[0].Message.Content)
+	models, err := provider.ListModels(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gpt-4"}, models)
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, "/openai/deployments/prod-gpt4/chat/completions", requests[0].URL.Path)
+	assert.Equal(t, "/openai/models", requests[1].URL.Path)
+	for _, r := range requests {
+		assert.Equal(t, "2024-02-01", r.URL.Query().Get("api-version"))
+		assert.Equal(t, "test_key", r.Header.Get("api-key"))
+		assert.Empty(t, r.Header.Get("Authorization"))
+		assert.Equal(t, "gateway_secret", r.Header.Get("X-Gateway-Token"))
+	}
+}
+
+// testEndpointAzureDefaultDeployment checks that a model without a deployment goes to the one named after
+//it, with the default API version of go-openai
+func testEndpointAzureDefaultDeployment(t *testing.T) {
+	var requests []*http.Request
+	server := newEndpointServer(t, &requests)
+	cfg := newTestConfig(t, map[string]interface{}{
+		"OPENAI_API_TYPE": AzureApiType,
+		"OPENAI_BASE_URL": server.URL + "/",
+	})
+
+	provider, err := NewProvider(cfg.GetAiConfig())
+	require.NoError(t, err)
+	_, err = provider.CreateCompletion(context.Background(), openai.ChatCompletionRequest{Model: openai.GPT3Dot5Turbo})
+	require.NoError(t, err)
+
+	require.Len(t, requests, 1)
+	assert.Equal(t, "/openai/deployments/gpt-35-turbo/chat/completions", requests[0].URL.Path)
+	assert.NotEmpty(t, requests[0].URL.Query().Get("api-version"))
+}
+
+// testEndpointAzureAd checks that the key is sent as a bearer token for Azure AD.
+func testEndpointAzureAd(t *testing.T) {
+	var requests []*http.Request
+	server := newEndpointServer(t, &requests)
+	cfg := newTestConfig(t, map[string]interface{}{
+		"OPENAI_API_TYPE": AzureAdApiType,
+		"OPENAI_BASE_URL": server.URL,
+	})
+
+	provider, err := NewProvider(cfg.GetAiConfig())
+	require.NoError(t, err)
+	_, err = provider.CreateCompletion(context.Background(), openai.ChatCompletionRequest{Model: "test_model"})
+	require.NoError(t, err)
+
+	require.Len(t, requests, 1)
+	assert.Equal(t, "/openai/deployments/test_model/chat/completions", requests[0].URL.Path)
+	assert.Equal(t, "Bearer test_key", requests[0].Header.Get("Authorization"))
+	assert.Empty(t, requests[0].Header.Get("api-key"))
+}
+
+// testEndpointAzureStreamOptions checks that the usage of a stream is not asked to Azure, which rejects
+//the stream options before its recent API versions
+func testEndpointAzureStreamOptions(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+	request := openai.ChatCompletionRequest{Model: "gpt-4", StreamOptions: &openai.StreamOptions{IncludeUsage: true}}
+
+	for _, apiType := range []string{AzureApiType, OpenAiApiType} {
+		cfg := newTestConfig(t, map[string]interface{}{"OPENAI_API_TYPE": apiType, "OPENAI_BASE_URL": server.URL})
+		provider, err := NewProvider(cfg.GetAiConfig())
+		require.NoError(t, err)
+		stream, err := provider.CreateCompletionStream(context.Background(), request)
+		require.NoError(t, err)
+		stream.Close()
+	}
+
+	require.Len(t, bodies, 2)
+	assert.NotContains(t, bodies[0], "stream_options")
+	assert.Contains(t, bodies[1], `"stream_options":{"include_usage":true}`)
+}
+
+// testEndpointOrganizationAndHeaders checks that the organization is sent to OpenAI, and that the headers
+//reach every backend, over the ones the backend sets
+func testEndpointOrganizationAndHeaders(t *testing.T) {
+	var requests []*http.Request
+	server := newEndpointServer(t, &requests)
+	cfg := newTestConfig(t, map[string]interface{}{
+		"OPENAI_BASE_URL":     server.URL + "/v1",
+		"OPENAI_ORGANIZATION": "org-test",
+		"OPENAI_HEADERS":      map[string]string{"X-Team": "infra", "Authorization": "Bearer gateway_key"},
+	})
+
+	provider, err := NewProvider(cfg.GetAiConfig())
+	require.NoError(t, err)
+	_, err = provider.CreateCompletion(context.Background(), openai.ChatCompletionRequest{Model: "test_model"})
+	require.NoError(t, err)
+
+	require.Len(t, requests, 1)
+	assert.Equal(t, "/v1/chat/completions", requests[0].URL.Path)
+	assert.Equal(t, "org-test", requests[0].Header.Get("OpenAI-Organization"))
+	assert.Equal(t, "infra", requests[0].Header.Get("X-Team"))
+	assert.Equal(t, "Bearer gateway_key", requests[0].Header.Get("Authorization"))
+
+	cfg = newTestConfig(t, map[string]interface{}{
+		"OPENAI_PROVIDER": OllamaProviderName,
+		"OPENAI_BASE_URL": server.URL,
+		"OPENAI_HEADERS":  map[string]string{"X-Team": "infra"},
+	})
+	provider, err = NewProvider(cfg.GetAiConfig())
+	require.NoError(t, err)
+	_, _ = provider.ListModels(context.Background())
+	require.Len(t, requests, 2)
+	assert.Equal(t, "infra", requests[1].Header.Get("X-Team"))
+}
+
+// testEndpointCheckModels checks that a model given a deployment is not checked against the listed models.
+func testEndpointCheckModels(t *testing.T) {
+	var requests []*http.Request
+	server := newEndpointServer(t, &requests)
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{
+		"OPENAI_API_TYPE":    AzureApiType,
+		"OPENAI_BASE_URL":    server.URL,
+		"OPENAI_DEPLOYMENTS": map[string]string{"company-gpt": "prod-gpt4"},
+	}))
+	require.NoError(t, err)
+
+	assert.NoError(t, engine.CheckModels("company-gpt"))
+	assert.Empty(t, requests)
+	assert.Error(t, engine.CheckModels("gpt-5"))
+}
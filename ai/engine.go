@@ -4,92 +4,144 @@ package ai
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
-	"net/url"
-	"regexp"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
+	"github.com/akhilsharma90/terminal-assistant/cache"
 	"github.com/akhilsharma90/terminal-assistant/config"
-	"github.com/akhilsharma90/terminal-assistant/system"
+	"github.com/akhilsharma90/terminal-assistant/usage"
 
 	"github.com/sashabaranov/go-openai"
 )
 
-const noexec = "[noexec]"
+// interrupted marks the answers that were cut short by Interrupt in the messages history.
+const interrupted = "[interrupted]"
+
+// ErrInterrupted is returned when a request was cancelled by Interrupt.
+var ErrInterrupted = errors.New("interrupted")
+
+// CommandOutputLimit is the number of bytes of each output of an executed command sent back to the model.
+const CommandOutputLimit = 4096
+
+// execFixPrompt asks the model to diagnose a failed command and to correct it.
+const execFixPrompt = "The command `%s` failed. Explain why in the field exp, and give a corrected command in the field cmd, " +
+	"or set exec to false if it can't be fixed by another command."
+
+// explainPipePrompt asks for the explanation of the piped input, when nothing else is asked.
+const explainPipePrompt = "Explain the input."
+
+// execRepairAttempts is how many times an exec answer not following the schema is sent back to be repaired.
+const execRepairAttempts = 2
+
+// execRepairPrompt asks the model to repair an exec answer, with what's wrong with it and the schema to follow.
+const execRepairPrompt = "Your previous answer is invalid: %s. " +
+	"Reply again with only a JSON object following this JSON schema, without any other text: %s"
 
 //creating the main engine here for the application, the engine has 2 modes - exec and chat
 //the messages sent for the exec mode are stored in the execMessages field and the chat ones
 //are stored in the chatMessages field. the config field here is the config struct from config package
-//client is the open ai client from the go-openai package. running shows if the engine is running
+//provider is the backend answering the requests (openai, ollama...). running shows if the engine is running
 //channel is for the output steam from the engine, it's a struct in the output.go file
 type Engine struct {
-	mode         EngineMode                     // The mode of the engine either ExecEngineMode or ChatEngineMode
-	config       *config.Config                 // The configuration settings for the engine
-	client       *openai.Client                 // The OpenAI API client
-	execMessages []openai.ChatCompletionMessage // Messages for executing commands
-	chatMessages []openai.ChatCompletionMessage // Messages for chat interactions
-	channel      chan EngineChatStreamOutput    // The channel for sending chat stream output
-	pipe         string                         // The pipe is the same as pipe in regular software engineering, turns the output from previous into input for the new
-	running      bool                           // Indicates whether the engine is running or not
+	mode            EngineMode                     // The mode of the engine, ExecEngineMode, ChatEngineMode or ExplainEngineMode
+	config          *config.Config                 // The configuration settings for the engine
+	provider        Provider                       // The provider backend answering the requests
+	execMessages    []openai.ChatCompletionMessage // Messages for executing commands
+	chatMessages    []openai.ChatCompletionMessage // Messages for chat interactions
+	explainMessages []openai.ChatCompletionMessage // Messages for explaining commands
+	channel         chan EngineChatStreamOutput    // The channel for sending chat stream output
+	pipe            string                         // The pipe is the same as pipe in regular software engineering, turns the output from previous into input for the new
+	pipeDigest      string                         // What was extracted from a pipe too large to be sent whole, sent in its place
+	pipeDigests     map[string]string              // Digests of the pipe made for each question, reused when it is asked again
+	running         bool                           // Indicates whether the engine is running or not
+	cancel          context.CancelFunc             // Cancels the request in flight, nil when there is none
+	status          string                         // What the request in flight is doing, like which attempt is running
+	partial         EnginePartialExecOutput        // What was received so far of the exec answer in flight
+	mu              sync.Mutex                     // Guards running, cancel, status and partial, they are read from other goroutines
+	busy            sync.Mutex                     // Held during a whole request, the changes of the conversation and the settings wait for it
+	ledger          *usage.Ledger                  // Records the tokens used by the requests, nil when not accounted
+	sampling        config.SamplingConfig          // Sampling parameters of this invocation, overriding the config
+	prompts         map[string]*template.Template  // Templates of the system prompt, by name
+	cache           *cache.Cache                   // Cache of the exec answers, nil when disabled
+	offline         bool                           // Indicates if only the cached answers are used, nothing is sent
+	answerKey       string                         // Cache key of the last exec answer, to forget it if its command is rejected
+	model           string                         // Model picked for every mode, empty means the models of the config
 }
 
 // NewEngine creates a new instance of the Engine struct.
 // It takes the mode (EngineMode) and config (*config.Config) as parameters.
 //and returns an instance of type Engine struct
 func NewEngine(mode EngineMode, config *config.Config) (*Engine, error) {
-	var client *openai.Client
-
-	// Check if a proxy is configured in the AI config
-	if config.GetAiConfig().GetProxy() != "" {
-
-		// Create a client configuration with the API key
-		clientConfig := openai.DefaultConfig(config.GetAiConfig().GetKey())
-
-		// Parse the proxy URL
-		proxyUrl, err := url.Parse(config.GetAiConfig().GetProxy())
-		if err != nil {
-			return nil, err
-		}
-
-		// Create a transport with the proxy URL
-		transport := &http.Transport{
-			Proxy: http.ProxyURL(proxyUrl),
-		}
+	// Create the provider backend picked in the AI config, it also takes care of the proxy
+	provider, err := NewProvider(config.GetAiConfig())
+	if err != nil {
+		return nil, err
+	}
 
-		// Set the transport in the client configuration
-		clientConfig.HTTPClient = &http.Client{
-			Transport: transport,
-		}
+	return NewEngineWithProvider(mode, config, provider)
+}
 
-		// Create a new client with the configured client configuration
-		client = openai.NewClientWithConfig(clientConfig)
-	} else {
-		// Create a new client with the API key
-		client = openai.NewClient(config.GetAiConfig().GetKey())
+// NewEngineWithProvider creates a new instance of the Engine struct answering through the given provider.
+//the prompt templates of the prompts directory are loaded, and an error is returned if one is broken
+func NewEngineWithProvider(mode EngineMode, config *config.Config, provider Provider) (*Engine, error) {
+	promptsDirectory := config.GetUserConfig().GetPromptsDirectory()
+	if promptsDirectory == "" {
+		promptsDirectory = config.GetSystemConfig().GetPromptsDirectory()
+	}
+	prompts, err := loadPromptTemplates(promptsDirectory)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create a new instance of the Engine struct with the provided parameters
 	//running is kept as false since we have just made the engine, but it isn't running yet
-	return &Engine{
-		mode:         mode,
-		config:       config,
-		client:       client,
-		execMessages: make([]openai.ChatCompletionMessage, 0),
-		chatMessages: make([]openai.ChatCompletionMessage, 0),
-		channel:      make(chan EngineChatStreamOutput),
-		pipe:         "",
-		running:      false,
-	}, nil
+	engine := &Engine{
+		mode:            mode,
+		config:          config,
+		provider:        provider,
+		execMessages:    make([]openai.ChatCompletionMessage, 0),
+		chatMessages:    make([]openai.ChatCompletionMessage, 0),
+		explainMessages: make([]openai.ChatCompletionMessage, 0),
+		channel:         make(chan EngineChatStreamOutput),
+		pipe:            "",
+		running:         false,
+		prompts:         prompts,
+	}
+	if err := engine.checkPrompts(); err != nil {
+		return nil, err
+	}
+
+	return engine, nil
+}
+
+//the engine can be used from several goroutines: the UI runs the requests in the background while it
+//keeps polling their status and can interrupt them. a request holds busy from start to end, so the
+//requests run one at a time and whatever changes the conversation or the settings (the mode, the
+//messages, the pipe...) waits for the request in flight to be over. those changes also hold mu, so
+//the getters only need mu and answer right away, even while a request is in flight
+
+// lock waits for the request in flight to be over and locks the state of the engine, the returned
+//function unlocks it
+func (e *Engine) lock() func() {
+	e.busy.Lock()
+	e.mu.Lock()
+
+	return func() {
+		e.mu.Unlock()
+		e.busy.Unlock()
+	}
 }
 
 //Four helper functions below to set and get values for the engine
 
 // SetMode sets the mode of the Engine.
 func (e *Engine) SetMode(mode EngineMode) *Engine {
+	defer e.lock()()
 	e.mode = mode
 
 	return e
@@ -97,6 +149,9 @@ func (e *Engine) SetMode(mode EngineMode) *Engine {
 
 // GetMode returns the mode of the Engine.
 func (e *Engine) GetMode() EngineMode {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	return e.mode
 }
 
@@ -107,21 +162,24 @@ func (e *Engine) GetChannel() chan EngineChatStreamOutput {
 
 // SetPipe sets the pipe of the Engine.
 func (e *Engine) SetPipe(pipe string) *Engine {
+	defer e.lock()()
 	e.pipe = pipe
+	e.pipeDigest = ""
+	e.pipeDigests = nil
 
 	return e
 }
 
 // Interrupt interrupts the Engine operation.
+//it cancels the context of the request in flight, which aborts the HTTP call. the completion
+//functions notice the cancellation and report it themselves: ChatStreamCompletion sends an
+//EngineChatStreamOutput with the interrupt flag set to true and ExecCompletion returns ErrInterrupted
 func (e *Engine) Interrupt() *Engine {
-	//engine has a channel field that can take messages of type EngineChatSteamOuput
-	//which is a struct defined in the output.go file
-	// Send an EngineChatStreamOutput with the interrupt flag set to true
-	e.channel <- EngineChatStreamOutput{
-		content:    "[Interrupt]",
-		last:       true,
-		interrupt:  true,
-		executable: false,
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.cancel != nil {
+		e.cancel()
 	}
 
 	// Set the running flag to false to stop the engine, we're setting the field of the engine
@@ -130,60 +188,215 @@ func (e *Engine) Interrupt() *Engine {
 	return e
 }
 
+// newRequestContext creates the context of a new request, bounded by the configured request timeout
+//and cancelled by Interrupt. the returned function must be called once the request is over
+func (e *Engine) newRequestContext() (context.Context, context.CancelFunc) {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if timeout := e.config.GetAiConfig().GetRequestTimeout(); timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	//the retry transport tells us when a request is sent again, so the UI can show which attempt is running
+	ctx = withRetryObserver(ctx, func(attempt int, maxAttempts int, wait time.Duration) {
+		e.setStatus(fmt.Sprintf("attempt %d/%d in %s", attempt, maxAttempts, wait.Round(100*time.Millisecond)))
+	})
+
+	e.mu.Lock()
+	e.cancel = cancel
+	e.running = true
+	e.status = ""
+	e.partial = EnginePartialExecOutput{}
+	e.mu.Unlock()
+
+	return ctx, func() {
+		e.mu.Lock()
+		e.cancel = nil
+		e.running = false
+		e.status = ""
+		e.mu.Unlock()
+		cancel()
+	}
+}
+
+// GetStatus returns what the request in flight is doing, empty when there is nothing worth showing.
+func (e *Engine) GetStatus() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.status
+}
+
+// setStatus sets what the request in flight is doing.
+func (e *Engine) setStatus(status string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.status = status
+}
+
+// requestError turns the error of a request into ErrInterrupted when the request was interrupted,
+//or into a readable timeout error when it ran out of time
+func (e *Engine) requestError(ctx context.Context, err error) error {
+	switch ctx.Err() {
+	case context.Canceled:
+		return ErrInterrupted
+	case context.DeadlineExceeded:
+		return fmt.Errorf("request timed out after %s", e.config.GetAiConfig().GetRequestTimeout())
+	default:
+		return err
+	}
+}
+
 //we want to clear the execMessages and chatMessages fields in the engine and set them with
 //empty values of the same type and this is what we do with the clear function
 // Clear clears the Engine messages based on the current mode.
 func (e *Engine) Clear() *Engine {
-	//if the mode is exec mode, then make exex messages empty
-	if e.mode == ExecEngineMode {
-		e.execMessages = []openai.ChatCompletionMessage{} // Clear execMessages by creating a new empty slice
-	} else {
-		//else the mode would be chat mode, because there are only two modes, so we make that empty
-		e.chatMessages = []openai.ChatCompletionMessage{} // Clear chatMessages
-	}
-
-	return e
+	defer e.lock()()
+	//only the messages of the current mode are made empty
+	return e.setMessages([]openai.ChatCompletionMessage{})
 }
 
 // Reset resets the Engine.
 //clear and reset are similar but different. in clear we empty the messages from the mode that 
 //we're in but with reset, we're emptying everything in the engine, like all msgs, irrespective
 func (e *Engine) Reset() *Engine {
+	defer e.lock()()
 	e.execMessages = []openai.ChatCompletionMessage{}
 	e.chatMessages = []openai.ChatCompletionMessage{}
+	e.explainMessages = []openai.ChatCompletionMessage{}
 
 	return e
 }
 
 // ExecCompletion execute a completion request to the OpenAI API and process the response.
+//the files and directories referenced with @path in the input are attached, see attachment.go
 func (e *Engine) ExecCompletion(input string) (*EngineExecOutput, error) {
-	ctx := context.Background()
+	e.busy.Lock()
+	defer e.busy.Unlock()
 
-	//when engine is processing, we set it to true
-	// Set the running flag to true
-	e.running = true
+	return e.execCompletion(input, true)
+}
+
+// execCompletion is ExecCompletion, attaching the references of the input only when attach is true.
+func (e *Engine) execCompletion(input string, attach bool) (*EngineExecOutput, error) {
+	//the context is cancelled by Interrupt or when the request timeout is reached
+	//when engine is processing, running is set to true until the request is over
+	ctx, done := e.newRequestContext()
+	defer done()
+
+	//nothing is sent once the hard budget is reached, the offline mode sends nothing anyway
+	if err := e.checkBudget(); err != nil && !e.offline {
+		return nil, err
+	}
 
-	// Append user message to the chat messages
-	//this method is defined a few lines below in this file only
+	// Append user message to the chat messages, after the files it references if it is attached
+	//these methods are defined a few lines below in this file only
+	if attach {
+		if err := e.appendAttachments(input); err != nil {
+			return nil, err
+		}
+	}
 	e.appendUserMessage(input)
 
-	// Create a chat completion request to the OpenAI API
-	//we will capture the response in the resp variable
-	resp, err := e.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model:     e.config.GetAiConfig().GetModel(),
-			MaxTokens: e.config.GetAiConfig().GetMaxTokens(),
-			Messages:  e.prepareCompletionMessages(),
-		},
-	)
+	//a piped input too large to be sent whole is read in chunks first, see pipe.go
+	chunks, err := e.digestPipe(ctx, input)
+	if err != nil {
+		if err == ErrInterrupted {
+			e.appendAssistantMessage(interrupted)
+		}
+		return nil, err
+	}
+
+	//the older turns are compacted if the messages don't fit in the context budget anymore
+	compacted, err := e.compactMessages(ctx)
 	if err != nil {
+		if err == ErrInterrupted {
+			e.appendAssistantMessage(interrupted)
+		}
 		return nil, err
 	}
 
-	// the content is in the choices, message and content inside resp variable
-	//we will fetch it and store it in content variable for easier access to it
-	content := resp.Choices[0].Message.Content
+	// Create a chat completion request to the OpenAI API, asking for a JSON object
+	//the providers that can't enforce the format rely on the system prompt describing the JSON
+	request := openai.ChatCompletionRequest{
+		Model:     e.getModel(),
+		MaxTokens: e.config.GetAiConfig().GetMaxTokens(),
+		Messages:  e.prepareCompletionMessages(),
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		},
+	}
+	e.applySampling(&request)
+
+	//we will capture the answer in the content variable, and the output decoded from it. the final answer
+	//of the turn is cached under the key of this first request, see cache.go
+	var output *EngineExecOutput
+	key, content, cached := e.getCachedAnswer(request, func(content string) (err error) {
+		output, err = parseEngineExecOutput(content)
+		return err
+	})
+	e.answerKey = key
+	valid := cached
+	if !cached {
+		content, output, valid, err = e.createValidExecCompletion(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//the model can ask to run read-only probes before giving its answer, see probe.go. the probes and
+	//their output are kept in the history so the next questions can rely on them too. once all the
+	//probes were used the model is asked for its answer, and if it still probes it gave none
+	var probes []EngineProbe
+	for round := 0; output.IsProbe(); round++ {
+		if round > e.getMaxProbes() {
+			output = &EngineExecOutput{
+				Command:     "",
+				Explanation: fmt.Sprintf("No answer was given after %d probes.", len(probes)),
+				Executable:  false,
+			}
+			valid = false
+			break
+		}
+
+		e.appendAssistantMessage(content)
+		if round == e.getMaxProbes() {
+			e.appendUserMessage(probeLimitPrompt)
+		} else {
+			probe, message := e.runProbe(ctx, output.GetProbe())
+			probes = append(probes, probe)
+			e.appendUserMessage(message)
+		}
+		if ctx.Err() != nil {
+			err = e.requestError(ctx, ctx.Err())
+			if err == ErrInterrupted {
+				e.appendAssistantMessage(interrupted)
+			}
+			return nil, err
+		}
+
+		request.Messages = e.prepareCompletionMessages()
+		content, output, valid, err = e.createValidExecCompletion(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		cached = false
+	}
+	if valid && !cached {
+		e.cacheAnswer(key, content)
+	}
+	output.probes = probes
+	output.compacted = compacted
+	output.chunks = chunks
+	//the model can give more alternatives than asked, the extra ones are dropped
+	if max := e.getMaxAlternatives(); len(output.Alternatives) > max-1 {
+		output.Alternatives = output.Alternatives[:max-1]
+	}
 
 	//we're maintaining the messages from user and from assistant (our terminal assistant)
 	//in the chat and referring to them as user message and assistant message and appending them
@@ -191,180 +404,463 @@ func (e *Engine) ExecCompletion(input string) (*EngineExecOutput, error) {
 	//this method is defined a few files below in this file only
 	e.appendAssistantMessage(content)
 
-	var output EngineExecOutput
+//we return the output object, which is of type EngineExecOutput, which is what we're supposed to retun from this function
+	return output, nil
+}
+
+// createValidExecCompletion sends a request and decodes its answer as an EngineExecOutput, valid is false
+//when the answer could not be decoded even after the repairs
+func (e *Engine) createValidExecCompletion(ctx context.Context, request openai.ChatCompletionRequest) (string, *EngineExecOutput, bool, error) {
+	var output *EngineExecOutput
+	content, valid, err := e.createRepairedCompletion(ctx, request, engineExecOutputSchema, func(content string) (err error) {
+		output, err = parseEngineExecOutput(content)
+		return err
+	})
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	//as a last resort, the answer is shown as it is, and it can't be executed
+	if !valid {
+		output = &EngineExecOutput{
+			Command:     "",
+			Explanation: content,
+			Executable:  false,
+		}
+	}
 
-	//we're expecting that the open ai will send us back the command that we have to execute
-	//this command will be part of the content string that we have extracted from the response above
-	//to get the command from the content string, we're doing a bit of regex match
+	return content, output, valid, nil
+}
 
-	// Unmarshal the content into the EngineExecOutput struct
-	err = json.Unmarshal([]byte(content), &output)
+// createRepairedCompletion sends a request and checks its answer with the given parser.
+//if the answer doesn't follow the schema, it is sent back with what's wrong with it and asked again,
+//the repair exchanges are not kept in the history, only the final answer is. valid is false when the
+//answer could still not be parsed after the repairs
+func (e *Engine) createRepairedCompletion(ctx context.Context, request openai.ChatCompletionRequest, schema string, parse func(content string) error) (content string, valid bool, err error) {
+	content, err = e.createExecCompletion(ctx, request)
 	if err != nil {
-		re := regexp.MustCompile(`\{.*?\}`)
-		match := re.FindString(content)
-		if match != "" {
-			// Unmarshal the match into the EngineExecOutput struct
-			//we have defined the output variable which is of type EngineExecOutput struct
-			//we wil unmarshal the value received in match into this object
-			err = json.Unmarshal([]byte(match), &output)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			//if we're unable to unmarshal the command from the content string, we attach
-			//the entire content object itself to the explanation field in the execoutput
-			// If unable to unmarshal, create a default EngineExecOutput
-			output = EngineExecOutput{
-				Command:     "",
-				Explanation: content,
-				Executable:  false,
-			}
+		return "", false, err
+	}
+
+	invalid := parse(content)
+	for repair := 1; invalid != nil && repair <= execRepairAttempts; repair++ {
+		request.Messages = append(
+			request.Messages,
+			openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: content,
+			},
+			openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleUser,
+				Content: fmt.Sprintf(execRepairPrompt, invalid, schema),
+			},
+		)
+
+		content, err = e.createExecCompletion(ctx, request)
+		if err != nil {
+			return "", false, err
 		}
+		invalid = parse(content)
 	}
-//we return the output object, which is of type execstreamoutput, which is what we're supposed to retun from this function
-	return &output, nil
+
+	return content, invalid == nil, nil
+}
+
+// createExecCompletion sends a streamed request and returns the content of the answer.
+//while it arrives, the answer is scanned so the command can be shown before the explanation is
+//complete, see GetPartialExecOutput. an interrupted request stays in the history, with an answer
+//saying it was interrupted
+func (e *Engine) createExecCompletion(ctx context.Context, request openai.ChatCompletionRequest) (string, error) {
+	e.setPartialExecOutput(EnginePartialExecOutput{})
+
+	//the offline mode only answers from the cache, which was looked up for the first request of the turn
+	if e.offline {
+		return "", ErrOffline
+	}
+
+	request.Stream = true
+	request.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	stream, err := e.provider.CreateCompletionStream(ctx, request)
+	if err != nil {
+		return "", e.execRequestError(ctx, err)
+	}
+	defer stream.Close()
+
+	//the tokens used come in a last chunk without any choice, when the backend doesn't send them they
+	//are estimated from what was received
+	var builder strings.Builder
+	var used openai.Usage
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			e.recordUsage(request, used, builder.String())
+			return "", e.execRequestError(ctx, err)
+		}
+		if resp.Usage != nil {
+			used = *resp.Usage
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+
+		builder.WriteString(resp.Choices[0].Delta.Content)
+		e.setPartialExecOutput(scanPartialExecOutput(builder.String()))
+	}
+
+	content := builder.String()
+	e.recordUsage(request, used, content)
+	if content == "" {
+		return "", errors.New("the answer is empty")
+	}
+
+	return content, nil
+}
+
+// execRequestError turns the error of an exec request like requestError, an interrupted request
+//is kept in the history with an answer saying it was interrupted
+func (e *Engine) execRequestError(ctx context.Context, err error) error {
+	err = e.requestError(ctx, err)
+	if err == ErrInterrupted {
+		e.appendAssistantMessage(interrupted)
+	}
+
+	return err
+}
+
+// GetPartialExecOutput returns what was received so far of the exec answer in flight.
+func (e *Engine) GetPartialExecOutput() EnginePartialExecOutput {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.partial
+}
+
+// setPartialExecOutput sets what was received so far of the exec answer in flight.
+func (e *Engine) setPartialExecOutput(partial EnginePartialExecOutput) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.partial = partial
+}
+
+// ExplainCompletion asks for the explanation of a command or a script. without any input, the piped
+//script is explained, like with cat script.sh | terminal-assistant -x
+func (e *Engine) ExplainCompletion(input string) (*EngineExplainOutput, error) {
+	e.busy.Lock()
+	defer e.busy.Unlock()
+
+	ctx, done := e.newRequestContext()
+	defer done()
+
+	if err := e.checkBudget(); err != nil && !e.offline {
+		return nil, err
+	}
+
+	if strings.TrimSpace(input) == "" {
+		input = explainPipePrompt
+	}
+	if err := e.appendAttachments(input); err != nil {
+		return nil, err
+	}
+	e.appendUserMessage(input)
+
+	chunks, err := e.digestPipe(ctx, input)
+	if err != nil {
+		if err == ErrInterrupted {
+			e.appendAssistantMessage(interrupted)
+		}
+		return nil, err
+	}
+
+	compacted, err := e.compactMessages(ctx)
+	if err != nil {
+		if err == ErrInterrupted {
+			e.appendAssistantMessage(interrupted)
+		}
+		return nil, err
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model:     e.getModel(),
+		MaxTokens: e.config.GetAiConfig().GetMaxTokens(),
+		Messages:  e.prepareCompletionMessages(),
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		},
+	}
+	e.applySampling(&request)
+
+	//like the exec answers, only the final explanation is cached, see cache.go
+	var output *EngineExplainOutput
+	parse := func(content string) (err error) {
+		output, err = parseEngineExplainOutput(content)
+		return err
+	}
+	key, content, valid := e.getCachedAnswer(request, parse)
+	if !valid {
+		content, valid, err = e.createRepairedCompletion(ctx, request, engineExplainOutputSchema, parse)
+		if err != nil {
+			return nil, err
+		}
+		if valid {
+			e.cacheAnswer(key, content)
+		}
+	}
+	//as a last resort, the answer is shown as it is, without any stage
+	if !valid {
+		output = &EngineExplainOutput{Summary: content}
+	}
+	output.compacted = compacted
+	output.chunks = chunks
+	e.appendAssistantMessage(content)
+
+	return output, nil
 }
 
 // ChatCompletion execute a completion request to the OpenAI API and process the response in real-time.
 func (e *Engine) ChatStreamCompletion(input string) error {
-	ctx := context.Background()
+	e.busy.Lock()
+	defer e.busy.Unlock()
 
-	// Set the running flag to true when the engine is processing the output
-	e.running = true
+	//the context is cancelled by Interrupt or when the request timeout is reached
+	//running is set to true when the engine is processing the output, until the request is over
+	ctx, done := e.newRequestContext()
+	defer done()
 
-	// Append user message to chat messages
+	//define output as a variable of type string
+	var output string
+
+	//nothing is sent once the hard budget is reached, or in offline mode as the chat answers are not cached
+	if err := e.checkBudget(); err != nil {
+		return e.interruptOr(ctx, output, err)
+	}
+	if e.offline {
+		return e.interruptOr(ctx, output, ErrOffline)
+	}
+
+	// Append user message to chat messages, after the files it references
+	if err := e.appendAttachments(input); err != nil {
+		return e.interruptOr(ctx, output, err)
+	}
 	e.appendUserMessage(input)
 
+	//a piped input too large to be sent whole is read in chunks first, see pipe.go
+	chunks, err := e.digestPipe(ctx, input)
+	if err != nil {
+		return e.interruptOr(ctx, output, err)
+	}
+
+	//the older turns are compacted if the messages don't fit in the context budget anymore
+	compacted, err := e.compactMessages(ctx)
+	if err != nil {
+		return e.interruptOr(ctx, output, err)
+	}
+
 	// Create a chat completion request to the OpenAI API, just like we did in the execCompletion func.
 	req := openai.ChatCompletionRequest{
-		Model:     e.config.GetAiConfig().GetModel(),
+		Model:     e.getModel(),
 		MaxTokens: e.config.GetAiConfig().GetMaxTokens(),
 		Messages:  e.prepareCompletionMessages(),
 		Stream:    true,
+		StreamOptions: &openai.StreamOptions{
+			IncludeUsage: true,
+		},
 	}
+	e.applySampling(&req)
 
-	// We now send the request object to the CreateChatCompletionStream function to create a stream
+	// We now send the request object to the CreateCompletionStream function to create a stream
 	//the stream is accessible to us via the stream variable now
-	stream, err := e.client.CreateChatCompletionStream(ctx, req)
+	stream, err := e.provider.CreateCompletionStream(ctx, req)
 	//handle the error from above
 	if err != nil {
-		return err
+		return e.interruptOr(ctx, output, err)
 	}
 	//defer the closing of the stream to the end of this function's execution
 	defer stream.Close()
-
-	//define output as a variable of type string
-	var output string
+	//the tokens used come in a last chunk without any choice, when the backend doesn't send them they
+	//are estimated from what was received. they are recorded however the stream ends, even when it was
+	//interrupted
+	var used openai.Usage
+	defer func() {
+		e.recordUsage(req, used, output)
+	}()
 
 	for {
-//since we are streaming the output and the engine has been set to running until engine is streaming the contents
-//we will place a condition to check engine running or in other words, streaming of output
-//we want to add each message received in the stream to the output variable
-		if e.running {
-			//receive the output from the stream, stream being the variable defined above
-			//capture that in the response variable, we will extract the actual content from this later
-			resp, err := stream.Recv()
-
-			// Check if completion is finished (i.e if we've reached end of the stream)
-			//if completion is finished, we would have to set engine running as false
-			//so that we can break out of the loop above
-			if errors.Is(err, io.EOF) {
-				//by default exeecutable is false because we're working with chat completion right now
-				//but there's a chance that we're working with commands even in chat completion mode, so it's
-				//recommended to handle this particular situation
-				executable := false
-				// Check if the output is executable, i.e if the engine is in executable mode
-				if e.mode == ExecEngineMode {
-					if !strings.HasPrefix(output, noexec) && !strings.Contains(output, "\n") {
-						//if it is, then set executable to true
-						executable = true
-					}
-				}
-
-// Send last output to channel saying that this is the last message because we are in the 
-//if condition where we're checking if this is the end of the stream and we're setting the
-//exectuable value of the streamOutput with the actual value that's in the executable variable
-//it could be true or false based on what we set it above, doesn't matter, whatever it is, we're setting it here
-				e.channel <- EngineChatStreamOutput{
-					content:    "",
-					last:       true,
-					executable: executable,
-				}
-//since we're in the condition where the end of file has been reached, we will
-//set the engine running field to false so we can break out of the outer loop
-				e.running = false
-
-//The last message from the stream would be the one from open ai, so we're setting it using the appendAssistantMessage func.
-// Append assistant message to chat messages
-				e.appendAssistantMessage(output)
-
-				return nil
-			}
-//now we're out of the end of file loop, but still inside the running loop
-			if err != nil {
-//if there's an error, we set the engine running to false
-				e.running = false
-				return err
-			}
-
-// The response from openai is in resp variable but we need the actual string, that's in content inside delta, choices
-			delta := resp.Choices[0].Delta.Content
-//add the contents of the delta variable to output, which is a string
-//we will keep extracting the contents from the response and adding it to the output variable
-//because we're working with a stream, meaning we won't get all our response in one go
-			output += delta
-
-// Send output to channel, saying that this isn't the last message and setting the actual content from delta to the content variable
-//setting last msg to false because the engine is still running and we're out of the end of file loop
-//keep the output stream going and adding delta content to it
+		//receive the output from the stream, stream being the variable defined above
+		//capture that in the response variable, we will extract the actual content from this later
+		resp, err := stream.Recv()
+
+		// Check if completion is finished (i.e if we've reached end of the stream)
+		if errors.Is(err, io.EOF) {
+			// Send last output to channel saying that this is the last message because we are in the
+			//if condition where we're checking if this is the end of the stream
 			e.channel <- EngineChatStreamOutput{
-				content: delta,
-				last:    false,
+				content:   "",
+				last:      true,
+				compacted: compacted,
+				chunks:    chunks,
 			}
 
-			// time.Sleep(time.Microsecond * 100)
-		} else {
-//if the engine isn't running, we will close the stream and return nil
-			stream.Close()
+			//The last message from the stream would be the one from open ai, so we're setting it using the appendAssistantMessage func.
+			// Append assistant message to chat messages
+			e.appendAssistantMessage(output)
+
 			return nil
 		}
+		//now we're out of the end of file check, the error can come from an interruption
+		if err != nil {
+			return e.interruptOr(ctx, output, err)
+		}
+
+		if resp.Usage != nil {
+			used = *resp.Usage
+		}
+		//a chunk can come without any choice, like the usage or the content filter results of Azure
+		if len(resp.Choices) == 0 {
+			continue
+		}
+
+		// The response from openai is in resp variable but we need the actual string, that's in content inside delta, choices
+		delta := resp.Choices[0].Delta.Content
+		//add the contents of the delta variable to output, which is a string
+		//we will keep extracting the contents from the response and adding it to the output variable
+		//because we're working with a stream, meaning we won't get all our response in one go
+		output += delta
+
+		// Send output to channel, saying that this isn't the last message and setting the actual content from delta to the content variable
+		//setting last msg to false because the stream is still going
+		e.channel <- EngineChatStreamOutput{
+			content: delta,
+			last:    false,
+		}
 	}
 }
 
+// interruptOr handles the error of a streamed request. if the request was interrupted, the partial
+//answer is kept in the history marked as interrupted and the last output is sent with the interrupt
+//flag, so whoever reads the channel goes back to the prompt. any other error is only returned, nothing
+//is sent on the channel
+func (e *Engine) interruptOr(ctx context.Context, output string, err error) error {
+	err = e.requestError(ctx, err)
+	if err != ErrInterrupted {
+		return err
+	}
+
+	e.appendAssistantMessage(strings.TrimSpace(fmt.Sprintf("%s %s", output, interrupted)))
+	e.channel <- EngineChatStreamOutput{
+		content:   "",
+		last:      true,
+		interrupt: true,
+	}
+
+	return nil
+}
+
 // appendUserMessage appends a user message to the chat messages in the Engine.
 //this function has been called multiple times in the functions above
 func (e *Engine) appendUserMessage(content string) *Engine {
-	if e.mode == ExecEngineMode {
-		//if the execute mode is exec mode, then we add the user's message to exec messages object
-		e.execMessages = append(e.execMessages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleUser,
-			Content: content,
-		})
-	} else {
-		//else we will be in chat mode, since there are only 2 modes and we will add the user's message 
-		//to the chat messages object
-		e.chatMessages = append(e.chatMessages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleUser,
-			Content: content,
-		})
+	//the user's message goes to the messages of the current mode, exec, chat or explain
+	return e.setMessages(append(e.getMessages(), openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: content,
+	}))
+}
+
+// appendAttachments appends the files and directories referenced with @path in the input, each one in
+//its own labelled message. nothing is appended if one of them is refused
+func (e *Engine) appendAttachments(input string) error {
+	userConfig := e.config.GetUserConfig()
+	attachments, err := LoadAttachments(input, userConfig.GetAttachmentMaxSize(), userConfig.GetAttachmentsMaxSize())
+	if err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		e.appendUserMessage(attachment.message())
 	}
 
-	return e
+	return nil
 }
 
 // appendAssistantMessage appends an assistant message to the chat messages in the Engine.
 //this function works exactly the same way as the func. above and has the same logic
 func (e *Engine) appendAssistantMessage(content string) *Engine {
-	if e.mode == ExecEngineMode {
-		e.execMessages = append(e.execMessages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleAssistant,
-			Content: content,
-		})
-	} else {
-		e.chatMessages = append(e.chatMessages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleAssistant,
-			Content: content,
-		})
+	return e.setMessages(append(e.getMessages(), openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: content,
+	}))
+}
+
+// AppendCommandResult tells the model how a command it proposed went once it was executed: its exit
+//code, its standard and error outputs, cut at CommandOutputLimit. it goes to the exec messages, so the
+//follow-ups like "sort that by date" refer to the real results
+func (e *Engine) AppendCommandResult(command string, exitCode int, stdout string, stderr string, truncated bool) *Engine {
+	defer e.lock()()
+	outputs := fmt.Sprintf("stdout:\n%s\nstderr:\n%s", orEmpty(stdout), orEmpty(stderr))
+	if truncated {
+		outputs += "\n[the outputs were truncated]"
+	}
+
+	e.execMessages = append(e.execMessages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: fmt.Sprintf("I executed `%s`, it exited with code %d.\n%s", command, exitCode, outputs),
+	})
+
+	return e
+}
+
+// FixCompletion asks the model to diagnose a command which failed and to propose a corrected one.
+//the result of the command, with its exit code and its error output, has to be added first with
+//AppendCommandResult, the answer goes through ExecCompletion like any other
+func (e *Engine) FixCompletion(command string) (*EngineExecOutput, error) {
+	e.busy.Lock()
+	defer e.busy.Unlock()
+
+	//the command can hold an @ like curl -d @data.json, it is not a reference to attach
+	return e.execCompletion(fmt.Sprintf(execFixPrompt, command), false)
+}
+
+// orEmpty returns the output without its surrounding blank lines, or says it is empty.
+func orEmpty(output string) string {
+	if output = strings.Trim(output, "\n"); output == "" {
+		return "(empty)"
+	}
+
+	return output
+}
+
+// getMaxAlternatives returns how many candidate commands the model can propose, at least 1.
+func (e *Engine) getMaxAlternatives() int {
+	if max := e.config.GetAiConfig().GetAlternatives(); max > 1 {
+		return max
+	}
+
+	return 1
+}
+
+// getMessages returns the messages history of the current mode.
+func (e *Engine) getMessages() []openai.ChatCompletionMessage {
+	switch e.mode {
+	case ExecEngineMode:
+		return e.execMessages
+	case ExplainEngineMode:
+		return e.explainMessages
+	default:
+		return e.chatMessages
+	}
+}
+
+// setMessages replaces the messages history of the current mode.
+func (e *Engine) setMessages(messages []openai.ChatCompletionMessage) *Engine {
+	switch e.mode {
+	case ExecEngineMode:
+		e.execMessages = messages
+	case ExplainEngineMode:
+		e.explainMessages = messages
+	default:
+		e.chatMessages = messages
 	}
 
 	return e
@@ -393,17 +889,18 @@ func (e *Engine) prepareCompletionMessages() []openai.ChatCompletionMessage {
 		)
 	}
 //check engine mode and accordingly append messages
-	if e.mode == ExecEngineMode {
-		messages = append(messages, e.execMessages...) // Append the user and assistant messages for execution mode.
-	} else {
-		messages = append(messages, e.chatMessages...) // Append the user and assistant messages for chat mode.
-	}
+	messages = append(messages, e.getMessages()...) // Append the user and assistant messages of the current mode.
 
 	return messages
 }
 
 // preparePipePrompt prepares the pipe prompt.
 func (e *Engine) preparePipePrompt() string {
+	//a pipe too large to be sent whole is replaced by what was extracted from it, see pipe.go
+	if e.pipeDigest != "" {
+		return e.pipeDigest
+	}
+
 	//pipe is the same as the software engineering concept, it helps in continuing the conversation
 	//or the stream by making the output from previous process into the input for the next process
 	return fmt.Sprintf("I will work on the following input: %s", e.pipe)
@@ -412,12 +909,15 @@ func (e *Engine) preparePipePrompt() string {
 // prepareSystemPrompt prepares the system prompt based on the current mode.
 func (e *Engine) prepareSystemPrompt() string {
 	var bodyPart string
-	// If the mode is ExecEngineMode, prepare the system prompt for execution mode else prepare the system prompt for chat mode.
-	if e.mode == ExecEngineMode {
+	// Prepare the system prompt of the current mode: execution, explanation or chat.
+	switch e.mode {
+	case ExecEngineMode:
 		//exec part is a different function and chat part is a separate function, both have their own prompts
 		//that are defined in the respective functions
 		bodyPart = e.prepareSystemPromptExecPart()
-	} else {
+	case ExplainEngineMode:
+		bodyPart = e.prepareSystemPromptExplainPart()
+	default:
 		bodyPart = e.prepareSystemPromptChatPart()
 	}
 
@@ -427,71 +927,26 @@ func (e *Engine) prepareSystemPrompt() string {
 }
 
 // prepareSystemPromptExecPart prepares the system prompt for execution mode.
-//preparing chat gpt to operate in command execution mode by giving it a long prompt
-//and setting the context, we want it to generate commands and run them
+//it is rendered from the exec template, see prompt.go
 func (e *Engine) prepareSystemPromptExecPart() string {
-	return "You are terminal-assistant, a powerful terminal assistant generating a JSON containing a command line for my input.\n" +
-		"You will always reply using the following json structure: {\"cmd\":\"the command\", \"exp\": \"some explanation\", \"exec\": true}.\n" +
-		"Your answer will always only contain the json structure, never add any advice or supplementary detail or information, even if I asked the same question before.\n" +
-		"The field cmd will contain a single line command (don't use new lines, use separators like && and ; instead).\n" +
-		"The field exp will contain an short explanation of the command if you managed to generate an executable command, otherwise it will contain the reason of your failure.\n" +
-		"The field exec will contain true if you managed to generate an executable command, false otherwise." +
-		"\n" +
-		"Examples:\n" +
-		"Me: list all files in my home dir\n" +
-		"terminal-assistant: {\"cmd\":\"ls ~\", \"exp\": \"list all files in your home dir\", \"exec\\: true}\n" +
-		"Me: list all pods of all docker images\n" +
-		"terminal-assistant: {\"cmd\":\"docker image ls\", \"exp\": \"list of all images from your docker instance\", \"exec\": true}\n" +
-		"Me: how are you ?\n" +
-		"terminal-assistant: {\"cmd\":\"\", \"exp\": \"I'm good thanks but I cannot generate a command for this. Use the chat mode to discuss.\", \"exec\": false}"
+	return e.renderPromptOrDefault(ExecPromptTemplate)
+}
+
+// prepareSystemPromptExplainPart prepares the system prompt for explain mode.
+//it is rendered from the explain template, see prompt.go
+func (e *Engine) prepareSystemPromptExplainPart() string {
+	return e.renderPromptOrDefault(ExplainPromptTemplate)
 }
 
 // prepareSystemPromptChatPart prepares the system prompt for chat mode.
-//preparing chat gpt for the chat mode to help as an assistant by replying to question
-//in this mode, we want it to just reply and not generate or execute any commands
+//it is rendered from the chat template, see prompt.go
 func (e *Engine) prepareSystemPromptChatPart() string {
-	return "You are a powerful terminal assistant.\n" +
-		"You will answer in the most helpful possible way.\n" +
-		"Always format your answer in markdown format.\n\n" +
-		"For example:\n" +
-		"Me: What is 2+2 ?\n" +
-		"terminal-assistant: The answer for `2+2` is `4`\n" +
-		"Me: +2 again ?\n" +
-		"terminal-assistant: The answer is `6`\n"
+	return e.renderPromptOrDefault(ChatPromptTemplate)
 }
 
 // prepareSystemPromptContextPart prepares the system prompt context part.
-//values such as operating system, distribution, home directory and shell will be sent as prompt to 
-//open ai so that the commands it creates for us will be easily executable and will be relevant to us
+//it is rendered from the context template, telling about the operating system, the shell and
+//such things so the commands generated are relevant to us, see prompt.go
 func (e *Engine) prepareSystemPromptContextPart() string {
-	part := "My context: "
-
-	if e.config.GetSystemConfig().GetOperatingSystem() != system.UnknownOperatingSystem {
-		// If the operating system is not unknown, append the operating system to the context part.
-		part += fmt.Sprintf("my operating system is %s, ", e.config.GetSystemConfig().GetOperatingSystem().String())
-	}
-	if e.config.GetSystemConfig().GetDistribution() != "" {
-		// If the distribution is not empty, append the distribution to the context part.
-		part += fmt.Sprintf("my distribution is %s, ", e.config.GetSystemConfig().GetDistribution())
-	}
-	if e.config.GetSystemConfig().GetHomeDirectory() != "" {
-		// If the home directory is not empty, append the home directory to the context part.
-		part += fmt.Sprintf("my home directory is %s, ", e.config.GetSystemConfig().GetHomeDirectory())
-	}
-	if e.config.GetSystemConfig().GetShell() != "" {
-		// If the shell is not empty, append the shell to the context part.
-		part += fmt.Sprintf("my shell is %s, ", e.config.GetSystemConfig().GetShell())
-	}
-	if e.config.GetSystemConfig().GetShell() != "" {
-		// If the editor is not empty, append the editor to the context part.
-		part += fmt.Sprintf("my editor is %s, ", e.config.GetSystemConfig().GetEditor())
-	}
-	part += "take this into account. "
-
-	// If the preferences are not empty, append the preferences to the context part.
-	if e.config.GetUserConfig().GetPreferences() != "" {
-		part += fmt.Sprintf("Also, %s.", e.config.GetUserConfig().GetPreferences())
-	}
-
-	return part
+	return e.renderPromptOrDefault(ContextPromptTemplate)
 }
@@ -0,0 +1,562 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akhilsharma90/terminal-assistant/config"
+	"github.com/akhilsharma90/terminal-assistant/system"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEngine runs the completion functions of the engine on top of every provider backend.
+func TestEngine(t *testing.T) {
+	t.Run("ExecCompletion", testEngineExecCompletion)
+	t.Run("PartialExec", testEnginePartialExec)
+	t.Run("ChatStreamCompletion", testEngineChatStreamCompletion)
+	t.Run("InterruptChatStream", testEngineInterruptChatStream)
+	t.Run("InterruptExec", testEngineInterruptExec)
+	t.Run("RequestTimeout", testEngineRequestTimeout)
+	t.Run("ExecRepair", testEngineExecRepair)
+	t.Run("ExecRepairFallback", testEngineExecRepairFallback)
+	t.Run("CommandResult", testEngineCommandResult)
+	t.Run("FixCompletion", testEngineFixCompletion)
+	t.Run("Alternatives", testEngineAlternatives)
+	t.Run("ExplainCompletion", testEngineExplainCompletion)
+	t.Run("ConcurrentChatStream", testEngineConcurrentChatStream)
+	t.Run("ConcurrentExec", testEngineConcurrentExec)
+}
+
+// newTestConfig builds a config from the given values, without reading any config file.
+func newTestConfig(t *testing.T, values map[string]interface{}) *config.Config {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	viper.Set("OPENAI_KEY", "test_key")
+	viper.Set("OPENAI_MODEL", "test_model")
+	viper.Set("OPENAI_MAX_TOKENS", 100)
+	for key, value := range values {
+		viper.Set(key, value)
+	}
+
+	return config.BuildConfig(system.Analyse())
+}
+
+// testProviderServers describes, for each backend, a stand-in server answering with the given content.
+var testProviderServers = map[string]func(content string, stream bool) http.HandlerFunc{
+	OpenAiProviderName: func(content string, stream bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if stream {
+				w.Header().Set("Content-Type", "text/event-stream")
+				//Azure starts with a chunk without any choice, holding the results of its content filter
+				fmt.Fprint(w, "data: {\"choices\":[],\"prompt_filter_results\":[]}\n\n")
+				for _, chunk := range []string{content[:len(content)/2], content[len(content)/2:]} {
+					fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", chunk)
+				}
+				//the usage comes last, in a chunk without any choice
+				fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":5}}\n\n")
+				fmt.Fprint(w, "data: [DONE]\n\n")
+				return
+			}
+			fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":%q}}],"usage":{"prompt_tokens":3,"completion_tokens":5}}`, content)
+		}
+	},
+	OllamaProviderName: func(content string, stream bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if stream {
+				for _, chunk := range []string{content[:len(content)/2], content[len(content)/2:]} {
+					fmt.Fprintf(w, "{\"message\":{\"role\":\"assistant\",\"content\":%q},\"done\":false}\n", chunk)
+				}
+				fmt.Fprint(w, "{\"message\":{\"role\":\"assistant\",\"content\":\"\"},\"done\":true}\n")
+				return
+			}
+			fmt.Fprintf(w, `{"message":{"role":"assistant","content":%q},"done":true}`, content)
+		}
+	},
+	AnthropicProviderName: func(content string, stream bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if stream {
+				fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\"}\n\n")
+				for _, chunk := range []string{content[:len(content)/2], content[len(content)/2:]} {
+					fmt.Fprintf(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":%q}}\n\n", chunk)
+				}
+				fmt.Fprint(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+				return
+			}
+			fmt.Fprintf(w, `{"content":[{"type":"text","text":%q}]}`, content)
+		}
+	},
+}
+
+// testEngineExecCompletion checks that ExecCompletion decodes the command whatever the provider is.
+func testEngineExecCompletion(t *testing.T) {
+	content := `{"cmd":"ls ~","exp":"list all files in your home dir","exec":true}`
+
+	for name, handler := range testProviderServers {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(handler(content, true))
+			defer server.Close()
+
+			cfg := newTestConfig(t, map[string]interface{}{
+				"OPENAI_PROVIDER": name,
+				"OPENAI_BASE_URL": server.URL,
+			})
+			engine, err := NewEngine(ExecEngineMode, cfg)
+			require.NoError(t, err)
+
+			output, err := engine.ExecCompletion("list all files in my home dir")
+			require.NoError(t, err)
+
+			assert.Equal(t, "ls ~", output.GetCommand())
+			assert.Equal(t, "list all files in your home dir", output.GetExplanation())
+			assert.True(t, output.IsExecutable())
+		})
+	}
+}
+
+// testEnginePartialExec checks that the command of a streamed exec answer is available as soon as it
+//is complete, while the rest of the answer has not arrived yet
+func testEnginePartialExec(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		send := func(chunk string) {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", chunk)
+			w.(http.Flusher).Flush()
+		}
+		send(`{"cmd":"ls `)
+		send(`~","exp":"list all `)
+		//the end of the answer waits for the test to have seen the command
+		<-release
+		send(`files","exec":true}`)
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL}))
+	require.NoError(t, err)
+
+	outputs := make(chan *EngineExecOutput, 1)
+	go func() {
+		output, err := engine.ExecCompletion("list all files in my home dir")
+		assert.NoError(t, err)
+		outputs <- output
+	}()
+
+	require.Eventually(t, func() bool {
+		return engine.GetPartialExecOutput().HasCommand()
+	}, 5*time.Second, 10*time.Millisecond)
+	partial := engine.GetPartialExecOutput()
+	assert.Equal(t, "ls ~", partial.GetCommand())
+	assert.Equal(t, "list all ", partial.GetExplanation())
+
+	close(release)
+	output := <-outputs
+	require.NotNil(t, output)
+	assert.Equal(t, "ls ~", output.GetCommand())
+	assert.Equal(t, "list all files", output.GetExplanation())
+}
+
+// testEngineChatStreamCompletion checks that ChatStreamCompletion forwards every chunk whatever the provider is.
+func testEngineChatStreamCompletion(t *testing.T) {
+	content := "The answer for `2+2` is `4`"
+
+	for name, handler := range testProviderServers {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(handler(content, true))
+			defer server.Close()
+
+			cfg := newTestConfig(t, map[string]interface{}{
+				"OPENAI_PROVIDER": name,
+				"OPENAI_BASE_URL": server.URL,
+			})
+			engine, err := NewEngine(ChatEngineMode, cfg)
+			require.NoError(t, err)
+
+			errs := make(chan error, 1)
+			go func() {
+				errs <- engine.ChatStreamCompletion("What is 2+2 ?")
+			}()
+
+			var received string
+			for output := range engine.GetChannel() {
+				received += output.GetContent()
+				if output.IsLast() {
+					break
+				}
+			}
+
+			require.NoError(t, <-errs)
+			assert.Equal(t, content, received)
+		})
+	}
+}
+
+// newHangingServer starts a stand-in server that sends the given chunk and then hangs until the client goes away.
+func newHangingServer(t *testing.T, chunk string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//the body has to be read for the server to notice when the client goes away
+		io.Copy(io.Discard, r.Body)
+		if chunk != "" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", chunk)
+			w.(http.Flusher).Flush()
+		}
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// testEngineInterruptChatStream checks that an interrupted stream sends the interrupt output and keeps the partial answer.
+func testEngineInterruptChatStream(t *testing.T) {
+	server := newHangingServer(t, "The answer")
+	cfg := newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL})
+	engine, err := NewEngine(ChatEngineMode, cfg)
+	require.NoError(t, err)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- engine.ChatStreamCompletion("What is 2+2 ?")
+	}()
+
+	first := <-engine.GetChannel()
+	assert.Equal(t, "The answer", first.GetContent())
+
+	engine.Interrupt()
+	last := <-engine.GetChannel()
+
+	require.NoError(t, <-errs)
+	assert.True(t, last.IsLast())
+	assert.True(t, last.IsInterrupt())
+	assert.Equal(t, "The answer [interrupted]", engine.chatMessages[len(engine.chatMessages)-1].Content)
+}
+
+// testEngineInterruptExec checks that an interrupted exec request returns ErrInterrupted.
+func testEngineInterruptExec(t *testing.T) {
+	server := newHangingServer(t, "")
+	cfg := newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL})
+	engine, err := NewEngine(ExecEngineMode, cfg)
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		engine.Interrupt()
+	}()
+
+	_, err = engine.ExecCompletion("list all files in my home dir")
+	assert.ErrorIs(t, err, ErrInterrupted)
+	assert.Equal(t, interrupted, engine.execMessages[len(engine.execMessages)-1].Content)
+}
+
+// testEngineRequestTimeout checks that a request running longer than the request timeout is aborted.
+func testEngineRequestTimeout(t *testing.T) {
+	server := newHangingServer(t, "")
+	cfg := newTestConfig(t, map[string]interface{}{
+		"OPENAI_BASE_URL":        server.URL,
+		"OPENAI_REQUEST_TIMEOUT": 1,
+	})
+	engine, err := NewEngine(ExecEngineMode, cfg)
+	require.NoError(t, err)
+
+	_, err = engine.ExecCompletion("list all files in my home dir")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInterrupted)
+	assert.Contains(t, err.Error(), "timed out after 1s")
+}
+
+// newRecordingServer starts a stand-in server answering with the given contents in order, the last one
+//being repeated, streamed when the request asks for it. the requests it received are returned through
+//the given slice
+func newRecordingServer(t *testing.T, requests *[]openai.ChatCompletionRequest, contents ...string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request openai.ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		*requests = append(*requests, request)
+
+		content := contents[len(contents)-1]
+		if len(*requests) <= len(contents) {
+			content = contents[len(*requests)-1]
+		}
+		if request.Stream {
+			testProviderServers[OpenAiProviderName](content, true)(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":%q}}]}`, content)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// testEngineExecRepair checks that an invalid answer is sent back to be repaired, with what's wrong with it.
+func testEngineExecRepair(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests,
+		`{"cmd":"find . -exec rm {} \\;","exec":true}`,
+		`{"cmd":"find . -exec rm {} \\;","exp":"delete everything","exec":true}`,
+	)
+	cfg := newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL})
+	engine, err := NewEngine(ExecEngineMode, cfg)
+	require.NoError(t, err)
+
+	output, err := engine.ExecCompletion("delete everything")
+	require.NoError(t, err)
+
+	assert.Equal(t, `find . -exec rm {} \;`, output.GetCommand())
+	assert.True(t, output.IsExecutable())
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, openai.ChatCompletionResponseFormatTypeJSONObject, requests[0].ResponseFormat.Type)
+	repair := requests[1].Messages[len(requests[1].Messages)-1]
+	assert.Equal(t, openai.ChatMessageRoleUser, repair.Role)
+	assert.Contains(t, repair.Content, "the field exp is missing")
+
+	//only the question and the final answer are kept in the history
+	assert.Len(t, engine.execMessages, 2)
+}
+
+// testEngineExecRepairFallback checks that an answer still invalid after the repairs is shown as plain text.
+func testEngineExecRepairFallback(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, "I cannot generate a command for this")
+	cfg := newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL})
+	engine, err := NewEngine(ExecEngineMode, cfg)
+	require.NoError(t, err)
+
+	output, err := engine.ExecCompletion("how are you ?")
+	require.NoError(t, err)
+
+	assert.Equal(t, "I cannot generate a command for this", output.GetExplanation())
+	assert.False(t, output.IsExecutable())
+	assert.Len(t, requests, execRepairAttempts+1)
+}
+
+// testEngineCommandResult checks that the result of an executed command is sent with the follow-up question.
+func testEngineCommandResult(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests,
+		`{"cmd":"du -sh *","exp":"size of each file","exec":true}`,
+		`{"cmd":"du -sh * | sort -h","exp":"size of each file, sorted","exec":true}`,
+	)
+	cfg := newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL})
+	engine, err := NewEngine(ExecEngineMode, cfg)
+	require.NoError(t, err)
+
+	_, err = engine.ExecCompletion("size of the files here")
+	require.NoError(t, err)
+	engine.AppendCommandResult("du -sh *", 1, "\n\n4.0K\tgo.mod\n\n", "du: cannot read secret: Permission denied\n", false)
+	_, err = engine.ExecCompletion("sort that by size")
+	require.NoError(t, err)
+
+	require.Len(t, requests, 2)
+	messages := requests[1].Messages
+	result := messages[len(messages)-2]
+	assert.Equal(t, openai.ChatMessageRoleUser, result.Role)
+	assert.Equal(t, "I executed `du -sh *`, it exited with code 1.\n"+
+		"stdout:\n4.0K\tgo.mod\n"+
+		"stderr:\ndu: cannot read secret: Permission denied", result.Content)
+	assert.Equal(t, "sort that by size", messages[len(messages)-1].Content)
+
+	//a command without output says so, and the truncation is told
+	engine.AppendCommandResult("touch file", 0, "", "", true)
+	assert.Equal(t, "I executed `touch file`, it exited with code 0.\nstdout:\n(empty)\nstderr:\n(empty)\n[the outputs were truncated]",
+		engine.execMessages[len(engine.execMessages)-1].Content)
+}
+
+// testEngineFixCompletion checks that a failed command is sent back with its result to get a corrected one.
+func testEngineFixCompletion(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests,
+		`{"cmd":"sudo apt install jq","exp":"apt needs root privileges, retry with sudo","exec":true}`,
+	)
+	cfg := newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL})
+	engine, err := NewEngine(ExecEngineMode, cfg)
+	require.NoError(t, err)
+
+	engine.AppendCommandResult("apt install jq", 100, "", "E: Could not open lock file, are you root?", false)
+	output, err := engine.FixCompletion("apt install jq")
+	require.NoError(t, err)
+	assert.Equal(t, "sudo apt install jq", output.GetCommand())
+	assert.True(t, output.IsExecutable())
+
+	require.Len(t, requests, 1)
+	messages := requests[0].Messages
+	assert.Contains(t, messages[len(messages)-2].Content, "it exited with code 100")
+	assert.Contains(t, messages[len(messages)-2].Content, "are you root?")
+	assert.Equal(t, fmt.Sprintf(execFixPrompt, "apt install jq"), messages[len(messages)-1].Content)
+}
+
+// testEngineAlternatives checks that the alternatives are only asked for when enabled, and that the
+//extra ones are dropped
+func testEngineAlternatives(t *testing.T) {
+	content := `{"cmd":"find . -name '*.go'","exp":"with find","exec":true,"alternatives":[` +
+		`{"cmd":"fd -e go","exp":"with fd"},{"cmd":"ls **/*.go","exp":"with a glob"},{"cmd":"git ls-files '*.go'","exp":"with git"}]}`
+
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, content, content)
+
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{
+		"OPENAI_BASE_URL":     server.URL,
+		"OPENAI_ALTERNATIVES": 3,
+	}))
+	require.NoError(t, err)
+	output, err := engine.ExecCompletion("find the go files")
+	require.NoError(t, err)
+	require.Len(t, output.GetCandidates(), 3)
+	assert.Equal(t, "ls **/*.go", output.GetCandidates()[2].GetCommand())
+	assert.Contains(t, requests[0].Messages[0].Content, "at most 3 commands")
+
+	engine, err = NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL}))
+	require.NoError(t, err)
+	output, err = engine.ExecCompletion("find the go files")
+	require.NoError(t, err)
+	assert.False(t, output.HasAlternatives())
+	assert.NotContains(t, requests[1].Messages[0].Content, "alternatives")
+}
+
+// testEngineExplainCompletion checks that a command is explained with the explain prompt, and that a
+//piped script is explained when nothing is asked
+func testEngineExplainCompletion(t *testing.T) {
+	content := `{"summary":"list the files","stages":[{"cmd":"ls -l","exp":"list the files","parts":[{"text":"ls","exp":"list"},{"text":"-l","exp":"long format"}]}]}`
+
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, content, content)
+
+	engine, err := NewEngine(ExplainEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL}))
+	require.NoError(t, err)
+	output, err := engine.ExplainCompletion("ls -l")
+	require.NoError(t, err)
+	assert.Equal(t, "list the files", output.GetSummary())
+	require.Len(t, output.GetStages(), 1)
+	assert.Len(t, output.GetStages()[0].GetParts(), 2)
+	assert.Contains(t, requests[0].Messages[0].Content, "explaining the command line or the script")
+	assert.Equal(t, "ls -l", requests[0].Messages[1].Content)
+	//the explanations have their own history
+	assert.Len(t, engine.explainMessages, 2)
+	assert.Empty(t, engine.execMessages)
+
+	engine.Reset().SetPipe("#!/bin/sh\nls -l")
+	_, err = engine.ExplainCompletion("")
+	require.NoError(t, err)
+	messages := requests[1].Messages
+	assert.Contains(t, messages[1].Content, "ls -l")
+	assert.Equal(t, explainPipePrompt, messages[2].Content)
+}
+
+// pollEngine calls the getters of the engine in a loop, like the UI does on each tick, until stop is closed.
+func pollEngine(engine *Engine, stop chan struct{}) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				engine.GetStatus()
+				engine.GetPartialExecOutput()
+				engine.GetMode()
+				engine.IsOffline()
+				engine.GetLedger()
+			}
+		}
+	}()
+
+	return &wg
+}
+
+// testEngineConcurrentChatStream checks that a chat stream can be polled and interrupted from other
+//goroutines, and that the changes of the engine wait for the stream to be over
+func testEngineConcurrentChatStream(t *testing.T) {
+	server := newHangingServer(t, "The answer")
+	engine, err := NewEngine(ChatEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL}))
+	require.NoError(t, err)
+
+	stop := make(chan struct{})
+	polling := pollEngine(engine, stop)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- engine.ChatStreamCompletion("What is 2+2 ?")
+	}()
+	first := <-engine.GetChannel()
+	assert.Equal(t, "The answer", first.GetContent())
+
+	//the mode is changed while the stream is in flight, it waits for the stream to be over
+	changed := make(chan struct{})
+	go func() {
+		engine.SetMode(ExecEngineMode)
+		close(changed)
+	}()
+	select {
+	case <-changed:
+		t.Fatal("the mode changed while the stream was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Equal(t, ChatEngineMode, engine.GetMode())
+
+	engine.Interrupt()
+	last := <-engine.GetChannel()
+	assert.True(t, last.IsInterrupt())
+	require.NoError(t, <-errs)
+
+	<-changed
+	close(stop)
+	polling.Wait()
+	assert.Equal(t, ExecEngineMode, engine.GetMode())
+	assert.Equal(t, "The answer [interrupted]", engine.chatMessages[len(engine.chatMessages)-1].Content)
+}
+
+// testEngineConcurrentExec checks that an exec request can be polled and interrupted from other
+//goroutines, and that a command result appended meanwhile comes after the interrupted request
+func testEngineConcurrentExec(t *testing.T) {
+	server := newHangingServer(t, `{"cmd":"ls",`)
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL}))
+	require.NoError(t, err)
+
+	stop := make(chan struct{})
+	polling := pollEngine(engine, stop)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := engine.ExecCompletion("list all files in my home dir")
+		errs <- err
+	}()
+	require.Eventually(t, func() bool {
+		return engine.GetPartialExecOutput().HasCommand()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	appended := make(chan struct{})
+	go func() {
+		engine.AppendCommandResult("ls", 0, "go.mod", "", false)
+		close(appended)
+	}()
+	engine.Interrupt()
+	assert.ErrorIs(t, <-errs, ErrInterrupted)
+	<-appended
+	close(stop)
+	polling.Wait()
+
+	messages := engine.execMessages
+	require.Len(t, messages, 3)
+	assert.Equal(t, interrupted, messages[1].Content)
+	assert.Contains(t, messages[2].Content, "I executed `ls`")
+}
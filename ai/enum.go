@@ -14,16 +14,20 @@ const (
 	ExecEngineMode EngineMode = iota
 	// ChatEngineMode represents the chat mode of the AI engine.
 	ChatEngineMode
+	// ExplainEngineMode represents the explain mode of the AI engine, going from a command to its explanation.
+	ExplainEngineMode
 )
 
 //Tere are two modes we can operate in - chat mode enables us to chat with the 
 //ai model whereas with exec mode we can execute commands
 // String method returns the string representation of the EngineMode.
 func (m EngineMode) String() string {
-	// If the mode is ExecEngineMode, return "exec".
-	if m == ExecEngineMode {
+	switch m {
+	case ExecEngineMode:
 		return "exec"
-	} else {
+	case ExplainEngineMode:
+		return "explain"
+	default:
 		// Otherwise, return "chat".
 		return "chat"
 	}
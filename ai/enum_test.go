@@ -24,6 +24,11 @@ func TestEngineModeString(t *testing.T) {
 			mode:     ChatEngineMode,
 			expected: "chat",
 		},
+		{
+			name:     "ExplainEngineMode",
+			mode:     ExplainEngineMode,
+			expected: "explain",
+		},
 		{
 			name:     "UnknownEngineMode",
 			mode:     EngineMode(42),
@@ -0,0 +1,168 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/akhilsharma90/terminal-assistant/cache"
+)
+
+//the models are discovered through the models endpoint of the provider, and kept in the cache of the
+//exec answers so the picker and the checks of the models don't ask for them every time. the engine
+//talks to the model picked in the REPL or with -model, else to the model of its mode, else to
+//openai_model. switching the model keeps the conversation, the next request goes to the new model
+
+// modelSuggestions is the maximum number of models suggested when a model is not available.
+const modelSuggestions = 5
+
+// modelsRequest is what the list of models is cached under, it depends on where it was asked.
+type modelsRequest struct {
+	Models   bool   `json:"models"`
+	Provider string `json:"provider"`
+	ApiType  string `json:"api_type"`
+	BaseUrl  string `json:"base_url"`
+	Key      string `json:"key"`
+}
+
+// SetModel sets the model the requests of every mode go to, empty goes back to the models of the config.
+func (e *Engine) SetModel(model string) *Engine {
+	defer e.lock()()
+	e.model = strings.TrimSpace(model)
+
+	return e
+}
+
+// GetModel returns the model the requests of the current mode go to.
+func (e *Engine) GetModel() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.getModel()
+}
+
+// getModel returns the model the requests of the current mode go to: the one set with SetModel, or
+//the one of the mode in the config, or openai_model
+func (e *Engine) getModel() string {
+	if e.model != "" {
+		return e.model
+	}
+
+	aiConfig := e.config.GetAiConfig()
+	var model string
+	switch e.mode {
+	case ExecEngineMode:
+		model = aiConfig.GetExecModel()
+	case ChatEngineMode:
+		model = aiConfig.GetChatModel()
+	case ExplainEngineMode:
+		model = aiConfig.GetExplainModel()
+	}
+	if model == "" {
+		model = aiConfig.GetModel()
+	}
+
+	return model
+}
+
+// ListModels returns the models available with the provider, sorted. they are taken from the cache when
+//they were listed recently, the offline mode only uses the cache
+func (e *Engine) ListModels() ([]string, error) {
+	e.busy.Lock()
+	defer e.busy.Unlock()
+
+	aiConfig := e.config.GetAiConfig()
+	key, err := cache.Key(modelsRequest{
+		Models:   true,
+		Provider: aiConfig.GetProvider(),
+		ApiType:  aiConfig.GetApiType(),
+		BaseUrl:  aiConfig.GetBaseUrl(),
+		Key:      aiConfig.GetKey(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//a broken cached list is only a miss, the models are asked again
+	if content, hit := e.getCachedModels(key); hit {
+		var models []string
+		if err := json.Unmarshal([]byte(content), &models); err == nil {
+			return models, nil
+		}
+	}
+	if e.offline {
+		return nil, ErrOffline
+	}
+
+	ctx, done := e.newRequestContext()
+	defer done()
+	models, err := e.provider.ListModels(ctx)
+	if err != nil {
+		return nil, e.requestError(ctx, err)
+	}
+	if content, err := json.Marshal(models); err == nil {
+		e.cacheAnswer(key, string(content))
+	}
+
+	return models, nil
+}
+
+// getCachedModels returns the cached list of models of the given key, if there is one.
+func (e *Engine) getCachedModels(key string) (string, bool) {
+	if e.cache == nil {
+		return "", false
+	}
+	content, err := e.cache.Get(key)
+	if err != nil {
+		return "", false
+	}
+
+	return content, true
+}
+
+// CheckModels returns an error if one of the models is not available with the provider, suggesting the
+//models with a similar name. the empty models, and the ones given an Azure deployment, are skipped.
+//the models can't be checked when they can't be listed, like offline without a cached list, or when
+//the provider lists none, they are accepted then and the requests will tell
+func (e *Engine) CheckModels(models ...string) error {
+	var checked []string
+	for _, model := range models {
+		if model != "" && !hasDeployment(e.config.GetAiConfig(), model) {
+			checked = append(checked, model)
+		}
+	}
+	if len(checked) == 0 {
+		return nil
+	}
+
+	available, err := e.ListModels()
+	if err != nil || len(available) == 0 {
+		return nil
+	}
+	for _, model := range checked {
+		if err := checkModel(model, available); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkModel returns an error if the model is not one of the models.
+func checkModel(model string, models []string) error {
+	var suggestions []string
+	for _, available := range models {
+		if available == model {
+			return nil
+		}
+		if len(suggestions) < modelSuggestions && strings.Contains(strings.ToLower(available), strings.ToLower(model)) {
+			suggestions = append(suggestions, available)
+		}
+	}
+
+	if len(suggestions) > 0 {
+		return fmt.Errorf("unknown model %s, did you mean %s?", model, strings.Join(suggestions, ", "))
+	}
+
+	return fmt.Errorf("unknown model %s, run with -models to list the available ones", model)
+}
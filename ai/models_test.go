@@ -0,0 +1,127 @@
+package ai
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akhilsharma90/terminal-assistant/cache"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestModels tests the models discovered through the provider, and the switch from one to another.
+func TestModels(t *testing.T) {
+	t.Run("ListModels", testModelsListModels)
+	t.Run("CheckModels", testModelsCheckModels)
+	t.Run("SetModel", testModelsSetModel)
+	t.Run("ModeModels", testModelsModeModels)
+}
+
+// newModelsServer starts a stand-in server listing the given models, the number of times they were
+//listed is counted with the given counter
+func newModelsServer(t *testing.T, listed *int, models ...string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/models", r.URL.Path)
+		*listed++
+		var data []string
+		for _, model := range models {
+			data = append(data, fmt.Sprintf(`{"id":%q,"object":"model"}`, model))
+		}
+		fmt.Fprintf(w, `{"object":"list","data":[%s]}`, strings.Join(data, ","))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// testModelsListModels checks that the models are sorted and cached, and that the offline mode only uses the cache.
+func testModelsListModels(t *testing.T) {
+	var listed int
+	server := newModelsServer(t, &listed, "gpt-4o", "gpt-3.5-turbo", "gpt-4")
+	answers, err := cache.NewCache(filepath.Join(t.TempDir(), "cache"), time.Hour, 0)
+	require.NoError(t, err)
+
+	offline, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL}))
+	require.NoError(t, err)
+	offline.SetCache(answers).SetOffline(true)
+	_, err = offline.ListModels()
+	assert.ErrorIs(t, err, ErrOffline)
+
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL}))
+	require.NoError(t, err)
+	engine.SetCache(answers)
+	models, err := engine.ListModels()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gpt-3.5-turbo", "gpt-4", "gpt-4o"}, models)
+
+	//the next engine finds them in the cache, even offline
+	models, err = offline.ListModels()
+	require.NoError(t, err)
+	assert.Len(t, models, 3)
+	assert.Equal(t, 1, listed)
+}
+
+// testModelsCheckModels checks that an unknown model is refused with the models of a similar name.
+func testModelsCheckModels(t *testing.T) {
+	var listed int
+	server := newModelsServer(t, &listed, "gpt-4o", "gpt-4", "llama3")
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL}))
+	require.NoError(t, err)
+
+	assert.NoError(t, engine.CheckModels("gpt-4", "", "llama3"))
+	err = engine.CheckModels("gpt-4", "GPT")
+	require.Error(t, err)
+	assert.Equal(t, "unknown model GPT, did you mean gpt-4, gpt-4o?", err.Error())
+	assert.ErrorContains(t, engine.CheckModels("claude"), "-models")
+
+	//nothing is listed when there is nothing to check
+	listed = 0
+	assert.NoError(t, engine.CheckModels("", ""))
+	assert.Equal(t, 0, listed)
+}
+
+// testModelsSetModel checks that the conversation goes on with the model switched to.
+func testModelsSetModel(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, `{"cmd":"ls","exp":"list files","exec":true}`)
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL}))
+	require.NoError(t, err)
+
+	_, err = engine.ExecCompletion("list files")
+	require.NoError(t, err)
+	engine.SetModel("gpt-4o")
+	assert.Equal(t, "gpt-4o", engine.GetModel())
+	_, err = engine.ExecCompletion("sort them")
+	require.NoError(t, err)
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, "test_model", requests[0].Model)
+	assert.Equal(t, "gpt-4o", requests[1].Model)
+	messages := requests[1].Messages
+	assert.Equal(t, "list files", messages[len(messages)-3].Content)
+
+	//an empty model goes back to the one of the config
+	engine.SetModel("")
+	assert.Equal(t, "test_model", engine.GetModel())
+}
+
+// testModelsModeModels checks that each mode uses its own model, openai_model being used for the others.
+func testModelsModeModels(t *testing.T) {
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_CHAT_MODEL": "gpt-4o"}))
+	require.NoError(t, err)
+
+	assert.Equal(t, "test_model", engine.GetModel())
+	engine.SetMode(ChatEngineMode)
+	assert.Equal(t, "gpt-4o", engine.GetModel())
+	engine.SetModel("gpt-4")
+	assert.Equal(t, "gpt-4", engine.SetMode(ExplainEngineMode).GetModel())
+}
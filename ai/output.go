@@ -2,14 +2,181 @@ package ai
 
 //COMPLETE
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
 //the output from execution and chat stream both look different, they're the two modes of the engine
 //the exec output has it's own struct defined as EngineExecOutput and the chatStreamOutput has its
 //own struct defined below
 // EngineExecOutput represents the output of an AI engine execution.
 type EngineExecOutput struct {
-	Command     string `json:"cmd"`  // Command executed by the AI engine
-	Explanation string `json:"exp"`  // Explanation of the command
-	Executable  bool   `json:"exec"` // Indicates if the command is executable.
+	Command      string                  `json:"cmd"`                    // Command executed by the AI engine
+	Explanation  string                  `json:"exp"`                    // Explanation of the command
+	Executable   bool                    `json:"exec"`                   // Indicates if the command is executable.
+	Steps        []EngineExecStep        `json:"steps,omitempty"`        // Ordered steps of a plan, when the task needs several commands.
+	Probe        string                  `json:"probe,omitempty"`        // Read-only command the model wants to run before answering.
+	Alternatives []EngineExecAlternative `json:"alternatives,omitempty"` // Other commands doing the same task in another way.
+	compacted    bool                    // Indicates if the older turns were compacted to fit in the context budget.
+	probes       []EngineProbe           // Probes run before the answer.
+	chunks       int                     // Chunks the piped input was read in, 0 when it was sent whole.
+}
+
+// EngineExecStep represents a single step of a multi-step plan.
+type EngineExecStep struct {
+	Command     string `json:"cmd"` // Command of the step
+	Explanation string `json:"exp"` // Explanation of the step
+}
+
+// EngineExecAlternative represents another command doing the same task, the user picks which one runs.
+type EngineExecAlternative struct {
+	Command     string `json:"cmd"` // Command of the alternative
+	Explanation string `json:"exp"` // Explanation of the alternative
+}
+
+// EngineProbe represents a read-only probe run before the answer, see probe.go.
+type EngineProbe struct {
+	command string // Command of the probe
+	output  string // Output of the probe, cut at probeOutputLimit
+	err     error  // Why the probe failed or was not run, nil when it succeeded
+}
+
+// engineExecOutputSchema is the JSON schema an exec answer has to follow, it is sent back to the
+//model when its answer has to be repaired
+const engineExecOutputSchema = `{"type":"object","properties":{"cmd":{"type":"string"},"exp":{"type":"string"},"exec":{"type":"boolean"},"steps":{"type":"array","items":{"type":"object","properties":{"cmd":{"type":"string"},"exp":{"type":"string"}},"required":["cmd","exp"]}},"probe":{"type":"string"},"alternatives":{"type":"array","items":{"type":"object","properties":{"cmd":{"type":"string"},"exp":{"type":"string"}},"required":["cmd","exp"]}}},"required":["cmd","exp","exec"]}`
+
+// engineExecOutputFields lists the fields required by engineExecOutputSchema with their JSON type.
+var engineExecOutputFields = []struct {
+	name string
+	kind string
+}{
+	{name: "cmd", kind: "string"},
+	{name: "exp", kind: "string"},
+	{name: "exec", kind: "boolean"},
+}
+
+// parseEngineExecOutput decodes an exec answer and validates it against engineExecOutputSchema.
+//the error tells what is wrong with the answer, it is meant to be sent back to the model
+func parseEngineExecOutput(content string) (*EngineExecOutput, error) {
+	content = trimCodeBlock(content)
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(content), &fields); err != nil {
+		return nil, errors.New("the answer is not a single JSON object")
+	}
+
+	//a probe is asked for before the answer, the other fields are not needed then
+	if raw, ok := fields["probe"]; ok && string(raw) != "null" {
+		var probe string
+		if err := json.Unmarshal(raw, &probe); err != nil {
+			return nil, errors.New("the field probe must be a string")
+		}
+		if strings.TrimSpace(probe) != "" {
+			return &EngineExecOutput{Probe: strings.TrimSpace(probe)}, nil
+		}
+	}
+
+	for _, field := range engineExecOutputFields {
+		raw, ok := fields[field.name]
+		if !ok {
+			return nil, fmt.Errorf("the field %s is missing", field.name)
+		}
+		var err error
+		switch field.kind {
+		case "string":
+			var value string
+			err = json.Unmarshal(raw, &value)
+		case "boolean":
+			var value bool
+			err = json.Unmarshal(raw, &value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("the field %s must be a %s", field.name, field.kind)
+		}
+	}
+
+	//steps and alternatives are optional, but when given each of them needs a command and an explanation
+	for _, list := range []struct {
+		field string
+		item  string
+	}{
+		{field: "steps", item: "step"},
+		{field: "alternatives", item: "alternative"},
+	} {
+		raw, ok := fields[list.field]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+		var items []map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, fmt.Errorf("the field %s must be an array of objects", list.field)
+		}
+		for i, item := range items {
+			for _, name := range []string{"cmd", "exp"} {
+				var value string
+				if err := json.Unmarshal(item[name], &value); err != nil {
+					return nil, fmt.Errorf("the field %s of %s %d must be a string", name, list.item, i+1)
+				}
+				if name == "cmd" && strings.TrimSpace(value) == "" {
+					return nil, fmt.Errorf("the field cmd of %s %d is empty", list.item, i+1)
+				}
+			}
+		}
+	}
+
+	var output EngineExecOutput
+	if err := json.Unmarshal([]byte(content), &output); err != nil {
+		return nil, err
+	}
+	if output.Executable && strings.TrimSpace(output.Command) == "" && len(output.Steps) == 0 {
+		return nil, errors.New("the field cmd is empty while exec is true")
+	}
+	output.Alternatives = dedupeAlternatives(output.Command, output.Alternatives)
+
+	return &output, nil
+}
+
+// trimCodeBlock removes the spaces around an answer, and the markdown code block some models wrap the
+//JSON in even when asked not to
+func trimCodeBlock(content string) string {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "```") {
+		content = strings.TrimPrefix(content, "```json")
+		content = strings.TrimPrefix(content, "```")
+		content = strings.TrimSuffix(strings.TrimSpace(content), "```")
+	}
+
+	return content
+}
+
+// dedupeAlternatives removes the alternatives repeating the command, or an alternative given before.
+//the commands are compared without their extra spaces, models often repeat the same command
+//with another spacing when asked for several
+func dedupeAlternatives(command string, alternatives []EngineExecAlternative) []EngineExecAlternative {
+	if len(alternatives) == 0 {
+		return nil
+	}
+
+	seen := map[string]bool{normalizeCommand(command): true}
+	var deduped []EngineExecAlternative
+	for _, alternative := range alternatives {
+		key := normalizeCommand(alternative.Command)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		deduped = append(deduped, alternative)
+	}
+
+	return deduped
+}
+
+// normalizeCommand collapses the spaces of a command, so two spellings of the same command compare equal.
+func normalizeCommand(command string) string {
+	return strings.Join(strings.Fields(command), " ")
 }
 
 //eo being accepted in these methods below is engine exec output
@@ -30,12 +197,269 @@ func (eo EngineExecOutput) IsExecutable() bool {
 	return eo.Executable
 }
 
+// GetSteps returns the ordered steps of the plan, if any.
+func (eo EngineExecOutput) GetSteps() []EngineExecStep {
+	return eo.Steps
+}
+
+// IsPlan returns a boolean indicating if the output is an executable multi-step plan.
+func (eo EngineExecOutput) IsPlan() bool {
+	return eo.Executable && len(eo.Steps) > 0
+}
+
+// IsCompacted returns a boolean indicating if the older turns were compacted before the request.
+func (eo EngineExecOutput) IsCompacted() bool {
+	return eo.compacted
+}
+
+// GetPipeChunks returns how many chunks the piped input was read in, 0 when it was sent whole.
+func (eo EngineExecOutput) GetPipeChunks() int {
+	return eo.chunks
+}
+
+// GetProbe returns the read-only command the model wants to run before answering.
+func (eo EngineExecOutput) GetProbe() string {
+	return eo.Probe
+}
+
+// IsProbe returns a boolean indicating if the model asks for a probe instead of answering.
+func (eo EngineExecOutput) IsProbe() bool {
+	return eo.Probe != ""
+}
+
+// GetProbes returns the probes run before the answer.
+func (eo EngineExecOutput) GetProbes() []EngineProbe {
+	return eo.probes
+}
+
+// GetAlternatives returns the other commands doing the same task in another way, if any.
+func (eo EngineExecOutput) GetAlternatives() []EngineExecAlternative {
+	return eo.Alternatives
+}
+
+// GetCandidates returns the commands the user can pick from: the command first, then its alternatives.
+//a plan or an answer which is not executable has no candidates
+func (eo EngineExecOutput) GetCandidates() []EngineExecAlternative {
+	if !eo.Executable || eo.IsPlan() {
+		return nil
+	}
+
+	candidates := []EngineExecAlternative{{Command: eo.Command, Explanation: eo.Explanation}}
+
+	return append(candidates, eo.Alternatives...)
+}
+
+// HasAlternatives returns a boolean indicating if the user has several commands to pick from.
+func (eo EngineExecOutput) HasAlternatives() bool {
+	return len(eo.GetCandidates()) > 1
+}
+
+// GetCommand returns the command of the step.
+func (s EngineExecStep) GetCommand() string {
+	return s.Command
+}
+
+// GetExplanation returns the explanation of the step.
+func (s EngineExecStep) GetExplanation() string {
+	return s.Explanation
+}
+
+// GetCommand returns the command of the alternative.
+func (a EngineExecAlternative) GetCommand() string {
+	return a.Command
+}
+
+// GetExplanation returns the explanation of the alternative.
+func (a EngineExecAlternative) GetExplanation() string {
+	return a.Explanation
+}
+
+// GetCommand returns the command of the probe.
+func (p EngineProbe) GetCommand() string {
+	return p.command
+}
+
+// GetOutput returns the output of the probe.
+func (p EngineProbe) GetOutput() string {
+	return p.output
+}
+
+// GetError returns why the probe failed or was not run, nil when it succeeded.
+func (p EngineProbe) GetError() error {
+	return p.err
+}
+
+// EngineExplainOutput represents the output of the explain mode: a command or a script broken down into
+//its pipeline stages, and each stage into its program, flags and arguments
+type EngineExplainOutput struct {
+	Summary   string               `json:"summary"` // What the command does as a whole
+	Stages    []EngineExplainStage `json:"stages"`  // Stages of the pipeline, in order
+	compacted bool                 // Indicates if the older turns were compacted to fit in the context budget.
+	chunks    int                  // Chunks the piped input was read in, 0 when it was sent whole.
+}
+
+// EngineExplainStage represents a stage of the pipeline, like a command between two pipes.
+type EngineExplainStage struct {
+	Command     string              `json:"cmd"`   // Command of the stage
+	Explanation string              `json:"exp"`   // Explanation of the stage
+	Parts       []EngineExplainPart `json:"parts"` // Program, flags and arguments of the stage
+}
+
+// EngineExplainPart represents the program, a flag or an argument of a stage.
+type EngineExplainPart struct {
+	Text        string `json:"text"`           // Part as written in the stage
+	Explanation string `json:"exp"`            // Explanation of the part
+	Risk        string `json:"risk,omitempty"` // Why the part is risky, empty when it is not
+}
+
+// engineExplainOutputSchema is the JSON schema an explain answer has to follow, it is sent back to the
+//model when its answer has to be repaired
+const engineExplainOutputSchema = `{"type":"object","properties":{"summary":{"type":"string"},"stages":{"type":"array","items":{"type":"object","properties":{"cmd":{"type":"string"},"exp":{"type":"string"},"parts":{"type":"array","items":{"type":"object","properties":{"text":{"type":"string"},"exp":{"type":"string"},"risk":{"type":"string"}},"required":["text","exp"]}}},"required":["cmd","exp","parts"]}}},"required":["summary","stages"]}`
+
+// parseEngineExplainOutput decodes an explain answer and validates it against engineExplainOutputSchema.
+//the error tells what is wrong with the answer, it is meant to be sent back to the model
+func parseEngineExplainOutput(content string) (*EngineExplainOutput, error) {
+	content = trimCodeBlock(content)
+
+	var fields struct {
+		Summary *json.RawMessage `json:"summary"`
+		Stages  *json.RawMessage `json:"stages"`
+	}
+	if err := json.Unmarshal([]byte(content), &fields); err != nil {
+		return nil, errors.New("the answer is not a single JSON object")
+	}
+	if fields.Summary == nil {
+		return nil, errors.New("the field summary is missing")
+	}
+	var summary string
+	if err := json.Unmarshal(*fields.Summary, &summary); err != nil {
+		return nil, errors.New("the field summary must be a string")
+	}
+	if fields.Stages == nil {
+		return nil, errors.New("the field stages is missing")
+	}
+
+	var stages []map[string]json.RawMessage
+	if err := json.Unmarshal(*fields.Stages, &stages); err != nil {
+		return nil, errors.New("the field stages must be an array of objects")
+	}
+	for i, stage := range stages {
+		for _, name := range []string{"cmd", "exp"} {
+			var value string
+			if err := json.Unmarshal(stage[name], &value); err != nil {
+				return nil, fmt.Errorf("the field %s of stage %d must be a string", name, i+1)
+			}
+		}
+		var parts []map[string]json.RawMessage
+		if err := json.Unmarshal(stage["parts"], &parts); err != nil {
+			return nil, fmt.Errorf("the field parts of stage %d must be an array of objects", i+1)
+		}
+		for j, part := range parts {
+			for _, name := range []string{"text", "exp", "risk"} {
+				raw, ok := part[name]
+				if !ok && name == "risk" {
+					continue
+				}
+				var value string
+				if err := json.Unmarshal(raw, &value); err != nil {
+					return nil, fmt.Errorf("the field %s of part %d of stage %d must be a string", name, j+1, i+1)
+				}
+			}
+		}
+	}
+
+	var output EngineExplainOutput
+	if err := json.Unmarshal([]byte(content), &output); err != nil {
+		return nil, err
+	}
+
+	return &output, nil
+}
+
+// GetSummary returns what the command does as a whole.
+func (xo EngineExplainOutput) GetSummary() string {
+	return xo.Summary
+}
+
+// GetStages returns the stages of the pipeline, in order.
+func (xo EngineExplainOutput) GetStages() []EngineExplainStage {
+	return xo.Stages
+}
+
+// IsRisky returns a boolean indicating if a part of the command is risky.
+func (xo EngineExplainOutput) IsRisky() bool {
+	for _, stage := range xo.Stages {
+		if stage.IsRisky() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsCompacted returns a boolean indicating if the older turns were compacted before the request.
+func (xo EngineExplainOutput) IsCompacted() bool {
+	return xo.compacted
+}
+
+// GetPipeChunks returns how many chunks the piped input was read in, 0 when it was sent whole.
+func (xo EngineExplainOutput) GetPipeChunks() int {
+	return xo.chunks
+}
+
+// GetCommand returns the command of the stage.
+func (s EngineExplainStage) GetCommand() string {
+	return s.Command
+}
+
+// GetExplanation returns the explanation of the stage.
+func (s EngineExplainStage) GetExplanation() string {
+	return s.Explanation
+}
+
+// GetParts returns the program, the flags and the arguments of the stage.
+func (s EngineExplainStage) GetParts() []EngineExplainPart {
+	return s.Parts
+}
+
+// IsRisky returns a boolean indicating if a part of the stage is risky.
+func (s EngineExplainStage) IsRisky() bool {
+	for _, part := range s.Parts {
+		if part.IsRisky() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetText returns the part as written in the stage.
+func (p EngineExplainPart) GetText() string {
+	return p.Text
+}
+
+// GetExplanation returns the explanation of the part.
+func (p EngineExplainPart) GetExplanation() string {
+	return p.Explanation
+}
+
+// GetRisk returns why the part is risky, empty when it is not.
+func (p EngineExplainPart) GetRisk() string {
+	return p.Risk
+}
+
+// IsRisky returns a boolean indicating if the part is risky.
+func (p EngineExplainPart) IsRisky() bool {
+	return strings.TrimSpace(p.Risk) != ""
+}
+
 // EngineChatStreamOutput represents the output of an AI engine chat stream.
 type EngineChatStreamOutput struct {
-	content    string // The content of the chat stream.
-	last       bool   // Indicates if this is the last output in the chat stream.
-	interrupt  bool   // Indicates if the chat stream was interrupted.
-	executable bool   // Indicates if the content is executable.
+	content   string // The content of the chat stream.
+	last      bool   // Indicates if this is the last output in the chat stream.
+	interrupt bool   // Indicates if the chat stream was interrupted.
+	compacted bool   // Indicates if the older turns were compacted before the request.
+	chunks    int    // Chunks the piped input was read in, 0 when it was sent whole.
 }
 
 // GetContent returns the content of the chat stream.
@@ -53,7 +477,12 @@ func (co EngineChatStreamOutput) IsInterrupt() bool {
 	return co.interrupt
 }
 
-// IsExecutable returns a boolean indicating if the content is executable.
-func (co EngineChatStreamOutput) IsExecutable() bool {
-	return co.executable
+// IsCompacted returns a boolean indicating if the older turns were compacted before the request.
+func (co EngineChatStreamOutput) IsCompacted() bool {
+	return co.compacted
+}
+
+// GetPipeChunks returns how many chunks the piped input was read in, 0 when it was sent whole.
+func (co EngineChatStreamOutput) GetPipeChunks() int {
+	return co.chunks
 }
@@ -30,6 +30,33 @@ func TestEngineExecOutputIsExecutable(t *testing.T) {
 	assert.True(t, result)
 }
 
+// TestEngineExecOutputIsPlan is a test function for testing the IsPlan method of the EngineExecOutput type
+func TestEngineExecOutputIsPlan(t *testing.T) {
+	steps := []EngineExecStep{{Command: "ls", Explanation: "list files"}}
+
+	assert.True(t, EngineExecOutput{Executable: true, Steps: steps}.IsPlan())
+	assert.False(t, EngineExecOutput{Executable: false, Steps: steps}.IsPlan())
+	assert.False(t, EngineExecOutput{Executable: true, Command: "ls"}.IsPlan())
+}
+
+// TestEngineExecOutputIsProbe is a test function for testing the IsProbe method of the EngineExecOutput type
+func TestEngineExecOutputIsProbe(t *testing.T) {
+	assert.True(t, EngineExecOutput{Probe: "git branch"}.IsProbe())
+	assert.False(t, EngineExecOutput{Command: "git branch", Executable: true}.IsProbe())
+}
+
+// TestEngineExecOutputGetCandidates is a test function for testing the GetCandidates method of the EngineExecOutput type
+func TestEngineExecOutputGetCandidates(t *testing.T) {
+	alternatives := []EngineExecAlternative{{Command: "fd -e go", Explanation: "find with fd"}}
+
+	eo := EngineExecOutput{Command: "find . -name '*.go'", Explanation: "find with find", Executable: true, Alternatives: alternatives}
+	assert.Equal(t, []EngineExecAlternative{{Command: "find . -name '*.go'", Explanation: "find with find"}, alternatives[0]}, eo.GetCandidates())
+	assert.True(t, eo.HasAlternatives())
+
+	assert.False(t, EngineExecOutput{Command: "ls", Executable: true}.HasAlternatives())
+	assert.Empty(t, EngineExecOutput{Explanation: "I cannot", Alternatives: alternatives}.GetCandidates())
+}
+
 // TestEngineChatStreamOutputGetContent is a test function for testing the GetContent method of the EngineChatStreamOutput type
 func TestEngineChatStreamOutputGetContent(t *testing.T) {
 	co := EngineChatStreamOutput{content: "testContent"}
@@ -54,10 +81,199 @@ func TestEngineChatStreamOutputIsInterrupt(t *testing.T) {
 	assert.True(t, result)
 }
 
-// TestEngineChatStreamOutputGetExplanation is a test function for testing the GetExplanation method of the EngineChatStreamOutput type
-func TestEngineChatStreamOutputIsExecutable(t *testing.T) {
-	co := EngineChatStreamOutput{executable: true}
-	result := co.IsExecutable()
+// TestParseEngineExecOutput is a test function for testing the validation of exec answers against the schema
+func TestParseEngineExecOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected *EngineExecOutput
+		err      string
+	}{
+		{
+			name:     "Valid",
+			content:  `{"cmd":"ls ~","exp":"list all files in your home dir","exec":true}`,
+			expected: &EngineExecOutput{Command: "ls ~", Explanation: "list all files in your home dir", Executable: true},
+		},
+		{
+			name:     "CommandWithBraces",
+			content:  `{"cmd":"find . -name '*.tmp' -exec rm {} \\;","exp":"delete all tmp files","exec":true}`,
+			expected: &EngineExecOutput{Command: "find . -name '*.tmp' -exec rm {} \\;", Explanation: "delete all tmp files", Executable: true},
+		},
+		{
+			name:     "AwkProgram",
+			content:  `{"cmd":"awk '{ sum += $1 } END { print sum }' sizes.txt","exp":"sum the first column","exec":true}`,
+			expected: &EngineExecOutput{Command: "awk '{ sum += $1 } END { print sum }' sizes.txt", Explanation: "sum the first column", Executable: true},
+		},
+		{
+			name:     "CodeBlock",
+			content:  "```json\n{\"cmd\":\"ls\",\"exp\":\"list files\",\"exec\":true}\n```",
+			expected: &EngineExecOutput{Command: "ls", Explanation: "list files", Executable: true},
+		},
+		{
+			name:    "PlainText",
+			content: "I cannot do that",
+			err:     "the answer is not a single JSON object",
+		},
+		{
+			name:    "TextAroundJson",
+			content: `Sure! {"cmd":"ls","exp":"list files","exec":true}`,
+			err:     "the answer is not a single JSON object",
+		},
+		{
+			name:    "MissingField",
+			content: `{"cmd":"ls","exec":true}`,
+			err:     "the field exp is missing",
+		},
+		{
+			name:    "WrongType",
+			content: `{"cmd":"ls","exp":"list files","exec":"yes"}`,
+			err:     "the field exec must be a boolean",
+		},
+		{
+			name:    "ExecutableWithoutCommand",
+			content: `{"cmd":" ","exp":"list files","exec":true}`,
+			err:     "the field cmd is empty while exec is true",
+		},
+		{
+			name:    "Plan",
+			content: `{"cmd":"","exp":"build and test","exec":true,"steps":[{"cmd":"go build ./...","exp":"build"},{"cmd":"go test ./...","exp":"test"}]}`,
+			expected: &EngineExecOutput{
+				Explanation: "build and test",
+				Executable:  true,
+				Steps: []EngineExecStep{
+					{Command: "go build ./...", Explanation: "build"},
+					{Command: "go test ./...", Explanation: "test"},
+				},
+			},
+		},
+		{
+			name:    "PlanNotAnArray",
+			content: `{"cmd":"","exp":"build","exec":true,"steps":"go build"}`,
+			err:     "the field steps must be an array of objects",
+		},
+		{
+			name:    "PlanStepWithoutExplanation",
+			content: `{"cmd":"","exp":"build and test","exec":true,"steps":[{"cmd":"go build ./...","exp":"build"},{"cmd":"go test ./..."}]}`,
+			err:     "the field exp of step 2 must be a string",
+		},
+		{
+			name:    "PlanStepWithoutCommand",
+			content: `{"cmd":"","exp":"build","exec":true,"steps":[{"cmd":"","exp":"build"}]}`,
+			err:     "the field cmd of step 1 is empty",
+		},
+		{
+			name:    "Alternatives",
+			content: `{"cmd":"find . -name '*.go'","exp":"with find","exec":true,"alternatives":[{"cmd":"fd -e go","exp":"with fd"},{"cmd":"find .  -name '*.go'","exp":"same"},{"cmd":"fd  -e go","exp":"same"}]}`,
+			expected: &EngineExecOutput{
+				Command:      "find . -name '*.go'",
+				Explanation:  "with find",
+				Executable:   true,
+				Alternatives: []EngineExecAlternative{{Command: "fd -e go", Explanation: "with fd"}},
+			},
+		},
+		{
+			name:    "AlternativeWithoutCommand",
+			content: `{"cmd":"ls","exp":"list files","exec":true,"alternatives":[{"cmd":" ","exp":"nothing"}]}`,
+			err:     "the field cmd of alternative 1 is empty",
+		},
+		{
+			name:     "Probe",
+			content:  `{"probe":" git branch "}`,
+			expected: &EngineExecOutput{Probe: "git branch"},
+		},
+		{
+			name:    "ProbeNotAString",
+			content: `{"probe":["git","branch"]}`,
+			err:     "the field probe must be a string",
+		},
+		{
+			name:    "EmptyProbe",
+			content: `{"probe":""}`,
+			err:     "the field cmd is missing",
+		},
+	}
 
-	assert.True(t, result)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := parseEngineExecOutput(test.content)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, output)
+		})
+	}
+}
+
+// TestParseEngineExplainOutput is a test function for testing the decoding and the validation of the explain answers
+func TestParseEngineExplainOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected *EngineExplainOutput
+		err      string
+	}{
+		{
+			name: "Valid",
+			content: `{"summary":"delete the tmp files","stages":[{"cmd":"find . -name '*.tmp'","exp":"list the tmp files","parts":[{"text":"find","exp":"search files"}]},` +
+				`{"cmd":"xargs rm","exp":"delete them","parts":[{"text":"rm","exp":"remove files","risk":"the files are gone for good"}]}]}`,
+			expected: &EngineExplainOutput{
+				Summary: "delete the tmp files",
+				Stages: []EngineExplainStage{
+					{Command: "find . -name '*.tmp'", Explanation: "list the tmp files", Parts: []EngineExplainPart{{Text: "find", Explanation: "search files"}}},
+					{Command: "xargs rm", Explanation: "delete them", Parts: []EngineExplainPart{{Text: "rm", Explanation: "remove files", Risk: "the files are gone for good"}}},
+				},
+			},
+		},
+		{
+			name:     "CodeBlock",
+			content:  "```json\n{\"summary\":\"list files\",\"stages\":[]}\n```",
+			expected: &EngineExplainOutput{Summary: "list files", Stages: []EngineExplainStage{}},
+		},
+		{
+			name:    "MissingSummary",
+			content: `{"stages":[]}`,
+			err:     "the field summary is missing",
+		},
+		{
+			name:    "StagesNotAnArray",
+			content: `{"summary":"list files","stages":"ls"}`,
+			err:     "the field stages must be an array of objects",
+		},
+		{
+			name:    "PartWithoutExplanation",
+			content: `{"summary":"list files","stages":[{"cmd":"ls -l","exp":"list files","parts":[{"text":"ls","exp":"list"},{"text":"-l"}]}]}`,
+			err:     "the field exp of part 2 of stage 1 must be a string",
+		},
+		{
+			name:    "RiskNotAString",
+			content: `{"summary":"delete","stages":[{"cmd":"rm x","exp":"delete","parts":[{"text":"rm","exp":"remove","risk":true}]}]}`,
+			err:     "the field risk of part 1 of stage 1 must be a string",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := parseEngineExplainOutput(test.content)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, output)
+		})
+	}
+}
+
+// TestEngineExplainOutputIsRisky is a test function for testing the IsRisky methods of the explain output types
+func TestEngineExplainOutputIsRisky(t *testing.T) {
+	safe := EngineExplainStage{Parts: []EngineExplainPart{{Text: "ls"}}}
+	risky := EngineExplainStage{Parts: []EngineExplainPart{{Text: "ls"}, {Text: "rm", Risk: "deletes files"}}}
+
+	assert.False(t, EngineExplainOutput{Stages: []EngineExplainStage{safe}}.IsRisky())
+	assert.True(t, EngineExplainOutput{Stages: []EngineExplainStage{safe, risky}}.IsRisky())
+	assert.False(t, EngineExplainPart{Text: "ls", Risk: " "}.IsRisky())
 }
@@ -0,0 +1,248 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+//a piped input is sent whole in its own message as long as it fits. a larger one, like a big log file,
+//is split in chunks of lines: each chunk is sent with the question of the user, asking for what is
+//relevant to it (map), then the extracts are gathered in a digest (reduce). if the digest is still too
+//large, it is read again the same way. the digest is sent in place of the input, it is made for each
+//question, as a follow-up may be about another part of the input, and reused when a question is asked again.
+//the input is read in chunks of openai_pipe_chunk_tokens tokens, at most openai_pipe_max_chunks of them,
+//so the largest input which can be read is about chunk tokens * max chunks * 4 bytes, around 60MB with
+//the defaults. no more than -pipe-max-size megabytes are read from the standard input
+
+// pipeExtractMaxTokens is the maximum size of what is extracted from each chunk.
+const pipeExtractMaxTokens = 300
+
+// pipeNothingRelevant is the answer of the model when a chunk has nothing relevant to the question.
+const pipeNothingRelevant = "NONE"
+
+// pipeExtractPrompt asks the model for what is relevant to the question in a chunk of the input.
+const pipeExtractPrompt = "You are reading part %d of %d of an input too large to be read at once, to answer a request about it. " +
+	"Extract from this part, as briefly as possible, everything relevant to the request: the lines, values, names, errors and counts it needs, quoted exactly. " +
+	"Do not answer the request itself. If nothing in this part is relevant, reply with " + pipeNothingRelevant + " only."
+
+// pipeExtractInput holds the request and a chunk of the input sent with pipeExtractPrompt.
+const pipeExtractInput = "Request: %s\n\nPart %d of %d of the input:\n%s"
+
+// pipeDigestPrompt introduces the digest of a large input, sent in place of the input itself.
+const pipeDigestPrompt = "I will work on an input too large to be sent whole (%d bytes). It was read in %d parts, " +
+	"here is what was extracted from them about my request %q:\n%s"
+
+// pipeBinarySample is how many bytes of an input are looked at to tell whether it is binary.
+const pipeBinarySample = 8192
+
+// DefaultPipeMaxSize is the size in bytes of the largest piped input, unless set with -pipe-max-size. a
+//larger one is refused without being read whole
+const DefaultPipeMaxSize = 64 << 20
+
+// pipeReadSize is the size of each read of a piped input.
+const pipeReadSize = 64 << 10
+
+// ErrBinaryPipe is returned when the piped input is not text.
+var ErrBinaryPipe = errors.New("the piped input is binary, only text can be sent")
+
+// ErrPipeTooLarge is returned when the piped input is larger than its limit.
+var ErrPipeTooLarge = errors.New("the piped input is too large")
+
+// ReadPipe reads a piped input in chunks, up to limit bytes, 0 meaning no limit. a binary input is refused
+//as soon as its beginning is read, and a larger input as soon as the limit is reached
+func ReadPipe(r io.Reader, limit int64) (string, error) {
+	var input []byte
+	buffer := make([]byte, pipeReadSize)
+	checked := false
+	for {
+		n, err := r.Read(buffer)
+		input = append(input, buffer[:n]...)
+		if limit > 0 && int64(len(input)) > limit {
+			return "", fmt.Errorf("%w, it is over %dMB (-pipe-max-size)", ErrPipeTooLarge, limit>>20)
+		}
+		if !checked && (len(input) >= pipeBinarySample || err == io.EOF) {
+			if IsBinaryInput(input) {
+				return "", ErrBinaryPipe
+			}
+			checked = true
+		}
+		if err == io.EOF {
+			return string(input), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// IsBinaryInput tells whether an input is binary rather than text, looking at its beginning: text has
+//no NUL byte and is valid UTF-8, a rune cut at the end of the sample aside
+func IsBinaryInput(input []byte) bool {
+	if len(input) > pipeBinarySample {
+		input = input[:pipeBinarySample]
+	}
+	if bytes.IndexByte(input, 0) >= 0 {
+		return true
+	}
+
+	for len(input) > 0 {
+		r, size := utf8.DecodeRune(input)
+		if r == utf8.RuneError && size <= 1 {
+			//an incomplete rune can only be at the end of the sample
+			return len(input) >= utf8.UTFMax || utf8.FullRune(input)
+		}
+		input = input[size:]
+	}
+
+	return false
+}
+
+// splitPipeChunks splits the input in chunks of at most the given tokens, cutting at the end of a line
+//whenever a chunk holds more than a single line
+func splitPipeChunks(input string, tokenizer modelTokenizer, tokens int) []string {
+	size := int(float64(tokens) * tokenizer.charsPerToken)
+	if size < 1 {
+		size = 1
+	}
+
+	var chunks []string
+	for input != "" {
+		//the end of the chunk is found in runes, the tokenizer counts characters
+		end, runes := 0, 0
+		for end < len(input) && runes < size {
+			_, width := utf8.DecodeRuneInString(input[end:])
+			end += width
+			runes++
+		}
+		if end < len(input) {
+			if newline := strings.LastIndexByte(input[:end], '\n'); newline > 0 {
+				end = newline + 1
+			}
+		}
+
+		chunks = append(chunks, input[:end])
+		input = input[end:]
+	}
+
+	return chunks
+}
+
+// getPipeChunkTokens returns the tokens of each chunk of a large piped input, half the context budget
+//unless set in the config, so the question and the extract fit along with it
+func (e *Engine) getPipeChunkTokens() int {
+	if tokens := e.config.GetAiConfig().GetPipeChunkTokens(); tokens > 0 {
+		return tokens
+	}
+
+	return e.getContextBudget() / 2
+}
+
+// digestPipe reads a piped input too large to be sent whole in chunks, against the given question, and
+//keeps the digest of it to be sent in its place. it returns how many chunks were read, 0 when the input
+//fits as it is or when the digest made for the same question before is reused
+func (e *Engine) digestPipe(ctx context.Context, question string) (int, error) {
+	tokenizer := getModelTokenizer(e.getModel())
+	tokens := e.getPipeChunkTokens()
+	if e.pipe == "" || tokenizer.countTokens(e.pipe) <= tokens {
+		return 0, nil
+	}
+	if digest, ok := e.pipeDigests[question]; ok {
+		e.pipeDigest = digest
+		return 0, nil
+	}
+	if e.offline {
+		return 0, ErrOffline
+	}
+
+	//the number of chunks is known before anything is sent, an input needing too many is refused
+	chunks := splitPipeChunks(e.pipe, tokenizer, tokens)
+	if max := e.config.GetAiConfig().GetPipeMaxChunks(); max > 0 && len(chunks) > max {
+		return 0, fmt.Errorf(
+			"the piped input is too large: it takes %d chunks of %d tokens, over the limit of %d (openai_pipe_max_chunks), about %d bytes fit",
+			len(chunks),
+			tokens,
+			max,
+			int(float64(tokens*max)*tokenizer.charsPerToken),
+		)
+	}
+
+	defer e.setStatus("")
+	read := 0
+	digest := e.pipe
+	for {
+		extracts, err := e.extractPipeChunks(ctx, question, chunks, read)
+		if err != nil {
+			return 0, e.requestError(ctx, err)
+		}
+		read += len(chunks)
+
+		//the digest is read again as long as it is still too large, it has to get smaller each time
+		previous := digest
+		digest = strings.Join(extracts, "\n\n")
+		if tokenizer.countTokens(digest) <= tokens {
+			break
+		}
+		if len(digest) >= len(previous) {
+			return 0, errors.New("the piped input could not be reduced to fit in the context")
+		}
+		chunks = splitPipeChunks(digest, tokenizer, tokens)
+	}
+	if strings.TrimSpace(digest) == "" {
+		digest = "Nothing relevant was found."
+	}
+
+	e.pipeDigest = fmt.Sprintf(pipeDigestPrompt, len(e.pipe), read, question, digest)
+	if e.pipeDigests == nil {
+		e.pipeDigests = map[string]string{}
+	}
+	e.pipeDigests[question] = e.pipeDigest
+
+	return read, nil
+}
+
+// extractPipeChunks asks the model for what is relevant to the question in each chunk, the chunks with
+//nothing relevant are left out. read is the number of chunks read before, for the progress shown
+func (e *Engine) extractPipeChunks(ctx context.Context, question string, chunks []string, read int) ([]string, error) {
+	var extracts []string
+	for i, chunk := range chunks {
+		e.setStatus(fmt.Sprintf("reading the input, chunk %d/%d", read+i+1, read+len(chunks)))
+
+		request := openai.ChatCompletionRequest{
+			Model:     e.getModel(),
+			MaxTokens: pipeExtractMaxTokens,
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role:    openai.ChatMessageRoleSystem,
+					Content: fmt.Sprintf(pipeExtractPrompt, i+1, len(chunks)),
+				},
+				{
+					Role:    openai.ChatMessageRoleUser,
+					Content: fmt.Sprintf(pipeExtractInput, question, i+1, len(chunks), chunk),
+				},
+			},
+		}
+		resp, err := e.provider.CreateCompletion(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Choices) == 0 {
+			e.recordUsage(request, resp.Usage, "")
+			return nil, errors.New("the answer contains no choice")
+		}
+		extract := strings.TrimSpace(resp.Choices[0].Message.Content)
+		e.recordUsage(request, resp.Usage, extract)
+
+		if extract != "" && extract != pipeNothingRelevant {
+			extracts = append(extracts, fmt.Sprintf("Part %d: %s", i+1, extract))
+		}
+	}
+
+	return extracts, nil
+}
@@ -0,0 +1,186 @@
+package ai
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPipe tests the reading of a piped input too large to be sent whole.
+func TestPipe(t *testing.T) {
+	t.Run("IsBinaryInput", testPipeIsBinaryInput)
+	t.Run("Read", testPipeRead)
+	t.Run("SplitChunks", testPipeSplitChunks)
+	t.Run("Digest", testPipeDigest)
+	t.Run("SmallInput", testPipeSmallInput)
+	t.Run("TooManyChunks", testPipeTooManyChunks)
+}
+
+// newLargePipe returns an input of the given number of lines, the second one holding an error.
+func newLargePipe(lines int) string {
+	var builder strings.Builder
+	for i := 1; i <= lines; i++ {
+		if i == 2 {
+			builder.WriteString("12:00:02 ERROR disk /dev/sda1 is full\n")
+		} else {
+			builder.WriteString("12:00:00 INFO everything is fine\n")
+		}
+	}
+
+	return builder.String()
+}
+
+// testPipeIsBinaryInput checks that text is told apart from binary input.
+func testPipeIsBinaryInput(t *testing.T) {
+	assert.False(t, IsBinaryInput([]byte("hello\nworld\n")))
+	assert.False(t, IsBinaryInput([]byte("héllo wörld")))
+	assert.False(t, IsBinaryInput([]byte{}))
+	assert.True(t, IsBinaryInput([]byte("hello\x00world")))
+	assert.True(t, IsBinaryInput([]byte{0xff, 0xfe, 'a', 'b', 'c', 'd'}))
+
+	//a rune cut by the end of the sample is not a sign of a binary input
+	input := []byte(strings.Repeat("a", pipeBinarySample-1) + "é")
+	assert.False(t, IsBinaryInput(input))
+}
+
+// testPipeRead checks that a piped input is read whole as long as it is text and not larger than the limit.
+func testPipeRead(t *testing.T) {
+	input, err := ReadPipe(strings.NewReader(newLargePipe(3)), DefaultPipeMaxSize)
+	require.NoError(t, err)
+	assert.Equal(t, newLargePipe(3), input)
+
+	//a binary input is refused once its beginning is read, without reading the rest
+	binary := strings.NewReader(strings.Repeat("\x00", pipeBinarySample))
+	_, err = ReadPipe(io.MultiReader(binary, failingReader{}), DefaultPipeMaxSize)
+	assert.ErrorIs(t, err, ErrBinaryPipe)
+
+	_, err = ReadPipe(strings.NewReader(strings.Repeat("a", 1<<20+1)), 1<<20)
+	assert.ErrorIs(t, err, ErrPipeTooLarge)
+	assert.EqualError(t, err, "the piped input is too large, it is over 1MB (-pipe-max-size)")
+	input, err = ReadPipe(strings.NewReader(strings.Repeat("a", 1<<20+1)), 0)
+	require.NoError(t, err, "0 should mean no limit.")
+	assert.Len(t, input, 1<<20+1)
+
+	_, err = ReadPipe(io.MultiReader(strings.NewReader(newLargePipe(3)), failingReader{}), DefaultPipeMaxSize)
+	assert.EqualError(t, err, "read failed")
+}
+
+// failingReader is a reader which always fails.
+type failingReader struct{}
+
+// Read fails.
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+// testPipeSplitChunks checks that the chunks are cut at the end of the lines and hold the whole input.
+func testPipeSplitChunks(t *testing.T) {
+	tokenizer := modelTokenizer{charsPerToken: 4}
+	input := newLargePipe(10)
+
+	chunks := splitPipeChunks(input, tokenizer, 20)
+	require.Len(t, chunks, 5)
+	for _, chunk := range chunks {
+		assert.True(t, strings.HasSuffix(chunk, "\n"))
+		assert.LessOrEqual(t, tokenizer.countTokens(chunk), 20)
+	}
+	assert.Equal(t, input, strings.Join(chunks, ""))
+
+	//a line longer than a chunk is cut wherever it has to
+	chunks = splitPipeChunks(strings.Repeat("é", 10), tokenizer, 1)
+	assert.Equal(t, []string{"éééé", "éééé", "éé"}, chunks)
+}
+
+// testPipeDigest checks that a large input is read in chunks against the question, and that the digest is
+//sent in its place
+func testPipeDigest(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests,
+		pipeNothingRelevant,
+		"12:00:02 ERROR disk /dev/sda1 is full",
+		pipeNothingRelevant,
+		`{"cmd":"df -h /dev/sda1","exp":"show the space left on the disk","exec":true}`,
+		pipeNothingRelevant,
+		"12:00:02 ERROR disk /dev/sda1 is full",
+		pipeNothingRelevant,
+		`{"cmd":"df -h /dev/sda1","exp":"show the space left on the disk","exec":true}`,
+	)
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{
+		"OPENAI_BASE_URL":          server.URL,
+		"OPENAI_PIPE_CHUNK_TOKENS": 20,
+	}))
+	require.NoError(t, err)
+	pipe := newLargePipe(6)
+	engine.SetPipe(pipe)
+
+	output, err := engine.ExecCompletion("why does my app crash?")
+	require.NoError(t, err)
+	assert.Equal(t, "df -h /dev/sda1", output.GetCommand())
+	assert.Equal(t, 3, output.GetPipeChunks())
+
+	require.Len(t, requests, 4)
+	for i, request := range requests[:3] {
+		assert.False(t, request.Stream)
+		assert.Contains(t, request.Messages[1].Content, "Request: why does my app crash?")
+		assert.Contains(t, request.Messages[1].Content, splitPipeChunks(pipe, getModelTokenizer("test_model"), 20)[i])
+	}
+	digest := requests[3].Messages[1].Content
+	assert.Contains(t, digest, "It was read in 3 parts")
+	assert.Contains(t, digest, "Part 2: 12:00:02 ERROR disk /dev/sda1 is full")
+	assert.NotContains(t, digest, "INFO")
+
+	//a follow-up may be about another part of the input, it gets its own digest
+	output, err = engine.ExecCompletion("and how do I free some space?")
+	require.NoError(t, err)
+	assert.Equal(t, 3, output.GetPipeChunks())
+	require.Len(t, requests, 8)
+	assert.Contains(t, requests[4].Messages[1].Content, "Request: and how do I free some space?")
+	assert.Contains(t, requests[7].Messages[1].Content, `my request "and how do I free some space?"`)
+
+	//the digest of a question asked again is reused, the input is not read again
+	output, err = engine.ExecCompletion("why does my app crash?")
+	require.NoError(t, err)
+	assert.Zero(t, output.GetPipeChunks())
+	require.Len(t, requests, 9)
+	assert.Contains(t, requests[8].Messages[1].Content, "Part 2: 12:00:02 ERROR disk /dev/sda1 is full")
+	assert.Contains(t, requests[8].Messages[1].Content, `my request "why does my app crash?"`)
+}
+
+// testPipeSmallInput checks that an input which fits is sent whole.
+func testPipeSmallInput(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, `{"cmd":"ls","exp":"list files","exec":true}`)
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL}))
+	require.NoError(t, err)
+	engine.SetPipe(newLargePipe(2))
+
+	output, err := engine.ExecCompletion("why does my app crash?")
+	require.NoError(t, err)
+	assert.Zero(t, output.GetPipeChunks())
+	require.Len(t, requests, 1)
+	assert.Contains(t, requests[0].Messages[1].Content, newLargePipe(2))
+}
+
+// testPipeTooManyChunks checks that an input needing more chunks than allowed is refused before anything is sent.
+func testPipeTooManyChunks(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, pipeNothingRelevant)
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{
+		"OPENAI_BASE_URL":          server.URL,
+		"OPENAI_PIPE_CHUNK_TOKENS": 20,
+		"OPENAI_PIPE_MAX_CHUNKS":   2,
+	}))
+	require.NoError(t, err)
+	engine.SetPipe(newLargePipe(6))
+
+	_, err = engine.ExecCompletion("why does my app crash?")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "takes 3 chunks of 20 tokens, over the limit of 2")
+	assert.Contains(t, err.Error(), "about 160 bytes fit")
+	assert.Empty(t, requests)
+}
@@ -0,0 +1,334 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/akhilsharma90/terminal-assistant/run"
+)
+
+//the exec mode can investigate before proposing a command: instead of its answer, the model can reply
+//{"probe": "git branch"} to run a read-only command and read its output, so it doesn't have to guess
+//file names, branches or container ids. only the commands of the allow list below are run, without a
+//shell, and the probes are bounded in number, in time and in output
+
+// defaultProbeTimeout is the time allowed for each probe when the config doesn't set it.
+const defaultProbeTimeout = 5 * time.Second
+
+// probeOutputLimit is the number of bytes of the output of a probe sent to the model, the probe is
+//stopped once it wrote that much, which keeps cat from sending a whole log file
+const probeOutputLimit = 4096
+
+// probeForbiddenCharacters is the shell syntax a probe can't contain, the probes are not run by a shell.
+const probeForbiddenCharacters = "|&;<>()$`\\\"'*?[]{}~!#\n"
+
+// probeAllowList describes the allowed probes to the model, in the prompt and when a probe is rejected.
+const probeAllowList = "ls, cat, head, wc, file, which, pwd, uname, git status, git branch, git remote, git log, " +
+	"git diff, git rev-parse, docker ps, docker images, and the version of a known program like go --version. " +
+	"cat, head, file and git only read the files under the working directory which are not hidden and don't hold secrets, " +
+	"given by relative paths"
+
+// probeLimitPrompt asks the model for its answer once it used all its probes.
+const probeLimitPrompt = "No more probes are allowed, reply now with your final answer."
+
+// probeCommands are the programs which can be probed with any arguments, but the flags refused by
+//probeCommandFlags and the files refused by probeReadingCommands
+var probeCommands = map[string]bool{
+	"ls":    true,
+	"cat":   true,
+	"head":  true,
+	"wc":    true,
+	"file":  true,
+	"which": true,
+	"pwd":   true,
+	"uname": true,
+}
+
+// probeReadingCommands are the probes reading the files given as arguments, they can only read the files
+//under the working directory which are neither hidden nor known to hold secrets
+var probeReadingCommands = map[string]bool{
+	"cat":  true,
+	"head": true,
+	"file": true,
+}
+
+// probeCommandFlags are the only flags allowed to some of the programs of probeCommands, the other flags
+//of file would compile a magic file (-C) or read the names of the files from another one (-f)
+var probeCommandFlags = map[string][]string{
+	"file": {"-b", "--brief", "-i", "--mime", "--mime-type", "--mime-encoding", "-L", "--dereference"},
+}
+
+// probeSecretFiles are the patterns of the names of the files known to hold secrets.
+var probeSecretFiles = []string{"id_*", "*.pem", "*.key", "*.p12", "*.pfx", "*.kdbx", "credentials*", "secrets.*"}
+
+// probeVersionCommands are the programs which can be asked for their version, with --version as their
+//only argument. a program can do anything with its arguments, so only the known ones are run
+var probeVersionCommands = map[string]bool{
+	"bash":      true,
+	"cargo":     true,
+	"cmake":     true,
+	"curl":      true,
+	"docker":    true,
+	"gcc":       true,
+	"git":       true,
+	"go":        true,
+	"gradle":    true,
+	"helm":      true,
+	"kubectl":   true,
+	"make":      true,
+	"mvn":       true,
+	"node":      true,
+	"npm":       true,
+	"pip":       true,
+	"pip3":      true,
+	"python":    true,
+	"python3":   true,
+	"ruby":      true,
+	"rustc":     true,
+	"terraform": true,
+	"yarn":      true,
+}
+
+// probeSubcommands are the programs which can only be probed with some subcommands, with the arguments
+//each subcommand accepts. nil accepts any flag but the forbidden ones, see probeForbiddenFlags, and the
+//files under the working directory given by relative paths
+var probeSubcommands = map[string]map[string][]string{
+	"git": {
+		"status":    nil,
+		"log":       nil,
+		"diff":      nil,
+		"rev-parse": nil,
+		"branch":    {"-a", "-r", "-v", "-vv", "--all", "--remotes", "--list", "--show-current"},
+		"remote":    {"-v"},
+	},
+	"docker": {
+		"ps":     nil,
+		"images": nil,
+	},
+}
+
+// probeForbiddenFlags are the flags of the allowed subcommands which would write a file (--output), read
+//one outside the repository (--no-index, -O) or run another program (--ext-diff).
+var probeForbiddenFlags = []string{"--output", "--no-index", "--ext-diff", "-O"}
+
+// parseProbe splits a probe into its program and its arguments, and checks it is allowed.
+func parseProbe(probe string) ([]string, error) {
+	if strings.ContainsAny(probe, probeForbiddenCharacters) {
+		return nil, errors.New("shell syntax is not supported")
+	}
+	args := strings.Fields(probe)
+	if len(args) == 0 {
+		return nil, errors.New("the probe is empty")
+	}
+
+	//asking a known program for its version doesn't change anything
+	if len(args) == 2 && args[1] == "--version" {
+		if err := checkVersionProbe(args[0]); err != nil {
+			return nil, err
+		}
+		return args, nil
+	}
+	if probeCommands[args[0]] {
+		if flags, ok := probeCommandFlags[args[0]]; ok {
+			for _, arg := range args[1:] {
+				if strings.HasPrefix(arg, "-") && !isProbeArgumentAllowed(arg, flags) {
+					return nil, fmt.Errorf("the argument %s of %s is not allowed", arg, args[0])
+				}
+			}
+		}
+		if probeReadingCommands[args[0]] {
+			if err := checkProbePaths(args[1:], false); err != nil {
+				return nil, fmt.Errorf("%s can't read %w", args[0], err)
+			}
+		}
+		return args, nil
+	}
+
+	subcommands, ok := probeSubcommands[args[0]]
+	if !ok {
+		return nil, fmt.Errorf("%s is not an allowed probe", args[0])
+	}
+	if len(args) < 2 {
+		return nil, fmt.Errorf("%s needs a subcommand", args[0])
+	}
+	allowed, ok := subcommands[args[1]]
+	if !ok {
+		return nil, fmt.Errorf("%s %s is not an allowed probe", args[0], args[1])
+	}
+	for _, arg := range args[2:] {
+		if !isProbeArgumentAllowed(arg, allowed) {
+			return nil, fmt.Errorf("the argument %s of %s %s is not allowed", arg, args[0], args[1])
+		}
+	}
+	//the arguments which are not flags may be files, like the paths given to git diff or git log
+	if allowed == nil {
+		if err := checkProbePaths(args[2:], true); err != nil {
+			return nil, fmt.Errorf("%s %s can't read %w", args[0], args[1], err)
+		}
+	}
+
+	return args, nil
+}
+
+// checkProbePaths checks the arguments of a probe which are not flags with checkProbePath, relative
+//refuses the absolute paths and the ones going up with ..
+func checkProbePaths(args []string, relative bool) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if relative && (filepath.IsAbs(arg) || isParentPath(arg)) {
+			return fmt.Errorf("%s, only relative paths under the working directory are allowed", arg)
+		}
+		if err := checkProbePath(dir, arg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isParentPath tells if one of the elements of the path is .., which goes up a directory.
+func isParentPath(path string) bool {
+	for _, name := range strings.Split(filepath.ToSlash(path), "/") {
+		if name == ".." {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkVersionProbe checks that the program asked for its version is a known one, given by its name and
+//found in the PATH, and not a path to any program
+func checkVersionProbe(program string) error {
+	if strings.Contains(program, "/") {
+		return fmt.Errorf("%s --version is not allowed, the program must be given by its name", program)
+	}
+	if !probeVersionCommands[program] {
+		return fmt.Errorf("%s --version is not an allowed probe", program)
+	}
+	if _, err := exec.LookPath(program); err != nil {
+		return fmt.Errorf("%s is not found in the PATH", program)
+	}
+
+	return nil
+}
+
+// checkProbePath checks that a file read by a probe is under the directory, and is neither hidden nor known
+//to hold secrets. a symbolic link is checked where it leads, that is the file which would be read
+func checkProbePath(dir string, path string) error {
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	target := path
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(dir, target)
+	}
+	if resolved, err := filepath.EvalSymlinks(target); err == nil {
+		target = resolved
+	}
+
+	relative, err := filepath.Rel(dir, filepath.Clean(target))
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s, it is outside the working directory", path)
+	}
+	for _, name := range strings.Split(relative, string(filepath.Separator)) {
+		if strings.HasPrefix(name, ".") && name != "." {
+			return fmt.Errorf("%s, it is a hidden file", path)
+		}
+	}
+	for _, pattern := range probeSecretFiles {
+		if matched, _ := filepath.Match(pattern, filepath.Base(relative)); matched {
+			return fmt.Errorf("%s, it may hold secrets", path)
+		}
+	}
+
+	return nil
+}
+
+// isProbeArgumentAllowed tells if the argument of a subcommand is allowed, nil allowing any argument
+//but the forbidden flags.
+func isProbeArgumentAllowed(arg string, allowed []string) bool {
+	if allowed == nil {
+		for _, flag := range probeForbiddenFlags {
+			if strings.HasPrefix(arg, flag) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, value := range allowed {
+		if arg == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getMaxProbes returns how many probes the model can run before answering.
+func (e *Engine) getMaxProbes() int {
+	if max := e.config.GetAiConfig().GetMaxProbes(); max > 0 {
+		return max
+	}
+
+	return 0
+}
+
+// getProbeTimeout returns the time allowed for each probe.
+func (e *Engine) getProbeTimeout() time.Duration {
+	if timeout := e.config.GetAiConfig().GetProbeTimeout(); timeout > 0 {
+		return timeout
+	}
+
+	return defaultProbeTimeout
+}
+
+// runProbe runs a probe asked by the model, and returns it along with the message telling its outcome
+//to the model. a probe which is not allowed is not run, the model is told which ones are
+func (e *Engine) runProbe(ctx context.Context, command string) (EngineProbe, string) {
+	probe := EngineProbe{command: command}
+
+	args, err := parseProbe(command)
+	if err != nil {
+		probe.err = err
+		return probe, fmt.Sprintf("The probe `%s` was not run: %s. Only these read-only commands are allowed: %s.", command, err, probeAllowList)
+	}
+
+	e.setStatus(fmt.Sprintf("probing `%s`", command))
+	defer e.setStatus("")
+
+	probeCtx, cancel := context.WithTimeout(ctx, e.getProbeTimeout())
+	defer cancel()
+
+	output, truncated, err := run.RunBoundedCommand(probeCtx, probeOutputLimit, args[0], args[1:]...)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", e.getProbeTimeout())
+	}
+	probe.output = output
+	probe.err = err
+
+	if strings.TrimSpace(output) == "" {
+		output = "(no output)"
+	}
+	if truncated {
+		output += "\n[truncated]"
+	}
+	if err != nil {
+		return probe, fmt.Sprintf("The probe `%s` failed: %s\n%s", command, err, output)
+	}
+
+	return probe, fmt.Sprintf("Output of the probe `%s`:\n%s", command, output)
+}
@@ -0,0 +1,182 @@
+package ai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProbe tests the read-only probes the exec mode can run before answering.
+func TestProbe(t *testing.T) {
+	t.Run("Parse", testProbeParse)
+	t.Run("Path", testProbePath)
+	t.Run("Investigate", testProbeInvestigate)
+	t.Run("Rejected", testProbeRejected)
+	t.Run("Limit", testProbeLimit)
+	t.Run("Prompt", testProbePrompt)
+}
+
+// testProbeParse checks which probes are allowed.
+func testProbeParse(t *testing.T) {
+	allowed := []string{
+		"ls -la",
+		"cat go.mod",
+		"head -n 5 probe.go",
+		"which docker",
+		"go --version",
+		"git status --short",
+		"git branch -a",
+		"git log --oneline -n 5",
+		"docker ps -a",
+		"file -b go.mod",
+		"git diff -- probe.go",
+		"git log --oneline main..HEAD",
+	}
+	for _, probe := range allowed {
+		_, err := parseProbe(probe)
+		assert.NoError(t, err, probe)
+	}
+
+	rejected := map[string]string{
+		"":                         "the probe is empty",
+		"rm -rf build":             "rm is not an allowed probe",
+		"ls | grep go":             "shell syntax is not supported",
+		"cat $HOME/.ssh/id_rsa":    "shell syntax is not supported",
+		"git checkout main":        "git checkout is not an allowed probe",
+		"git branch new-feature":   "the argument new-feature of git branch is not allowed",
+		"git log --output=log.txt": "the argument --output=log.txt of git log is not allowed",
+		"docker":                   "docker needs a subcommand",
+		"go version --help":        "go is not an allowed probe",
+		"rm --version":             "rm --version is not an allowed probe",
+		"./build.sh --version":     "./build.sh --version is not allowed, the program must be given by its name",
+		"/usr/bin/go --version":    "/usr/bin/go --version is not allowed, the program must be given by its name",
+		"cat /etc/passwd":          "cat can't read /etc/passwd, it is outside the working directory",
+		"head -n 5 ../.env":        "head can't read ../.env, it is outside the working directory",
+		"cat .env":                 "cat can't read .env, it is a hidden file",
+		"cat certs/server.pem":     "cat can't read certs/server.pem, it may hold secrets",
+
+		"git diff --no-index /home/user/.ssh/id_rsa /dev/null": "the argument --no-index of git diff is not allowed",
+		"git diff --ext-diff":               "the argument --ext-diff of git diff is not allowed",
+		"git diff -O/etc/passwd":            "the argument -O/etc/passwd of git diff is not allowed",
+		"git diff --output-indicator-new=x": "the argument --output-indicator-new=x of git diff is not allowed",
+		"git diff /etc/passwd":              "git diff can't read /etc/passwd, only relative paths under the working directory are allowed",
+		"git log -p -- ../secrets.txt":      "git log can't read ../secrets.txt, only relative paths under the working directory are allowed",
+		"git log -- .env":                   "git log can't read .env, it is a hidden file",
+		"file -C -m magic":                  "the argument -C of file is not allowed",
+		"file -f names.txt":                 "the argument -f of file is not allowed",
+		"file /etc/shadow":                  "file can't read /etc/shadow, it is outside the working directory",
+		"file id_rsa":                       "file can't read id_rsa, it may hold secrets",
+	}
+	for probe, message := range rejected {
+		_, err := parseProbe(probe)
+		assert.EqualError(t, err, message, probe)
+	}
+}
+
+// testProbePath checks the files the probes can read, a symbolic link being checked where it leads.
+func testProbePath(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "logs"), 0755))
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "outside")))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "logs"), filepath.Join(dir, "current")))
+
+	assert.NoError(t, checkProbePath(dir, "logs/app.log"))
+	assert.NoError(t, checkProbePath(dir, filepath.Join(dir, "logs", "app.log")))
+	assert.NoError(t, checkProbePath(dir, "current"))
+	assert.EqualError(t, checkProbePath(dir, "outside"), "outside, it is outside the working directory")
+	assert.EqualError(t, checkProbePath(dir, "logs/../../x"), "logs/../../x, it is outside the working directory")
+	assert.EqualError(t, checkProbePath(dir, "logs/.git/config"), "logs/.git/config, it is a hidden file")
+	assert.EqualError(t, checkProbePath(dir, "id_rsa.pub"), "id_rsa.pub, it may hold secrets")
+	assert.EqualError(t, checkProbePath(dir, "aws/credentials"), "aws/credentials, it may hold secrets")
+}
+
+// testProbeInvestigate checks that the output of a probe is sent to the model before it answers.
+func testProbeInvestigate(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests,
+		`{"probe":"ls probe_test.go"}`,
+		`{"cmd":"cat probe_test.go","exp":"show the test","exec":true}`,
+	)
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{
+		"OPENAI_BASE_URL":   server.URL,
+		"OPENAI_MAX_PROBES": 3,
+	}))
+	require.NoError(t, err)
+
+	output, err := engine.ExecCompletion("show the test of the probes")
+	require.NoError(t, err)
+	assert.Equal(t, "cat probe_test.go", output.GetCommand())
+
+	require.Len(t, output.GetProbes(), 1)
+	assert.Equal(t, "ls probe_test.go", output.GetProbes()[0].GetCommand())
+	assert.Equal(t, "probe_test.go\n", output.GetProbes()[0].GetOutput())
+	assert.NoError(t, output.GetProbes()[0].GetError())
+
+	//the probe and its output are sent with the second request and kept in the history
+	require.Len(t, requests, 2)
+	messages := requests[1].Messages
+	assert.Equal(t, `{"probe":"ls probe_test.go"}`, messages[len(messages)-2].Content)
+	assert.Equal(t, "Output of the probe `ls probe_test.go`:\nprobe_test.go\n", messages[len(messages)-1].Content)
+	assert.Len(t, engine.execMessages, 4)
+}
+
+// testProbeRejected checks that a probe which is not allowed is not run, and the model is told why.
+func testProbeRejected(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests,
+		`{"probe":"rm -rf build"}`,
+		`{"cmd":"","exp":"I cannot check the build directory","exec":false}`,
+	)
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{
+		"OPENAI_BASE_URL":   server.URL,
+		"OPENAI_MAX_PROBES": 3,
+	}))
+	require.NoError(t, err)
+
+	output, err := engine.ExecCompletion("clean the build")
+	require.NoError(t, err)
+
+	require.Len(t, output.GetProbes(), 1)
+	assert.EqualError(t, output.GetProbes()[0].GetError(), "rm is not an allowed probe")
+	require.Len(t, requests, 2)
+	messages := requests[1].Messages
+	assert.Contains(t, messages[len(messages)-1].Content, "The probe `rm -rf build` was not run: rm is not an allowed probe.")
+}
+
+// testProbeLimit checks that the model is asked for its answer once it used all its probes.
+func testProbeLimit(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, `{"probe":"pwd"}`)
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{
+		"OPENAI_BASE_URL":   server.URL,
+		"OPENAI_MAX_PROBES": 2,
+	}))
+	require.NoError(t, err)
+
+	output, err := engine.ExecCompletion("where am I")
+	require.NoError(t, err)
+	assert.False(t, output.IsExecutable())
+	assert.Equal(t, "No answer was given after 2 probes.", output.GetExplanation())
+	assert.Len(t, output.GetProbes(), 2)
+
+	//two probes, then the request asking for the answer
+	require.Len(t, requests, 4)
+	messages := requests[3].Messages
+	assert.Equal(t, probeLimitPrompt, messages[len(messages)-1].Content)
+}
+
+// testProbePrompt checks that the probes are only described to the model when they are enabled.
+func testProbePrompt(t *testing.T) {
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_MAX_PROBES": 3}))
+	require.NoError(t, err)
+	assert.Contains(t, engine.GetSystemPrompt(), "You can run at most 3 probes.")
+
+	engine, err = NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{}))
+	require.NoError(t, err)
+	assert.NotContains(t, engine.GetSystemPrompt(), "probe")
+}
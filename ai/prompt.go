@@ -0,0 +1,238 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/akhilsharma90/terminal-assistant/system"
+)
+
+//the system prompt is made of the part of the mode (exec, chat or explain) and of the context part. each part
+//is a text/template, the built-in ones below are used unless a template file with the same name is
+//found in the prompts directory, like ~/.config/terminal-assistant/exec.tmpl
+
+// Names of the prompt templates, the files of the prompts directory are named after them with a .tmpl extension
+const (
+	ExecPromptTemplate    = "exec"
+	ChatPromptTemplate    = "chat"
+	ExplainPromptTemplate = "explain"
+	ContextPromptTemplate = "context"
+)
+
+// defaultExecPrompt is the built-in template of the exec part.
+//preparing chat gpt to operate in command execution mode by giving it a long prompt
+//and setting the context, we want it to generate commands and run them
+const defaultExecPrompt = "You are terminal-assistant, a powerful terminal assistant generating a JSON containing a command line for my input.\n" +
+	"You will always reply using the following json structure: {\"cmd\":\"the command\", \"exp\": \"some explanation\", \"exec\": true}.\n" +
+	"Your answer will always only contain the json structure, never add any advice or supplementary detail or information, even if I asked the same question before.\n" +
+	"The field cmd will contain a single line command (don't use new lines, use separators like && and ; instead).\n" +
+	"The field exp will contain an short explanation of the command if you managed to generate an executable command, otherwise it will contain the reason of your failure.\n" +
+	"The field exec will contain true if you managed to generate an executable command, false otherwise.\n" +
+	"When the task needs several commands that are better reviewed one at a time, leave the field cmd empty and add a field steps containing the ordered list of commands, each one as {\"cmd\":\"the command\", \"exp\": \"some explanation\"}." +
+	"\n" +
+	"Examples:\n" +
+	"Me: list all files in my home dir\n" +
+	"terminal-assistant: {\"cmd\":\"ls ~\", \"exp\": \"list all files in your home dir\", \"exec\": true}\n" +
+	"Me: list all pods of all docker images\n" +
+	"terminal-assistant: {\"cmd\":\"docker image ls\", \"exp\": \"list of all images from your docker instance\", \"exec\": true}\n" +
+	"Me: create a go module named demo and run its tests\n" +
+	"terminal-assistant: {\"cmd\":\"\", \"exp\": \"create the demo module and run its tests\", \"exec\": true, \"steps\": [{\"cmd\":\"mkdir demo\", \"exp\": \"create the module dir\"}, {\"cmd\":\"cd demo && go mod init demo\", \"exp\": \"initialise the module\"}, {\"cmd\":\"cd demo && go test ./...\", \"exp\": \"run the tests\"}]}\n" +
+	"Me: how are you ?\n" +
+	"terminal-assistant: {\"cmd\":\"\", \"exp\": \"I'm good thanks but I cannot generate a command for this. Use the chat mode to discuss.\", \"exec\": false}" +
+	"{{ if gt .Alternatives 1 }}\n" +
+	"When the task can be done in several good ways, like with find or fd, sed or awk, add a field alternatives containing the other commands, " +
+	"each one as {\"cmd\":\"the command\", \"exp\": \"some explanation\"}, with at most {{ .Alternatives }} commands counting the one of the field cmd. " +
+	"Never repeat the same command, and leave alternatives out when there is only one sensible way.\n" +
+	"Me: find the go files changed today\n" +
+	"terminal-assistant: {\"cmd\":\"find . -name '*.go' -mtime -1\", \"exp\": \"find the go files modified in the last 24 hours\", \"exec\": true, " +
+	"\"alternatives\": [{\"cmd\":\"fd -e go --changed-within 1d\", \"exp\": \"same with fd, which skips the ignored files\"}]}{{ end }}" +
+	"{{ if .Probes }}\n" +
+	"When you need to know something about my system to generate the command, like a file name, a branch or a container id, " +
+	"don't guess it: reply only {\"probe\": \"the command\"} with a single read-only command among " + probeAllowList + ". " +
+	"I will reply with its output, then you can probe again or give your answer. You can run at most {{ .Probes }} probes.\n" +
+	"Me: switch to the branch about the login page\n" +
+	"terminal-assistant: {\"probe\": \"git branch\"}{{ end }}"
+
+// defaultChatPrompt is the built-in template of the chat part.
+//preparing chat gpt for the chat mode to help as an assistant by replying to question
+//in this mode, we want it to just reply and not generate or execute any commands
+const defaultChatPrompt = "You are a powerful terminal assistant.\n" +
+	"You will answer in the most helpful possible way.\n" +
+	"Always format your answer in markdown format.\n\n" +
+	"For example:\n" +
+	"Me: What is 2+2 ?\n" +
+	"terminal-assistant: The answer for `2+2` is `4`\n" +
+	"Me: +2 again ?\n" +
+	"terminal-assistant: The answer is `6`\n"
+
+// defaultExplainPrompt is the built-in template of the explain part.
+//the other direction of the exec mode: a command or a script is given, and it is broken down into its
+//pipeline stages, then each stage into its program, flags and arguments, flagging the risky parts
+const defaultExplainPrompt = "You are terminal-assistant, a powerful terminal assistant explaining the command line or the script I give you.\n" +
+	"You will always reply using the following json structure: " +
+	"{\"summary\": \"what it does as a whole\", \"stages\": [{\"cmd\": \"the stage\", \"exp\": \"what the stage does\", " +
+	"\"parts\": [{\"text\": \"a part of the stage\", \"exp\": \"what the part does\", \"risk\": \"why the part is risky\"}]}]}.\n" +
+	"Your answer will always only contain the json structure, never add any advice or supplementary detail or information.\n" +
+	"The field stages will contain the stages of the pipeline in order, split on |, &&, || and ;. For a script, each stage is a command or a block of the script.\n" +
+	"The field parts of a stage will contain the program, then each flag with its value and each argument, copied exactly as they are written in the stage.\n" +
+	"The field risk will only be present for the parts that can destroy or expose data, need root privileges, run code downloaded from the network, or can't be undone.\n" +
+	"\n" +
+	"Examples:\n" +
+	"Me: find . -name '*.tmp' | xargs rm -f\n" +
+	"terminal-assistant: {\"summary\": \"delete all the .tmp files under the current directory\", \"stages\": [" +
+	"{\"cmd\": \"find . -name '*.tmp'\", \"exp\": \"list the .tmp files\", \"parts\": [{\"text\": \"find\", \"exp\": \"search for files in a directory tree\"}, " +
+	"{\"text\": \".\", \"exp\": \"start from the current directory\"}, {\"text\": \"-name '*.tmp'\", \"exp\": \"only the files whose name ends with .tmp\"}]}, " +
+	"{\"cmd\": \"xargs rm -f\", \"exp\": \"delete each listed file\", \"parts\": [{\"text\": \"xargs\", \"exp\": \"run a command with the lines read as arguments\"}, " +
+	"{\"text\": \"rm\", \"exp\": \"remove files\", \"risk\": \"the files are deleted for good\"}, {\"text\": \"-f\", \"exp\": \"never ask for a confirmation\", \"risk\": \"nothing is asked before deleting\"}]}]}"
+
+// defaultContextPrompt is the built-in template of the context part.
+//values such as operating system, distribution, home directory and shell will be sent as prompt to
+//open ai so that the commands it creates for us will be easily executable and will be relevant to us
+const defaultContextPrompt = "My context: " +
+	"{{ if .OperatingSystem }}my operating system is {{ .OperatingSystem }}, {{ end }}" +
+	"{{ if .Distribution }}my distribution is {{ .Distribution }}, {{ end }}" +
+	"{{ if .HomeDirectory }}my home directory is {{ .HomeDirectory }}, {{ end }}" +
+	"{{ if .Shell }}my shell is {{ .Shell }}, {{ end }}" +
+	"{{ if .Editor }}my editor is {{ .Editor }}, {{ end }}" +
+	"take this into account. " +
+	"{{ if .Preferences }}Also, {{ .Preferences }}.{{ end }}"
+
+// defaultPrompts maps the name of each template to its built-in text.
+var defaultPrompts = map[string]string{
+	ExecPromptTemplate:    defaultExecPrompt,
+	ChatPromptTemplate:    defaultChatPrompt,
+	ExplainPromptTemplate: defaultExplainPrompt,
+	ContextPromptTemplate: defaultContextPrompt,
+}
+
+// PromptData is what the prompt templates can use.
+type PromptData struct {
+	Mode            string           // Mode of the engine, exec, chat or explain
+	System          *system.Analysis // The whole system analysis, its getters can be called like {{ .System.GetUsername }}
+	OperatingSystem string           // Operating system, empty when unknown
+	Distribution    string           // Distribution of the operating system
+	HomeDirectory   string           // Home directory of the user
+	Username        string           // Name of the user
+	Shell           string           // Shell of the user
+	Editor          string           // Editor of the user
+	Preferences     string           // Preferences of the user config
+	Cwd             string           // Current working directory
+	Date            string           // Current date, like 2006-01-02
+	Now             time.Time        // Current time, for other formats like {{ .Now.Format "15:04" }}
+	Pipe            PipeData         // What was piped in
+	Probes          int              // Read-only probes the model can run before answering, 0 when disabled
+	Alternatives    int              // Candidate commands the model can propose, 1 or less when only one
+}
+
+// PipeData describes what was piped in, its content is sent in its own message.
+type PipeData struct {
+	Present bool // Indicates if something was piped in
+	Size    int  // Size in bytes
+	Lines   int  // Number of lines
+}
+
+// loadPromptTemplates parses the templates of the given directory, the built-in templates are used
+//for the missing files. an empty directory means only the built-in templates are used
+func loadPromptTemplates(dir string) (map[string]*template.Template, error) {
+	templates := map[string]*template.Template{}
+	for name, text := range defaultPrompts {
+		if dir != "" {
+			content, err := os.ReadFile(filepath.Join(dir, name+".tmpl"))
+			if err == nil {
+				text = string(content)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+
+		parsed, err := template.New(name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s prompt template: %w", name, err)
+		}
+		templates[name] = parsed
+	}
+
+	return templates, nil
+}
+
+// preparePromptData gathers what the prompt templates can use.
+func (e *Engine) preparePromptData() PromptData {
+	analysis := e.config.GetSystemConfig()
+	now := time.Now()
+	cwd, _ := os.Getwd()
+
+	data := PromptData{
+		Mode:          e.mode.String(),
+		System:        analysis,
+		Distribution:  analysis.GetDistribution(),
+		HomeDirectory: analysis.GetHomeDirectory(),
+		Username:      analysis.GetUsername(),
+		Shell:         analysis.GetShell(),
+		Editor:        analysis.GetEditor(),
+		Preferences:   e.config.GetUserConfig().GetPreferences(),
+		Cwd:           cwd,
+		Date:          now.Format("2006-01-02"),
+		Now:           now,
+		Pipe: PipeData{
+			Present: e.pipe != "",
+			Size:    len(e.pipe),
+		},
+		Probes:       e.getMaxProbes(),
+		Alternatives: e.getMaxAlternatives(),
+	}
+	if analysis.GetOperatingSystem() != system.UnknownOperatingSystem {
+		data.OperatingSystem = analysis.GetOperatingSystem().String()
+	}
+	if e.pipe != "" {
+		data.Pipe.Lines = strings.Count(e.pipe, "\n") + 1
+	}
+
+	return data
+}
+
+// renderPrompt renders the prompt template of the given name.
+func (e *Engine) renderPrompt(name string) (string, error) {
+	var prompt strings.Builder
+	if err := e.prompts[name].Execute(&prompt, e.preparePromptData()); err != nil {
+		return "", fmt.Errorf("cannot render the %s prompt template: %w", name, err)
+	}
+
+	return prompt.String(), nil
+}
+
+// renderPromptOrDefault renders the prompt template of the given name, falling back to the built-in
+//template if it fails. the templates are checked when the engine is created, so this should not happen
+func (e *Engine) renderPromptOrDefault(name string) string {
+	prompt, err := e.renderPrompt(name)
+	if err != nil {
+		var fallback strings.Builder
+		template.Must(template.New(name).Parse(defaultPrompts[name])).Execute(&fallback, e.preparePromptData())
+		return fallback.String()
+	}
+
+	return prompt
+}
+
+// checkPrompts renders every template once, so a broken template is reported when the engine is created.
+func (e *Engine) checkPrompts() error {
+	for name := range defaultPrompts {
+		if _, err := e.renderPrompt(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetSystemPrompt returns the fully rendered system prompt of the current mode, as sent with the requests.
+func (e *Engine) GetSystemPrompt() string {
+	e.busy.Lock()
+	defer e.busy.Unlock()
+
+	return e.prepareSystemPrompt()
+}
@@ -0,0 +1,90 @@
+package ai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPrompt tests the rendering of the system prompt from its templates.
+func TestPrompt(t *testing.T) {
+	t.Run("Default", testPromptDefault)
+	t.Run("Custom", testPromptCustom)
+	t.Run("BrokenTemplate", testPromptBrokenTemplate)
+	t.Run("RenderError", testPromptRenderError)
+}
+
+// writePromptTemplates writes the given templates in a temporary prompts directory and returns it.
+func writePromptTemplates(t *testing.T, templates map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, text := range templates {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name+".tmpl"), []byte(text), 0600))
+	}
+
+	return dir
+}
+
+// testPromptDefault checks that the built-in templates are used when the prompts directory has none.
+func testPromptDefault(t *testing.T) {
+	cfg := newTestConfig(t, map[string]interface{}{
+		"USER_PROMPTS_DIRECTORY": t.TempDir(),
+		"USER_PREFERENCES":       "I prefer short answers",
+	})
+	engine, err := NewEngine(ExecEngineMode, cfg)
+	require.NoError(t, err)
+
+	prompt := engine.GetSystemPrompt()
+	assert.Contains(t, prompt, "You are terminal-assistant, a powerful terminal assistant generating a JSON")
+	assert.Contains(t, prompt, "My context: ")
+	assert.Contains(t, prompt, "my home directory is "+cfg.GetSystemConfig().GetHomeDirectory()+", ")
+	assert.Contains(t, prompt, "take this into account. Also, I prefer short answers.")
+
+	engine.SetMode(ChatEngineMode)
+	assert.Contains(t, engine.GetSystemPrompt(), "You are a powerful terminal assistant.")
+}
+
+// testPromptCustom checks that the template files replace the built-in ones, with access to the prompt data.
+func testPromptCustom(t *testing.T) {
+	dir := writePromptTemplates(t, map[string]string{
+		ExecPromptTemplate:    "Answer in JSON, {{ .Username }}. Mode: {{ .Mode }}.",
+		ContextPromptTemplate: "Cwd: {{ .Cwd }}. Date: {{ .Date }}. Shell: {{ .System.GetShell }}.{{ if .Pipe.Present }} Pipe: {{ .Pipe.Lines }} lines.{{ end }}",
+	})
+	cfg := newTestConfig(t, map[string]interface{}{"USER_PROMPTS_DIRECTORY": dir})
+	engine, err := NewEngine(ExecEngineMode, cfg)
+	require.NoError(t, err)
+	engine.SetPipe("first\nsecond\nthird")
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	expected := "Answer in JSON, " + cfg.GetSystemConfig().GetUsername() + ". Mode: exec.\n" +
+		"Cwd: " + cwd + ". Date: " + time.Now().Format("2006-01-02") + ". Shell: " + cfg.GetSystemConfig().GetShell() + ". Pipe: 3 lines."
+	assert.Equal(t, expected, engine.GetSystemPrompt())
+
+	//the chat template was not customised
+	engine.SetMode(ChatEngineMode)
+	assert.Contains(t, engine.GetSystemPrompt(), "You are a powerful terminal assistant.")
+}
+
+// testPromptBrokenTemplate checks that a template which can't be parsed is reported when creating the engine.
+func testPromptBrokenTemplate(t *testing.T) {
+	dir := writePromptTemplates(t, map[string]string{ChatPromptTemplate: "Hello {{ .Username "})
+
+	_, err := NewEngine(ChatEngineMode, newTestConfig(t, map[string]interface{}{"USER_PROMPTS_DIRECTORY": dir}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid chat prompt template")
+}
+
+// testPromptRenderError checks that a template using unknown data is reported when creating the engine.
+func testPromptRenderError(t *testing.T) {
+	dir := writePromptTemplates(t, map[string]string{ContextPromptTemplate: "{{ .Unknown }}"})
+
+	_, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"USER_PROMPTS_DIRECTORY": dir}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot render the context prompt template")
+}
@@ -0,0 +1,187 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/akhilsharma90/terminal-assistant/config"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Names of the provider backends that can be picked with OPENAI_PROVIDER in the config file.
+const (
+	OpenAiProviderName           = "openai"
+	OpenAiCompatibleProviderName = "openai-compatible"
+	OllamaProviderName           = "ollama"
+	AnthropicProviderName        = "anthropic"
+)
+
+//the engine speaks the go-openai request and response types everywhere, so every backend
+//translates from and to those types. this way ExecCompletion and ChatStreamCompletion don't
+//have to know which backend is actually answering
+
+// Provider is a backend able to answer chat completion requests, blocking or streamed.
+type Provider interface {
+	// CreateCompletion sends a request and waits for the whole answer.
+	CreateCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+	// CreateCompletionStream sends a request and returns a stream of answer chunks.
+	CreateCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (ProviderStream, error)
+	// ListModels returns the names of the models available through the models endpoint, sorted.
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// ProviderStream is a stream of answer chunks, Recv returns io.EOF once the answer is complete.
+type ProviderStream interface {
+	Recv() (openai.ChatCompletionStreamResponse, error)
+	Close() error
+}
+
+// NewProvider creates the provider backend selected in the AI config.
+func NewProvider(aiConfig config.AiConfig) (Provider, error) {
+	httpClient, err := newHttpClient(aiConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	//the API types only change how the OpenAI routes are reached, the other backends have their own
+	if apiType := aiConfig.GetApiType(); apiType != "" && apiType != OpenAiApiType {
+		switch aiConfig.GetProvider() {
+		case "", OpenAiProviderName, OpenAiCompatibleProviderName:
+		default:
+			return nil, fmt.Errorf("api type %s does not apply to provider %s", apiType, aiConfig.GetProvider())
+		}
+	}
+
+	switch aiConfig.GetProvider() {
+	//an empty provider keeps the behaviour of config files written before providers existed
+	case "", OpenAiProviderName:
+		clientConfig, err := newOpenAiClientConfig(aiConfig, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		return NewOpenAiProviderWithConfig(clientConfig), nil
+	case OpenAiCompatibleProviderName:
+		if aiConfig.GetBaseUrl() == "" {
+			return nil, fmt.Errorf("provider %s requires a base url", OpenAiCompatibleProviderName)
+		}
+		clientConfig, err := newOpenAiClientConfig(aiConfig, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		return NewOpenAiProviderWithConfig(clientConfig), nil
+	case OllamaProviderName:
+		return NewOllamaProvider(aiConfig.GetBaseUrl(), httpClient), nil
+	case AnthropicProviderName:
+		return NewAnthropicProvider(aiConfig.GetKey(), aiConfig.GetBaseUrl(), httpClient), nil
+	default:
+		return nil, fmt.Errorf("unknown provider %s", aiConfig.GetProvider())
+	}
+}
+
+// newHttpClient creates the http client shared by all backends, going through the proxy if one is configured
+//and adding the headers of the config to every request.
+//the connect timeout bounds the dial and the TLS handshake, the whole request is bounded by the engine context
+func newHttpClient(aiConfig config.AiConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if timeout := aiConfig.GetConnectTimeout(); timeout > 0 {
+		dialer := &net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = timeout
+	}
+
+	if aiConfig.GetProxy() != "" {
+		// Parse the proxy URL
+		proxyUrl, err := url.Parse(aiConfig.GetProxy())
+		if err != nil {
+			return nil, err
+		}
+		// Set the proxy URL in the transport
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	//every request goes through the retry transport, which sends it again on 429, 5xx and network errors
+	var roundTripper http.RoundTripper = newRetryTransport(
+		transport,
+		aiConfig.GetMaxRetries(),
+		aiConfig.GetRetryDelay(),
+		aiConfig.GetRetryMaxDelay(),
+	)
+
+	//the headers are added once, the retries send the request holding them
+	if len(aiConfig.GetHeaders()) > 0 {
+		roundTripper = &headerTransport{
+			next:    roundTripper,
+			headers: aiConfig.GetHeaders(),
+		}
+	}
+
+	//a cassette records the final answers, after the retries, or replays them without any network
+	if aiConfig.GetCassette() != "" {
+		cassette, err := newCassetteTransport(roundTripper, aiConfig.GetCassette(), aiConfig.GetCassetteMode())
+		if err != nil {
+			return nil, err
+		}
+		roundTripper = cassette
+	}
+
+	return &http.Client{
+		Transport: roundTripper,
+	}, nil
+}
+
+// ProviderError is returned by the non OpenAI backends when the API answers with an error.
+type ProviderError struct {
+	StatusCode int    // HTTP status code of the answer, 0 if the error came inside a stream
+	Message    string // Error message sent by the API
+}
+
+// Error returns the error message, prefixed by the status code when there is one.
+func (e *ProviderError) Error() string {
+	if e.StatusCode > 0 {
+		return fmt.Sprintf("error, status code: %d, message: %s", e.StatusCode, e.Message)
+	}
+
+	return e.Message
+}
+
+// newProviderError reads the body of a failed answer into a ProviderError.
+func newProviderError(resp *http.Response) *ProviderError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	//most APIs wrap the message in an error field, either as a string or as an object
+	var wrapped struct {
+		Error json.RawMessage `json:"error"`
+	}
+	message := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &wrapped) == nil && len(wrapped.Error) > 0 {
+		var text string
+		var object struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(wrapped.Error, &text) == nil {
+			message = text
+		} else if json.Unmarshal(wrapped.Error, &object) == nil && object.Message != "" {
+			message = object.Message
+		}
+	}
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+
+	return &ProviderError{
+		StatusCode: resp.StatusCode,
+		Message:    message,
+	}
+}
@@ -0,0 +1,323 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	anthropicDefaultBaseUrl   = "https://api.anthropic.com"
+	anthropicVersion          = "2023-06-01"
+	anthropicDefaultMaxTokens = 1024
+	anthropicModelsPageSize   = 1000
+)
+
+// AnthropicProvider talks to an API following the Anthropic messages format.
+type AnthropicProvider struct {
+	key        string
+	baseUrl    string
+	httpClient *http.Client
+}
+
+// anthropicMessage is a message as expected by /v1/messages.
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// anthropicRequest is the body sent to /v1/messages.
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   float32            `json:"temperature,omitempty"`
+	TopP          float32            `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+}
+
+// anthropicResponse is the full answer of /v1/messages.
+type anthropicResponse struct {
+	Id      string `json:"id"`
+	Model   string `json:"model"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// anthropicEvent is the data of a single server sent event of a streamed answer.
+type anthropicEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicModels is a page of the answer of /v1/models.
+type anthropicModels struct {
+	Data []struct {
+		Id string `json:"id"`
+	} `json:"data"`
+	HasMore bool   `json:"has_more"`
+	LastId  string `json:"last_id"`
+}
+
+// NewAnthropicProvider creates a new AnthropicProvider, an empty base URL means the official Anthropic API.
+func NewAnthropicProvider(key string, baseUrl string, httpClient *http.Client) *AnthropicProvider {
+	if baseUrl == "" {
+		baseUrl = anthropicDefaultBaseUrl
+	}
+
+	return &AnthropicProvider{
+		key:        key,
+		baseUrl:    strings.TrimRight(baseUrl, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// CreateCompletion sends a blocking request to /v1/messages.
+func (p *AnthropicProvider) CreateCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	resp, err := p.send(ctx, request, false)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var answer anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+
+	//the answer is a list of blocks, we only care about the text ones
+	var content strings.Builder
+	for _, block := range answer.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+
+	finishReason := openai.FinishReasonStop
+	if answer.StopReason == "max_tokens" {
+		finishReason = openai.FinishReasonLength
+	}
+
+	return openai.ChatCompletionResponse{
+		ID:    answer.Id,
+		Model: answer.Model,
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Message: openai.ChatCompletionMessage{
+					Role:    openai.ChatMessageRoleAssistant,
+					Content: content.String(),
+				},
+				FinishReason: finishReason,
+			},
+		},
+		Usage: openai.Usage{
+			PromptTokens:     answer.Usage.InputTokens,
+			CompletionTokens: answer.Usage.OutputTokens,
+			TotalTokens:      answer.Usage.InputTokens + answer.Usage.OutputTokens,
+		},
+	}, nil
+}
+
+// CreateCompletionStream sends a streamed request to /v1/messages, the answer comes back as server sent events.
+func (p *AnthropicProvider) CreateCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (ProviderStream, error) {
+	resp, err := p.send(ctx, request, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &anthropicStream{
+		body:   resp.Body,
+		reader: bufio.NewReader(resp.Body),
+	}, nil
+}
+
+// ListModels lists the models of /v1/models, going through its pages.
+func (p *AnthropicProvider) ListModels(ctx context.Context) ([]string, error) {
+	var models []string
+	after := ""
+	for {
+		query := url.Values{"limit": {strconv.Itoa(anthropicModelsPageSize)}}
+		if after != "" {
+			query.Set("after_id", after)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseUrl+"/v1/models?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("x-api-key", p.key)
+		req.Header.Set("anthropic-version", anthropicVersion)
+
+		page, err := p.getModels(req)
+		if err != nil {
+			return nil, err
+		}
+		for _, model := range page.Data {
+			models = append(models, model.Id)
+		}
+		if !page.HasMore || page.LastId == "" {
+			break
+		}
+		after = page.LastId
+	}
+	sort.Strings(models)
+
+	return models, nil
+}
+
+// getModels sends a request for a page of /v1/models, any non 2xx answer is turned into a ProviderError.
+func (p *AnthropicProvider) getModels(req *http.Request) (*anthropicModels, error) {
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, newProviderError(resp)
+	}
+
+	var page anthropicModels
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// send translates the request for /v1/messages and posts it, any non 2xx answer is turned into a ProviderError.
+func (p *AnthropicProvider) send(ctx context.Context, request openai.ChatCompletionRequest, stream bool) (*http.Response, error) {
+	body := anthropicRequest{
+		Model:         request.Model,
+		Messages:      []anthropicMessage{},
+		MaxTokens:     request.MaxTokens,
+		Temperature:   request.Temperature,
+		TopP:          request.TopP,
+		StopSequences: request.Stop,
+		Stream:        stream,
+	}
+	if body.MaxTokens <= 0 {
+		body.MaxTokens = anthropicDefaultMaxTokens
+	}
+
+	//system prompts are a top level field and the messages have to alternate between user
+	//and assistant, so consecutive messages of the same role (like the pipe prompt followed by
+	//the user question) are merged together
+	var system []string
+	for _, message := range request.Messages {
+		if message.Role == openai.ChatMessageRoleSystem {
+			system = append(system, message.Content)
+			continue
+		}
+		last := len(body.Messages) - 1
+		if last >= 0 && body.Messages[last].Role == message.Role {
+			body.Messages[last].Content += "\n\n" + message.Content
+			continue
+		}
+		body.Messages = append(body.Messages, anthropicMessage{Role: message.Role, Content: message.Content})
+	}
+	body.System = strings.Join(system, "\n\n")
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseUrl+"/v1/messages", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", p.key)
+	req.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		defer resp.Body.Close()
+		return nil, newProviderError(resp)
+	}
+
+	return resp, nil
+}
+
+// anthropicStream reads the server sent events of a streamed /v1/messages answer.
+type anthropicStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	done   bool
+}
+
+// Recv returns the next text chunk of the answer, or io.EOF once the message_stop event was received.
+func (s *anthropicStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	for {
+		if s.done {
+			return openai.ChatCompletionStreamResponse{}, io.EOF
+		}
+
+		line, err := s.reader.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		//only the data lines matter, the event lines repeat the type that is also in the data
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			if err != nil {
+				return openai.ChatCompletionStreamResponse{}, err
+			}
+			continue
+		}
+
+		var event anthropicEvent
+		if err := json.Unmarshal(bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:"))), &event); err != nil {
+			return openai.ChatCompletionStreamResponse{}, err
+		}
+
+		switch event.Type {
+		case "content_block_delta":
+			if event.Delta.Type != "text_delta" {
+				continue
+			}
+			return openai.ChatCompletionStreamResponse{
+				Choices: []openai.ChatCompletionStreamChoice{
+					{
+						Delta: openai.ChatCompletionStreamChoiceDelta{
+							Role:    openai.ChatMessageRoleAssistant,
+							Content: event.Delta.Text,
+						},
+					},
+				},
+			}, nil
+		case "message_stop":
+			s.done = true
+		case "error":
+			return openai.ChatCompletionStreamResponse{}, &ProviderError{Message: event.Error.Message}
+		}
+	}
+}
+
+// Close closes the underlying response body.
+func (s *anthropicStream) Close() error {
+	return s.body.Close()
+}
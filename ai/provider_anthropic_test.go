@@ -0,0 +1,130 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAnthropicProvider is a test function for testing the AnthropicProvider against a stand-in server
+func TestAnthropicProvider(t *testing.T) {
+	t.Run("CreateCompletion", testAnthropicProviderCreateCompletion)
+	t.Run("CreateCompletionStream", testAnthropicProviderCreateCompletionStream)
+	t.Run("Error", testAnthropicProviderError)
+	t.Run("ListModels", testAnthropicProviderListModels)
+}
+
+// testAnthropicProviderCreateCompletion checks the translation of a blocking request and of its answer.
+func testAnthropicProviderCreateCompletion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "test_key", r.Header.Get("x-api-key"))
+		assert.Equal(t, anthropicVersion, r.Header.Get("anthropic-version"))
+
+		var body anthropicRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "be brief", body.System)
+		assert.Equal(t, anthropicDefaultMaxTokens, body.MaxTokens)
+		assert.Equal(t, float32(0.5), body.TopP)
+		assert.Equal(t, []anthropicMessage{{Role: "user", Content: "I will work on the following input: x\n\nhi"}}, body.Messages)
+
+		fmt.Fprint(w, `{"id":"msg_1","content":[{"type":"text","text":"hel"},{"type":"text","text":"lo"}],"stop_reason":"end_turn","usage":{"input_tokens":3,"output_tokens":1}}`)
+	}))
+	defer server.Close()
+
+	provider := NewAnthropicProvider("test_key", server.URL, http.DefaultClient)
+	resp, err := provider.CreateCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model: "claude",
+		TopP:  0.5,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "be brief"},
+			{Role: openai.ChatMessageRoleUser, Content: "I will work on the following input: x"},
+			{Role: openai.ChatMessageRoleUser, Content: "hi"},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "hello", resp.Choices[0].Message.Content)
+	assert.Equal(t, openai.FinishReasonStop, resp.Choices[0].FinishReason)
+	assert.Equal(t, 4, resp.Usage.TotalTokens)
+}
+
+// testAnthropicProviderCreateCompletionStream checks that the text deltas of a streamed answer become chunks.
+func testAnthropicProviderCreateCompletionStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body anthropicRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.True(t, body.Stream)
+
+		fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\"}\n\n")
+		fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"hel\"}}\n\n")
+		fmt.Fprint(w, "event: ping\ndata: {\"type\":\"ping\"}\n\n")
+		fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"lo\"}}\n\n")
+		fmt.Fprint(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+	}))
+	defer server.Close()
+
+	provider := NewAnthropicProvider("test_key", server.URL, http.DefaultClient)
+	stream, err := provider.CreateCompletionStream(context.Background(), openai.ChatCompletionRequest{Model: "claude"})
+	require.NoError(t, err)
+	defer stream.Close()
+
+	var content string
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content += resp.Choices[0].Delta.Content
+	}
+
+	assert.Equal(t, "hello", content)
+}
+
+// testAnthropicProviderError checks that an error answer is turned into a ProviderError.
+func testAnthropicProviderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`)
+	}))
+	defer server.Close()
+
+	provider := NewAnthropicProvider("test_key", server.URL, http.DefaultClient)
+	_, err := provider.CreateCompletion(context.Background(), openai.ChatCompletionRequest{Model: "claude"})
+
+	var providerErr *ProviderError
+	require.ErrorAs(t, err, &providerErr)
+	assert.Equal(t, http.StatusUnauthorized, providerErr.StatusCode)
+	assert.Equal(t, "invalid x-api-key", providerErr.Message)
+}
+
+// testAnthropicProviderListModels checks that the models are listed through all the pages of /v1/models.
+func testAnthropicProviderListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/models", r.URL.Path)
+		assert.Equal(t, "test_key", r.Header.Get("x-api-key"))
+		assert.Equal(t, anthropicVersion, r.Header.Get("anthropic-version"))
+		if r.URL.Query().Get("after_id") == "" {
+			fmt.Fprint(w, `{"data":[{"id":"claude-3-opus"}],"has_more":true,"last_id":"claude-3-opus"}`)
+			return
+		}
+		assert.Equal(t, "claude-3-opus", r.URL.Query().Get("after_id"))
+		fmt.Fprint(w, `{"data":[{"id":"claude-3-haiku"}],"has_more":false}`)
+	}))
+	defer server.Close()
+
+	provider := NewAnthropicProvider("test_key", server.URL, http.DefaultClient)
+	models, err := provider.ListModels(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"claude-3-haiku", "claude-3-opus"}, models)
+}
@@ -0,0 +1,254 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const ollamaDefaultBaseUrl = "http://localhost:11434"
+
+// OllamaProvider talks to the native chat API of an Ollama server.
+type OllamaProvider struct {
+	baseUrl    string
+	httpClient *http.Client
+}
+
+// ollamaMessage is a message as expected and returned by /api/chat.
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ollamaRequest is the body sent to /api/chat.
+type ollamaRequest struct {
+	Model    string                 `json:"model"`
+	Messages []ollamaMessage        `json:"messages"`
+	Stream   bool                   `json:"stream"`
+	Format   string                 `json:"format,omitempty"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+}
+
+// ollamaResponse is a full answer, or a single chunk of it when streaming.
+type ollamaResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+// ollamaTags is the answer of /api/tags, listing the models pulled on the server.
+type ollamaTags struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+// NewOllamaProvider creates a new OllamaProvider, an empty base URL means a local Ollama server.
+func NewOllamaProvider(baseUrl string, httpClient *http.Client) *OllamaProvider {
+	if baseUrl == "" {
+		baseUrl = ollamaDefaultBaseUrl
+	}
+
+	return &OllamaProvider{
+		baseUrl:    strings.TrimRight(baseUrl, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// CreateCompletion sends a blocking request to /api/chat.
+func (p *OllamaProvider) CreateCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	resp, err := p.send(ctx, request, false)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var answer ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	if answer.Error != "" {
+		return openai.ChatCompletionResponse{}, &ProviderError{StatusCode: resp.StatusCode, Message: answer.Error}
+	}
+
+	return openai.ChatCompletionResponse{
+		Model: answer.Model,
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Message: openai.ChatCompletionMessage{
+					Role:    openai.ChatMessageRoleAssistant,
+					Content: answer.Message.Content,
+				},
+				FinishReason: openai.FinishReasonStop,
+			},
+		},
+		Usage: openai.Usage{
+			PromptTokens:     answer.PromptEvalCount,
+			CompletionTokens: answer.EvalCount,
+			TotalTokens:      answer.PromptEvalCount + answer.EvalCount,
+		},
+	}, nil
+}
+
+// CreateCompletionStream sends a streamed request to /api/chat, the answer comes back as one JSON object per line.
+func (p *OllamaProvider) CreateCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (ProviderStream, error) {
+	resp, err := p.send(ctx, request, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ollamaStream{
+		body:   resp.Body,
+		reader: bufio.NewReader(resp.Body),
+	}, nil
+}
+
+// ListModels lists the models pulled on the server, from /api/tags.
+func (p *OllamaProvider) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseUrl+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, newProviderError(resp)
+	}
+
+	var tags ollamaTags
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, err
+	}
+	models := make([]string, 0, len(tags.Models))
+	for _, model := range tags.Models {
+		models = append(models, model.Name)
+	}
+	sort.Strings(models)
+
+	return models, nil
+}
+
+// send translates the request for /api/chat and posts it, any non 2xx answer is turned into a ProviderError.
+func (p *OllamaProvider) send(ctx context.Context, request openai.ChatCompletionRequest, stream bool) (*http.Response, error) {
+	body := ollamaRequest{
+		Model:    request.Model,
+		Messages: make([]ollamaMessage, 0, len(request.Messages)),
+		Stream:   stream,
+		Options:  map[string]interface{}{},
+	}
+	for _, message := range request.Messages {
+		body.Messages = append(body.Messages, ollamaMessage{Role: message.Role, Content: message.Content})
+	}
+	//a JSON object answer is asked with the json format
+	if request.ResponseFormat != nil && request.ResponseFormat.Type == openai.ChatCompletionResponseFormatTypeJSONObject {
+		body.Format = "json"
+	}
+	//ollama calls max tokens num_predict and keeps the sampling parameters under options
+	if request.MaxTokens > 0 {
+		body.Options["num_predict"] = request.MaxTokens
+	}
+	if request.Temperature != 0 {
+		body.Options["temperature"] = request.Temperature
+	}
+	if request.TopP != 0 {
+		body.Options["top_p"] = request.TopP
+	}
+	if request.Seed != nil {
+		body.Options["seed"] = *request.Seed
+	}
+	if len(request.Stop) > 0 {
+		body.Options["stop"] = request.Stop
+	}
+	if request.PresencePenalty != 0 {
+		body.Options["presence_penalty"] = request.PresencePenalty
+	}
+	if request.FrequencyPenalty != 0 {
+		body.Options["frequency_penalty"] = request.FrequencyPenalty
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseUrl+"/api/chat", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		defer resp.Body.Close()
+		return nil, newProviderError(resp)
+	}
+
+	return resp, nil
+}
+
+// ollamaStream reads the line delimited chunks of a streamed /api/chat answer.
+type ollamaStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	done   bool
+}
+
+// Recv returns the next chunk of the answer, or io.EOF once Ollama flagged the answer as done.
+func (s *ollamaStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	for {
+		if s.done {
+			return openai.ChatCompletionStreamResponse{}, io.EOF
+		}
+
+		line, err := s.reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err != nil {
+				return openai.ChatCompletionStreamResponse{}, err
+			}
+			continue
+		}
+
+		var chunk ollamaResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return openai.ChatCompletionStreamResponse{}, err
+		}
+		if chunk.Error != "" {
+			return openai.ChatCompletionStreamResponse{}, &ProviderError{Message: chunk.Error}
+		}
+		s.done = chunk.Done
+
+		return openai.ChatCompletionStreamResponse{
+			Model: chunk.Model,
+			Choices: []openai.ChatCompletionStreamChoice{
+				{
+					Delta: openai.ChatCompletionStreamChoiceDelta{
+						Role:    openai.ChatMessageRoleAssistant,
+						Content: chunk.Message.Content,
+					},
+				},
+			},
+		}, nil
+	}
+}
+
+// Close closes the underlying response body.
+func (s *ollamaStream) Close() error {
+	return s.body.Close()
+}
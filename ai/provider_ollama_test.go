@@ -0,0 +1,126 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOllamaProvider is a test function for testing the OllamaProvider against a stand-in server
+func TestOllamaProvider(t *testing.T) {
+	t.Run("CreateCompletion", testOllamaProviderCreateCompletion)
+	t.Run("CreateCompletionStream", testOllamaProviderCreateCompletionStream)
+	t.Run("Error", testOllamaProviderError)
+	t.Run("ListModels", testOllamaProviderListModels)
+}
+
+// testOllamaProviderCreateCompletion checks the translation of a blocking request and of its answer.
+func testOllamaProviderCreateCompletion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/chat", r.URL.Path)
+
+		var body ollamaRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "llama2", body.Model)
+		assert.False(t, body.Stream)
+		assert.Equal(t, float64(100), body.Options["num_predict"])
+		assert.Equal(t, 0.5, body.Options["top_p"])
+		assert.Equal(t, float64(42), body.Options["seed"])
+		assert.Equal(t, []interface{}{"\n"}, body.Options["stop"])
+		assert.Equal(t, []ollamaMessage{{Role: "system", Content: "be brief"}, {Role: "user", Content: "hi"}}, body.Messages)
+
+		fmt.Fprint(w, `{"model":"llama2","message":{"role":"assistant","content":"hello"},"done":true,"prompt_eval_count":3,"eval_count":1}`)
+	}))
+	defer server.Close()
+
+	seed := 42
+	provider := NewOllamaProvider(server.URL, http.DefaultClient)
+	resp, err := provider.CreateCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:     "llama2",
+		MaxTokens: 100,
+		TopP:      0.5,
+		Seed:      &seed,
+		Stop:      []string{"\n"},
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "be brief"},
+			{Role: openai.ChatMessageRoleUser, Content: "hi"},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "hello", resp.Choices[0].Message.Content)
+	assert.Equal(t, 3, resp.Usage.PromptTokens)
+	assert.Equal(t, 1, resp.Usage.CompletionTokens)
+}
+
+// testOllamaProviderCreateCompletionStream checks that each line of a streamed answer becomes a chunk.
+func testOllamaProviderCreateCompletionStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body ollamaRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.True(t, body.Stream)
+
+		fmt.Fprint(w, "{\"message\":{\"role\":\"assistant\",\"content\":\"hel\"},\"done\":false}\n")
+		fmt.Fprint(w, "{\"message\":{\"role\":\"assistant\",\"content\":\"lo\"},\"done\":false}\n")
+		fmt.Fprint(w, "{\"message\":{\"role\":\"assistant\",\"content\":\"\"},\"done\":true}\n")
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider(server.URL, http.DefaultClient)
+	stream, err := provider.CreateCompletionStream(context.Background(), openai.ChatCompletionRequest{Model: "llama2"})
+	require.NoError(t, err)
+	defer stream.Close()
+
+	var content string
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content += resp.Choices[0].Delta.Content
+	}
+
+	assert.Equal(t, "hello", content)
+}
+
+// testOllamaProviderError checks that an error answer is turned into a ProviderError.
+func testOllamaProviderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":"model 'llama2' not found"}`)
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider(server.URL, http.DefaultClient)
+	_, err := provider.CreateCompletion(context.Background(), openai.ChatCompletionRequest{Model: "llama2"})
+
+	var providerErr *ProviderError
+	require.ErrorAs(t, err, &providerErr)
+	assert.Equal(t, http.StatusNotFound, providerErr.StatusCode)
+	assert.Equal(t, "model 'llama2' not found", providerErr.Message)
+}
+
+// testOllamaProviderListModels checks that the models pulled on the server are listed, sorted.
+func testOllamaProviderListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/tags", r.URL.Path)
+		assert.Equal(t, http.MethodGet, r.Method)
+		fmt.Fprint(w, `{"models":[{"name":"mistral:latest"},{"name":"llama2:latest"}]}`)
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider(server.URL, http.DefaultClient)
+	models, err := provider.ListModels(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"llama2:latest", "mistral:latest"}, models)
+}
@@ -0,0 +1,70 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAiProvider talks to the OpenAI API, or to any API exposing the same routes under another base URL.
+type OpenAiProvider struct {
+	client      *openai.Client
+	streamUsage bool // Indicates if the usage of the streamed answers can be asked for
+}
+
+// NewOpenAiProvider creates a new OpenAiProvider, an empty base URL means the official OpenAI API.
+func NewOpenAiProvider(key string, baseUrl string, httpClient *http.Client) *OpenAiProvider {
+	clientConfig := openai.DefaultConfig(key)
+	if baseUrl != "" {
+		clientConfig.BaseURL = baseUrl
+	}
+	clientConfig.HTTPClient = httpClient
+
+	return NewOpenAiProviderWithConfig(clientConfig)
+}
+
+// NewOpenAiProviderWithConfig creates a new OpenAiProvider from a go-openai config, like the one of an
+//Azure OpenAI resource.
+func NewOpenAiProviderWithConfig(clientConfig openai.ClientConfig) *OpenAiProvider {
+	return &OpenAiProvider{
+		client: openai.NewClientWithConfig(clientConfig),
+		//Azure rejects the stream options before its recent API versions, the usage is then estimated
+		streamUsage: clientConfig.APIType == openai.APITypeOpenAI,
+	}
+}
+
+// CreateCompletion sends a blocking chat completion request.
+func (p *OpenAiProvider) CreateCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	return p.client.CreateChatCompletion(ctx, request)
+}
+
+// CreateCompletionStream sends a streamed chat completion request.
+func (p *OpenAiProvider) CreateCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (ProviderStream, error) {
+	if !p.streamUsage {
+		request.StreamOptions = nil
+	}
+	stream, err := p.client.CreateChatCompletionStream(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// ListModels lists the models of /models.
+func (p *OpenAiProvider) ListModels(ctx context.Context) ([]string, error) {
+	list, err := p.client.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]string, 0, len(list.Models))
+	for _, model := range list.Models {
+		models = append(models, model.ID)
+	}
+	sort.Strings(models)
+
+	return models, nil
+}
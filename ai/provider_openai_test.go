@@ -0,0 +1,83 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOpenAiProvider is a test function for testing the OpenAiProvider against a stand-in server
+func TestOpenAiProvider(t *testing.T) {
+	t.Run("CreateCompletion", testOpenAiProviderCreateCompletion)
+	t.Run("CreateCompletionStream", testOpenAiProviderCreateCompletionStream)
+	t.Run("ListModels", testOpenAiProviderListModels)
+}
+
+// testOpenAiProviderCreateCompletion checks that the base URL and the key are used for blocking requests.
+func testOpenAiProviderCreateCompletion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer test_key", r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"hello"}}],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`)
+	}))
+	defer server.Close()
+
+	provider := NewOpenAiProvider("test_key", server.URL+"/v1", http.DefaultClient)
+	resp, err := provider.CreateCompletion(context.Background(), openai.ChatCompletionRequest{Model: "test_model"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "hello", resp.Choices[0].Message.Content)
+	assert.Equal(t, 4, resp.Usage.TotalTokens)
+}
+
+// testOpenAiProviderCreateCompletionStream checks that the chunks of a streamed answer are returned in order.
+func testOpenAiProviderCreateCompletionStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"hel\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"lo\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	provider := NewOpenAiProvider("test_key", server.URL+"/v1", http.DefaultClient)
+	stream, err := provider.CreateCompletionStream(context.Background(), openai.ChatCompletionRequest{Model: "test_model"})
+	require.NoError(t, err)
+	defer stream.Close()
+
+	var content string
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content += resp.Choices[0].Delta.Content
+	}
+
+	assert.Equal(t, "hello", content)
+}
+
+// testOpenAiProviderListModels checks that the models of /models are listed, sorted.
+func testOpenAiProviderListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/models", r.URL.Path)
+		assert.Equal(t, "Bearer test_key", r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"object":"list","data":[{"id":"gpt-4o","object":"model"},{"id":"gpt-4","object":"model"}]}`)
+	}))
+	defer server.Close()
+
+	provider := NewOpenAiProvider("test_key", server.URL+"/v1", http.DefaultClient)
+	models, err := provider.ListModels(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"gpt-4", "gpt-4o"}, models)
+}
@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewProvider is a test function for testing the backend selection of NewProvider
+func TestNewProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   map[string]interface{}
+		expected Provider
+		err      bool
+	}{
+		{
+			name:     "Default",
+			values:   map[string]interface{}{},
+			expected: &OpenAiProvider{},
+		},
+		{
+			name:     "OpenAi",
+			values:   map[string]interface{}{"OPENAI_PROVIDER": OpenAiProviderName},
+			expected: &OpenAiProvider{},
+		},
+		{
+			name:     "OpenAiCompatible",
+			values:   map[string]interface{}{"OPENAI_PROVIDER": OpenAiCompatibleProviderName, "OPENAI_BASE_URL": "http://localhost:8080/v1"},
+			expected: &OpenAiProvider{},
+		},
+		{
+			name:   "OpenAiCompatibleWithoutBaseUrl",
+			values: map[string]interface{}{"OPENAI_PROVIDER": OpenAiCompatibleProviderName},
+			err:    true,
+		},
+		{
+			name:     "Ollama",
+			values:   map[string]interface{}{"OPENAI_PROVIDER": OllamaProviderName},
+			expected: &OllamaProvider{},
+		},
+		{
+			name:     "Anthropic",
+			values:   map[string]interface{}{"OPENAI_PROVIDER": AnthropicProviderName},
+			expected: &AnthropicProvider{},
+		},
+		{
+			name:   "Unknown",
+			values: map[string]interface{}{"OPENAI_PROVIDER": "unknown"},
+			err:    true,
+		},
+		{
+			name:     "Azure",
+			values:   map[string]interface{}{"OPENAI_API_TYPE": AzureApiType, "OPENAI_BASE_URL": "https://company.openai.azure.com"},
+			expected: &OpenAiProvider{},
+		},
+		{
+			name:   "AzureWithoutBaseUrl",
+			values: map[string]interface{}{"OPENAI_API_TYPE": AzureApiType},
+			err:    true,
+		},
+		{
+			name:   "AzureWithOllama",
+			values: map[string]interface{}{"OPENAI_PROVIDER": OllamaProviderName, "OPENAI_API_TYPE": AzureApiType},
+			err:    true,
+		},
+		{
+			name:   "UnknownApiType",
+			values: map[string]interface{}{"OPENAI_API_TYPE": "unknown"},
+			err:    true,
+		},
+		{
+			name:   "InvalidProxy",
+			values: map[string]interface{}{"OPENAI_PROXY": "://invalid"},
+			err:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := newTestConfig(t, test.values)
+
+			provider, err := NewProvider(cfg.GetAiConfig())
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.IsType(t, test.expected, provider)
+		})
+	}
+}
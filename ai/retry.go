@@ -0,0 +1,157 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//retries are done at the HTTP level so every provider backend gets them for free, and so the
+//Retry-After header sent with a 429 or a 503 can be honoured, go-openai doesn't expose it in its errors
+
+// retryObserverKey is the context key under which the engine stores its retryObserver.
+type retryObserverKey struct{}
+
+// retryObserver is notified before each new attempt of a request, with the attempt number (starting at 2),
+//the maximum number of attempts and the time waited before sending it.
+type retryObserver func(attempt int, maxAttempts int, wait time.Duration)
+
+// withRetryObserver returns a copy of the context carrying the given observer.
+func withRetryObserver(ctx context.Context, observer retryObserver) context.Context {
+	return context.WithValue(ctx, retryObserverKey{}, observer)
+}
+
+// retryTransport is a http.RoundTripper retrying the requests failing with a retryable error,
+//waiting a jittered exponential backoff, or what the server asked for with Retry-After.
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	delay      time.Duration
+	maxDelay   time.Duration
+}
+
+// newRetryTransport wraps the base transport, no retry is done if maxRetries is 0.
+func newRetryTransport(base http.RoundTripper, maxRetries int, delay time.Duration, maxDelay time.Duration) *retryTransport {
+	return &retryTransport{
+		base:       base,
+		maxRetries: maxRetries,
+		delay:      delay,
+		maxDelay:   maxDelay,
+	}
+}
+
+// RoundTrip sends the request, and sends it again as long as it fails with a retryable error and retries are left.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	//a body that can't be rewound can only be sent once
+	maxRetries := t.maxRetries
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		maxRetries = 0
+	}
+
+	attemptReq := req
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(attemptReq)
+		if attempt > maxRetries || !isRetryable(ctx, resp, err) {
+			return resp, err
+		}
+
+		wait := t.backoff(attempt, resp)
+		//the failed answer is dropped, its body has to be consumed for the connection to be reused
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+
+		if observer, ok := ctx.Value(retryObserverKey{}).(retryObserver); ok {
+			observer(attempt+1, maxRetries+1, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		attemptReq = req.Clone(ctx)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq.Body = body
+		}
+	}
+}
+
+// backoff returns the time to wait before the next attempt. Retry-After wins when the server sent it,
+//otherwise the delay doubles at each attempt up to the max delay, with a random jitter of up to half of it.
+func (t *retryTransport) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return wait
+		}
+	}
+
+	wait := t.delay
+	for i := 1; i < attempt && wait < t.maxDelay; i++ {
+		wait *= 2
+	}
+	if t.maxDelay > 0 && wait > t.maxDelay {
+		wait = t.maxDelay
+	}
+	if wait <= 0 {
+		return 0
+	}
+
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// isRetryable tells if a request failing this way is worth sending again.
+func isRetryable(ctx context.Context, resp *http.Response, err error) bool {
+	//the request was interrupted or ran out of time, sending it again would not help
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	//the server could not be reached, or the connection dropped
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+		529: // Anthropic overloaded
+		return true
+	default:
+		return false
+	}
+}
+
+// parseRetryAfter reads a Retry-After header, given either in seconds or as an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
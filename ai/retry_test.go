@@ -0,0 +1,174 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRetryTransport is a test function for testing the retries against a server returning scripted failures
+func TestRetryTransport(t *testing.T) {
+	t.Run("RetryUntilSuccess", testRetryUntilSuccess)
+	t.Run("RetryAfter", testRetryAfter)
+	t.Run("NoRetryOnClientError", testNoRetryOnClientError)
+	t.Run("RetriesExhausted", testRetriesExhausted)
+	t.Run("Backoff", testRetryBackoff)
+	t.Run("ParseRetryAfter", testParseRetryAfter)
+	t.Run("EngineRetry", testEngineRetry)
+}
+
+// scriptedContent is the answer of a scripted server once its failures are over.
+const scriptedContent = `{"cmd":"","exp":"hello","exec":false}`
+
+// newScriptedServer starts a server answering with the given status codes in order, then with a valid completion.
+//the returned counter tells how many requests it received
+func newScriptedServer(t *testing.T, headers http.Header, statuses ...int) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := atomic.AddInt32(&requests, 1)
+		if int(request) <= len(statuses) {
+			for key, values := range headers {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(statuses[request-1])
+			fmt.Fprintf(w, `{"error":{"message":"scripted failure %d"}}`, request)
+			return
+		}
+		//the exec answers are streamed
+		if body, _ := io.ReadAll(r.Body); strings.Contains(string(body), `"stream":true`) {
+			testProviderServers[OpenAiProviderName](scriptedContent, true)(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":%q}}]}`, scriptedContent)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+// newRetryProvider creates an OpenAiProvider going through a retry transport with short delays.
+func newRetryProvider(url string, maxRetries int) *OpenAiProvider {
+	client := &http.Client{
+		Transport: newRetryTransport(http.DefaultTransport, maxRetries, 10*time.Millisecond, 50*time.Millisecond),
+	}
+
+	return NewOpenAiProvider("test_key", url, client)
+}
+
+// testRetryUntilSuccess checks that 429 and 5xx answers are retried until the request succeeds.
+func testRetryUntilSuccess(t *testing.T) {
+	server, requests := newScriptedServer(t, nil, http.StatusTooManyRequests, http.StatusServiceUnavailable)
+
+	var attempts []int
+	ctx := withRetryObserver(context.Background(), func(attempt int, maxAttempts int, wait time.Duration) {
+		attempts = append(attempts, attempt)
+		assert.Equal(t, 4, maxAttempts)
+	})
+
+	resp, err := newRetryProvider(server.URL, 3).CreateCompletion(ctx, openai.ChatCompletionRequest{Model: "test_model"})
+	require.NoError(t, err)
+
+	assert.Equal(t, scriptedContent, resp.Choices[0].Message.Content)
+	assert.Equal(t, int32(3), atomic.LoadInt32(requests))
+	assert.Equal(t, []int{2, 3}, attempts)
+}
+
+// testRetryAfter checks that the Retry-After header is honoured.
+func testRetryAfter(t *testing.T) {
+	server, requests := newScriptedServer(t, http.Header{"Retry-After": []string{"1"}}, http.StatusTooManyRequests)
+
+	var waited time.Duration
+	ctx := withRetryObserver(context.Background(), func(attempt int, maxAttempts int, wait time.Duration) {
+		waited = wait
+	})
+
+	start := time.Now()
+	_, err := newRetryProvider(server.URL, 3).CreateCompletion(ctx, openai.ChatCompletionRequest{Model: "test_model"})
+	require.NoError(t, err)
+
+	assert.Equal(t, time.Second, waited)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+}
+
+// testNoRetryOnClientError checks that a 4xx other than 429 is returned right away.
+func testNoRetryOnClientError(t *testing.T) {
+	server, requests := newScriptedServer(t, nil, http.StatusBadRequest)
+
+	_, err := newRetryProvider(server.URL, 3).CreateCompletion(context.Background(), openai.ChatCompletionRequest{Model: "test_model"})
+	require.Error(t, err)
+
+	assert.True(t, strings.Contains(err.Error(), "scripted failure 1"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+}
+
+// testRetriesExhausted checks that the last failure is returned once all retries were used.
+func testRetriesExhausted(t *testing.T) {
+	server, requests := newScriptedServer(t, nil, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+
+	_, err := newRetryProvider(server.URL, 2).CreateCompletion(context.Background(), openai.ChatCompletionRequest{Model: "test_model"})
+	require.Error(t, err)
+
+	assert.True(t, strings.Contains(err.Error(), "scripted failure 3"))
+	assert.Equal(t, int32(3), atomic.LoadInt32(requests))
+}
+
+// testRetryBackoff checks that the backoff doubles, stays under the max delay and is jittered.
+func testRetryBackoff(t *testing.T) {
+	transport := newRetryTransport(http.DefaultTransport, 5, time.Second, 4*time.Second)
+
+	for attempt, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 5: 4 * time.Second} {
+		wait := transport.backoff(attempt, nil)
+		assert.GreaterOrEqual(t, wait, expected/2)
+		assert.LessOrEqual(t, wait, expected)
+	}
+}
+
+// testParseRetryAfter checks both formats of the Retry-After header.
+func testParseRetryAfter(t *testing.T) {
+	wait, ok := parseRetryAfter("3")
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, wait)
+
+	wait, ok = parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.InDelta(t, float64(time.Hour), float64(wait), float64(2*time.Second))
+
+	_, ok = parseRetryAfter("")
+	assert.False(t, ok)
+
+	_, ok = parseRetryAfter("soon")
+	assert.False(t, ok)
+}
+
+// testEngineRetry checks that the engine goes through the retries configured in the AI config.
+func testEngineRetry(t *testing.T) {
+	server, requests := newScriptedServer(t, nil, http.StatusInternalServerError)
+	cfg := newTestConfig(t, map[string]interface{}{
+		"OPENAI_BASE_URL":        server.URL,
+		"OPENAI_MAX_RETRIES":     1,
+		"OPENAI_RETRY_DELAY":     0.01,
+		"OPENAI_RETRY_MAX_DELAY": 0.01,
+	})
+	engine, err := NewEngine(ExecEngineMode, cfg)
+	require.NoError(t, err)
+
+	output, err := engine.ExecCompletion("say hello")
+	require.NoError(t, err)
+
+	assert.Equal(t, "hello", output.GetExplanation())
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+	assert.Empty(t, engine.GetStatus())
+}
@@ -0,0 +1,63 @@
+package ai
+
+import (
+	"math"
+
+	"github.com/akhilsharma90/terminal-assistant/config"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// SetSampling sets the sampling parameters of this invocation, they override the ones of the config for both modes.
+func (e *Engine) SetSampling(sampling config.SamplingConfig) *Engine {
+	defer e.lock()()
+	e.sampling = sampling
+
+	return e
+}
+
+// prepareSampling returns the sampling parameters of the current mode, with the ones of this invocation on top.
+func (e *Engine) prepareSampling() config.SamplingConfig {
+	sampling := e.config.GetAiConfig().GetChatSampling()
+	//the explanations are as deterministic as the commands, they use the exec parameters too
+	if e.mode == ExecEngineMode || e.mode == ExplainEngineMode {
+		sampling = e.config.GetAiConfig().GetExecSampling()
+	}
+
+	return sampling.Merge(e.sampling)
+}
+
+// applySampling sets the sampling parameters of the current mode on the request.
+func (e *Engine) applySampling(request *openai.ChatCompletionRequest) {
+	sampling := e.prepareSampling()
+
+	if sampling.Temperature != nil {
+		request.Temperature = nonZero(*sampling.Temperature)
+	}
+	if sampling.TopP != nil {
+		request.TopP = nonZero(*sampling.TopP)
+	}
+	if sampling.Seed != nil {
+		seed := *sampling.Seed
+		request.Seed = &seed
+	}
+	if len(sampling.Stop) > 0 {
+		request.Stop = sampling.Stop
+	}
+	if sampling.PresencePenalty != nil {
+		request.PresencePenalty = float32(*sampling.PresencePenalty)
+	}
+	if sampling.FrequencyPenalty != nil {
+		request.FrequencyPenalty = float32(*sampling.FrequencyPenalty)
+	}
+}
+
+// nonZero converts a sampling value for the request. go-openai leaves the zero values out of the
+//request, and the API then uses its default (1 for temperature), so a zero is sent as the smallest float
+func nonZero(value float64) float32 {
+	if value == 0 {
+		return math.SmallestNonzeroFloat32
+	}
+
+	return float32(value)
+}
@@ -0,0 +1,90 @@
+package ai
+
+import (
+	"math"
+	"testing"
+
+	"github.com/akhilsharma90/terminal-assistant/config"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSampling tests that the sampling parameters of each mode are sent with the requests.
+func TestSampling(t *testing.T) {
+	t.Run("ExecMode", testSamplingExecMode)
+	t.Run("ChatMode", testSamplingChatMode)
+	t.Run("Override", testSamplingOverride)
+}
+
+// newSamplingTestConfig returns a config with a shared temperature and different sampling parameters per mode.
+func newSamplingTestConfig(t *testing.T, url string) *config.Config {
+	t.Helper()
+
+	return newTestConfig(t, map[string]interface{}{
+		"OPENAI_BASE_URL":      url,
+		"OPENAI_TEMPERATURE":   0.7,
+		"OPENAI_EXEC_SAMPLING": map[string]interface{}{"temperature": 0, "seed": 42, "stop": []string{"\n\n"}},
+		"OPENAI_CHAT_SAMPLING": map[string]interface{}{"top_p": 0.9, "presence_penalty": 0.5, "frequency_penalty": 0.25},
+	})
+}
+
+// testSamplingExecMode checks the exec parameters, a zero temperature must be sent rather than left out.
+func testSamplingExecMode(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, `{"cmd":"ls","exp":"list files","exec":true}`)
+	engine, err := NewEngine(ExecEngineMode, newSamplingTestConfig(t, server.URL))
+	require.NoError(t, err)
+
+	_, err = engine.ExecCompletion("list files")
+	require.NoError(t, err)
+
+	require.Len(t, requests, 1)
+	assert.Equal(t, float32(math.SmallestNonzeroFloat32), requests[0].Temperature)
+	require.NotNil(t, requests[0].Seed)
+	assert.Equal(t, 42, *requests[0].Seed)
+	assert.Equal(t, []string{"\n\n"}, requests[0].Stop)
+	assert.Zero(t, requests[0].TopP)
+}
+
+// testSamplingChatMode checks the chat parameters, the shared temperature applies as chat doesn't set one.
+func testSamplingChatMode(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, "4")
+	engine, err := NewEngine(ChatEngineMode, newSamplingTestConfig(t, server.URL))
+	require.NoError(t, err)
+
+	go engine.ChatStreamCompletion("What is 2+2 ?")
+	for output := range engine.GetChannel() {
+		if output.IsLast() {
+			break
+		}
+	}
+
+	require.Len(t, requests, 1)
+	assert.Equal(t, float32(0.7), requests[0].Temperature)
+	assert.Equal(t, float32(0.9), requests[0].TopP)
+	assert.Equal(t, float32(0.5), requests[0].PresencePenalty)
+	assert.Equal(t, float32(0.25), requests[0].FrequencyPenalty)
+	assert.Nil(t, requests[0].Seed)
+}
+
+// testSamplingOverride checks that the parameters of the invocation win over the ones of the config.
+func testSamplingOverride(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, `{"cmd":"ls","exp":"list files","exec":true}`)
+	engine, err := NewEngine(ExecEngineMode, newSamplingTestConfig(t, server.URL))
+	require.NoError(t, err)
+
+	temperature, seed := 1.2, 7
+	engine.SetSampling(config.SamplingConfig{Temperature: &temperature, Seed: &seed})
+
+	_, err = engine.ExecCompletion("list files")
+	require.NoError(t, err)
+
+	require.Len(t, requests, 1)
+	assert.Equal(t, float32(1.2), requests[0].Temperature)
+	assert.Equal(t, 7, *requests[0].Seed)
+	assert.Equal(t, []string{"\n\n"}, requests[0].Stop)
+}
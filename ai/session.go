@@ -0,0 +1,42 @@
+package ai
+
+import (
+	"github.com/akhilsharma90/terminal-assistant/session"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// SaveSession copies the conversation of the engine into the session: the messages of every mode, the
+//mode, the model and the piped input. the session still has to be written to its store
+func (e *Engine) SaveSession(s *session.Session) *Engine {
+	defer e.lock()()
+	s.Mode = e.mode.String()
+	s.Model = e.getModel()
+	s.Pipe = e.pipe
+	s.ExecMessages = copyMessages(e.execMessages)
+	s.ChatMessages = copyMessages(e.chatMessages)
+	s.ExplainMessages = copyMessages(e.explainMessages)
+
+	return e
+}
+
+// RestoreSession picks the conversation of the session up where it was left: its messages replace the
+//ones of the engine, and its piped input is restored unless another one was given to the engine
+func (e *Engine) RestoreSession(s *session.Session) *Engine {
+	defer e.lock()()
+	e.execMessages = copyMessages(s.ExecMessages)
+	e.chatMessages = copyMessages(s.ChatMessages)
+	e.explainMessages = copyMessages(s.ExplainMessages)
+	if e.pipe == "" && s.Pipe != "" {
+		e.pipe = s.Pipe
+		e.pipeDigest = ""
+		e.pipeDigests = nil
+	}
+
+	return e
+}
+
+// copyMessages returns a copy of the messages, never nil, so the engine and the session don't share them.
+func copyMessages(messages []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	return append([]openai.ChatCompletionMessage{}, messages...)
+}
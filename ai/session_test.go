@@ -0,0 +1,66 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/akhilsharma90/terminal-assistant/session"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSession tests the conversation of the engine saved in a session and picked up again.
+func TestSession(t *testing.T) {
+	t.Run("SaveAndRestore", testSessionSaveAndRestore)
+	t.Run("RestorePipe", testSessionRestorePipe)
+}
+
+// testSessionSaveAndRestore checks that a restored conversation is sent with the next question.
+func testSessionSaveAndRestore(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests,
+		`{"cmd":"du -sh *","exp":"size of each file","exec":true}`,
+		`{"cmd":"du -sh * | sort -h","exp":"size of each file, sorted","exec":true}`,
+	)
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL}))
+	require.NoError(t, err)
+	engine.SetPipe("go.mod\nmain.go")
+
+	_, err = engine.ExecCompletion("size of the files here")
+	require.NoError(t, err)
+	saved := &session.Session{}
+	engine.SaveSession(saved)
+	assert.Equal(t, "exec", saved.Mode)
+	assert.Equal(t, "test_model", saved.Model)
+	assert.Equal(t, "go.mod\nmain.go", saved.Pipe)
+	require.Len(t, saved.ExecMessages, 2)
+	assert.Empty(t, saved.ChatMessages)
+
+	//the session doesn't share the messages of the engine
+	engine.Reset()
+	assert.Len(t, saved.ExecMessages, 2)
+
+	resumed, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL}))
+	require.NoError(t, err)
+	resumed.RestoreSession(saved)
+	_, err = resumed.ExecCompletion("sort that by size")
+	require.NoError(t, err)
+
+	require.Len(t, requests, 2)
+	messages := requests[1].Messages
+	assert.Equal(t, "size of the files here", messages[len(messages)-3].Content)
+	assert.Equal(t, "sort that by size", messages[len(messages)-1].Content)
+	assert.Contains(t, messages[1].Content, "main.go")
+}
+
+// testSessionRestorePipe checks that a piped input given to the engine is kept over the one of the session.
+func testSessionRestorePipe(t *testing.T) {
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, nil))
+	require.NoError(t, err)
+
+	engine.SetPipe("new input").RestoreSession(&session.Session{Pipe: "old input"})
+	saved := &session.Session{}
+	engine.SaveSession(saved)
+	assert.Equal(t, "new input", saved.Pipe)
+}
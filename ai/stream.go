@@ -0,0 +1,162 @@
+package ai
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+//the exec answers are streamed, the JSON object arrives a few characters at a time. it is scanned
+//after each chunk for the fields cmd and exp, so the command can be shown as soon as it is complete
+//while the explanation is still arriving
+
+// EnginePartialExecOutput represents an exec answer which is still arriving.
+type EnginePartialExecOutput struct {
+	command         string // Command received so far
+	commandComplete bool   // Indicates if the whole command was received
+	explanation     string // Explanation received so far
+}
+
+// GetCommand returns the command received so far.
+func (po EnginePartialExecOutput) GetCommand() string {
+	return po.command
+}
+
+// IsCommandComplete returns a boolean indicating if the whole command was received.
+func (po EnginePartialExecOutput) IsCommandComplete() bool {
+	return po.commandComplete
+}
+
+// GetExplanation returns the explanation received so far.
+func (po EnginePartialExecOutput) GetExplanation() string {
+	return po.explanation
+}
+
+// HasCommand returns a boolean indicating if a complete and non empty command was received.
+func (po EnginePartialExecOutput) HasCommand() bool {
+	return po.commandComplete && strings.TrimSpace(po.command) != ""
+}
+
+// scanPartialExecOutput reads the fields cmd and exp of the top level object of a JSON answer which
+//may be cut anywhere. whatever comes before the object, like a code fence, is skipped, and the
+//scan stops at the first thing which is incomplete or not JSON
+func scanPartialExecOutput(content string) EnginePartialExecOutput {
+	var output EnginePartialExecOutput
+
+	i := strings.IndexByte(content, '{')
+	if i < 0 {
+		return output
+	}
+	i++
+
+	for {
+		i = skipJsonSeparators(content, i)
+		if i >= len(content) || content[i] != '"' {
+			return output
+		}
+		key, complete, next := scanJsonString(content, i)
+		if !complete {
+			return output
+		}
+
+		i = skipJsonSeparators(content, next)
+		if i >= len(content) || content[i] != ':' {
+			return output
+		}
+		i = skipJsonSeparators(content, i+1)
+		if i >= len(content) {
+			return output
+		}
+
+		//only the string values are read, the others are skipped whatever their size
+		if content[i] != '"' {
+			next, complete = skipJsonValue(content, i)
+		} else {
+			var value string
+			value, complete, next = scanJsonString(content, i)
+			switch key {
+			case "cmd":
+				output.command = value
+				output.commandComplete = complete
+			case "exp":
+				output.explanation = value
+			}
+		}
+		if !complete {
+			return output
+		}
+		i = next
+	}
+}
+
+// skipJsonSeparators returns the position of the first character from i which is neither a space nor a comma.
+func skipJsonSeparators(content string, i int) int {
+	for i < len(content) && strings.IndexByte(" \t\r\n,", content[i]) >= 0 {
+		i++
+	}
+
+	return i
+}
+
+// scanJsonString decodes the JSON string starting with the quote at the given position. when it is
+//cut, the characters received so far are decoded, without a trailing escape sequence which is not
+//complete yet. next is the position after the closing quote
+func scanJsonString(content string, start int) (value string, complete bool, next int) {
+	//end is the position after the last character or escape sequence which is complete
+	end := start + 1
+	for i := start + 1; i < len(content); {
+		switch content[i] {
+		case '"':
+			json.Unmarshal([]byte(content[start:i+1]), &value)
+			return value, true, i + 1
+		case '\\':
+			size := 2
+			if i+1 < len(content) && content[i+1] == 'u' {
+				size = 6
+			}
+			if i+size > len(content) {
+				i = len(content)
+				continue
+			}
+			i += size
+		default:
+			i++
+		}
+		end = i
+	}
+
+	json.Unmarshal([]byte(content[start:end]+`"`), &value)
+	return value, false, len(content)
+}
+
+// skipJsonValue skips the JSON value which is not a string starting at the given position: an
+//object, an array, a number, a boolean or null. complete is false when the value is cut
+func skipJsonValue(content string, start int) (next int, complete bool) {
+	depth := 0
+	for i := start; i < len(content); i++ {
+		switch content[i] {
+		case '"':
+			_, complete, next := scanJsonString(content, i)
+			if !complete {
+				return next, false
+			}
+			i = next - 1
+		case '{', '[':
+			depth++
+		case '}', ']':
+			//the end of the enclosing object ends a scalar value
+			if depth == 0 {
+				return i, true
+			}
+			depth--
+			if depth == 0 {
+				return i + 1, true
+			}
+		case ',', ' ', '\t', '\r', '\n':
+			if depth == 0 {
+				return i, true
+			}
+		}
+	}
+
+	return len(content), false
+}
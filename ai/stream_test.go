@@ -0,0 +1,86 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestScanPartialExecOutput is a test function for testing the scan of exec answers cut anywhere
+func TestScanPartialExecOutput(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		command     string
+		complete    bool
+		explanation string
+	}{
+		{
+			name:    "Empty",
+			content: "",
+		},
+		{
+			name:    "KeyOnly",
+			content: `{"cm`,
+		},
+		{
+			name:     "CommandCut",
+			content:  `{"cmd":"ls -l`,
+			command:  "ls -l",
+			complete: false,
+		},
+		{
+			name:     "CommandComplete",
+			content:  `{"cmd":"ls -l",`,
+			command:  "ls -l",
+			complete: true,
+		},
+		{
+			name:        "ExplanationCut",
+			content:     `{"cmd":"ls -l","exp":"list the fi`,
+			command:     "ls -l",
+			complete:    true,
+			explanation: "list the fi",
+		},
+		{
+			name:     "EscapeCut",
+			content:  `{"cmd":"echo \"hi\" \`,
+			command:  `echo "hi" `,
+			complete: false,
+		},
+		{
+			name:     "UnicodeEscapeCut",
+			content:  `{"cmd":"echo é \u00`,
+			command:  "echo é ",
+			complete: false,
+		},
+		{
+			name:        "OtherFieldsFirst",
+			content:     "```json\n{\"exec\": true, \"steps\": [{\"cmd\":\"a}\"}], \"cmd\": \"pwd\", \"exp\": \"print\"}",
+			command:     "pwd",
+			complete:    true,
+			explanation: "print",
+		},
+		{
+			name:    "NotJson",
+			content: "I cannot generate a command for this",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output := scanPartialExecOutput(test.content)
+
+			assert.Equal(t, test.command, output.GetCommand())
+			assert.Equal(t, test.complete, output.IsCommandComplete())
+			assert.Equal(t, test.explanation, output.GetExplanation())
+		})
+	}
+}
+
+// TestEnginePartialExecOutputHasCommand is a test function for testing the HasCommand method of the EnginePartialExecOutput type
+func TestEnginePartialExecOutputHasCommand(t *testing.T) {
+	assert.True(t, EnginePartialExecOutput{command: "ls", commandComplete: true}.HasCommand())
+	assert.False(t, EnginePartialExecOutput{command: "ls", commandComplete: false}.HasCommand())
+	assert.False(t, EnginePartialExecOutput{command: " ", commandComplete: true}.HasCommand())
+}
@@ -0,0 +1,180 @@
+package ai
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/akhilsharma90/terminal-assistant/export"
+	"github.com/akhilsharma90/terminal-assistant/session"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+//a session only holds the messages sent to the model, the transcript is read back from them: the
+//attachments and the results of the executed commands are messages of their own, the probes are
+//left out, and the JSON answers of the exec and explain modes are turned back into text
+
+// commandResultPattern matches the message added by AppendCommandResult, with the command and its exit code.
+var commandResultPattern = regexp.MustCompile("(?s)^I executed `(.*?)`, it exited with code (-?\\d+)\\.")
+
+// attachmentPrefixes start the messages of the attachments, see Attachment.message.
+var attachmentPrefixes = []string{"Content of the attached file ", "Listing of the attached directory "}
+
+// probePrefixes start the messages holding the output of a probe, see runProbe.
+var probePrefixes = []string{"Output of the probe `", "The probe `", probeLimitPrompt}
+
+// Transcribe turns the conversation saved in the session into a transcript to export, the turns of
+//each mode one after the other
+func Transcribe(s *session.Session) export.Transcript {
+	transcript := export.Transcript{
+		Id:        s.ID,
+		Name:      s.Name,
+		Directory: s.Directory,
+		Model:     s.Model,
+		Created:   s.Created,
+		Updated:   s.Updated,
+		Turns:     []export.Turn{},
+	}
+	for _, conversation := range []struct {
+		mode     EngineMode
+		messages []openai.ChatCompletionMessage
+	}{
+		{mode: ExecEngineMode, messages: s.ExecMessages},
+		{mode: ChatEngineMode, messages: s.ChatMessages},
+		{mode: ExplainEngineMode, messages: s.ExplainMessages},
+	} {
+		transcript.Turns = append(transcript.Turns, transcribeMessages(conversation.mode, conversation.messages)...)
+	}
+
+	return transcript
+}
+
+// transcribeMessages turns the messages of a mode into turns, one for each prompt of the user.
+func transcribeMessages(mode EngineMode, messages []openai.ChatCompletionMessage) []export.Turn {
+	var turns []export.Turn
+	var attachments []string
+	for _, message := range messages {
+		switch message.Role {
+		case openai.ChatMessageRoleSystem:
+			if strings.HasPrefix(message.Content, summaryPrefix) {
+				turns = append(turns, export.Turn{
+					Mode:    mode.String(),
+					Answer:  strings.TrimPrefix(message.Content, summaryPrefix),
+					Summary: true,
+				})
+			}
+		case openai.ChatMessageRoleUser:
+			if reference, ok := transcribeAttachment(message.Content); ok {
+				attachments = append(attachments, reference)
+				continue
+			}
+			if hasAnyPrefix(message.Content, probePrefixes) {
+				continue
+			}
+			if result := commandResultPattern.FindStringSubmatch(message.Content); result != nil {
+				if len(turns) == 0 {
+					turns = append(turns, export.Turn{Mode: mode.String()})
+				}
+				exitCode, _ := strconv.Atoi(result[2])
+				transcribeCommandResult(&turns[len(turns)-1], result[1], exitCode)
+				continue
+			}
+			turns = append(turns, export.Turn{Mode: mode.String(), Prompt: message.Content, Attachments: attachments})
+			attachments = nil
+		case openai.ChatMessageRoleAssistant:
+			if len(turns) == 0 {
+				continue
+			}
+			transcribeAnswer(&turns[len(turns)-1], mode, message.Content)
+		}
+	}
+
+	return turns
+}
+
+// transcribeAttachment returns the reference of the attachment held by the message, if it holds one.
+func transcribeAttachment(content string) (string, bool) {
+	for _, prefix := range attachmentPrefixes {
+		if strings.HasPrefix(content, prefix) {
+			label := strings.SplitN(strings.TrimPrefix(content, prefix), "\n", 2)[0]
+			return strings.TrimSuffix(label, ":"), true
+		}
+	}
+
+	return "", false
+}
+
+// transcribeCommandResult marks the proposed command as executed with its exit code. a command which
+//was not proposed, or which is executed once more, is added to the commands of the turn
+func transcribeCommandResult(turn *export.Turn, command string, exitCode int) {
+	for i := range turn.Commands {
+		if !turn.Commands[i].Executed && normalizeCommand(turn.Commands[i].Command) == normalizeCommand(command) {
+			turn.Commands[i].Executed = true
+			turn.Commands[i].ExitCode = &exitCode
+			return
+		}
+	}
+
+	turn.Commands = append(turn.Commands, export.Command{Command: command, Executed: true, ExitCode: &exitCode})
+}
+
+// transcribeAnswer sets the answer of the turn from the message of the model. the answers asking for a
+//probe are left out, the answer given after the probes is the one of the turn
+func transcribeAnswer(turn *export.Turn, mode EngineMode, content string) {
+	if content == interrupted {
+		turn.Interrupted = true
+		return
+	}
+
+	switch mode {
+	case ExecEngineMode:
+		output, err := parseEngineExecOutput(content)
+		if err != nil {
+			turn.Answer = content
+			return
+		}
+		if output.IsProbe() {
+			return
+		}
+		turn.Answer = output.GetExplanation()
+		turn.Commands = nil
+		if output.IsPlan() {
+			for _, step := range output.GetSteps() {
+				turn.Commands = append(turn.Commands, export.Command{Command: step.GetCommand(), Explanation: step.GetExplanation()})
+			}
+		}
+		for _, candidate := range output.GetCandidates() {
+			turn.Commands = append(turn.Commands, export.Command{Command: candidate.GetCommand(), Explanation: candidate.GetExplanation()})
+		}
+	case ExplainEngineMode:
+		output, err := parseEngineExplainOutput(content)
+		if err != nil {
+			turn.Answer = content
+			return
+		}
+		lines := []string{output.GetSummary(), ""}
+		for i, stage := range output.GetStages() {
+			lines = append(lines, fmt.Sprintf("%d. %s: %s", i+1, export.CodeSpan(stage.GetCommand()), stage.GetExplanation()))
+		}
+		turn.Answer = strings.TrimSpace(strings.Join(lines, "\n"))
+	default:
+		if strings.HasSuffix(content, " "+interrupted) {
+			turn.Interrupted = true
+			content = strings.TrimSuffix(content, " "+interrupted)
+		}
+		turn.Answer = content
+	}
+}
+
+// hasAnyPrefix returns a boolean indicating if the text starts with one of the prefixes.
+func hasAnyPrefix(text string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
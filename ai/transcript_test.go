@@ -0,0 +1,98 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/akhilsharma90/terminal-assistant/session"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTranscribe tests the transcript read back from the messages of a session.
+func TestTranscribe(t *testing.T) {
+	t.Run("Exec", testTranscribeExec)
+	t.Run("ChatAndExplain", testTranscribeChatAndExplain)
+}
+
+// testTranscribeExec checks that the attachments, the probes and the executed commands of an exec
+//conversation end up in the right turns
+func testTranscribeExec(t *testing.T) {
+	user := func(content string) openai.ChatCompletionMessage {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: content}
+	}
+	assistant := func(content string) openai.ChatCompletionMessage {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content}
+	}
+
+	transcript := Transcribe(&session.Session{
+		ID:   "1a2b3c4d",
+		Name: "deploy",
+		ExecMessages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: summaryPrefix + "The user cleaned the logs."},
+			user("Content of the attached file deploy.sh:\n```\nmake\n```"),
+			user("run @deploy.sh"),
+			assistant(`{"probe":"ls"}`),
+			user("Output of the probe `ls`:\ndeploy.sh"),
+			assistant(`{"cmd":"sh deploy.sh","exp":"run the script","exec":true,"alternatives":[{"cmd":"bash deploy.sh","exp":"run it with bash"}]}`),
+			user("I executed `bash  deploy.sh`, it exited with code 2.\nstdout:\n(empty)\nstderr:\nfailed"),
+			user("I executed `make clean`, it exited with code 0.\nstdout:\n(empty)\nstderr:\n(empty)"),
+			user("plan a release"),
+			assistant(`{"cmd":"","exp":"two steps","exec":true,"steps":[{"cmd":"make","exp":"build"},{"cmd":"make release","exp":"release"}]}`),
+			user("and then?"),
+			assistant(interrupted),
+		},
+	})
+
+	assert.Equal(t, "1a2b3c4d", transcript.Id)
+	assert.Equal(t, "deploy", transcript.Name)
+	require.Len(t, transcript.Turns, 4)
+
+	assert.True(t, transcript.Turns[0].Summary)
+	assert.Equal(t, "The user cleaned the logs.", transcript.Turns[0].Answer)
+
+	turn := transcript.Turns[1]
+	assert.Equal(t, "exec", turn.Mode)
+	assert.Equal(t, "run @deploy.sh", turn.Prompt)
+	assert.Equal(t, []string{"deploy.sh"}, turn.Attachments)
+	assert.Equal(t, "run the script", turn.Answer)
+	require.Len(t, turn.Commands, 3)
+	assert.Equal(t, "sh deploy.sh", turn.Commands[0].Command)
+	assert.False(t, turn.Commands[0].Executed)
+	assert.True(t, turn.Commands[1].Executed)
+	assert.Equal(t, 2, *turn.Commands[1].ExitCode)
+	assert.Equal(t, "make clean", turn.Commands[2].Command)
+	assert.Equal(t, 0, *turn.Commands[2].ExitCode)
+
+	turn = transcript.Turns[2]
+	require.Len(t, turn.Commands, 2)
+	assert.Equal(t, "make release", turn.Commands[1].Command)
+	assert.Empty(t, turn.Attachments)
+
+	assert.True(t, transcript.Turns[3].Interrupted)
+	assert.Empty(t, transcript.Turns[3].Answer)
+}
+
+// testTranscribeChatAndExplain checks that the chat answers are kept as they are, and that the explain
+//answers are turned back into text
+func testTranscribeChatAndExplain(t *testing.T) {
+	transcript := Transcribe(&session.Session{
+		ChatMessages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "what is a pipe?"},
+			{Role: openai.ChatMessageRoleAssistant, Content: "A pipe sends **the output** of a command " + interrupted},
+		},
+		ExplainMessages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "ls | wc -l"},
+			{Role: openai.ChatMessageRoleAssistant, Content: `{"summary":"counts the files","stages":[{"cmd":"ls","exp":"lists the files","parts":[]},{"cmd":"wc -l","exp":"counts the lines","parts":[]}]}`},
+		},
+	})
+
+	require.Len(t, transcript.Turns, 2)
+	assert.Equal(t, "chat", transcript.Turns[0].Mode)
+	assert.Equal(t, "A pipe sends **the output** of a command", transcript.Turns[0].Answer)
+	assert.True(t, transcript.Turns[0].Interrupted)
+
+	assert.Equal(t, "explain", transcript.Turns[1].Mode)
+	assert.Equal(t, "counts the files\n\n1. `ls`: lists the files\n2. `wc -l`: counts the lines", transcript.Turns[1].Answer)
+}
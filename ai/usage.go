@@ -0,0 +1,52 @@
+package ai
+
+import (
+	"github.com/akhilsharma90/terminal-assistant/usage"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// SetLedger sets the ledger recording the usage of the requests, nil disables the accounting.
+func (e *Engine) SetLedger(ledger *usage.Ledger) *Engine {
+	defer e.lock()()
+	e.ledger = ledger
+
+	return e
+}
+
+// GetLedger returns the ledger recording the usage of the requests.
+func (e *Engine) GetLedger() *usage.Ledger {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.ledger
+}
+
+// checkBudget returns an error once the hard budget of the ledger is reached, the request is then not sent.
+func (e *Engine) checkBudget() error {
+	if e.ledger == nil {
+		return nil
+	}
+
+	return e.ledger.CheckBudget()
+}
+
+// recordUsage records the tokens used by a request in the ledger. when the API didn't return them, like
+//a backend which doesn't send the usage of a streamed answer, they are estimated from the request and
+//the answer
+func (e *Engine) recordUsage(request openai.ChatCompletionRequest, used openai.Usage, answer string) {
+	if e.ledger == nil {
+		return
+	}
+
+	promptTokens, completionTokens := used.PromptTokens, used.CompletionTokens
+	estimated := promptTokens == 0 && completionTokens == 0
+	if estimated {
+		tokenizer := getModelTokenizer(request.Model)
+		promptTokens = tokenizer.countMessagesTokens(request.Messages)
+		completionTokens = tokenizer.countTokens(answer)
+	}
+
+	//the ledger is only accounting, failing to write it must not fail the request
+	e.ledger.Add(request.Model, e.mode.String(), promptTokens, completionTokens, estimated)
+}
@@ -0,0 +1,145 @@
+package ai
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/akhilsharma90/terminal-assistant/usage"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUsage tests the accounting of the requests in the ledger.
+func TestUsage(t *testing.T) {
+	t.Run("RecordExec", testUsageRecordExec)
+	t.Run("RecordChatStream", testUsageRecordChatStream)
+	t.Run("Estimated", testUsageEstimated)
+	t.Run("HardBudget", testUsageHardBudget)
+}
+
+// newTestLedger returns an in memory ledger pricing the test model at a dollar per thousand tokens.
+func newTestLedger(t *testing.T, hardBudget float64) *usage.Ledger {
+	t.Helper()
+
+	prices := usage.NewPriceTable(map[string]usage.Price{"test_model": {Prompt: 1000, Completion: 1000}})
+	ledger, err := usage.NewLedger("", prices, 0, hardBudget)
+	require.NoError(t, err)
+
+	return ledger
+}
+
+// testUsageRecordExec checks that the usage of an exec answer is recorded with the model and the mode,
+//the usage of the stream being asked for
+func testUsageRecordExec(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, `{"cmd":"ls","exp":"list files","exec":true}`)
+
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL}))
+	require.NoError(t, err)
+	engine.SetLedger(newTestLedger(t, 0))
+
+	_, err = engine.ExecCompletion("list files")
+	require.NoError(t, err)
+
+	require.Len(t, requests, 1)
+	require.NotNil(t, requests[0].StreamOptions)
+	assert.True(t, requests[0].StreamOptions.IncludeUsage)
+	records := engine.GetLedger().GetRecords()
+	require.Len(t, records, 1)
+	assert.Equal(t, "test_model", records[0].Model)
+	assert.Equal(t, "exec", records[0].Mode)
+	assert.False(t, records[0].Estimated)
+	assert.Equal(t, 3, records[0].PromptTokens)
+	assert.Equal(t, 5, records[0].CompletionTokens)
+}
+
+// testUsageRecordChatStream checks that the usage sent at the end of a chat stream is recorded.
+func testUsageRecordChatStream(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, "The answer for `2+2` is `4`")
+
+	engine, err := NewEngine(ChatEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL}))
+	require.NoError(t, err)
+	engine.SetLedger(newTestLedger(t, 0))
+	streamChat(t, engine)
+
+	require.Len(t, requests, 1)
+	require.NotNil(t, requests[0].StreamOptions)
+	assert.True(t, requests[0].StreamOptions.IncludeUsage)
+	records := engine.GetLedger().GetRecords()
+	require.Len(t, records, 1)
+	assert.Equal(t, "chat", records[0].Mode)
+	assert.False(t, records[0].Estimated)
+	assert.Equal(t, 3, records[0].PromptTokens)
+	assert.Equal(t, 5, records[0].CompletionTokens)
+}
+
+// testUsageEstimated checks that the usage of a stream is estimated when the backend doesn't send it.
+func testUsageEstimated(t *testing.T) {
+	server := httptest.NewServer(testProviderServers[OllamaProviderName]("The answer for `2+2` is `4`", true))
+	defer server.Close()
+
+	engine, err := NewEngine(ChatEngineMode, newTestConfig(t, map[string]interface{}{
+		"OPENAI_PROVIDER": OllamaProviderName,
+		"OPENAI_BASE_URL": server.URL,
+	}))
+	require.NoError(t, err)
+	engine.SetLedger(newTestLedger(t, 0))
+	streamChat(t, engine)
+
+	records := engine.GetLedger().GetRecords()
+	require.Len(t, records, 1)
+	assert.True(t, records[0].Estimated)
+	assert.Equal(t, getModelTokenizer("test_model").countTokens("The answer for `2+2` is `4`"), records[0].CompletionTokens)
+	assert.Greater(t, records[0].PromptTokens, 0)
+}
+
+// streamChat asks a question to the chat engine and reads its answer until the end of the stream.
+func streamChat(t *testing.T, engine *Engine) {
+	t.Helper()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- engine.ChatStreamCompletion("What is 2+2 ?")
+	}()
+	for output := range engine.GetChannel() {
+		if output.IsLast() {
+			break
+		}
+	}
+	require.NoError(t, <-errs)
+}
+
+// testUsageHardBudget checks that nothing is sent once the hard budget is reached.
+func testUsageHardBudget(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := newRecordingServer(t, &requests, `{"cmd":"ls","exp":"list files","exec":true}`)
+
+	engine, err := NewEngine(ExecEngineMode, newTestConfig(t, map[string]interface{}{"OPENAI_BASE_URL": server.URL}))
+	require.NoError(t, err)
+	ledger := newTestLedger(t, 1)
+	_, err = ledger.Add("test_model", "exec", 1000, 0, false)
+	require.NoError(t, err)
+	engine.SetLedger(ledger)
+
+	_, err = engine.ExecCompletion("list files")
+	assert.ErrorIs(t, err, usage.ErrHardBudgetExceeded)
+	assert.Empty(t, requests)
+	assert.Empty(t, engine.execMessages)
+
+	//the error of a chat stream is only returned
+	engine.SetMode(ChatEngineMode)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- engine.ChatStreamCompletion("What is 2+2 ?")
+	}()
+	select {
+	case <-engine.GetChannel():
+		assert.Fail(t, "Nothing should be sent on the channel.")
+	case err := <-errs:
+		assert.ErrorIs(t, err, usage.ErrHardBudgetExceeded)
+	}
+	assert.Empty(t, requests)
+}
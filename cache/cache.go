@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//the answers of the exec requests are kept on disk, so asking the same question in the same context
+//doesn't hit the API again. each answer is a JSON file named after the hash of the request it answers,
+//it expires after the TTL, and the oldest answers are removed once the cache is over its size cap
+
+// ErrMiss is returned by Get when there is no cached answer for a request.
+var ErrMiss = errors.New("no cached answer")
+
+// entryExtension is the extension of the files of the cache directory holding an answer.
+const entryExtension = ".json"
+
+// Entry is a cached answer.
+type Entry struct {
+	Time    time.Time `json:"time"`    // When the answer was cached
+	Content string    `json:"content"` // Content of the answer
+}
+
+// Cache stores the answers of the requests in a directory.
+type Cache struct {
+	dir     string           // Directory of the answers, one file per answer
+	ttl     time.Duration    // How long an answer is kept, 0 means forever
+	maxSize int64            // Maximum size of the answers in bytes, 0 means no limit
+	now     func() time.Time // Returns the current time, replaced in tests
+	mu      sync.Mutex       // Guards the files of the directory
+}
+
+// NewCache opens the cache stored in the given directory, it is created if missing.
+func NewCache(dir string, ttl time.Duration, maxSize int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Cache{
+		dir:     dir,
+		ttl:     ttl,
+		maxSize: maxSize,
+		now:     time.Now,
+	}, nil
+}
+
+// Key returns the key of a request, the hash of its JSON encoding. every field of the request counts,
+//like the model, the messages with the system prompt, and the sampling parameters
+func Key(request interface{}) (string, error) {
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(encoded)
+
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// path returns the file of the answer of the given key.
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key+entryExtension)
+}
+
+// isExpired tells if an answer cached at the given time is too old to be used.
+func (c *Cache) isExpired(cached time.Time) bool {
+	return c.ttl > 0 && c.now().Sub(cached) > c.ttl
+}
+
+// Get returns the cached answer of the given key, or ErrMiss. an expired or broken answer is removed.
+func (c *Cache) Get(key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	content, err := os.ReadFile(c.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrMiss
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(content, &entry); err != nil || c.isExpired(entry.Time) {
+		os.Remove(c.path(key))
+		return "", ErrMiss
+	}
+
+	return entry.Content, nil
+}
+
+// Put caches the answer of the given key, then removes the oldest answers if the cache is over its size cap.
+func (c *Cache) Put(key string, content string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	encoded, err := json.Marshal(Entry{Time: now, Content: content})
+	if err != nil {
+		return err
+	}
+	//the answer is written aside then moved, so a crash never leaves a half written answer
+	tmp, err := os.CreateTemp(c.dir, key+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(encoded); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	//the modification time orders the answers when pruning, it follows the clock of the cache
+	if err := os.Chtimes(c.path(key), now, now); err != nil {
+		return err
+	}
+
+	return c.prune()
+}
+
+// Delete removes the cached answer of the given key, if any.
+func (c *Cache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.Remove(c.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// prune removes the expired answers, then the oldest ones until the cache fits in its size cap.
+func (c *Cache) prune() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	var (
+		files []os.FileInfo
+		size  int64
+	)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), entryExtension) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if c.isExpired(info.ModTime()) {
+			os.Remove(filepath.Join(c.dir, info.Name()))
+			continue
+		}
+		files = append(files, info)
+		size += info.Size()
+	}
+	if c.maxSize <= 0 {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, file := range files {
+		if size <= c.maxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, file.Name())); err != nil {
+			return err
+		}
+		size -= file.Size()
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCache opens a cache in a temporary directory, whose clock is set to the returned time.
+func newTestCache(t *testing.T, ttl time.Duration, maxSize int64) (*Cache, *time.Time) {
+	t.Helper()
+
+	cache, err := NewCache(filepath.Join(t.TempDir(), "cache"), ttl, maxSize)
+	require.NoError(t, err)
+	now := time.Date(2024, time.March, 15, 12, 0, 0, 0, time.Local)
+	cache.now = func() time.Time { return now }
+
+	return cache, &now
+}
+
+func TestCache(t *testing.T) {
+	// TestKey tests that the key changes with any field of the request.
+	t.Run("Key", func(t *testing.T) {
+		type request struct {
+			Model       string
+			Temperature float32
+		}
+		key, err := Key(request{Model: "test_model", Temperature: 0.2})
+		require.NoError(t, err)
+		same, err := Key(request{Model: "test_model", Temperature: 0.2})
+		require.NoError(t, err)
+		other, err := Key(request{Model: "test_model", Temperature: 0.7})
+		require.NoError(t, err)
+
+		assert.Equal(t, key, same)
+		assert.NotEqual(t, key, other)
+		assert.Len(t, key, 64)
+	})
+
+	// TestGetPut tests that an answer is found once cached, and survives reopening the cache.
+	t.Run("GetPut", func(t *testing.T) {
+		cache, _ := newTestCache(t, time.Hour, 0)
+
+		_, err := cache.Get("key")
+		assert.ErrorIs(t, err, ErrMiss)
+
+		require.NoError(t, cache.Put("key", `{"cmd":"ls"}`))
+		content, err := cache.Get("key")
+		require.NoError(t, err)
+		assert.Equal(t, `{"cmd":"ls"}`, content)
+
+		reopened, err := NewCache(cache.dir, 0, 0)
+		require.NoError(t, err)
+		content, err = reopened.Get("key")
+		require.NoError(t, err)
+		assert.Equal(t, `{"cmd":"ls"}`, content)
+	})
+
+	// TestExpired tests that an answer older than the TTL is not used anymore, and removed.
+	t.Run("Expired", func(t *testing.T) {
+		cache, now := newTestCache(t, time.Hour, 0)
+		require.NoError(t, cache.Put("key", "answer"))
+
+		*now = now.Add(2 * time.Hour)
+		_, err := cache.Get("key")
+		assert.ErrorIs(t, err, ErrMiss)
+		assert.NoFileExists(t, cache.path("key"))
+	})
+
+	// TestBroken tests that a broken answer is a miss.
+	t.Run("Broken", func(t *testing.T) {
+		cache, _ := newTestCache(t, time.Hour, 0)
+		require.NoError(t, os.WriteFile(cache.path("key"), []byte("{"), 0600))
+
+		_, err := cache.Get("key")
+		assert.ErrorIs(t, err, ErrMiss)
+	})
+
+	// TestDelete tests that a deleted answer is a miss, and that deleting a missing answer is fine.
+	t.Run("Delete", func(t *testing.T) {
+		cache, _ := newTestCache(t, time.Hour, 0)
+		require.NoError(t, cache.Put("key", "answer"))
+
+		require.NoError(t, cache.Delete("key"))
+		_, err := cache.Get("key")
+		assert.ErrorIs(t, err, ErrMiss)
+		assert.NoError(t, cache.Delete("key"))
+	})
+
+	// TestSizeCap tests that the oldest answers are removed once the cache is over its size cap.
+	t.Run("SizeCap", func(t *testing.T) {
+		cache, now := newTestCache(t, 0, 200)
+
+		for _, key := range []string{"first", "second", "third"} {
+			require.NoError(t, cache.Put(key, "an answer of some length"))
+			*now = now.Add(time.Minute)
+		}
+
+		_, err := cache.Get("first")
+		assert.ErrorIs(t, err, ErrMiss)
+		for _, key := range []string{"second", "third"} {
+			_, err := cache.Get(key)
+			assert.NoError(t, err, key)
+		}
+	})
+}
@@ -2,6 +2,12 @@ package config
 
 //COMPLETE
 
+import (
+	"time"
+
+	"github.com/akhilsharma90/terminal-assistant/usage"
+)
+
 // Constants for AI configuration keys - we're defining the constants here
 //for working with them in the project
 const (
@@ -10,6 +16,49 @@ const (
 	openai_proxy       = "OPENAI_PROXY"       // Proxy to use for OpenAI API
 	openai_temperature = "OPENAI_TEMPERATURE" // Temperature setting for OpenAI API
 	openai_max_tokens  = "OPENAI_MAX_TOKENS"  // Maximum tokens to generate for OpenAI API
+	openai_provider    = "OPENAI_PROVIDER"    // Provider backend (openai, openai-compatible, ollama, anthropic)
+	openai_base_url    = "OPENAI_BASE_URL"    // Base URL of the provider API, empty means the provider default
+
+	openai_api_type     = "OPENAI_API_TYPE"     // API type of the openai provider (openai, azure, azure-ad)
+	openai_api_version  = "OPENAI_API_VERSION"  // Version of the Azure API, empty means the go-openai default
+	openai_deployments  = "OPENAI_DEPLOYMENTS"  // Azure deployment of each model, a missing model uses its name without dots
+	openai_organization = "OPENAI_ORGANIZATION" // Organization ID sent with the OpenAI requests, empty means none
+	openai_headers      = "OPENAI_HEADERS"      // Headers added to every request sent to the provider, like the ones of a gateway
+
+	openai_connect_timeout = "OPENAI_CONNECT_TIMEOUT" // Seconds allowed to connect to the API, 0 means no limit
+	openai_request_timeout = "OPENAI_REQUEST_TIMEOUT" // Seconds allowed for a whole request including streaming, 0 means no limit
+
+	openai_max_retries     = "OPENAI_MAX_RETRIES"     // Number of retries of a request failing with a 429, a 5xx or a network error
+	openai_retry_delay     = "OPENAI_RETRY_DELAY"     // Seconds waited before the first retry, doubled at each retry
+	openai_retry_max_delay = "OPENAI_RETRY_MAX_DELAY" // Maximum seconds waited between two retries
+
+	openai_context_budget   = "OPENAI_CONTEXT_BUDGET"   // Tokens the messages sent can use, 0 means the model context window minus max tokens
+	openai_context_strategy = "OPENAI_CONTEXT_STRATEGY" // How older turns are compacted once over budget (trim, summarize)
+
+	openai_prices      = "OPENAI_PRICES"      // Prices in dollars per million prompt and completion tokens, by model
+	openai_soft_budget = "OPENAI_SOFT_BUDGET" // Monthly spend in dollars above which a warning is shown, 0 means none
+	openai_hard_budget = "OPENAI_HARD_BUDGET" // Monthly spend in dollars above which requests are blocked, 0 means none
+
+	openai_exec_sampling = "OPENAI_EXEC_SAMPLING" // Sampling parameters of the exec mode, overriding openai_temperature
+	openai_chat_sampling = "OPENAI_CHAT_SAMPLING" // Sampling parameters of the chat mode, overriding openai_temperature
+
+	openai_exec_model    = "OPENAI_EXEC_MODEL"    // Model of the exec mode, empty means openai_model
+	openai_chat_model    = "OPENAI_CHAT_MODEL"    // Model of the chat mode, empty means openai_model
+	openai_explain_model = "OPENAI_EXPLAIN_MODEL" // Model of the explain mode, empty means openai_model
+
+	openai_max_probes    = "OPENAI_MAX_PROBES"    // Read-only probes the exec mode can run before answering, 0 disables them
+	openai_probe_timeout = "OPENAI_PROBE_TIMEOUT" // Seconds allowed for each probe, 0 means the default
+
+	openai_alternatives = "OPENAI_ALTERNATIVES" // Candidate commands the exec mode can propose for a task, 1 or less means a single one
+
+	openai_cache_ttl      = "OPENAI_CACHE_TTL"      // Seconds the exec answers are cached, 0 disables the cache
+	openai_cache_max_size = "OPENAI_CACHE_MAX_SIZE" // Megabytes the cached answers can use, 0 means no limit
+
+	openai_cassette      = "OPENAI_CASSETTE"      // File the exchanges with the API are recorded in or replayed from, empty means none
+	openai_cassette_mode = "OPENAI_CASSETTE_MODE" // Whether the cassette is recorded or replayed (record, replay)
+
+	openai_pipe_chunk_tokens = "OPENAI_PIPE_CHUNK_TOKENS" // Tokens of each chunk a large piped input is read in, 0 means half the context budget
+	openai_pipe_max_chunks   = "OPENAI_PIPE_MAX_CHUNKS"   // Chunks a piped input can be read in, 0 means no limit
 )
 
 // AiConfig represents the configuration for the AI.
@@ -21,6 +70,49 @@ type AiConfig struct {
 	proxy       string
 	temperature float64
 	maxTokens   int
+	provider    string
+	baseUrl     string
+
+	apiType      string
+	apiVersion   string
+	deployments  map[string]string
+	organization string
+	headers      map[string]string
+
+	connectTimeout time.Duration
+	requestTimeout time.Duration
+
+	maxRetries    int
+	retryDelay    time.Duration
+	retryMaxDelay time.Duration
+
+	contextBudget   int
+	contextStrategy string
+
+	prices     map[string]usage.Price
+	softBudget float64
+	hardBudget float64
+
+	execSampling SamplingConfig
+	chatSampling SamplingConfig
+
+	execModel    string
+	chatModel    string
+	explainModel string
+
+	maxProbes    int
+	probeTimeout time.Duration
+
+	alternatives int
+
+	cacheTtl     time.Duration
+	cacheMaxSize int64
+
+	cassette     string
+	cassetteMode string
+
+	pipeChunkTokens int
+	pipeMaxChunks   int
 }
 
 //to return each of the values for the struct, we have a separate helper function
@@ -49,3 +141,158 @@ func (c AiConfig) GetTemperature() float64 {
 func (c AiConfig) GetMaxTokens() int {
 	return c.maxTokens
 }
+
+// GetProvider returns the name of the provider backend to talk to.
+func (c AiConfig) GetProvider() string {
+	return c.provider
+}
+
+// GetBaseUrl returns the base URL of the provider API.
+func (c AiConfig) GetBaseUrl() string {
+	return c.baseUrl
+}
+
+// GetConnectTimeout returns the time allowed to connect to the API, 0 means no limit.
+func (c AiConfig) GetConnectTimeout() time.Duration {
+	return c.connectTimeout
+}
+
+// GetRequestTimeout returns the time allowed for a whole request, 0 means no limit.
+func (c AiConfig) GetRequestTimeout() time.Duration {
+	return c.requestTimeout
+}
+
+// GetMaxRetries returns the number of retries of a failing request, 0 means no retry.
+func (c AiConfig) GetMaxRetries() int {
+	return c.maxRetries
+}
+
+// GetRetryDelay returns the time waited before the first retry.
+func (c AiConfig) GetRetryDelay() time.Duration {
+	return c.retryDelay
+}
+
+// GetRetryMaxDelay returns the maximum time waited between two retries.
+func (c AiConfig) GetRetryMaxDelay() time.Duration {
+	return c.retryMaxDelay
+}
+
+// GetContextBudget returns the tokens the messages sent can use, 0 means it is derived from the model.
+func (c AiConfig) GetContextBudget() int {
+	return c.contextBudget
+}
+
+// GetContextStrategy returns how older turns are compacted once the messages are over budget.
+func (c AiConfig) GetContextStrategy() string {
+	return c.contextStrategy
+}
+
+// GetPrices returns the prices by model set in the config, they override the default ones.
+func (c AiConfig) GetPrices() map[string]usage.Price {
+	return c.prices
+}
+
+// GetSoftBudget returns the monthly spend above which a warning is shown, 0 means none.
+func (c AiConfig) GetSoftBudget() float64 {
+	return c.softBudget
+}
+
+// GetHardBudget returns the monthly spend above which requests are blocked, 0 means none.
+func (c AiConfig) GetHardBudget() float64 {
+	return c.hardBudget
+}
+
+// GetExecSampling returns the sampling parameters sent with the exec requests.
+func (c AiConfig) GetExecSampling() SamplingConfig {
+	return c.execSampling
+}
+
+// GetChatSampling returns the sampling parameters sent with the chat requests.
+func (c AiConfig) GetChatSampling() SamplingConfig {
+	return c.chatSampling
+}
+
+// GetExecModel returns the model of the exec mode, empty means the model of openai_model.
+func (c AiConfig) GetExecModel() string {
+	return c.execModel
+}
+
+// GetChatModel returns the model of the chat mode, empty means the model of openai_model.
+func (c AiConfig) GetChatModel() string {
+	return c.chatModel
+}
+
+// GetExplainModel returns the model of the explain mode, empty means the model of openai_model.
+func (c AiConfig) GetExplainModel() string {
+	return c.explainModel
+}
+
+// GetMaxProbes returns the read-only probes the exec mode can run before answering, 0 means none.
+func (c AiConfig) GetMaxProbes() int {
+	return c.maxProbes
+}
+
+// GetProbeTimeout returns the time allowed for each probe, 0 means the default.
+func (c AiConfig) GetProbeTimeout() time.Duration {
+	return c.probeTimeout
+}
+
+// GetAlternatives returns the candidate commands the exec mode can propose for a task, 1 or less means a single one.
+func (c AiConfig) GetAlternatives() int {
+	return c.alternatives
+}
+
+// GetCacheTtl returns how long the exec answers are cached, 0 means the cache is disabled.
+func (c AiConfig) GetCacheTtl() time.Duration {
+	return c.cacheTtl
+}
+
+// GetCacheMaxSize returns the bytes the cached answers can use, 0 means no limit.
+func (c AiConfig) GetCacheMaxSize() int64 {
+	return c.cacheMaxSize
+}
+
+// GetCassette returns the file the exchanges with the API are recorded in or replayed from, empty means none.
+func (c AiConfig) GetCassette() string {
+	return c.cassette
+}
+
+// GetCassetteMode returns whether the cassette is recorded or replayed.
+func (c AiConfig) GetCassetteMode() string {
+	return c.cassetteMode
+}
+
+// GetApiType returns the API type of the openai provider, empty means openai.
+func (c AiConfig) GetApiType() string {
+	return c.apiType
+}
+
+// GetApiVersion returns the version of the Azure API, empty means the go-openai default.
+func (c AiConfig) GetApiVersion() string {
+	return c.apiVersion
+}
+
+// GetDeployments returns the Azure deployment of each model, the models are in lower case.
+func (c AiConfig) GetDeployments() map[string]string {
+	return c.deployments
+}
+
+// GetOrganization returns the organization ID sent with the OpenAI requests, empty means none.
+func (c AiConfig) GetOrganization() string {
+	return c.organization
+}
+
+// GetHeaders returns the headers added to every request sent to the provider.
+func (c AiConfig) GetHeaders() map[string]string {
+	return c.headers
+}
+
+// GetPipeChunkTokens returns the tokens of each chunk a large piped input is read in, 0 means half the context budget.
+func (c AiConfig) GetPipeChunkTokens() int {
+	return c.pipeChunkTokens
+}
+
+// GetPipeMaxChunks returns the chunks a piped input can be read in, 0 means no limit.
+func (c AiConfig) GetPipeMaxChunks() int {
+	return c.pipeMaxChunks
+}
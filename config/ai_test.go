@@ -2,6 +2,9 @@ package config
 
 import (
 	"testing"
+	"time"
+
+	"github.com/akhilsharma90/terminal-assistant/usage"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -13,6 +16,19 @@ func TestAiConfig(t *testing.T) {
 	t.Run("GetProxy", testGetProxy)
 	t.Run("GetTemperature", testGetTemperature)
 	t.Run("GetMaxTokens", testGetMaxTokens)
+	t.Run("GetProvider", testGetProvider)
+	t.Run("GetBaseUrl", testGetBaseUrl)
+	t.Run("GetEndpoint", testGetEndpoint)
+	t.Run("GetTimeouts", testGetTimeouts)
+	t.Run("GetRetries", testGetRetries)
+	t.Run("GetContext", testGetContext)
+	t.Run("GetBudgets", testGetBudgets)
+	t.Run("GetModels", testGetModels)
+	t.Run("GetProbes", testGetProbes)
+	t.Run("GetAlternatives", testGetAlternatives)
+	t.Run("GetCache", testGetCache)
+	t.Run("GetCassette", testGetCassette)
+	t.Run("GetPipeChunks", testGetPipeChunks)
 }
 
 // testGetKey is a subtest function for testing the GetKey method of the AiConfig type
@@ -66,3 +82,120 @@ func testGetMaxTokens(t *testing.T) {
 
 	assert.Equal(t, expectedMaxTokens, actualMaxTokens, "The two maxTokens should be the same.")
 }
+
+// testGetProvider is a subtest function for testing the GetProvider method of the AiConfig type
+func testGetProvider(t *testing.T) {
+	expectedProvider := "ollama"
+	aiConfig := AiConfig{provider: expectedProvider}
+
+	actualProvider := aiConfig.GetProvider()
+
+	assert.Equal(t, expectedProvider, actualProvider, "The two providers should be the same.")
+}
+
+// testGetBaseUrl is a subtest function for testing the GetBaseUrl method of the AiConfig type
+func testGetBaseUrl(t *testing.T) {
+	expectedBaseUrl := "http://localhost:11434"
+	aiConfig := AiConfig{baseUrl: expectedBaseUrl}
+
+	actualBaseUrl := aiConfig.GetBaseUrl()
+
+	assert.Equal(t, expectedBaseUrl, actualBaseUrl, "The two base urls should be the same.")
+}
+
+// testGetTimeouts is a subtest function for testing the timeout getters of the AiConfig type
+func testGetTimeouts(t *testing.T) {
+	aiConfig := AiConfig{connectTimeout: 5 * time.Second, requestTimeout: time.Minute}
+
+	assert.Equal(t, 5*time.Second, aiConfig.GetConnectTimeout(), "The two connect timeouts should be the same.")
+	assert.Equal(t, time.Minute, aiConfig.GetRequestTimeout(), "The two request timeouts should be the same.")
+}
+
+// testGetRetries is a subtest function for testing the retry getters of the AiConfig type
+func testGetRetries(t *testing.T) {
+	aiConfig := AiConfig{maxRetries: 3, retryDelay: time.Second, retryMaxDelay: 30 * time.Second}
+
+	assert.Equal(t, 3, aiConfig.GetMaxRetries(), "The two max retries should be the same.")
+	assert.Equal(t, time.Second, aiConfig.GetRetryDelay(), "The two retry delays should be the same.")
+	assert.Equal(t, 30*time.Second, aiConfig.GetRetryMaxDelay(), "The two retry max delays should be the same.")
+}
+
+// testGetContext is a subtest function for testing the context window getters of the AiConfig type
+func testGetContext(t *testing.T) {
+	aiConfig := AiConfig{contextBudget: 3000, contextStrategy: "summarize"}
+
+	assert.Equal(t, 3000, aiConfig.GetContextBudget(), "The two context budgets should be the same.")
+	assert.Equal(t, "summarize", aiConfig.GetContextStrategy(), "The two context strategies should be the same.")
+}
+
+// testGetModels is a function for testing the GetExecModel, GetChatModel and GetExplainModel methods of AiConfig
+func testGetModels(t *testing.T) {
+	aiConfig := AiConfig{execModel: "gpt-4", chatModel: "gpt-4o", explainModel: ""}
+
+	assert.Equal(t, "gpt-4", aiConfig.GetExecModel(), "The two exec models should be the same.")
+	assert.Equal(t, "gpt-4o", aiConfig.GetChatModel(), "The two chat models should be the same.")
+	assert.Empty(t, aiConfig.GetExplainModel(), "The explain model should be empty.")
+}
+
+// testGetProbes is a subtest function for testing the probe getters of the AiConfig type
+func testGetProbes(t *testing.T) {
+	aiConfig := AiConfig{maxProbes: 5, probeTimeout: 5 * time.Second}
+
+	assert.Equal(t, 5, aiConfig.GetMaxProbes(), "The two max probes should be the same.")
+	assert.Equal(t, 5*time.Second, aiConfig.GetProbeTimeout(), "The two probe timeouts should be the same.")
+}
+
+// testGetAlternatives is a subtest function for testing the GetAlternatives method of the AiConfig type
+func testGetAlternatives(t *testing.T) {
+	aiConfig := AiConfig{alternatives: 3}
+
+	assert.Equal(t, 3, aiConfig.GetAlternatives(), "The two alternatives should be the same.")
+}
+
+// testGetCache is a subtest function for testing the cache getters of the AiConfig type
+func testGetCache(t *testing.T) {
+	aiConfig := AiConfig{cacheTtl: time.Hour, cacheMaxSize: 1024}
+
+	assert.Equal(t, time.Hour, aiConfig.GetCacheTtl(), "The two cache ttls should be the same.")
+	assert.Equal(t, int64(1024), aiConfig.GetCacheMaxSize(), "The two cache max sizes should be the same.")
+}
+
+// testGetCassette is a subtest function for testing the cassette getters of the AiConfig type
+func testGetCassette(t *testing.T) {
+	aiConfig := AiConfig{cassette: "/tmp/cassette.json", cassetteMode: "record"}
+
+	assert.Equal(t, "/tmp/cassette.json", aiConfig.GetCassette(), "The two cassettes should be the same.")
+	assert.Equal(t, "record", aiConfig.GetCassetteMode(), "The two cassette modes should be the same.")
+}
+
+// testGetBudgets is a subtest function for testing the price and budget getters of the AiConfig type
+func testGetBudgets(t *testing.T) {
+	prices := map[string]usage.Price{"test_model": {Prompt: 1, Completion: 2}}
+	aiConfig := AiConfig{prices: prices, softBudget: 5, hardBudget: 10}
+
+	assert.Equal(t, prices, aiConfig.GetPrices(), "The two price tables should be the same.")
+	assert.Equal(t, 5.0, aiConfig.GetSoftBudget(), "The two soft budgets should be the same.")
+	assert.Equal(t, 10.0, aiConfig.GetHardBudget(), "The two hard budgets should be the same.")
+}
+
+// testGetEndpoint is a subtest function for testing the getters of the API type, the Azure deployments,
+//the organization and the headers of the AiConfig type
+func testGetEndpoint(t *testing.T) {
+	deployments := map[string]string{"gpt-4": "prod-gpt4"}
+	headers := map[string]string{"x-gateway-token": "secret"}
+	aiConfig := AiConfig{apiType: "azure", apiVersion: "2024-02-01", deployments: deployments, organization: "org-1", headers: headers}
+
+	assert.Equal(t, "azure", aiConfig.GetApiType(), "The two API types should be the same.")
+	assert.Equal(t, "2024-02-01", aiConfig.GetApiVersion(), "The two API versions should be the same.")
+	assert.Equal(t, deployments, aiConfig.GetDeployments(), "The two deployments should be the same.")
+	assert.Equal(t, "org-1", aiConfig.GetOrganization(), "The two organizations should be the same.")
+	assert.Equal(t, headers, aiConfig.GetHeaders(), "The two header sets should be the same.")
+}
+
+// testGetPipeChunks is a subtest function for testing the pipe chunks getters of the AiConfig type
+func testGetPipeChunks(t *testing.T) {
+	aiConfig := AiConfig{pipeChunkTokens: 2000, pipeMaxChunks: 50}
+
+	assert.Equal(t, 2000, aiConfig.GetPipeChunkTokens(), "The two chunk sizes should be the same.")
+	assert.Equal(t, 50, aiConfig.GetPipeMaxChunks(), "The two chunk limits should be the same.")
+}
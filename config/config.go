@@ -5,10 +5,12 @@ package config
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
 
 	"github.com/akhilsharma90/terminal-assistant/system"
+	"github.com/akhilsharma90/terminal-assistant/usage"
 	"github.com/spf13/viper"
 )
 
@@ -46,6 +48,9 @@ func NewConfig() (*Config, error) {
 
 	system := system.Analyse()
 
+	// the limits missing from the file, like the ones added after it was written, get their default values
+	setLimitDefaults()
+
 	// Set the configuration file name, which is a field in the analysis struct in analyzer.go file
 	viper.SetConfigName(strings.ToLower(system.GetApplicationName()))
 	//the analysis struct has a field for config file path, that's what we're updating here
@@ -57,8 +62,13 @@ func NewConfig() (*Config, error) {
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, err
 	}
-	
 
+	return BuildConfig(system), nil
+}
+
+// BuildConfig builds a Config from the values currently held by viper, without reading any file.
+//NewConfig calls it once the file has been read, tests can call it directly after setting values in viper
+func BuildConfig(system *system.Analysis) *Config {
 	// To be able to set the config, we need to set values for the ai field in the struct,
 	//the user field and the system field and we set the values for all of them here
 	return &Config{
@@ -68,13 +78,168 @@ func NewConfig() (*Config, error) {
 			proxy:       viper.GetString(openai_proxy),
 			temperature: viper.GetFloat64(openai_temperature),
 			maxTokens:   viper.GetInt(openai_max_tokens),
+			provider:    viper.GetString(openai_provider),
+			baseUrl:     viper.GetString(openai_base_url),
+
+			apiType:      viper.GetString(openai_api_type),
+			apiVersion:   viper.GetString(openai_api_version),
+			deployments:  readDeployments(),
+			organization: viper.GetString(openai_organization),
+			headers:      viper.GetStringMapString(openai_headers),
+
+			connectTimeout: time.Duration(viper.GetInt(openai_connect_timeout)) * time.Second,
+			requestTimeout: time.Duration(viper.GetInt(openai_request_timeout)) * time.Second,
+
+			maxRetries:    viper.GetInt(openai_max_retries),
+			retryDelay:    time.Duration(viper.GetFloat64(openai_retry_delay) * float64(time.Second)),
+			retryMaxDelay: time.Duration(viper.GetFloat64(openai_retry_max_delay) * float64(time.Second)),
+
+			contextBudget:   viper.GetInt(openai_context_budget),
+			contextStrategy: viper.GetString(openai_context_strategy),
+
+			prices:     readPrices(),
+			softBudget: viper.GetFloat64(openai_soft_budget),
+			hardBudget: viper.GetFloat64(openai_hard_budget),
+
+			execSampling: readSampling(openai_exec_sampling),
+			chatSampling: readSampling(openai_chat_sampling),
+
+			execModel:    viper.GetString(openai_exec_model),
+			chatModel:    viper.GetString(openai_chat_model),
+			explainModel: viper.GetString(openai_explain_model),
+
+			maxProbes:    viper.GetInt(openai_max_probes),
+			probeTimeout: time.Duration(viper.GetFloat64(openai_probe_timeout) * float64(time.Second)),
+
+			alternatives: viper.GetInt(openai_alternatives),
+
+			cacheTtl:     time.Duration(viper.GetInt(openai_cache_ttl)) * time.Second,
+			cacheMaxSize: int64(viper.GetFloat64(openai_cache_max_size) * 1024 * 1024),
+
+			cassette:     viper.GetString(openai_cassette),
+			cassetteMode: readCassetteMode(),
+
+			pipeChunkTokens: viper.GetInt(openai_pipe_chunk_tokens),
+			pipeMaxChunks:   viper.GetInt(openai_pipe_max_chunks),
 		},
 		user: UserConfig{
 			defaultPromptMode: viper.GetString(user_default_prompt_mode),
 			preferences:       viper.GetString(user_preferences),
+			promptsDirectory:  viper.GetString(user_prompts_directory),
+			fixAttempts:       viper.GetInt(user_fix_attempts),
+
+			attachmentMaxSize:  viper.GetInt64(user_attachment_max_size) * 1024,
+			attachmentsMaxSize: viper.GetInt64(user_attachments_max_size) * 1024,
+
+			sessionAutoResume: viper.GetBool(user_session_auto_resume),
 		},
 		system: system,
-	}, nil
+	}
+}
+
+// readSampling reads the sampling parameters of a mode, on top of openai_temperature which applies to both
+//modes. a malformed object is ignored
+func readSampling(key string) SamplingConfig {
+	var sampling SamplingConfig
+	if viper.IsSet(openai_temperature) {
+		temperature := viper.GetFloat64(openai_temperature)
+		sampling.Temperature = &temperature
+	}
+
+	var mode SamplingConfig
+	if err := viper.UnmarshalKey(key, &mode); err != nil {
+		return sampling
+	}
+
+	return sampling.Merge(mode)
+}
+
+// readCassetteMode reads whether the cassette is recorded or replayed, replaying when it isn't set so a
+//cassette never sends anything by mistake
+func readCassetteMode() string {
+	if mode := viper.GetString(openai_cassette_mode); mode != "" {
+		return mode
+	}
+
+	return "replay"
+}
+
+// readDeployments reads the Azure deployment of each model, the models are put in lower case as viper
+//does with the keys of a config file, so they are found whatever the case they were written in
+func readDeployments() map[string]string {
+	deployments := map[string]string{}
+	for model, deployment := range viper.GetStringMapString(openai_deployments) {
+		deployments[strings.ToLower(model)] = deployment
+	}
+
+	return deployments
+}
+
+// readPrices reads the price table of the config, a malformed table is ignored and the default prices are used.
+func readPrices() map[string]usage.Price {
+	prices := map[string]usage.Price{}
+	if err := viper.UnmarshalKey(openai_prices, &prices); err != nil {
+		return map[string]usage.Price{}
+	}
+
+	return prices
+}
+
+// setLimitDefaults registers the default values of the limits, a config file written before they existed
+//gets them too. the features missing from such a file, like the probes, the alternatives, the cache or
+//the retries, stay off until they are set in it
+func setLimitDefaults() {
+	viper.SetDefault(openai_cache_max_size, 10)
+	viper.SetDefault(openai_pipe_max_chunks, 10000)
+	viper.SetDefault(user_attachment_max_size, 256)
+	viper.SetDefault(user_attachments_max_size, 1024)
+}
+
+// setDefaults registers the default values of all the fields of a new config file.
+func setDefaults() {
+	setLimitDefaults()
+
+	// Set the AI default values for all the fields in the ai config struct
+	viper.SetDefault(openai_model, openai.GPT3Dot5Turbo)
+	viper.SetDefault(openai_proxy, "")
+	viper.SetDefault(openai_temperature, 0.2)
+	viper.SetDefault(openai_max_tokens, 1000)
+	viper.SetDefault(openai_provider, "openai")
+	viper.SetDefault(openai_base_url, "")
+	viper.SetDefault(openai_api_type, "openai")
+	viper.SetDefault(openai_api_version, "")
+	viper.SetDefault(openai_deployments, map[string]string{})
+	viper.SetDefault(openai_organization, "")
+	viper.SetDefault(openai_headers, map[string]string{})
+	viper.SetDefault(openai_connect_timeout, 10)
+	viper.SetDefault(openai_request_timeout, 120)
+	viper.SetDefault(openai_max_retries, 3)
+	viper.SetDefault(openai_retry_delay, 1)
+	viper.SetDefault(openai_retry_max_delay, 30)
+	viper.SetDefault(openai_context_budget, 0)
+	viper.SetDefault(openai_context_strategy, "trim")
+	viper.SetDefault(openai_prices, map[string]usage.Price{})
+	viper.SetDefault(openai_soft_budget, 0)
+	viper.SetDefault(openai_hard_budget, 0)
+	viper.SetDefault(openai_exec_sampling, map[string]interface{}{})
+	viper.SetDefault(openai_chat_sampling, map[string]interface{}{})
+	viper.SetDefault(openai_exec_model, "")
+	viper.SetDefault(openai_chat_model, "")
+	viper.SetDefault(openai_explain_model, "")
+	viper.SetDefault(openai_max_probes, 5)
+	viper.SetDefault(openai_probe_timeout, 5)
+	viper.SetDefault(openai_alternatives, 3)
+	viper.SetDefault(openai_cache_ttl, 86400)
+	viper.SetDefault(openai_cassette, "")
+	viper.SetDefault(openai_cassette_mode, "replay")
+	viper.SetDefault(openai_pipe_chunk_tokens, 0)
+
+	// Setting the user defaults by setting values for the fields in the userConfig struct
+	viper.SetDefault(user_default_prompt_mode, "exec")
+	viper.SetDefault(user_preferences, "")
+	viper.SetDefault(user_prompts_directory, "")
+	viper.SetDefault(user_fix_attempts, 0)
+	viper.SetDefault(user_session_auto_resume, false)
 }
 
 //this is the writeConfig function of the config package that gets called in the ui.go file
@@ -85,16 +250,10 @@ func WriteConfig(key string, write bool) (*Config, error) {
 	//we'll tackle next
 	system := system.Analyse()
 
-	// Set the AI default values for all the fields in the ai config struct
+	// Set the key and the model of the new config, the other fields keep their defaults
 	viper.Set(openai_key, key)
 	viper.Set(openai_model, openai.GPT3Dot5Turbo)
-	viper.SetDefault(openai_proxy, "")
-	viper.SetDefault(openai_temperature, 0.2)
-	viper.SetDefault(openai_max_tokens, 1000)
-
-	// Setting the user defaults by setting values for the fields in the userConfig struct
-	viper.SetDefault(user_default_prompt_mode, "exec")
-	viper.SetDefault(user_preferences, "")
+	setDefaults()
 
 	if write {
 		//now that all the config values for system (with the help of the analyse func),
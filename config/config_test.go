@@ -2,10 +2,12 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/akhilsharma90/terminal-assistant/system"
+	"github.com/akhilsharma90/terminal-assistant/usage"
 
 	"github.com/sashabaranov/go-openai"
 	"github.com/spf13/viper"
@@ -17,6 +19,7 @@ func TestConfig(t *testing.T) {
 	// TestConfig is a test function that runs subtests for NewConfig and WriteConfig.
 	t.Run("NewConfig", testNewConfig)
 	t.Run("WriteConfig", testWriteConfig)
+	t.Run("Defaults", testConfigDefaults)
 }
 
 // setupViper initializes the Viper configuration for testing purposes.
@@ -33,6 +36,10 @@ func setupViper(t *testing.T) {
 	viper.Set(openai_max_tokens, 2000)
 	viper.Set(user_default_prompt_mode, "exec")
 	viper.Set(user_preferences, "test_preferences")
+	viper.Set(openai_prices, map[string]interface{}{
+		"test_model": map[string]interface{}{"prompt": 1.5, "completion": 3},
+	})
+	viper.Set(openai_exec_sampling, map[string]interface{}{"temperature": 0, "seed": 42})
 
 	require.NoError(t, viper.SafeWriteConfigAs("/tmp/terminal-assistant.json"))
 }
@@ -60,6 +67,11 @@ func testNewConfig(t *testing.T) {
 	assert.Equal(t, 2000, cfg.GetAiConfig().GetMaxTokens())
 	assert.Equal(t, "exec", cfg.GetUserConfig().GetDefaultPromptMode())
 	assert.Equal(t, "test_preferences", cfg.GetUserConfig().GetPreferences())
+	assert.Equal(t, usage.Price{Prompt: 1.5, Completion: 3}, cfg.GetAiConfig().GetPrices()["test_model"])
+	assert.Equal(t, 0.0, *cfg.GetAiConfig().GetExecSampling().Temperature)
+	assert.Equal(t, 42, *cfg.GetAiConfig().GetExecSampling().Seed)
+	assert.Equal(t, 0.2, *cfg.GetAiConfig().GetChatSampling().Temperature)
+	assert.Nil(t, cfg.GetAiConfig().GetChatSampling().Seed)
 
 	assert.NotNil(t, cfg.GetSystemConfig())
 }
@@ -92,3 +104,28 @@ func testWriteConfig(t *testing.T) {
 	assert.Equal(t, "exec", viper.GetString(user_default_prompt_mode))
 	assert.Equal(t, "test_preferences", viper.GetString(user_preferences))
 }
+
+// testConfigDefaults checks that the limits missing from the config file, like the ones added after it was
+//written, get the same values as in a new config file, while the features missing from it stay off
+func testConfigDefaults(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	dir := t.TempDir()
+	viper.AddConfigPath(dir)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "terminal-assistant.json"), []byte(`{"openai_key": "test_key"}`), 0600))
+
+	cfg, err := NewConfig()
+	require.NoError(t, err)
+
+	assert.Equal(t, "test_key", cfg.GetAiConfig().GetKey())
+	assert.Equal(t, int64(10*1024*1024), cfg.GetAiConfig().GetCacheMaxSize())
+	assert.Equal(t, 10000, cfg.GetAiConfig().GetPipeMaxChunks())
+	assert.Equal(t, int64(256*1024), cfg.GetUserConfig().GetAttachmentMaxSize())
+	assert.Equal(t, int64(1024*1024), cfg.GetUserConfig().GetAttachmentsMaxSize())
+
+	assert.Zero(t, cfg.GetAiConfig().GetMaxRetries())
+	assert.Zero(t, cfg.GetAiConfig().GetMaxProbes())
+	assert.Zero(t, cfg.GetAiConfig().GetAlternatives())
+	assert.Zero(t, cfg.GetAiConfig().GetCacheTtl())
+	assert.Zero(t, cfg.GetAiConfig().GetRequestTimeout())
+}
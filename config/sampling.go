@@ -0,0 +1,39 @@
+package config
+
+//the sampling parameters change how the model picks its words. exec and chat have their own, as
+//commands are better generated deterministically while a discussion can be more creative
+
+// SamplingConfig represents the sampling parameters sent with the requests, the nil fields are not sent.
+//the fields are exported so the exec and chat objects of the config file can be decoded into it
+type SamplingConfig struct {
+	Temperature      *float64 `mapstructure:"temperature"`       // Randomness of the answer, from 0 to 2
+	TopP             *float64 `mapstructure:"top_p"`             // Only the tokens in this top probability mass are considered
+	Seed             *int     `mapstructure:"seed"`              // Makes the answers repeatable, as far as the API allows it
+	Stop             []string `mapstructure:"stop"`              // Sequences ending the answer
+	PresencePenalty  *float64 `mapstructure:"presence_penalty"`  // Pushes the model towards new topics, from -2 to 2
+	FrequencyPenalty *float64 `mapstructure:"frequency_penalty"` // Keeps the model from repeating itself, from -2 to 2
+}
+
+// Merge returns a copy of the sampling where the fields set in the given one override its own.
+func (s SamplingConfig) Merge(other SamplingConfig) SamplingConfig {
+	if other.Temperature != nil {
+		s.Temperature = other.Temperature
+	}
+	if other.TopP != nil {
+		s.TopP = other.TopP
+	}
+	if other.Seed != nil {
+		s.Seed = other.Seed
+	}
+	if other.Stop != nil {
+		s.Stop = other.Stop
+	}
+	if other.PresencePenalty != nil {
+		s.PresencePenalty = other.PresencePenalty
+	}
+	if other.FrequencyPenalty != nil {
+		s.FrequencyPenalty = other.FrequencyPenalty
+	}
+
+	return s
+}
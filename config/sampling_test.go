@@ -0,0 +1,28 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSamplingConfig is a test function for testing the SamplingConfig type
+func TestSamplingConfig(t *testing.T) {
+	t.Run("Merge", testSamplingMerge)
+}
+
+// testSamplingMerge is a subtest function for testing that only the set fields override the others
+func testSamplingMerge(t *testing.T) {
+	temperature, topP, override := 0.2, 0.9, 0.0
+	seed := 42
+	base := SamplingConfig{Temperature: &temperature, TopP: &topP, Stop: []string{"\n"}}
+
+	merged := base.Merge(SamplingConfig{Temperature: &override, Seed: &seed})
+
+	assert.Equal(t, 0.0, *merged.Temperature, "The set temperature should override the base one.")
+	assert.Equal(t, 0.9, *merged.TopP, "The unset top_p should be kept.")
+	assert.Equal(t, 42, *merged.Seed, "The set seed should be added.")
+	assert.Equal(t, []string{"\n"}, merged.Stop, "The unset stop should be kept.")
+	assert.Nil(t, merged.PresencePenalty, "The presence penalty should stay unset.")
+	assert.Equal(t, 0.2, *base.Temperature, "The base should not be modified.")
+}
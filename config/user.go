@@ -5,6 +5,13 @@ package config
 const (
 	user_default_prompt_mode = "USER_DEFAULT_PROMPT_MODE"
 	user_preferences         = "USER_PREFERENCES"
+	user_prompts_directory   = "USER_PROMPTS_DIRECTORY"
+	user_fix_attempts        = "USER_FIX_ATTEMPTS"
+
+	user_attachment_max_size  = "USER_ATTACHMENT_MAX_SIZE"  // Kilobytes each file attached with @path can take, 0 means no limit
+	user_attachments_max_size = "USER_ATTACHMENTS_MAX_SIZE" // Kilobytes all the files attached to a prompt can take, 0 means no limit
+
+	user_session_auto_resume = "USER_SESSION_AUTO_RESUME" // Whether the last session of the current directory is resumed when none is given
 )
 
 //similar pattern followed here as ai.go file, we're using struct and constants
@@ -16,6 +23,16 @@ type UserConfig struct {
 	defaultPromptMode string
 	// preferences are the user's preferences.
 	preferences string
+	// promptsDirectory is the directory of the user's prompt templates, empty means the default one.
+	promptsDirectory string
+	// fixAttempts is how many corrected commands can be asked in a row after a command failed, 0 disables it.
+	fixAttempts int
+	// attachmentMaxSize is the bytes each file attached with @path can take, 0 means no limit.
+	attachmentMaxSize int64
+	// attachmentsMaxSize is the bytes all the files attached to a prompt can take, 0 means no limit.
+	attachmentsMaxSize int64
+	// sessionAutoResume is whether the last session of the current directory is resumed when none is given.
+	sessionAutoResume bool
 }
 
 //below are helper functions that help get those values
@@ -29,3 +46,28 @@ func (c UserConfig) GetDefaultPromptMode() string {
 func (c UserConfig) GetPreferences() string {
 	return c.preferences
 }
+
+// GetPromptsDirectory returns the directory of the user's prompt templates, empty means the default one.
+func (c UserConfig) GetPromptsDirectory() string {
+	return c.promptsDirectory
+}
+
+// GetFixAttempts returns how many corrected commands can be asked in a row after a command failed, 0 means none.
+func (c UserConfig) GetFixAttempts() int {
+	return c.fixAttempts
+}
+
+// GetAttachmentMaxSize returns the bytes each file attached with @path can take, 0 means no limit.
+func (c UserConfig) GetAttachmentMaxSize() int64 {
+	return c.attachmentMaxSize
+}
+
+// GetAttachmentsMaxSize returns the bytes all the files attached to a prompt can take, 0 means no limit.
+func (c UserConfig) GetAttachmentsMaxSize() int64 {
+	return c.attachmentsMaxSize
+}
+
+// IsSessionAutoResume returns whether the last session of the current directory is resumed when none is given.
+func (c UserConfig) IsSessionAutoResume() bool {
+	return c.sessionAutoResume
+}
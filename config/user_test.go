@@ -12,6 +12,13 @@ func TestUserConfig(t *testing.T) {
 	t.Run("GetDefaultPromptMode", testGetDefaultPromptMode)
 	// Run the test for GetPreferences
 	t.Run("GetPreferences", testGetPreferences)
+	// Run the test for GetPromptsDirectory
+	t.Run("GetPromptsDirectory", testGetPromptsDirectory)
+	// Run the test for GetFixAttempts
+	t.Run("GetFixAttempts", testGetFixAttempts)
+	// Run the test for the attachments limits
+	t.Run("GetAttachmentsMaxSize", testGetAttachmentsMaxSize)
+	t.Run("IsSessionAutoResume", testIsSessionAutoResume)
 }
 
 // testGetDefaultPromptMode tests the GetDefaultPromptMode method of UserConfig
@@ -37,3 +44,31 @@ func testGetPreferences(t *testing.T) {
 
 	assert.Equal(t, expectedPreferences, actualPreferences, "The two preferences should be the same.")
 }
+
+// testGetPromptsDirectory tests the GetPromptsDirectory method of UserConfig
+func testGetPromptsDirectory(t *testing.T) {
+	userConfig := UserConfig{promptsDirectory: "/tmp/prompts"}
+
+	assert.Equal(t, "/tmp/prompts", userConfig.GetPromptsDirectory(), "The two prompts directories should be the same.")
+}
+
+// testGetFixAttempts tests the GetFixAttempts method of UserConfig
+func testGetFixAttempts(t *testing.T) {
+	userConfig := UserConfig{fixAttempts: 2}
+
+	assert.Equal(t, 2, userConfig.GetFixAttempts(), "The two fix attempts should be the same.")
+}
+
+// testGetAttachmentsMaxSize tests the attachments limits getters of UserConfig
+func testGetAttachmentsMaxSize(t *testing.T) {
+	userConfig := UserConfig{attachmentMaxSize: 1024, attachmentsMaxSize: 4096}
+
+	assert.Equal(t, int64(1024), userConfig.GetAttachmentMaxSize(), "The two file limits should be the same.")
+	assert.Equal(t, int64(4096), userConfig.GetAttachmentsMaxSize(), "The two total limits should be the same.")
+}
+
+// testIsSessionAutoResume tests the IsSessionAutoResume method of UserConfig
+func testIsSessionAutoResume(t *testing.T) {
+	assert.True(t, UserConfig{sessionAutoResume: true}.IsSessionAutoResume(), "The session should be resumed.")
+	assert.False(t, UserConfig{}.IsSessionAutoResume(), "The session should not be resumed by default.")
+}
@@ -0,0 +1,58 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+//the HTML export is the markdown export rendered in a single page, without any external resource so
+//it can be attached to a ticket as it is. its colors are the ones of the dark glamour style the
+//answers are rendered with in the terminal. the raw HTML of the answers is left out
+
+// htmlStyle is the stylesheet of the HTML export, following the dark glamour style.
+const htmlStyle = `body { background: #1c1c1c; color: #d0d0d0; font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; line-height: 1.5; margin: 0; }
+main { max-width: 60rem; margin: 0 auto; padding: 2rem; }
+h1, h2, h3, h4, h5, h6 { color: #00afff; font-weight: bold; }
+h1 { background: #5f5fff; color: #ffff87; display: inline-block; padding: 0 0.5rem; }
+a { color: #008787; }
+hr { border: none; border-top: 1px solid #585858; }
+code { background: #303030; color: #ff5f5f; padding: 0 0.25rem; }
+pre { background: #303030; padding: 0.75rem; overflow-x: auto; }
+pre code { color: #808080; padding: 0; }
+blockquote { border-left: 2px solid #585858; margin-left: 0; padding-left: 1rem; color: #bcbcbc; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #585858; padding: 0.25rem 0.5rem; }
+strong { color: #eeeeee; }
+`
+
+// htmlPage is the page the rendered markdown is put in, with the title and the body to fill.
+const htmlPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>%s</title>
+<style>
+%s</style>
+</head>
+<body>
+<main>
+%s</main>
+</body>
+</html>
+`
+
+// Html renders the transcript as a standalone HTML page.
+func Html(transcript Transcript) ([]byte, error) {
+	var body bytes.Buffer
+	renderer := goldmark.New(goldmark.WithExtensions(extension.GFM))
+	if err := renderer.Convert([]byte(Markdown(transcript)), &body); err != nil {
+		return nil, err
+	}
+
+	return []byte(fmt.Sprintf(htmlPage, html.EscapeString(transcript.GetTitle()), htmlStyle, body.String())), nil
+}
@@ -0,0 +1,16 @@
+package export
+
+import "encoding/json"
+
+// Json encodes the transcript as indented JSON, for the tools reading the conversations.
+func Json(transcript Transcript) ([]byte, error) {
+	if transcript.Turns == nil {
+		transcript.Turns = []Turn{}
+	}
+	content, err := json.MarshalIndent(transcript, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(content, '\n'), nil
+}
@@ -0,0 +1,127 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+)
+
+// markdownTimeLayout is the layout of the dates in the header of an exported conversation.
+const markdownTimeLayout = "2006-01-02 15:04 MST"
+
+// Markdown renders the transcript as a markdown document: a header with the session, then each turn with
+//its prompt, its answer and the commands proposed in it
+func Markdown(transcript Transcript) string {
+	var builder strings.Builder
+
+	builder.WriteString(fmt.Sprintf("# %s\n\n", transcript.GetTitle()))
+	builder.WriteString(fmt.Sprintf("- **Directory**: %s\n", CodeSpan(transcript.Directory)))
+	builder.WriteString(fmt.Sprintf("- **Model**: %s\n", CodeSpan(transcript.Model)))
+	builder.WriteString(fmt.Sprintf("- **Created**: %s\n", transcript.Created.Format(markdownTimeLayout)))
+	builder.WriteString(fmt.Sprintf("- **Updated**: %s\n", transcript.Updated.Format(markdownTimeLayout)))
+
+	if len(transcript.Turns) == 0 {
+		builder.WriteString("\n*The conversation is empty.*\n")
+	}
+
+	number := 0
+	for _, turn := range transcript.Turns {
+		if turn.Summary {
+			builder.WriteString(fmt.Sprintf("\n## Summary of the earlier turns (%s)\n\n%s\n", turn.Mode, turn.Answer))
+			continue
+		}
+
+		number++
+		builder.WriteString(fmt.Sprintf("\n## Turn %d (%s)\n", number, turn.Mode))
+		if turn.Prompt != "" {
+			builder.WriteString("\n**Prompt**\n\n")
+			builder.WriteString(blockQuote(turn.Prompt))
+		}
+		if len(turn.Attachments) > 0 {
+			attachments := make([]string, len(turn.Attachments))
+			for j, attachment := range turn.Attachments {
+				attachments[j] = CodeSpan(attachment)
+			}
+			builder.WriteString(fmt.Sprintf("\n**Attachments**: %s\n", strings.Join(attachments, ", ")))
+		}
+		if turn.Answer != "" {
+			builder.WriteString(fmt.Sprintf("\n**Answer**\n\n%s\n", strings.TrimSpace(turn.Answer)))
+		}
+		if turn.Interrupted {
+			builder.WriteString("\n*The answer was interrupted.*\n")
+		}
+
+		for j, command := range turn.Commands {
+			builder.WriteString(fmt.Sprintf("\n**Command %d**: %s\n", j+1, command.GetStatus()))
+			if command.Explanation != "" && command.Explanation != turn.Answer {
+				builder.WriteString(fmt.Sprintf("\n%s\n", strings.TrimSpace(command.Explanation)))
+			}
+			builder.WriteString("\n" + codeBlock(command.Command, "sh"))
+		}
+	}
+
+	return builder.String()
+}
+
+// GetStatus returns whether the command was executed, and with which exit code.
+func (c Command) GetStatus() string {
+	switch {
+	case !c.Executed:
+		return "not executed"
+	case c.ExitCode == nil:
+		return "executed"
+	default:
+		return fmt.Sprintf("executed, exit code %d", *c.ExitCode)
+	}
+}
+
+// blockQuote quotes every line of the text.
+func blockQuote(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// CodeSpan wraps the text in an inline code span, with more backticks than the longest run of them in the text.
+func CodeSpan(text string) string {
+	if text == "" {
+		return ""
+	}
+	fence := strings.Repeat("`", longestBacktickRun(text)+1)
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		return fence + " " + text + " " + fence
+	}
+
+	return fence + text + fence
+}
+
+// codeBlock wraps the text in a fenced code block, with more backticks than the longest run of them in
+//the text, and at least three
+func codeBlock(text string, language string) string {
+	length := longestBacktickRun(text) + 1
+	if length < 3 {
+		length = 3
+	}
+	fence := strings.Repeat("`", length)
+
+	return fmt.Sprintf("%s%s\n%s\n%s\n", fence, language, strings.TrimRight(text, "\n"), fence)
+}
+
+// longestBacktickRun returns the length of the longest run of backticks in the text.
+func longestBacktickRun(text string) int {
+	longest, run := 0, 0
+	for _, char := range text {
+		if char != '`' {
+			run = 0
+			continue
+		}
+		run++
+		if run > longest {
+			longest = run
+		}
+	}
+
+	return longest
+}
@@ -0,0 +1,140 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//a conversation is exported from its transcript: the turns of each mode, with the prompt, the answer,
+//and the commands which were proposed, with whether they were executed and how they exited. the
+//secrets found in the transcript are redacted before it is written in any format
+
+// redacted replaces the secrets found in a transcript.
+const redacted = "REDACTED"
+
+// Transcript is a conversation ready to be exported.
+type Transcript struct {
+	Id        string    `json:"id"`             // Identifier of the session
+	Name      string    `json:"name,omitempty"` // Name of the session, empty when unnamed
+	Directory string    `json:"directory"`      // Directory the session was started in
+	Model     string    `json:"model"`          // Model the session was talking to
+	Created   time.Time `json:"created"`        // When the session was started
+	Updated   time.Time `json:"updated"`        // When the session was last saved
+	Turns     []Turn    `json:"turns"`          // Turns of the conversation, grouped by mode
+}
+
+// Turn is a prompt and its answer.
+type Turn struct {
+	Mode        string    `json:"mode"`                  // Mode of the turn (exec, chat, explain)
+	Prompt      string    `json:"prompt,omitempty"`      // Prompt of the user, empty for a summary of the earlier turns
+	Attachments []string  `json:"attachments,omitempty"` // Files and directories attached to the prompt with @path
+	Answer      string    `json:"answer,omitempty"`      // Answer of the model, the explanation of the commands in exec mode
+	Commands    []Command `json:"commands,omitempty"`    // Commands proposed in the answer, and the ones executed after it
+	Interrupted bool      `json:"interrupted,omitempty"` // Indicates if the answer was cut short
+	Summary     bool      `json:"summary,omitempty"`     // Indicates if the turn summarizes the earlier turns, which were compacted
+}
+
+// Command is a command proposed in an answer.
+type Command struct {
+	Command     string `json:"command"`               // Command line
+	Explanation string `json:"explanation,omitempty"` // Explanation of the command
+	Executed    bool   `json:"executed"`              // Indicates if the command was executed
+	ExitCode    *int   `json:"exit_code,omitempty"`   // Exit code of the executed command
+}
+
+// GetTitle returns the title of the exported conversation, after the name of the session or its ID.
+func (t Transcript) GetTitle() string {
+	if t.Name != "" {
+		return "Session " + t.Name
+	}
+
+	return "Session " + t.Id
+}
+
+// Write writes the transcript to the file, in the format given by its extension: .md, .json or .html.
+//the transcript is expected to be redacted already
+func Write(path string, transcript Transcript) error {
+	var content []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		content = []byte(Markdown(transcript))
+	case ".json":
+		content, err = Json(transcript)
+	case ".html", ".htm":
+		content, err = Html(transcript)
+	default:
+		return fmt.Errorf("unknown export format %q, use .md, .json or .html", filepath.Ext(path))
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, content, 0600)
+}
+
+// secretPatterns match the secrets redacted from a transcript. the groups named keep and tail are kept
+//around the secret, like the name of a password field
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{16,}`),
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{20,}`),
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{20,}`),
+	regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}`),
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`),
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]+`),
+	regexp.MustCompile(`(?i)(?P<keep>\bbearer\s+)[A-Za-z0-9._~+/-]{8,}=*`),
+	regexp.MustCompile(`(?P<keep>://[^/\s:@]+:)[^/\s@]+(?P<tail>@)`),
+	regexp.MustCompile(`(?i)(?P<keep>\b[\w-]*(?:password|passwd|secret|token|api[_-]?key|access[_-]?key|private[_-]?key)["']?\s*[=:]\s*)(?:"[^"\n]*"|'[^'\n]*'|[^\s"',;]+)`),
+}
+
+// Redact returns a copy of the transcript with the secrets replaced by REDACTED: the given ones, like
+//the API key of the config, and the ones looking like keys, tokens and passwords
+func Redact(transcript Transcript, secrets ...string) Transcript {
+	copied := transcript
+	copied.Directory = redactText(transcript.Directory, secrets)
+	copied.Turns = make([]Turn, len(transcript.Turns))
+	for i, turn := range transcript.Turns {
+		turn.Prompt = redactText(turn.Prompt, secrets)
+		turn.Answer = redactText(turn.Answer, secrets)
+		turn.Attachments = append([]string{}, turn.Attachments...)
+		turn.Commands = append([]Command{}, turn.Commands...)
+		for j := range turn.Commands {
+			turn.Commands[j].Command = redactText(turn.Commands[j].Command, secrets)
+			turn.Commands[j].Explanation = redactText(turn.Commands[j].Explanation, secrets)
+		}
+		copied.Turns[i] = turn
+	}
+
+	return copied
+}
+
+// redactText replaces the given secrets and the ones matched by secretPatterns in the text. the given
+//secrets which are too short to be told apart from ordinary words are left alone
+func redactText(text string, secrets []string) string {
+	for _, secret := range secrets {
+		if len(secret) >= 8 {
+			text = strings.ReplaceAll(text, secret, redacted)
+		}
+	}
+	for _, pattern := range secretPatterns {
+		text = pattern.ReplaceAllStringFunc(text, func(match string) string {
+			groups := pattern.FindStringSubmatch(match)
+			kept := func(name string) string {
+				if i := pattern.SubexpIndex(name); i > 0 && groups != nil {
+					return groups[i]
+				}
+				return ""
+			}
+			return kept("keep") + redacted + kept("tail")
+		})
+	}
+
+	return text
+}
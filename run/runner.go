@@ -1,11 +1,19 @@
 package run
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"strings"
 )
 
+// ErrOutputLimit is returned by the writer of RunBoundedCommand once the output limit is reached.
+var ErrOutputLimit = errors.New("output limit reached")
+
 //We can use open AI to generate commands but to actually run it, we need to use the exec.Command function
 //and that's essentially what we're calling here
 // RunCommand executes the command and returns the output from execution and any error encountered
@@ -20,22 +28,141 @@ func RunCommand(cmd string, arg ...string) (string, error) {
 	return string(out), nil
 }
 
+// RunBoundedCommand executes the command without a shell, killing it when the context is done, and
+//returns its combined output cut at limit bytes. a command writing more than that is stopped, and the
+//returned boolean tells the output was truncated
+func RunBoundedCommand(ctx context.Context, limit int, cmd string, arg ...string) (string, bool, error) {
+	//the command is killed once the limit is reached, otherwise it would block on its full pipe
+	commandCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	output := &limitedBuffer{limit: limit, full: cancel}
+	command := exec.CommandContext(commandCtx, cmd, arg...)
+	command.Stdout = output
+	command.Stderr = output
+
+	err := command.Run()
+	if output.truncated {
+		//the command was stopped because of us, what it wrote so far is what we wanted
+		return output.String(), true, nil
+	}
+	if ctx.Err() != nil {
+		return output.String(), false, ctx.Err()
+	}
+
+	return output.String(), false, err
+}
+
+// limitedBuffer is a buffer refusing to grow past its limit, full is called once it is reached.
+//the buffer is not embedded, its ReadFrom would let io.Copy write past the limit
+type limitedBuffer struct {
+	buffer    bytes.Buffer
+	limit     int
+	truncated bool
+	full      func()
+}
+
+// Write writes up to the limit and fails once it is reached, which stops the command writing.
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if left := b.limit - b.buffer.Len(); len(p) > left {
+		b.buffer.Write(p[:left])
+		b.truncated = true
+		b.full()
+		return left, ErrOutputLimit
+	}
+
+	return b.buffer.Write(p)
+}
+
+// String returns what was written so far.
+func (b *limitedBuffer) String() string {
+	return b.buffer.String()
+}
+
+// OutputCapture keeps the first bytes written to it up to its limit and silently drops the rest, so a
+//command can keep writing to the terminal while its output is captured
+type OutputCapture struct {
+	buffer    bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// NewOutputCapture creates an OutputCapture keeping up to limit bytes.
+func NewOutputCapture(limit int) *OutputCapture {
+	return &OutputCapture{limit: limit}
+}
+
+// Write keeps what fits in the limit, it never fails so the other writers of an io.MultiWriter get everything.
+func (o *OutputCapture) Write(p []byte) (int, error) {
+	if left := o.limit - o.buffer.Len(); len(p) > left {
+		o.buffer.Write(p[:left])
+		o.truncated = true
+	} else {
+		o.buffer.Write(p)
+	}
+
+	return len(p), nil
+}
+
+// String returns what was captured.
+func (o *OutputCapture) String() string {
+	return o.buffer.String()
+}
+
+// IsTruncated tells if some of the output was dropped.
+func (o *OutputCapture) IsTruncated() bool {
+	return o.truncated
+}
+
+// CaptureCommandOutput makes the command write its standard and error outputs both to where they go and
+//to the returned captures, each keeping up to limit bytes. a terminal is captured too, so the command
+//writes to a pipe and some programs drop their colors
+func CaptureCommandOutput(cmd *exec.Cmd, limit int) (*OutputCapture, *OutputCapture) {
+	var stdout, stderr *OutputCapture
+	cmd.Stdout, stdout = captureOutput(os.Stdout, limit)
+	cmd.Stderr, stderr = captureOutput(os.Stderr, limit)
+
+	return stdout, stderr
+}
+
+// captureOutput returns the writer of a command output going to the file, along with its capture. the
+//capture is written first, so the output is kept even when writing to the file fails
+func captureOutput(file *os.File, limit int) (io.Writer, *OutputCapture) {
+	capture := NewOutputCapture(limit)
+
+	return io.MultiWriter(capture, file), capture
+}
+
+// ExitCode returns the exit code of a command run with the given error, -1 when it could not run at all.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		return exitError.ExitCode()
+	}
+
+	return -1
+}
+
 // PrepareInteractiveCommand prepares a bash command for interactive execution
 func PrepareInteractiveCommand(input string) *exec.Cmd {
 	// Return a bash command that echoes a newline, executes the input command, and then echoes another newline
+	//before exiting with the status of the input command, so that its exit code is not the one of the echo
 	return exec.Command(
 		"bash",
 		"-c",
-		fmt.Sprintf("echo \"\n\";%s; echo \"\n\";", strings.TrimRight(input, ";")),
+		fmt.Sprintf("echo \"\n\";%s; rc=$?; echo \"\n\"; exit $rc", strings.TrimRight(input, ";")),
 	)
 }
 
 // PrepareEditSettingsCommand prepares a bash command for editing settings
 func PrepareEditSettingsCommand(input string) *exec.Cmd {
-	// Return a bash command that executes the input command and then echoes a newline
+	// Return a bash command that executes the input command and then echoes a newline, keeping its exit code
 	return exec.Command(
 		"bash",
 		"-c",
-		fmt.Sprintf("%s; echo \"\n\";", strings.TrimRight(input, ";")),
+		fmt.Sprintf("%s; rc=$?; echo \"\n\"; exit $rc", strings.TrimRight(input, ";")),
 	)
 }
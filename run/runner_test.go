@@ -1,16 +1,22 @@
 package run
 
 import (
+	"context"
+	"os"
 	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/term"
 )
 
 func TestRun(t *testing.T) {
 	// TestRun is a unit test for the Run function.
 	t.Run("RunCommand", testRunCommand)
+	t.Run("RunBoundedCommand", testRunBoundedCommand)
+	t.Run("CaptureCommandOutput", testCaptureCommandOutput)
 	t.Run("PrepareInteractiveCommand", testPrepareInteractiveCommand)
 	t.Run("PrepareEditSettingsCommand", testPrepareEditSettingsCommand)
 }
@@ -23,6 +29,69 @@ func testRunCommand(t *testing.T) {
 	assert.Equal(t, "Hello, World!\n", output, "The command output should be the same.")
 }
 
+// testRunBoundedCommand is a unit test for the RunBoundedCommand function.
+// It verifies that the output is cut at the limit and that the command is killed once the context is done.
+func testRunBoundedCommand(t *testing.T) {
+	output, truncated, err := RunBoundedCommand(context.Background(), 100, "echo", "Hello, World!")
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, World!\n", output, "The command output should be the same.")
+	assert.False(t, truncated, "The command output should not be truncated.")
+
+	output, truncated, err = RunBoundedCommand(context.Background(), 5, "echo", "Hello, World!")
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", output, "The command output should be cut at the limit.")
+	assert.True(t, truncated, "The command output should be truncated.")
+
+	//a command writing forever is stopped at the limit
+	output, truncated, err = RunBoundedCommand(context.Background(), 1000, "yes")
+	require.NoError(t, err)
+	assert.Len(t, output, 1000)
+	assert.True(t, truncated, "The command output should be truncated.")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, _, err = RunBoundedCommand(ctx, 100, "sleep", "5")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// testCaptureCommandOutput is a unit test for the CaptureCommandOutput and ExitCode functions.
+// It verifies that both outputs are captured up to the limit, along with the exit code.
+func testCaptureCommandOutput(t *testing.T) {
+	cmd := exec.Command("bash", "-c", "echo Hello, World!; echo failure >&2; exit 3")
+	stdout, stderr := CaptureCommandOutput(cmd, 5)
+	err := cmd.Run()
+
+	assert.Equal(t, 3, ExitCode(err), "The exit code should be the one of the command.")
+	assert.Equal(t, "Hello", stdout.String(), "The standard output should be cut at the limit.")
+	assert.True(t, stdout.IsTruncated(), "The standard output should be truncated.")
+	assert.Equal(t, "failu", stderr.String(), "The error output should be cut at the limit.")
+
+	//an output going to a terminal is captured as well
+	terminal := openTerminal(t)
+	writer, capture := captureOutput(terminal, 5)
+	cmd = exec.Command("bash", "-c", "echo failure >&2; exit 3")
+	cmd.Stderr = writer
+	assert.Equal(t, 3, ExitCode(cmd.Run()))
+	assert.Equal(t, "failu", capture.String(), "An output going to a terminal should be captured.")
+
+	assert.Equal(t, 0, ExitCode(nil), "A command without error should exit with 0.")
+	assert.Equal(t, -1, ExitCode(exec.Command("not-a-command").Run()), "A command which can't run has no exit code.")
+}
+
+// openTerminal opens the master side of a new pseudo terminal, standing for the terminal of the user.
+func openTerminal(t *testing.T) *os.File {
+	t.Helper()
+
+	terminal, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("no pseudo terminal: %v", err)
+	}
+	t.Cleanup(func() { terminal.Close() })
+	require.True(t, term.IsTerminal(int(terminal.Fd())))
+
+	return terminal
+}
+
 func testPrepareInteractiveCommand(t *testing.T) {
 	// testPrepareInteractiveCommand tests the PrepareInteractiveCommand function.
 	// It verifies that the generated command matches the expected command with the given input.
@@ -31,10 +100,15 @@ func testPrepareInteractiveCommand(t *testing.T) {
 	expectedCmd := exec.Command(
 		"bash",
 		"-c",
-		"echo \"\n\";echo 'Hello, World!'; echo \"\n\";",
+		"echo \"\n\";echo 'Hello, World!'; rc=$?; echo \"\n\"; exit $rc",
 	)
 
 	assert.Equal(t, expectedCmd.Args, cmd.Args, "The command arguments should be the same.")
+
+	//the exit code is the one of the input command, not the one of the trailing echo
+	cmd = PrepareInteractiveCommand("ls /nonexistent-path;")
+	assert.NotEqual(t, 0, ExitCode(cmd.Run()), "A failing command should keep its exit code.")
+	assert.Equal(t, 0, ExitCode(PrepareInteractiveCommand("true").Run()))
 }
 
 // testPrepareEditSettingsCommand is a unit test function that tests the PrepareEditSettingsCommand function.
@@ -44,8 +118,9 @@ func testPrepareEditSettingsCommand(t *testing.T) {
 	expectedCmd := exec.Command(
 		"bash",
 		"-c",
-		"nano yo.json; echo \"\n\";",
+		"nano yo.json; rc=$?; echo \"\n\"; exit $rc",
 	)
 
 	assert.Equal(t, expectedCmd.Args, cmd.Args, "The command arguments should be the same.")
+	assert.Equal(t, 4, ExitCode(PrepareEditSettingsCommand("(exit 4)").Run()), "The exit code should be the one of the command.")
 }
@@ -0,0 +1,41 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Report lists the sessions in markdown, the last updated first, marking the ones started in the given directory.
+func Report(sessions []*Session, directory string) string {
+	if len(sessions) == 0 {
+		return "**Sessions**\n\nno session saved yet\n"
+	}
+
+	var table strings.Builder
+	table.WriteString("**Sessions**\n\n")
+	table.WriteString("| id | name | mode | messages | updated | directory |\n")
+	table.WriteString("|---|---|---|---:|---|---|\n")
+	for _, session := range sessions {
+		location := session.Directory
+		if location == directory {
+			location += " (here)"
+		}
+		fmt.Fprintf(
+			&table,
+			"| %s | %s | %s | %d | %s | %s |\n",
+			session.ID,
+			escapeCell(session.Name),
+			session.Mode,
+			session.CountMessages(),
+			session.Updated.Local().Format("2006-01-02 15:04"),
+			escapeCell(location),
+		)
+	}
+
+	return table.String()
+}
+
+// escapeCell escapes the pipes of a value shown in a table cell.
+func escapeCell(value string) string {
+	return strings.ReplaceAll(value, "|", "\\|")
+}
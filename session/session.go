@@ -0,0 +1,326 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+//the conversations are kept on disk as sessions, so they can be resumed after the program exits. each
+//session is a JSON file named after its ID, holding the messages of every mode along with the mode, the
+//model and the piped input. a session can be given a name, unique among the sessions, and is referred
+//to by its name, its ID, or the beginning of its ID
+
+// ErrNotFound is returned when no session matches a reference.
+var ErrNotFound = errors.New("no such session")
+
+// fileExtension is the extension of the files of the sessions directory holding a session.
+const fileExtension = ".json"
+
+// idBytes is the number of random bytes of an ID, which is written in hexadecimal.
+const idBytes = 4
+
+// Session is a conversation saved on disk.
+type Session struct {
+	ID              string                         `json:"id"`                         // Identifier of the session, also the name of its file
+	Name            string                         `json:"name,omitempty"`             // Name given by the user, empty when unnamed
+	Directory       string                         `json:"directory"`                  // Directory the session was started in
+	Mode            string                         `json:"mode"`                       // Mode the session was left in (exec, chat, explain)
+	Model           string                         `json:"model"`                      // Model the session was talking to
+	Pipe            string                         `json:"pipe,omitempty"`             // Piped input the session works on
+	Created         time.Time                      `json:"created"`                    // When the session was started
+	Updated         time.Time                      `json:"updated"`                    // When the session was last saved
+	ExecMessages    []openai.ChatCompletionMessage `json:"exec_messages,omitempty"`    // Messages of the exec mode
+	ChatMessages    []openai.ChatCompletionMessage `json:"chat_messages,omitempty"`    // Messages of the chat mode
+	ExplainMessages []openai.ChatCompletionMessage `json:"explain_messages,omitempty"` // Messages of the explain mode
+}
+
+// GetLabel returns the name of the session, or its ID when it has none.
+func (s *Session) GetLabel() string {
+	if s.Name != "" {
+		return s.Name
+	}
+
+	return s.ID
+}
+
+// CountMessages returns the number of messages of the session, in every mode.
+func (s *Session) CountMessages() int {
+	return len(s.ExecMessages) + len(s.ChatMessages) + len(s.ExplainMessages)
+}
+
+// Store keeps the sessions in a directory.
+type Store struct {
+	dir string           // Directory of the sessions, one file per session
+	now func() time.Time // Returns the current time, replaced in tests
+	mu  sync.Mutex       // Guards the files of the directory
+}
+
+// NewStore opens the sessions stored in the given directory, it is created if missing.
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		dir: dir,
+		now: time.Now,
+	}, nil
+}
+
+// path returns the file of the session of the given ID.
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+fileExtension)
+}
+
+// New starts a session in the given directory and saves it, the name can be empty.
+func (s *Store) New(name string, directory string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkName(name, ""); err != nil {
+		return nil, err
+	}
+	id, err := s.newId()
+	if err != nil {
+		return nil, err
+	}
+	session := &Session{ID: id, Name: name, Directory: directory, Created: s.now()}
+
+	return session, s.save(session)
+}
+
+// Save writes the session, its update time set to now.
+func (s *Store) Save(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.save(session)
+}
+
+// List returns the sessions, the last updated first. a broken file is left out.
+func (s *Store) List() ([]*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.list()
+}
+
+// Find returns the session matching the reference: its ID, its name, or the beginning of its ID when
+//a single session starts with it
+func (s *Store) Find(reference string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.find(reference)
+}
+
+// Last returns the last updated session started in the given directory, or ErrNotFound.
+func (s *Store) Last(directory string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		if session.Directory == directory {
+			return session, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// Rename gives a new name to the session matching the reference.
+func (s *Store) Rename(reference string, name string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.TrimSpace(name) == "" {
+		return nil, errors.New("the new name of the session is empty")
+	}
+	session, err := s.find(reference)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkName(name, session.ID); err != nil {
+		return nil, err
+	}
+	session.Name = name
+
+	return session, s.save(session)
+}
+
+// Fork copies the session matching the reference into a new session with the given name, which can be
+//empty. the copy goes on from there on its own, the original is left as it is
+func (s *Store) Fork(reference string, name string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := s.find(reference)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkName(name, ""); err != nil {
+		return nil, err
+	}
+	id, err := s.newId()
+	if err != nil {
+		return nil, err
+	}
+
+	fork := *session
+	fork.ID = id
+	fork.Name = name
+	fork.Created = s.now()
+	fork.ExecMessages = append([]openai.ChatCompletionMessage{}, session.ExecMessages...)
+	fork.ChatMessages = append([]openai.ChatCompletionMessage{}, session.ChatMessages...)
+	fork.ExplainMessages = append([]openai.ChatCompletionMessage{}, session.ExplainMessages...)
+
+	return &fork, s.save(&fork)
+}
+
+// Delete removes the session matching the reference, and returns it.
+func (s *Store) Delete(reference string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := s.find(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, os.Remove(s.path(session.ID))
+}
+
+// newId returns a random ID which no session has yet.
+func (s *Store) newId() (string, error) {
+	for {
+		random := make([]byte, idBytes)
+		if _, err := rand.Read(random); err != nil {
+			return "", err
+		}
+		id := hex.EncodeToString(random)
+		if _, err := os.Stat(s.path(id)); errors.Is(err, os.ErrNotExist) {
+			return id, nil
+		}
+	}
+}
+
+// checkName checks that no other session than the one of the given ID has the name, an empty name is
+//always allowed
+func (s *Store) checkName(name string, id string) error {
+	if name == "" {
+		return nil
+	}
+	sessions, err := s.list()
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.Name == name && session.ID != id {
+			return fmt.Errorf("a session is already named %q", name)
+		}
+	}
+
+	return nil
+}
+
+// save writes the session aside then moves it, so a crash never leaves a half written session.
+func (s *Store) save(session *Session) error {
+	session.Updated = s.now()
+	encoded, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, session.ID+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(encoded); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path(session.ID)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return nil
+}
+
+// list reads the sessions of the directory, the last updated first.
+func (s *Store) list() ([]*Session, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*Session
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != fileExtension {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var session Session
+		if err := json.Unmarshal(content, &session); err != nil || session.ID == "" {
+			continue
+		}
+		sessions = append(sessions, &session)
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Updated.After(sessions[j].Updated)
+	})
+
+	return sessions, nil
+}
+
+// find returns the session matching the reference, see Find.
+func (s *Store) find(reference string) (*Session, error) {
+	if reference == "" {
+		return nil, ErrNotFound
+	}
+	sessions, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+
+	var prefixed []*Session
+	for _, session := range sessions {
+		if session.ID == reference || session.Name == reference {
+			return session, nil
+		}
+		if strings.HasPrefix(session.ID, reference) {
+			prefixed = append(prefixed, session)
+		}
+	}
+	switch len(prefixed) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, reference)
+	case 1:
+		return prefixed[0], nil
+	default:
+		return nil, fmt.Errorf("%q matches %d sessions, give more of the ID", reference, len(prefixed))
+	}
+}
@@ -0,0 +1,173 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStore tests the sessions saved on disk.
+func TestStore(t *testing.T) {
+	t.Run("SaveAndFind", testStoreSaveAndFind)
+	t.Run("Last", testStoreLast)
+	t.Run("Rename", testStoreRename)
+	t.Run("Fork", testStoreFork)
+	t.Run("Delete", testStoreDelete)
+	t.Run("Report", testStoreReport)
+}
+
+// newTestStore opens a store in a temporary directory, with a clock moving a minute forward on each call.
+func newTestStore(t *testing.T) *Store {
+	store, err := NewStore(filepath.Join(t.TempDir(), "sessions"))
+	require.NoError(t, err)
+
+	now := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+
+	return store
+}
+
+// testStoreSaveAndFind checks that a saved session is found again by its ID, its name or the beginning of its ID.
+func testStoreSaveAndFind(t *testing.T) {
+	store := newTestStore(t)
+
+	session, err := store.New("deploy", "/srv/app")
+	require.NoError(t, err)
+	assert.Len(t, session.ID, 2*idBytes)
+	session.Mode = "chat"
+	session.ChatMessages = []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "how do I deploy?"}}
+	require.NoError(t, store.Save(session))
+
+	for _, reference := range []string{session.ID, "deploy", session.ID[:3]} {
+		found, err := store.Find(reference)
+		require.NoError(t, err, reference)
+		assert.Equal(t, session.ID, found.ID)
+		assert.Equal(t, "chat", found.Mode)
+		assert.Equal(t, "how do I deploy?", found.ChatMessages[0].Content)
+	}
+
+	_, err = store.Find("unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	//a name can only be taken once
+	_, err = store.New("deploy", "/srv/app")
+	assert.Error(t, err)
+
+	//a broken file is left out
+	require.NoError(t, os.WriteFile(filepath.Join(store.dir, "broken.json"), []byte("{"), 0600))
+	sessions, err := store.List()
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1)
+}
+
+// testStoreLast checks that the last updated session of a directory is found.
+func testStoreLast(t *testing.T) {
+	store := newTestStore(t)
+
+	first, err := store.New("", "/srv/app")
+	require.NoError(t, err)
+	second, err := store.New("", "/srv/app")
+	require.NoError(t, err)
+	_, err = store.New("", "/home")
+	require.NoError(t, err)
+
+	last, err := store.Last("/srv/app")
+	require.NoError(t, err)
+	assert.Equal(t, second.ID, last.ID)
+
+	require.NoError(t, store.Save(first))
+	last, err = store.Last("/srv/app")
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, last.ID)
+
+	_, err = store.Last("/tmp")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+// testStoreRename checks that a session is renamed, unless the name is taken.
+func testStoreRename(t *testing.T) {
+	store := newTestStore(t)
+
+	session, err := store.New("", "/srv/app")
+	require.NoError(t, err)
+	_, err = store.New("taken", "/srv/app")
+	require.NoError(t, err)
+
+	renamed, err := store.Rename(session.ID, "backup")
+	require.NoError(t, err)
+	assert.Equal(t, "backup", renamed.GetLabel())
+	_, err = store.Find("backup")
+	assert.NoError(t, err)
+
+	_, err = store.Rename("backup", "taken")
+	assert.Error(t, err)
+	_, err = store.Rename("backup", " ")
+	assert.Error(t, err)
+	//a session can be renamed to its own name
+	_, err = store.Rename("backup", "backup")
+	assert.NoError(t, err)
+}
+
+// testStoreFork checks that a fork goes on on its own, the original being left as it is.
+func testStoreFork(t *testing.T) {
+	store := newTestStore(t)
+
+	session, err := store.New("main", "/srv/app")
+	require.NoError(t, err)
+	session.ExecMessages = []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "list files"}}
+	require.NoError(t, store.Save(session))
+
+	fork, err := store.Fork("main", "")
+	require.NoError(t, err)
+	assert.NotEqual(t, session.ID, fork.ID)
+	assert.Equal(t, fork.ID, fork.GetLabel())
+	assert.Equal(t, 1, fork.CountMessages())
+
+	fork.ExecMessages = append(fork.ExecMessages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "sort them"})
+	require.NoError(t, store.Save(fork))
+	original, err := store.Find("main")
+	require.NoError(t, err)
+	assert.Equal(t, 1, original.CountMessages())
+}
+
+// testStoreDelete checks that a deleted session is gone.
+func testStoreDelete(t *testing.T) {
+	store := newTestStore(t)
+
+	session, err := store.New("old", "/srv/app")
+	require.NoError(t, err)
+
+	deleted, err := store.Delete("old")
+	require.NoError(t, err)
+	assert.Equal(t, session.ID, deleted.ID)
+	_, err = store.Find(session.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = store.Delete("old")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+// testStoreReport checks that the sessions are listed, the ones of the directory being marked.
+func testStoreReport(t *testing.T) {
+	store := newTestStore(t)
+	assert.Contains(t, Report(nil, "/srv/app"), "no session saved yet")
+
+	_, err := store.New("a|b", "/srv/app")
+	require.NoError(t, err)
+	_, err = store.New("", "/home")
+	require.NoError(t, err)
+	sessions, err := store.List()
+	require.NoError(t, err)
+
+	report := Report(sessions, "/srv/app")
+	assert.Contains(t, report, "a\\|b")
+	assert.Contains(t, report, "/srv/app (here)")
+	assert.NotContains(t, report, "/home (here)")
+}
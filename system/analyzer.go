@@ -24,6 +24,10 @@ type Analysis struct {
 	username        string          // The username of the current user.
 	editor          string          // The default editor set.
 	configFile      string          // The configuration file path.
+	usageFile       string          // The usage ledger file path.
+	promptsDir      string          // The directory of the prompt templates.
+	cacheDir        string          // The directory of the response cache.
+	sessionsDir     string          // The directory of the saved sessions.
 }
 
 //below are a bunch of helper functions that'll help us get the values for the analysis struct
@@ -68,6 +72,26 @@ func (a *Analysis) GetConfigFile() string {
 	return a.configFile
 }
 
+// GetUsageFile is a method that returns the usage ledger file path.
+func (a *Analysis) GetUsageFile() string {
+	return a.usageFile
+}
+
+// GetPromptsDirectory is a method that returns the directory of the prompt templates.
+func (a *Analysis) GetPromptsDirectory() string {
+	return a.promptsDir
+}
+
+// GetCacheDirectory is a method that returns the directory of the response cache.
+func (a *Analysis) GetCacheDirectory() string {
+	return a.cacheDir
+}
+
+// GetSessionsDirectory is a method that returns the directory of the saved sessions.
+func (a *Analysis) GetSessionsDirectory() string {
+	return a.sessionsDir
+}
+
 // Analyse is a function that returns an Analysis object by calling functions for each of 
 //the values required for the fields in the struct
 func Analyse() *Analysis {
@@ -79,6 +103,10 @@ func Analyse() *Analysis {
 		username:        GetUsername(),
 		editor:          GetEditor(),
 		configFile:      GetConfigFile(),
+		usageFile:       GetUsageFile(),
+		promptsDir:      GetPromptsDirectory(),
+		cacheDir:        GetCacheDirectory(),
+		sessionsDir:     GetSessionsDirectory(),
 	}
 }
 
@@ -174,3 +202,43 @@ func GetConfigFile() string {
 		strings.ToLower(APPLICATION_NAME),
 	)
 }
+
+// GetUsageFile is a function that returns the usage ledger file path.
+//it sits next to the config file, with one JSON line per request sent to the API
+func GetUsageFile() string {
+	return fmt.Sprintf(
+		"%s/.config/%s-usage.jsonl",
+		GetHomeDirectory(),
+		strings.ToLower(APPLICATION_NAME),
+	)
+}
+
+// GetPromptsDirectory is a function that returns the directory of the prompt templates.
+//the templates found there (exec.tmpl, chat.tmpl and context.tmpl) replace the built-in prompts
+func GetPromptsDirectory() string {
+	return fmt.Sprintf(
+		"%s/.config/%s",
+		GetHomeDirectory(),
+		strings.ToLower(APPLICATION_NAME),
+	)
+}
+
+// GetCacheDirectory is a function that returns the directory of the response cache.
+//it sits next to the config file, with one file per cached answer
+func GetCacheDirectory() string {
+	return fmt.Sprintf(
+		"%s/.config/%s-cache",
+		GetHomeDirectory(),
+		strings.ToLower(APPLICATION_NAME),
+	)
+}
+
+// GetSessionsDirectory is a function that returns the directory of the saved sessions.
+//it sits next to the config file, with one file per session
+func GetSessionsDirectory() string {
+	return fmt.Sprintf(
+		"%s/.config/%s-sessions",
+		GetHomeDirectory(),
+		strings.ToLower(APPLICATION_NAME),
+	)
+}
@@ -30,4 +30,8 @@ func testAnalyse(t *testing.T) {
 	assert.NotEmpty(t, analysis.GetHomeDirectory(), "Home directory should not be empty.")
 	assert.NotEmpty(t, analysis.GetUsername(), "Username should not be empty.")
 	assert.NotEmpty(t, analysis.GetConfigFile(), "Config file should not be empty.")
+	assert.NotEmpty(t, analysis.GetUsageFile(), "Usage file should not be empty.")
+	assert.NotEmpty(t, analysis.GetPromptsDirectory(), "Prompts directory should not be empty.")
+	assert.NotEmpty(t, analysis.GetCacheDirectory(), "Cache directory should not be empty.")
+	assert.NotEmpty(t, analysis.GetSessionsDirectory(), "Sessions directory should not be empty.")
 }
@@ -0,0 +1,553 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/akhilsharma90/terminal-assistant/ai"
+	"github.com/akhilsharma90/terminal-assistant/export"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+//everything the REPL does besides answering a prompt is a /command of the registry below. a prompt
+//starting with a / followed by the name of a command, or the beginning of one, is a command, so a path
+//like /usr/bin/ls or a question like /tmp is full, why? is still sent as a prompt. the commands bound to
+//a key run the same way when the key is pressed, and the help is generated from the registry, so a new
+//command only has to be added there
+
+// commandLinePattern matches a prompt which may hold a command: a / followed by a word, then the arguments.
+var commandLinePattern = regexp.MustCompile(`^/([a-z]*)(\s|$)`)
+
+// Command is a /command of the REPL.
+type Command struct {
+	name     string                             // Name typed after the /
+	usage    string                             // Arguments shown in the help, <required> or [optional]
+	help     string                             // What the command does, shown in the help
+	key      string                             // Key running the command without arguments, empty when there is none
+	minArgs  int                                // Number of arguments the command needs
+	maxArgs  int                                // Number of arguments the command takes at most
+	engine   bool                               // Whether the command waits for the engine to be ready
+	complete func(u *Ui, arg string) []string   // Candidates of the argument being typed, nil when there are none
+	run      func(u *Ui, args []string) tea.Cmd // Runs the command, its output is printed by the returned command
+}
+
+// GetName returns the name of the command, without the /.
+func (c *Command) GetName() string {
+	return c.name
+}
+
+// GetSyntax returns how the command is typed, like /model [name].
+func (c *Command) GetSyntax() string {
+	if c.usage == "" {
+		return "/" + c.name
+	}
+
+	return fmt.Sprintf("/%s %s", c.name, c.usage)
+}
+
+// GetHelp returns what the command does.
+func (c *Command) GetHelp() string {
+	return c.help
+}
+
+// GetKey returns the key running the command, empty when there is none.
+func (c *Command) GetKey() string {
+	return c.key
+}
+
+// KeyHelp is a key of the REPL which doesn't run a command, listed in the help after the commands.
+type KeyHelp struct {
+	Key  string // Key as shown in the help
+	Help string // What the key does
+}
+
+// Commands is the registry of the /commands of the REPL.
+type Commands struct {
+	commands []*Command // Commands in the order of the help
+	keys     []KeyHelp  // Keys which don't run a command
+}
+
+// NewCommands creates the registry of the commands of the REPL.
+func NewCommands() *Commands {
+	return &Commands{
+		commands: []*Command{
+			{name: "help", help: "show this help", key: "ctrl+h", run: (*Ui).runHelp},
+			{name: "mode", usage: "<exec|chat|explain>", help: "switch the prompt mode, each mode keeps its conversation", minArgs: 1, maxArgs: 1, engine: true, complete: completeMode, run: (*Ui).runMode},
+			{name: "model", usage: "[name]", help: "switch to the model, or pick it among the available ones, the discussion goes on with it", key: "ctrl+o", maxArgs: 1, engine: true, complete: completeModel, run: (*Ui).runModel},
+			{name: "temp", usage: "[value]", help: "set the temperature from 0 to 2, or go back to the one of the config", maxArgs: 1, engine: true, run: (*Ui).runTemp},
+			{name: "pipe", usage: "[file]", help: "work on the content of the file as if it was piped in, or drop the piped input", maxArgs: 1, engine: true, complete: completePath, run: (*Ui).runPipe},
+			{name: "save", usage: "[name]", help: "save the session now, under this name", maxArgs: 1, engine: true, run: (*Ui).runSave},
+			{name: "load", usage: "<session>", help: "go on with the saved session of this name or ID", minArgs: 1, maxArgs: 1, engine: true, complete: completeSession, run: (*Ui).runLoad},
+			{name: "export", usage: "<file>", help: "export the session to a .md, .json or .html file, the secrets redacted", minArgs: 1, maxArgs: 1, engine: true, complete: completePath, run: (*Ui).runExport},
+			{name: "clear", help: "clear the terminal but keep the discussion", key: "ctrl+l", run: (*Ui).runClear},
+			{name: "reset", help: "clear the terminal and start a new discussion", key: "ctrl+r", engine: true, run: (*Ui).runReset},
+			{name: "settings", help: "edit the settings", key: "ctrl+s", engine: true, run: (*Ui).runSettings},
+		},
+		keys: []KeyHelp{
+			{Key: "↑/↓", Help: "navigate in history, or pick among alternative commands or models"},
+			{Key: "tab", Help: "switch between 🚀 exec, 💬 chat and 🔍 explain prompt modes, or complete a /command or an @path"},
+			{Key: "r/s/a", Help: "run, skip or abort the current step of a plan"},
+			{Key: "esc", Help: "interrupt the answer being generated"},
+			{Key: "ctrl+c", Help: "interrupt the answer being generated, exit otherwise"},
+		},
+	}
+}
+
+// GetCommands returns the commands, in the order of the help.
+func (c *Commands) GetCommands() []*Command {
+	return c.commands
+}
+
+// GetKeys returns the keys which don't run a command.
+func (c *Commands) GetKeys() []KeyHelp {
+	return c.keys
+}
+
+// Find returns the command of the given name, nil when there is none.
+func (c *Commands) Find(name string) *Command {
+	for _, command := range c.commands {
+		if command.name == name {
+			return command
+		}
+	}
+
+	return nil
+}
+
+// FindKey returns the command run by the given key, nil when there is none.
+func (c *Commands) FindKey(key string) *Command {
+	for _, command := range c.commands {
+		if command.key != "" && command.key == key {
+			return command
+		}
+	}
+
+	return nil
+}
+
+// IsCommandLine returns true when the prompt holds a command rather than something to send: the word
+//after the / is the name of a command or the beginning of one, a mistyped command being refused with the
+//commands of a similar name
+func (c *Commands) IsCommandLine(input string) bool {
+	match := commandLinePattern.FindStringSubmatch(input)
+	if match == nil {
+		return false
+	}
+	for _, command := range c.commands {
+		if strings.HasPrefix(command.name, match[1]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Parse returns the command of the line and its arguments, an unknown command is refused with the
+//commands of a similar name, and a wrong number of arguments with the syntax of the command
+func (c *Commands) Parse(line string) (*Command, []string, error) {
+	words, err := splitCommandLine(line)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(words) == 0 {
+		return nil, nil, errors.New("no command, /help lists them")
+	}
+
+	name := strings.TrimPrefix(words[0], "/")
+	command := c.Find(name)
+	if command == nil {
+		var suggestions []string
+		for _, candidate := range c.commands {
+			if name != "" && (strings.HasPrefix(candidate.name, name) || strings.HasPrefix(name, candidate.name)) {
+				suggestions = append(suggestions, "/"+candidate.name)
+			}
+		}
+		if len(suggestions) > 0 {
+			return nil, nil, fmt.Errorf("unknown command %s, did you mean %s?", words[0], strings.Join(suggestions, ", "))
+		}
+		return nil, nil, fmt.Errorf("unknown command %s, /help lists them", words[0])
+	}
+
+	args := words[1:]
+	if len(args) < command.minArgs || len(args) > command.maxArgs {
+		return nil, nil, fmt.Errorf("usage: %s", command.GetSyntax())
+	}
+
+	return command, args, nil
+}
+
+// Complete returns the line with the command, or the argument being typed, completed with the longest
+//prefix shared by its candidates. a command completed for good is followed by a space when it takes
+//arguments
+func (c *Commands) Complete(u *Ui, line string) string {
+	space := strings.LastIndexFunc(line, unicode.IsSpace)
+	if space < 0 {
+		var names []string
+		for _, command := range c.commands {
+			if strings.HasPrefix(command.name, line[1:]) {
+				names = append(names, command.name)
+			}
+		}
+		if len(names) == 0 {
+			return line
+		}
+		if len(names) == 1 && c.Find(names[0]).maxArgs > 0 {
+			return "/" + names[0] + " "
+		}
+		return "/" + commonPrefix(names)
+	}
+
+	command := c.Find(strings.TrimPrefix(strings.Fields(line)[0], "/"))
+	if command == nil || command.complete == nil {
+		return line
+	}
+	arg := line[space+1:]
+	var candidates []string
+	for _, candidate := range command.complete(u, arg) {
+		if strings.HasPrefix(candidate, arg) {
+			candidates = append(candidates, candidate)
+		}
+	}
+	if len(candidates) == 0 {
+		return line
+	}
+
+	return line[:space+1] + commonPrefix(candidates)
+}
+
+// splitCommandLine splits the line into words, a word can be quoted with " or ' to hold spaces.
+func splitCommandLine(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	var quote rune
+	inWord := false
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("the quote %c is not closed", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
+
+// commonPrefix returns the longest prefix shared by the candidates, never cutting a rune in two.
+func commonPrefix(candidates []string) string {
+	common := []rune(candidates[0])
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, string(common)) {
+			common = common[:len(common)-1]
+		}
+	}
+
+	return string(common)
+}
+
+// expandHome replaces the ~ at the beginning of the path with the home directory.
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
+//the candidates of the arguments, they are filtered on what was typed by Complete
+
+// completeMode returns the prompt modes.
+func completeMode(u *Ui, arg string) []string {
+	return []string{ExecPromptMode.String(), ChatPromptMode.String(), ExplainPromptMode.String()}
+}
+
+// completeModel returns the models listed last, nothing is listed while completing.
+func completeModel(u *Ui, arg string) []string {
+	return u.state.listed
+}
+
+// completePath returns the path being typed completed as far as the files allow.
+func completePath(u *Ui, arg string) []string {
+	return []string{completeAttachmentPath(arg)}
+}
+
+// completeSession returns the names and the IDs of the saved sessions.
+func completeSession(u *Ui, arg string) []string {
+	if u.sessions == nil {
+		return nil
+	}
+	sessions, err := u.sessions.List()
+	if err != nil {
+		return nil
+	}
+
+	var references []string
+	for _, saved := range sessions {
+		if saved.Name != "" {
+			references = append(references, saved.Name)
+		}
+		references = append(references, saved.ID)
+	}
+	sort.Strings(references)
+
+	return references
+}
+
+//the commands themselves, they run in Update like the keys did, so they can change the state of the
+//UI. what takes time, like checking a model, runs in the background and comes back as a message
+
+// canRunCommand returns true when the UI waits for a prompt, and the engine is ready if the command needs it.
+func (u *Ui) canRunCommand(command *Command) bool {
+	if u.state.configuring || u.state.querying || u.state.confirming || u.state.executing || u.state.picking {
+		return false
+	}
+
+	return u.engine != nil || !command.engine
+}
+
+// runCommandLine runs the command typed in the prompt, or prints why it can't be run.
+func (u *Ui) runCommandLine(line string) tea.Cmd {
+	command, args, err := u.commands.Parse(line)
+	if err != nil {
+		return u.printCommandError(err)
+	}
+	if !u.canRunCommand(command) {
+		return u.printCommandError(fmt.Errorf("%s can't run now", command.GetSyntax()))
+	}
+
+	return command.run(u, args)
+}
+
+// printCommandOutput prints what a command did and goes back to the prompt.
+func (u *Ui) printCommandOutput(output string) tea.Cmd {
+	return tea.Sequence(
+		tea.Println(fmt.Sprintf("\n%s\n", output)),
+		textinput.Blink,
+	)
+}
+
+// printCommandError prints why a command failed and goes back to the prompt.
+func (u *Ui) printCommandError(err error) tea.Cmd {
+	return u.printCommandOutput(u.components.renderer.RenderError(fmt.Sprintf("[%s]", err)))
+}
+
+// runHelp prints the help.
+func (u *Ui) runHelp(args []string) tea.Cmd {
+	return tea.Sequence(
+		tea.Println(u.components.renderer.RenderContent(u.components.renderer.RenderHelpMessage(u.commands))),
+		textinput.Blink,
+	)
+}
+
+// runMode switches the prompt mode, the engine goes on with the conversation of the mode.
+func (u *Ui) runMode(args []string) tea.Cmd {
+	mode := GetPromptModeFromString(args[0])
+	if mode != ExecPromptMode && mode != ChatPromptMode && mode != ExplainPromptMode {
+		return u.printCommandError(fmt.Errorf("unknown mode %s, the modes are exec, chat and explain", args[0]))
+	}
+	u.setPromptMode(mode)
+
+	return u.printCommandOutput(u.components.renderer.RenderSuccess(fmt.Sprintf("[switched to %s mode]", mode)))
+}
+
+// runModel switches to the given model once it is checked against the available ones, and opens the
+//model picker without one
+func (u *Ui) runModel(args []string) tea.Cmd {
+	//querying is set while the models are listed, so the spinner ticks and esc can interrupt
+	u.state.querying = true
+	u.state.buffer = ""
+	u.components.prompt.Blur()
+	if len(args) == 0 {
+		return tea.Batch(
+			u.listModels(),
+			u.components.spinner.Tick,
+		)
+	}
+
+	return tea.Batch(
+		u.checkModel(args[0]),
+		u.components.spinner.Tick,
+	)
+}
+
+// runTemp sets the temperature of this invocation, the one of the config is used again without a value.
+func (u *Ui) runTemp(args []string) tea.Cmd {
+	output := "[temperature of the config]"
+	if len(args) == 0 {
+		u.state.sampling.Temperature = nil
+	} else {
+		temperature, err := strconv.ParseFloat(args[0], 64)
+		if err != nil || temperature < 0 || temperature > 2 {
+			return u.printCommandError(fmt.Errorf("the temperature goes from 0 to 2, not %s", args[0]))
+		}
+		u.state.sampling.Temperature = &temperature
+		output = fmt.Sprintf("[temperature set to %s]", strconv.FormatFloat(temperature, 'f', -1, 64))
+	}
+	u.engine.SetSampling(u.state.sampling)
+
+	return u.printCommandOutput(u.components.renderer.RenderSuccess(output))
+}
+
+// runPipe reads the file as the piped input of the next prompts, the piped input is dropped without one.
+func (u *Ui) runPipe(args []string) tea.Cmd {
+	if len(args) == 0 {
+		u.state.pipe = ""
+		u.engine.SetPipe("")
+		return u.printCommandOutput(u.components.renderer.RenderSuccess("[piped input dropped]"))
+	}
+
+	path, err := expandHome(args[0])
+	if err != nil {
+		return u.printCommandError(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return u.printCommandError(err)
+	}
+	defer file.Close()
+	content, err := ai.ReadPipe(file, u.state.pipeLimit)
+	if err != nil {
+		return u.printCommandError(err)
+	}
+	u.state.pipe = content
+	u.engine.SetPipe(u.state.pipe)
+
+	return u.printCommandOutput(u.components.renderer.RenderSuccess(fmt.Sprintf("[piped input read from %s, %d bytes]", args[0], len(content))))
+}
+
+// runSave saves the session now, the session is started if there is none yet and named or renamed
+//when a name is given
+func (u *Ui) runSave(args []string) tea.Cmd {
+	if u.sessions == nil {
+		return u.printCommandError(errors.New("the sessions can't be saved"))
+	}
+
+	var name string
+	if len(args) > 0 {
+		name = args[0]
+	}
+	if u.session == nil {
+		directory, _ := os.Getwd()
+		current, err := u.sessions.New(name, directory)
+		if err != nil {
+			return u.printCommandError(err)
+		}
+		u.session = current
+	} else if name != "" {
+		renamed, err := u.sessions.Rename(u.session.ID, name)
+		if err != nil {
+			return u.printCommandError(err)
+		}
+		u.session = renamed
+	}
+	if warning := u.saveSession(); warning != "" {
+		return u.printCommandOutput(warning)
+	}
+
+	return u.printCommandOutput(u.components.renderer.RenderSuccess(fmt.Sprintf("[session %s saved]", u.session.GetLabel())))
+}
+
+// runLoad goes on with the saved session, in the mode it was left in. the current session is kept as
+//it was saved
+func (u *Ui) runLoad(args []string) tea.Cmd {
+	if u.sessions == nil {
+		return u.printCommandError(errors.New("the sessions can't be loaded"))
+	}
+	loaded, err := u.sessions.Find(args[0])
+	if err != nil {
+		return u.printCommandError(fmt.Errorf("%s: %s", args[0], err))
+	}
+
+	u.engine.RestoreSession(loaded)
+	u.session = loaded
+	if mode := GetPromptModeFromString(loaded.Mode); mode == ExecPromptMode || mode == ChatPromptMode || mode == ExplainPromptMode {
+		u.setPromptMode(mode)
+	}
+
+	return u.printCommandOutput(u.components.renderer.RenderSuccess(fmt.Sprintf("[loaded session %s, %d messages]", loaded.GetLabel(), loaded.CountMessages())))
+}
+
+// runExport saves the session and exports it to the file, the API key and anything looking like a
+//secret being redacted
+func (u *Ui) runExport(args []string) tea.Cmd {
+	if warning := u.saveSession(); warning != "" {
+		return u.printCommandOutput(warning)
+	}
+	if u.session == nil {
+		return u.printCommandError(errors.New("there is nothing to export yet"))
+	}
+
+	path, err := expandHome(args[0])
+	if err != nil {
+		return u.printCommandError(err)
+	}
+	transcript := export.Redact(ai.Transcribe(u.session), secretsOf(u.config)...)
+	if err := export.Write(path, transcript); err != nil {
+		return u.printCommandError(err)
+	}
+
+	return u.printCommandOutput(u.components.renderer.RenderSuccess(fmt.Sprintf("[session %s exported to %s]", u.session.GetLabel(), args[0])))
+}
+
+// runClear clears the terminal, the discussion goes on.
+func (u *Ui) runClear(args []string) tea.Cmd {
+	return tea.Sequence(
+		tea.ClearScreen,
+		textinput.Blink,
+	)
+}
+
+// runReset clears the terminal and the history, and starts a new discussion.
+func (u *Ui) runReset(args []string) tea.Cmd {
+	u.history.Reset()
+	u.engine.Reset()
+	//the saved session is kept as it was, the next answer starts a new one
+	u.session = nil
+	u.components.prompt.SetValue("")
+
+	return tea.Sequence(
+		tea.ClearScreen,
+		textinput.Blink,
+	)
+}
+
+// runSettings opens the config file in the editor, the engine is rebuilt from it once it is closed.
+func (u *Ui) runSettings(args []string) tea.Cmd {
+	u.state.executing = true
+	u.state.buffer = ""
+	u.state.command = ""
+	u.components.prompt.Blur()
+
+	return u.editSettings()
+}
@@ -0,0 +1,203 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/akhilsharma90/terminal-assistant/ai"
+	"github.com/akhilsharma90/terminal-assistant/session"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCommands tests the registry of the /commands and the commands run in the REPL.
+func TestCommands(t *testing.T) {
+	t.Run("IsCommandLine", testCommandsIsCommandLine)
+	t.Run("Parse", testCommandsParse)
+	t.Run("Complete", testCommandsComplete)
+	t.Run("Help", testCommandsHelp)
+	t.Run("Run", testCommandsRun)
+	t.Run("Sessions", testCommandsSessions)
+}
+
+// testCommandsIsCommandLine checks that only a / followed by the name of a command, or the beginning of
+//one, is a command, not a path nor a word which is no command
+func testCommandsIsCommandLine(t *testing.T) {
+	commands := NewCommands()
+	assert.True(t, commands.IsCommandLine("/help"))
+	assert.True(t, commands.IsCommandLine("/model gpt-4"))
+	assert.True(t, commands.IsCommandLine("/mo chat"))
+	assert.True(t, commands.IsCommandLine("/"))
+	assert.False(t, commands.IsCommandLine("/usr/bin/ls -la"))
+	assert.False(t, commands.IsCommandLine("/tmp is full, why?"))
+	assert.False(t, commands.IsCommandLine("/quit"))
+	assert.False(t, commands.IsCommandLine("list /tmp"))
+	assert.False(t, commands.IsCommandLine(" /help"))
+}
+
+// testCommandsParse checks the arguments, the quotes, and the errors of unknown commands and wrong arguments.
+func testCommandsParse(t *testing.T) {
+	commands := NewCommands()
+
+	command, args, err := commands.Parse(`/save "my session"`)
+	require.NoError(t, err)
+	assert.Equal(t, "save", command.GetName())
+	assert.Equal(t, []string{"my session"}, args)
+
+	_, args, err = commands.Parse("/temp")
+	require.NoError(t, err)
+	assert.Empty(t, args)
+
+	_, _, err = commands.Parse("/mode")
+	assert.EqualError(t, err, "usage: /mode <exec|chat|explain>")
+	_, _, err = commands.Parse("/help me")
+	assert.EqualError(t, err, "usage: /help")
+	_, _, err = commands.Parse("/mo chat")
+	assert.EqualError(t, err, "unknown command /mo, did you mean /mode, /model?")
+	_, _, err = commands.Parse("/quit")
+	assert.EqualError(t, err, "unknown command /quit, /help lists them")
+	_, _, err = commands.Parse(`/save "my session`)
+	assert.Error(t, err)
+}
+
+// testCommandsComplete checks that the names and the arguments are completed as far as their candidates
+//agree, through the prompt
+func testCommandsComplete(t *testing.T) {
+	u := NewUi(&UiInput{runMode: ReplMode, promptMode: ExecPromptMode})
+	u.state.listed = []string{"gpt-4", "gpt-4o", "llama3"}
+	complete := func(line string) string {
+		return u.commands.Complete(u, line)
+	}
+
+	for line, expected := range map[string]string{
+		"/he":          "/help",
+		"/mo":          "/mode",
+		"/tem":         "/temp ",
+		"/mode ch":     "/mode chat",
+		"/model g":     "/model gpt-4",
+		"/model ll":    "/model llama3",
+		"/clear again": "/clear again",
+	} {
+		p := NewPrompt(ExecPromptMode)
+		p.SetValue(line)
+		p.input.CursorEnd()
+		assert.True(t, p.CompleteCommand(u.commands, complete), line)
+		assert.Equal(t, expected, p.GetValue(), line)
+	}
+
+	for _, line := range []string{"/usr/bin/l", "/x"} {
+		p := NewPrompt(ExecPromptMode)
+		p.SetValue(line)
+		p.input.CursorEnd()
+		assert.False(t, p.CompleteCommand(u.commands, complete), "%s should not be completed as a command.", line)
+	}
+
+	//the shared prefix of the candidates is made of whole runes
+	assert.Equal(t, "caf", commonPrefix([]string{"café", "cafè"}))
+}
+
+// testCommandsHelp checks that the help lists every command with its key, and the other keys.
+func testCommandsHelp(t *testing.T) {
+	commands := NewCommands()
+	help := NewRenderer(glamour.WithAutoStyle()).RenderHelpMessage(commands)
+
+	for _, command := range commands.GetCommands() {
+		assert.Contains(t, help, "`"+command.GetSyntax()+"`")
+	}
+	assert.Contains(t, help, "- `/model [name]` or `ctrl+o`: ")
+	assert.Contains(t, help, "- `esc`: ")
+	assert.Equal(t, "settings", commands.FindKey("ctrl+s").GetName())
+	assert.Nil(t, commands.FindKey("ctrl+c"))
+}
+
+// testCommandsRun checks that the commands typed in the prompt change the mode, the temperature and the
+//piped input of the engine, that a wrong one leaves them as they were, and that a word which is no command
+//is sent
+func testCommandsRun(t *testing.T) {
+	u := newTestUi(t, ExecPromptMode, "http://localhost")
+	enter := func(line string) {
+		u.components.prompt.SetValue(line)
+		u.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	}
+
+	enter("/mode chat")
+	assert.Equal(t, ChatPromptMode, u.state.promptMode)
+	assert.Equal(t, ChatPromptMode, u.components.prompt.GetMode())
+	assert.Equal(t, ai.ChatEngineMode, u.engine.GetMode())
+	assert.Empty(t, u.components.prompt.GetValue())
+	assert.False(t, u.state.querying)
+
+	enter("/mode shell")
+	assert.Equal(t, ChatPromptMode, u.state.promptMode)
+
+	enter("/temp 0.3")
+	require.NotNil(t, u.state.sampling.Temperature)
+	assert.Equal(t, 0.3, *u.state.sampling.Temperature)
+	enter("/temp 3")
+	assert.Equal(t, 0.3, *u.state.sampling.Temperature)
+	enter("/temp")
+	assert.Nil(t, u.state.sampling.Temperature)
+
+	path := filepath.Join(t.TempDir(), "access.log")
+	require.NoError(t, os.WriteFile(path, []byte("GET / 200"), 0644))
+	enter("/pipe " + path)
+	assert.Equal(t, "GET / 200", u.state.pipe)
+	enter("/pipe")
+	assert.Empty(t, u.state.pipe)
+
+	//the keys run the commands bound to them
+	u.Update(tea.KeyMsg{Type: tea.KeyCtrlO})
+	assert.True(t, u.state.querying)
+
+	//a word after the / which is no command is sent to the model
+	u = newTestUi(t, ExecPromptMode, "http://localhost")
+	enter("/tmp is full, why?")
+	assert.True(t, u.state.querying)
+}
+
+// testCommandsSessions checks that the session is saved under a name, exported, and that another one is
+//loaded with its mode
+func testCommandsSessions(t *testing.T) {
+	u := newTestUi(t, ExecPromptMode, "http://localhost")
+	store, err := session.NewStore(filepath.Join(t.TempDir(), "sessions"))
+	require.NoError(t, err)
+	u.sessions = store
+	enter := func(line string) {
+		u.components.prompt.SetValue(line)
+		u.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	}
+
+	enter("/save deploy")
+	require.NotNil(t, u.session)
+	assert.Equal(t, "deploy", u.session.Name)
+	enter(`/save "deploy v2"`)
+	saved, err := store.Find("deploy v2")
+	require.NoError(t, err)
+	assert.Equal(t, u.session.ID, saved.ID)
+
+	path := filepath.Join(t.TempDir(), "deploy.md")
+	enter("/export " + path)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "# Session deploy v2")
+
+	other, err := store.New("logs", "/var/log")
+	require.NoError(t, err)
+	other.Mode = "chat"
+	other.ChatMessages = []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "why is it full?"}}
+	require.NoError(t, store.Save(other))
+	assert.Contains(t, completeSession(u, ""), "logs")
+
+	enter("/load logs")
+	assert.Equal(t, other.ID, u.session.ID)
+	assert.Equal(t, ChatPromptMode, u.state.promptMode)
+	conversation := &session.Session{}
+	u.engine.SaveSession(conversation)
+	require.Len(t, conversation.ChatMessages, 1)
+	assert.Equal(t, "why is it full?", conversation.ChatMessages[0].Content)
+}
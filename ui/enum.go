@@ -6,11 +6,12 @@ package ui
 type PromptMode int
 
 // These are the constants representing different prompt modes.
-//four prompt modes defined here (exec, chat, config and default)
+//five prompt modes defined here (exec, chat, explain, config and default)
 const (
 	ExecPromptMode PromptMode = iota
 	ConfigPromptMode
 	ChatPromptMode
+	ExplainPromptMode
 	DefaultPromptMode
 )
 
@@ -26,6 +27,8 @@ func (m PromptMode) String() string {
 		return "config"
 	case ChatPromptMode:
 		return "chat"
+	case ExplainPromptMode:
+		return "explain"
 	default:
 		//whatever we set as the default in the config file
 		return "default"
@@ -41,6 +44,8 @@ func GetPromptModeFromString(s string) PromptMode {
 		return ConfigPromptMode
 	case "chat":
 		return ChatPromptMode
+	case "explain":
+		return ExplainPromptMode
 	default:
 		return DefaultPromptMode
 	}
@@ -69,3 +74,23 @@ func (m RunMode) String() string {
 		return "repl"
 	}
 }
+
+// SessionAction is an enumerated type that represents what is done with the saved sessions.
+type SessionAction int
+
+// These are the constants representing the actions on the saved sessions.
+//the fork goes on in a prompt, the other actions print what they did and quit
+const (
+	// NoSessionAction is used when a prompt is started as usual.
+	NoSessionAction SessionAction = iota
+	// ListSessionAction is used to list the saved sessions.
+	ListSessionAction
+	// RenameSessionAction is used to rename a session.
+	RenameSessionAction
+	// DeleteSessionAction is used to delete a session.
+	DeleteSessionAction
+	// ForkSessionAction is used to go on from a copy of a session.
+	ForkSessionAction
+	// ExportSessionAction is used to export a session to a file.
+	ExportSessionAction
+)
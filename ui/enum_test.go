@@ -24,6 +24,7 @@ func testPromptModeString(t *testing.T) {
 		{"Exec", ExecPromptMode, "exec"},
 		{"Config", ConfigPromptMode, "config"},
 		{"Chat", ChatPromptMode, "chat"},
+		{"Explain", ExplainPromptMode, "explain"},
 		{"Default", DefaultPromptMode, "default"},
 	}
 
@@ -44,6 +45,7 @@ func testGetPromptModeFromString(t *testing.T) {
 		{"Exec", "exec", ExecPromptMode},
 		{"Config", "config", ConfigPromptMode},
 		{"Chat", "chat", ChatPromptMode},
+		{"Explain", "explain", ExplainPromptMode},
 		{"Default", "unknown", DefaultPromptMode},
 	}
 
@@ -1,19 +1,33 @@
 package ui
 //COMPLETE
 import (
-	"bufio"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"os"
+	"strconv"
 	"strings"
+
+	"github.com/akhilsharma90/terminal-assistant/ai"
+	"github.com/akhilsharma90/terminal-assistant/config"
 )
 
 type UiInput struct {
-	runMode    RunMode //runmode has REPL and CLI
+	runMode    RunMode    //runmode has REPL and CLI
 	promptMode PromptMode //promptmode has execute, chat and default
 	args       string
 	pipe       string
+	usage      bool                  //usage shows the usage report instead of starting a prompt
+	prompt     bool                  //prompt prints the rendered system prompt instead of starting a prompt
+	noCache    bool                  //noCache bypasses the cache of the exec answers
+	offline    bool                  //offline only answers from the cache, nothing is sent
+	sampling   config.SamplingConfig //sampling parameters of this invocation, overriding the config
+	session    string                //session resumed, or started with this name when there is none
+	sessions   SessionAction         //what is done with the saved sessions instead of starting a prompt
+	target     string                //session the action applies to
+	model      string                //model of this invocation, overriding the ones of the config
+	models     bool                  //models lists the available models instead of starting a prompt
+	pipeLimit  int64                 //pipeLimit is the size in bytes of the largest piped input, 0 means no limit
 }
 
 // NewUIInput is a function that creates a new UiInput instance.
@@ -27,13 +41,62 @@ func NewUIInput() (*UiInput, error) {
 	//whereas if user selects -c, means he wants the terminal to enter chat mode
 	flagSet := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 
-	// Declare boolean variables for the exec and chat flags.
-	var exec, chat bool
+	// Declare boolean variables for the exec, chat, explain, usage and prompt flags.
+	var exec, chat, explain, usage, prompt bool
 
 	//for our flagSet (which is a NewFlagSet from the flag package), we set exec and chat flags
 	// Register the exec and chat flags with the flag set.
 	flagSet.BoolVar(&exec, "e", false, "exec prompt mode")
 	flagSet.BoolVar(&chat, "c", false, "chat prompt mode")
+	flagSet.BoolVar(&explain, "x", false, "explain prompt mode")
+	flagSet.BoolVar(&usage, "u", false, "usage report")
+	flagSet.BoolVar(&prompt, "p", false, "print the rendered system prompt")
+
+	//the exec answers are cached, -no-cache sends the question anyway and -offline only uses the cache
+	var noCache, offline bool
+	flagSet.BoolVar(&noCache, "no-cache", false, "bypass the cache of the exec answers")
+	flagSet.BoolVar(&offline, "offline", false, "only answer from the cache")
+
+	//the sampling parameters given on the command line override the ones of the config for this
+	//invocation only, a parameter which is not given is left to the config
+	var sampling config.SamplingConfig
+	flagSet.Func("temperature", "sampling temperature, from 0 to 2", floatFlag(&sampling.Temperature))
+	flagSet.Func("top-p", "nucleus sampling probability mass, from 0 to 1", floatFlag(&sampling.TopP))
+	flagSet.Func("seed", "seed making the answers repeatable", func(value string) error {
+		seed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		sampling.Seed = &seed
+		return nil
+	})
+	flagSet.Func("stop", "sequence ending the answer, can be repeated", func(value string) error {
+		sampling.Stop = append(sampling.Stop, value)
+		return nil
+	})
+	flagSet.Func("presence-penalty", "presence penalty, from -2 to 2", floatFlag(&sampling.PresencePenalty))
+	flagSet.Func("frequency-penalty", "frequency penalty, from -2 to 2", floatFlag(&sampling.FrequencyPenalty))
+
+	//the model given on the command line is used in every mode, it's checked against the available ones
+	var model string
+	var models bool
+	flagSet.StringVar(&model, "model", "", "model to use in every mode, overriding the config")
+	flagSet.BoolVar(&models, "models", false, "list the available models")
+
+	//a piped input larger than this is refused without being read whole
+	var pipeMaxSize int64
+	flagSet.Int64Var(&pipeMaxSize, "pipe-max-size", ai.DefaultPipeMaxSize>>20, "largest piped input, in megabytes, 0 means no limit")
+
+	//the conversations are saved as sessions, -session resumes one by its name or ID and the other flags
+	//manage them. the new name of a renamed session, or the name of a fork, is given after the flags
+	var session, fork, rename, remove, export string
+	var list bool
+	flagSet.StringVar(&session, "session", "", "resume the session with this name or ID, or start one with this name")
+	flagSet.BoolVar(&list, "sessions", false, "list the saved sessions")
+	flagSet.StringVar(&fork, "fork-session", "", "go on from a copy of the session with this name or ID")
+	flagSet.StringVar(&rename, "rename-session", "", "rename the session with this name or ID")
+	flagSet.StringVar(&remove, "delete-session", "", "delete the session with this name or ID")
+	flagSet.StringVar(&export, "export", "", "export the session given with -session, or the last one of this directory, to this .md, .json or .html file")
 
 	//parse is a function present in the flag package, it parses arguments from the command list
 	//according to the flag package, this should not contain any commands and this is why the command
@@ -47,6 +110,20 @@ func NewUIInput() (*UiInput, error) {
 		return nil, err
 	}
 
+	//the prompt modes exclude each other, giving several of them is refused instead of picking one, before
+	//a piped input is read for nothing
+	modes := 0
+	for _, mode := range []bool{exec, chat, explain} {
+		if mode {
+			modes++
+		}
+	}
+	if modes > 1 {
+		err := errors.New("only one of -e, -c and -x can be given")
+		fmt.Println("Error parsing flags:", err)
+		return nil, err
+	}
+
 //according to the docs - this returns the "non-flag" arguments
 //meaning strings etc. that we don't want to process as flags
 
@@ -68,35 +145,20 @@ func NewUIInput() (*UiInput, error) {
 	//since this function initializes a new UI for us, we're clearing the pipe
 	pipe := ""
 	// Check if the standard input is not a named pipe and is empty.
-	//if there's some existing data and is not empty, then we will create a reader
-	//with bufio.NewReader and read it
+	//if there's some existing data and is not empty, then we will read it
 	//if size is not zero and pipe is also not zero, then we will read this
 	if !(stat.Mode()&os.ModeNamedPipe == 0 && stat.Size() == 0) {
-		// Create a new reader for the standard input.
-		//the new reader has access to the os.stdin
-		reader := bufio.NewReader(os.Stdin)
-		// Create a new string builder for operations such as append
-		var builder strings.Builder
-
-		// Read runes from the reader until EOF is reached.
-		//read the entire data from the file using the reader
-		for {
-			r, _, err := reader.ReadRune()
-			if err != nil && err == io.EOF {
-				break
-			}
-			// Write the rune to the string builder.
-			_, err = builder.WriteRune(r)
-			if err != nil {
-				// Print an error message and return if there is an error writing the rune.
-				fmt.Println("Error getting input:", err)
-				return nil, err
-			}
+		// Read the standard input in chunks, up to a hard limit. only text can be sent, a binary input
+		//is refused right away instead of being sent mangled
+		input, err := ai.ReadPipe(os.Stdin, pipeMaxSize<<20)
+		if err != nil {
+			fmt.Println("Error getting input:", err)
+			return nil, err
 		}
 
-		// Trim the whitespace from the string builder's string and assign it to the pipe variable.
+		// Trim the whitespace from the input and assign it to the pipe variable.
 		//so we can access this later (the input from the user now)
-		pipe = strings.TrimSpace(builder.String())
+		pipe = strings.TrimSpace(input)
 	}
 
 	// Set the run mode to REPL mode by default. chat mode of the engine equates to repl mode of UI
@@ -114,10 +176,32 @@ func NewUIInput() (*UiInput, error) {
 	//else we set it to chatPromptMode
 	
 	promptMode := DefaultPromptMode
-	if exec && !chat {
+	if exec {
 		promptMode = ExecPromptMode
-	} else if !exec && chat {
+	} else if chat {
 		promptMode = ChatPromptMode
+	} else if explain {
+		promptMode = ExplainPromptMode
+	}
+
+	//a piped script is explained right away, like cat script.sh | terminal-assistant -x
+	if promptMode == ExplainPromptMode && pipe != "" {
+		runMode = CliMode
+	}
+
+	//a fork is resumed like any session, the name of the fork being the one given with -session
+	sessions, target := NoSessionAction, ""
+	switch {
+	case list:
+		sessions = ListSessionAction
+	case rename != "":
+		sessions, target = RenameSessionAction, rename
+	case remove != "":
+		sessions, target = DeleteSessionAction, remove
+	case fork != "":
+		sessions, target = ForkSessionAction, fork
+	case export != "":
+		sessions, target = ExportSessionAction, export
 	}
 
 	// Return a new UiInput instance with the run mode, prompt mode, arguments, and pipe input.
@@ -127,9 +211,32 @@ func NewUIInput() (*UiInput, error) {
 		promptMode: promptMode,
 		args:       strings.Join(args, " "),
 		pipe:       pipe,
+		usage:      usage,
+		prompt:     prompt,
+		noCache:    noCache,
+		offline:    offline,
+		sampling:   sampling,
+		session:    session,
+		sessions:   sessions,
+		target:     target,
+		model:      model,
+		models:     models,
+		pipeLimit:  pipeMaxSize << 20,
 	}, nil
 }
 
+// floatFlag returns a flag parser setting the given float pointer, so an unset flag stays nil.
+func floatFlag(target **float64) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*target = &parsed
+		return nil
+	}
+}
+
 //four helper functions below to get the fields from the struct UiInput defined on top
 // GetRunMode is a method that returns the run mode of the UiInput instance.
 func (i *UiInput) GetRunMode() RunMode {
@@ -150,3 +257,53 @@ func (i *UiInput) GetArgs() string {
 func (i *UiInput) GetPipe() string {
 	return i.pipe
 }
+
+// GetPipeLimit is a method that returns the size in bytes of the largest piped input, 0 meaning no limit.
+func (i *UiInput) GetPipeLimit() int64 {
+	return i.pipeLimit
+}
+
+// IsUsage is a method that returns whether the usage report was asked for instead of a prompt.
+func (i *UiInput) IsUsage() bool {
+	return i.usage
+}
+
+// IsPrintPrompt is a method that returns whether the rendered system prompt was asked for instead of a prompt.
+func (i *UiInput) IsPrintPrompt() bool {
+	return i.prompt
+}
+
+// IsNoCache is a method that returns whether the cache of the exec answers is bypassed.
+func (i *UiInput) IsNoCache() bool {
+	return i.noCache
+}
+
+// IsOffline is a method that returns whether only the cached answers are used.
+func (i *UiInput) IsOffline() bool {
+	return i.offline
+}
+
+// GetSampling is a method that returns the sampling parameters of this invocation.
+func (i *UiInput) GetSampling() config.SamplingConfig {
+	return i.sampling
+}
+
+// GetSession is a method that returns the session to resume, or to start with this name when there is none.
+func (i *UiInput) GetSession() string {
+	return i.session
+}
+
+// GetSessionAction is a method that returns what is done with the saved sessions, and the session it applies to.
+func (i *UiInput) GetSessionAction() (SessionAction, string) {
+	return i.sessions, i.target
+}
+
+// GetModel is a method that returns the model of this invocation, empty when the ones of the config are used.
+func (i *UiInput) GetModel() string {
+	return i.model
+}
+
+// IsListModels is a method that returns whether the available models were asked for instead of a prompt.
+func (i *UiInput) IsListModels() bool {
+	return i.models
+}
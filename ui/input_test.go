@@ -4,6 +4,8 @@ import (
 	"os"
 	"testing"
 
+	"github.com/akhilsharma90/terminal-assistant/ai"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -13,6 +15,13 @@ func TestUiInput(t *testing.T) {
 	t.Run("GetRunMode", testGetRunMode)
 	t.Run("GetPromptMode", testGetPromptMode)
 	t.Run("GetArgs", testGetArgs)
+	t.Run("IsUsage", testIsUsage)
+	t.Run("IsPrintPrompt", testIsPrintPrompt)
+	t.Run("IsOffline", testIsOffline)
+	t.Run("GetSampling", testGetSampling)
+	t.Run("GetSessionAction", testGetSessionAction)
+	t.Run("GetModel", testGetModel)
+	t.Run("GetPipeLimit", testGetPipeLimit)
 }
 
 // testNewUIInput is a unit test function that tests the NewUIInput function.
@@ -40,7 +49,8 @@ func testGetRunMode(t *testing.T) {
 }
 
 // testGetPromptMode is a unit test function that tests the GetPromptMode method of the UIInput struct.
-// It verifies that the PromptMode is set to ExecPromptMode when the command-line argument "-e" is provided.
+// It verifies that the PromptMode is set to ExecPromptMode when the command-line argument "-e" is provided,
+// to ExplainPromptMode with "-x", and that conflicting flags are refused.
 func testGetPromptMode(t *testing.T) {
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
@@ -48,6 +58,20 @@ func testGetPromptMode(t *testing.T) {
 	os.Args = []string{"cmd", "-e"}
 	uiInput, _ := NewUIInput()
 	assert.Equal(t, ExecPromptMode, uiInput.GetPromptMode(), "PromptMode should be ExecPromptMode.")
+
+	os.Args = []string{"cmd", "-x", "tar -xzvf archive.tar.gz"}
+	uiInput, _ = NewUIInput()
+	assert.Equal(t, ExplainPromptMode, uiInput.GetPromptMode(), "PromptMode should be ExplainPromptMode.")
+	assert.Equal(t, CliMode, uiInput.GetRunMode(), "RunMode should be CliMode.")
+
+	os.Args = []string{"cmd", "-x", "-c"}
+	uiInput, err := NewUIInput()
+	assert.EqualError(t, err, "only one of -e, -c and -x can be given")
+	assert.Nil(t, uiInput, "UiInput should be nil.")
+
+	os.Args = []string{"cmd", "-e", "-c", "-x", "list files"}
+	_, err = NewUIInput()
+	assert.Error(t, err, "Conflicting flags should be refused.")
 }
 
 // testGetArgs is a unit test function that tests the GetArgs method of the UIInput struct.
@@ -60,3 +84,133 @@ func testGetArgs(t *testing.T) {
 	uiInput, _ := NewUIInput()
 	assert.Equal(t, "arg1 arg2", uiInput.GetArgs(), "Args should be 'arg1 arg2'.")
 }
+
+// testIsUsage is a unit test function that tests the IsUsage method of the UIInput struct.
+// It verifies that the usage report is asked for when the command-line argument "-u" is provided.
+func testIsUsage(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"cmd", "-u"}
+	uiInput, _ := NewUIInput()
+	assert.True(t, uiInput.IsUsage(), "Usage report should be asked for.")
+}
+
+// testIsPrintPrompt is a unit test function that tests the IsPrintPrompt method of the UIInput struct.
+// It verifies that the rendered system prompt is asked for when the command-line argument "-p" is provided.
+func testIsPrintPrompt(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"cmd", "-c", "-p"}
+	uiInput, _ := NewUIInput()
+	assert.True(t, uiInput.IsPrintPrompt(), "Rendered prompt should be asked for.")
+	assert.Equal(t, ChatPromptMode, uiInput.GetPromptMode(), "Prompt mode should be chat.")
+}
+
+// testIsOffline is a unit test function that tests the IsNoCache and IsOffline methods of the UIInput struct.
+// It verifies that the cache flags are parsed, with one or two dashes.
+func testIsOffline(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"cmd", "--offline", "show disk usage"}
+	uiInput, _ := NewUIInput()
+	assert.True(t, uiInput.IsOffline(), "Offline mode should be asked for.")
+	assert.False(t, uiInput.IsNoCache(), "Cache should not be bypassed.")
+
+	os.Args = []string{"cmd", "-no-cache", "show disk usage"}
+	uiInput, _ = NewUIInput()
+	assert.False(t, uiInput.IsOffline(), "Offline mode should not be asked for.")
+	assert.True(t, uiInput.IsNoCache(), "Cache should be bypassed.")
+}
+
+// testGetSampling is a unit test function that tests the GetSampling method of the UIInput struct.
+// It verifies that the sampling flags are parsed and that the flags which are not given stay unset.
+func testGetSampling(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"cmd", "-temperature", "0", "-seed", "42", "-stop", "END", "-stop", "STOP", "list files"}
+	uiInput, err := NewUIInput()
+	assert.NoError(t, err, "NewUIInput should not return an error.")
+
+	sampling := uiInput.GetSampling()
+	assert.Equal(t, 0.0, *sampling.Temperature, "Temperature should be set.")
+	assert.Equal(t, 42, *sampling.Seed, "Seed should be set.")
+	assert.Equal(t, []string{"END", "STOP"}, sampling.Stop, "Stop sequences should be set.")
+	assert.Nil(t, sampling.TopP, "Top p should not be set.")
+	assert.Equal(t, "list files", uiInput.GetArgs(), "Args should not contain the flags.")
+}
+
+// testGetSessionAction is a unit test function that tests the GetSession and GetSessionAction methods of the UIInput struct.
+// It verifies that the session flags are parsed, the new name of a renamed session being given after the flags.
+func testGetSessionAction(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"cmd", "-session", "deploy"}
+	uiInput, _ := NewUIInput()
+	action, _ := uiInput.GetSessionAction()
+	assert.Equal(t, "deploy", uiInput.GetSession(), "Session should be set.")
+	assert.Equal(t, NoSessionAction, action, "No action should be asked for.")
+	assert.Equal(t, ReplMode, uiInput.GetRunMode(), "RunMode should be ReplMode.")
+
+	os.Args = []string{"cmd", "-rename-session", "1a2b", "release", "notes"}
+	uiInput, _ = NewUIInput()
+	action, target := uiInput.GetSessionAction()
+	assert.Equal(t, RenameSessionAction, action, "Rename should be asked for.")
+	assert.Equal(t, "1a2b", target, "Target should be set.")
+	assert.Equal(t, "release notes", uiInput.GetArgs(), "Args should hold the new name.")
+
+	os.Args = []string{"cmd", "-fork-session", "deploy", "-session", "deploy-v2"}
+	uiInput, _ = NewUIInput()
+	action, target = uiInput.GetSessionAction()
+	assert.Equal(t, ForkSessionAction, action, "Fork should be asked for.")
+	assert.Equal(t, "deploy", target, "Target should be set.")
+	assert.Equal(t, "deploy-v2", uiInput.GetSession(), "Session should name the fork.")
+
+	os.Args = []string{"cmd", "-sessions"}
+	uiInput, _ = NewUIInput()
+	action, _ = uiInput.GetSessionAction()
+	assert.Equal(t, ListSessionAction, action, "List should be asked for.")
+
+	os.Args = []string{"cmd", "-export", "deploy.html", "-session", "deploy"}
+	uiInput, _ = NewUIInput()
+	action, target = uiInput.GetSessionAction()
+	assert.Equal(t, ExportSessionAction, action, "Export should be asked for.")
+	assert.Equal(t, "deploy.html", target, "Target should be the exported file.")
+	assert.Equal(t, "deploy", uiInput.GetSession(), "Session should be the exported one.")
+}
+
+// testGetModel is a unit test function that tests the GetModel and IsListModels methods of the UIInput struct.
+// It verifies that the model flags are parsed, with one or two dashes.
+func testGetModel(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"cmd", "--model", "gpt-4o", "list files"}
+	uiInput, _ := NewUIInput()
+	assert.Equal(t, "gpt-4o", uiInput.GetModel(), "Model should be set.")
+	assert.False(t, uiInput.IsListModels(), "Models should not be listed.")
+	assert.Equal(t, "list files", uiInput.GetArgs(), "Args should not contain the flags.")
+
+	os.Args = []string{"cmd", "-models"}
+	uiInput, _ = NewUIInput()
+	assert.Empty(t, uiInput.GetModel(), "Model should not be set.")
+	assert.True(t, uiInput.IsListModels(), "Models should be listed.")
+}
+
+// testGetPipeLimit is a unit test function that tests the GetPipeLimit method of the UIInput struct.
+func testGetPipeLimit(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	os.Args = []string{"cmd", "list files"}
+	uiInput, _ := NewUIInput()
+	assert.Equal(t, int64(ai.DefaultPipeMaxSize), uiInput.GetPipeLimit(), "The default limit should be used.")
+
+	os.Args = []string{"cmd", "-pipe-max-size", "100", "list files"}
+	uiInput, _ = NewUIInput()
+	assert.Equal(t, int64(100<<20), uiInput.GetPipeLimit(), "The limit should be given in megabytes.")
+}
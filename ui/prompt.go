@@ -2,6 +2,10 @@ package ui
 //COMPLETE
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
@@ -15,12 +19,14 @@ import (
 
 
 const (
-	exec_icon          = "🚀 > "
-	exec_placeholder   = "Execute something..."
-	config_icon        = "🔒 > "
-	config_placeholder = "Enter your OpenAI key..."
-	chat_icon          = "💬 > "
-	chat_placeholder   = "Ask me something..."
+	exec_icon           = "🚀 > "
+	exec_placeholder    = "Execute something..."
+	config_icon         = "🔒 > "
+	config_placeholder  = "Enter your OpenAI key..."
+	chat_icon           = "💬 > "
+	chat_placeholder    = "Ask me something..."
+	explain_icon        = "🔍 > "
+	explain_placeholder = "Paste a command to explain..."
 )
 
 // Prompt is a struct that represents a prompt in the user interface.
@@ -105,6 +111,41 @@ func (p *Prompt) Update(msg tea.Msg) (*Prompt, tea.Cmd) {
 	return p, updateCmd
 }
 
+// CompletePath is a method on the Prompt struct that completes the @path reference before the cursor
+//with the files it can be, it returns false when the cursor is not at the end of a reference
+func (p *Prompt) CompletePath() bool {
+	value := []rune(p.input.Value())
+	position := p.input.Position()
+	start := position
+	for start > 0 && !unicode.IsSpace(value[start-1]) {
+		start--
+	}
+	word := string(value[start:position])
+	if !strings.HasPrefix(word, "@") {
+		return false
+	}
+
+	completed := []rune("@" + completeAttachmentPath(word[1:]))
+	p.input.SetValue(string(value[:start]) + string(completed) + string(value[position:]))
+	p.input.SetCursor(start + len(completed))
+
+	return true
+}
+
+// CompleteCommand is a method on the Prompt struct that completes the /command of the registry being typed
+//with the given function, it returns false when the prompt doesn't hold a command or the cursor is not at its end
+func (p *Prompt) CompleteCommand(commands *Commands, complete func(line string) string) bool {
+	value := p.input.Value()
+	if !commands.IsCommandLine(value) || p.input.Position() != len([]rune(value)) {
+		return false
+	}
+
+	p.input.SetValue(complete(value))
+	p.input.CursorEnd()
+
+	return true
+}
+
 // View is a method on the Prompt struct that returns a string representation of the text input model.
 func (p *Prompt) View() string {
 	return p.input.View()
@@ -124,6 +165,8 @@ func getPromptStyle(mode PromptMode) lipgloss.Style {
 		return lipgloss.NewStyle().Foreground(lipgloss.Color(exec_color))
 	case ConfigPromptMode:
 		return lipgloss.NewStyle().Foreground(lipgloss.Color(config_color))
+	case ExplainPromptMode:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color(explain_color))
 	default:
 		return lipgloss.NewStyle().Foreground(lipgloss.Color(chat_color))
 	}
@@ -138,6 +181,8 @@ func getPromptIcon(mode PromptMode) string {
 		return style.Render(exec_icon)
 	case ConfigPromptMode:
 		return style.Render(config_icon)
+	case ExplainPromptMode:
+		return style.Render(explain_icon)
 	default:
 		return style.Render(chat_icon)
 	}
@@ -150,7 +195,55 @@ func getPromptPlaceholder(mode PromptMode) string {
 		return exec_placeholder
 	case ConfigPromptMode:
 		return config_placeholder
+	case ExplainPromptMode:
+		return explain_placeholder
 	default:
 		return chat_placeholder
 	}
 }
+
+// completeAttachmentPath is a function that completes a path with the longest prefix shared by the
+//entries it can be, a single directory matching gets a trailing / so its entries can be completed next
+func completeAttachmentPath(path string) string {
+	directory, prefix := filepath.Split(path)
+	read := directory
+	if read == "" {
+		read = "."
+	} else if strings.HasPrefix(read, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return path
+		}
+		read = filepath.Join(home, read[2:])
+	}
+	entries, err := os.ReadDir(read)
+	if err != nil {
+		return path
+	}
+
+	//the hidden entries are only completed when their dot was typed
+	var matches []os.DirEntry
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), prefix) && (strings.HasPrefix(prefix, ".") || !strings.HasPrefix(entry.Name(), ".")) {
+			matches = append(matches, entry)
+		}
+	}
+	if len(matches) == 0 {
+		return path
+	}
+	if len(matches) == 1 {
+		if matches[0].IsDir() {
+			return directory + matches[0].Name() + "/"
+		}
+		return directory + matches[0].Name()
+	}
+
+	common := matches[0].Name()
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(match.Name(), common) {
+			common = common[:len(common)-1]
+		}
+	}
+
+	return directory + common
+}
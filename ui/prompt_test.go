@@ -1,6 +1,8 @@
 package ui
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/charmbracelet/lipgloss"
@@ -12,6 +14,7 @@ func TestUIPrompt(t *testing.T) {
 	t.Run("PromptStyle", testPromptStyle)
 	t.Run("PromptIcon", testPromptIcon)
 	t.Run("PromptPlaceholder", testPromptPlaceholder)
+	t.Run("CompletePath", testPromptCompletePath)
 }
 
 func testPrompt(t *testing.T) {
@@ -24,6 +27,7 @@ func testPrompt(t *testing.T) {
 		{"Exec", ExecPromptMode, ""},
 		{"Config", ConfigPromptMode, ""},
 		{"Chat", ChatPromptMode, ""},
+		{"Explain", ExplainPromptMode, ""},
 	}
 
 	// Iterate over each test case and run subtests.
@@ -47,6 +51,7 @@ func testPromptStyle(t *testing.T) {
 		{"Exec", ExecPromptMode, getPromptStyle},
 		{"Config", ConfigPromptMode, getPromptStyle},
 		{"Chat", ChatPromptMode, getPromptStyle},
+		{"Explain", ExplainPromptMode, getPromptStyle},
 	}
 
 	for _, tc := range testCases {
@@ -68,6 +73,7 @@ func testPromptIcon(t *testing.T) {
 		{"Exec", ExecPromptMode, getPromptIcon},
 		{"Config", ConfigPromptMode, getPromptIcon},
 		{"Chat", ChatPromptMode, getPromptIcon},
+		{"Explain", ExplainPromptMode, getPromptIcon},
 	}
 
 	for _, tc := range testCases {
@@ -89,6 +95,7 @@ func testPromptPlaceholder(t *testing.T) {
 		{"Exec", ExecPromptMode, getPromptPlaceholder},
 		{"Config", ConfigPromptMode, getPromptPlaceholder},
 		{"Chat", ChatPromptMode, getPromptPlaceholder},
+		{"Explain", ExplainPromptMode, getPromptPlaceholder},
 	}
 
 	for _, tc := range testCases {
@@ -98,3 +105,31 @@ func testPromptPlaceholder(t *testing.T) {
 		})
 	}
 }
+
+// testPromptCompletePath tests the completion of the @path reference before the cursor.
+func testPromptCompletePath(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main_test.go"), []byte("package main"), 0644))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "docs"), 0755))
+
+	p := NewPrompt(ChatPromptMode)
+	p.SetValue("explain @" + filepath.Join(dir, "ma"))
+	p.input.CursorEnd()
+	assert.True(t, p.CompletePath())
+	assert.Equal(t, "explain @"+filepath.Join(dir, "main"), p.GetValue(), "The shared prefix should be completed.")
+
+	p.SetValue("explain @" + filepath.Join(dir, "d"))
+	p.input.CursorEnd()
+	assert.True(t, p.CompletePath())
+	assert.Equal(t, "explain @"+filepath.Join(dir, "docs")+"/", p.GetValue(), "A single directory should get a trailing slash.")
+
+	p.SetValue("explain @" + filepath.Join(dir, "x"))
+	p.input.CursorEnd()
+	assert.True(t, p.CompletePath())
+	assert.Equal(t, "explain @"+filepath.Join(dir, "x"), p.GetValue(), "A path matching nothing should be left as it is.")
+
+	p.SetValue("explain this")
+	p.input.CursorEnd()
+	assert.False(t, p.CompletePath(), "A word which is not a reference should not be completed.")
+}
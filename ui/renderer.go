@@ -3,6 +3,11 @@ package ui
 //COMPLETE
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/akhilsharma90/terminal-assistant/ai"
+
 	"github.com/charmbracelet/glamour"
 	"github.com/charmbracelet/lipgloss"
 )
@@ -12,6 +17,7 @@ const (
 	exec_color    = "#ffa657"
 	config_color  = "#ffffff"
 	chat_color    = "#66b3ff"
+	explain_color = "#d2a8ff"
 	help_color    = "#aaaaaa"
 	error_color   = "#cc3333"
 	warning_color = "#ffcc00"
@@ -81,6 +87,81 @@ func (r *Renderer) RenderHelp(in string) string {
 	return r.helpRenderer.Render(in)
 }
 
+// explainColumnLimit is the widest a stage or a part can be before its explanation goes to the next line.
+const explainColumnLimit = 48
+
+// RenderExplanation renders the explanation of a command: the summary, then each stage of the pipeline
+//with its parts below it, their explanations aligned in a column on the right. the risky parts are
+//rendered as warnings, with why they are risky under their explanation
+func (r *Renderer) RenderExplanation(output ai.EngineExplainOutput) string {
+	rendered := r.RenderContent(output.GetSummary())
+
+	//the explanations start after the widest stage or part, unless it is too wide
+	column := 0
+	for i, stage := range output.GetStages() {
+		labels := []string{fmt.Sprintf("%d. %s", i+1, stage.GetCommand())}
+		for _, part := range stage.GetParts() {
+			labels = append(labels, "     "+part.GetText())
+		}
+		for _, label := range labels {
+			if width := explainLabelWidth(label); width > column {
+				column = width
+			}
+		}
+	}
+	if column > explainColumnLimit {
+		column = explainColumnLimit
+	}
+
+	for i, stage := range output.GetStages() {
+		rendered += r.renderExplainRow(fmt.Sprintf("  %d. %s", i+1, stage.GetCommand()), stage.GetExplanation(), "", column+2)
+		for _, part := range stage.GetParts() {
+			rendered += r.renderExplainRow("       "+part.GetText(), part.GetExplanation(), part.GetRisk(), column+2)
+		}
+	}
+	if output.IsRisky() {
+		rendered += "\n" + r.RenderWarning("  [risky: review the parts marked ⚠ before running it]") + "\n"
+	}
+
+	return rendered
+}
+
+// renderExplainRow renders a stage or a part with its explanation in the given column, and why it is
+//risky on the next line when it is
+func (r *Renderer) renderExplainRow(label string, explanation string, risk string, column int) string {
+	//the next lines of a multi-line stage, like a loop of a script, are indented below its first line
+	lines := strings.Split(label, "\n")
+	for i := range lines {
+		if i > 0 {
+			lines[i] = "       " + lines[i]
+		}
+		if strings.TrimSpace(risk) != "" {
+			lines[i] = r.RenderWarning(lines[i])
+		}
+	}
+
+	//a label too wide for the column gets its explanation on the next line
+	first := lines[0]
+	var rows []string
+	if lipgloss.Width(first) > column {
+		rows = append(rows, lines...)
+		rows = append(rows, strings.Repeat(" ", column+2)+r.RenderHelp(explanation))
+	} else {
+		rows = append(rows, first+strings.Repeat(" ", column-lipgloss.Width(first)+2)+r.RenderHelp(explanation))
+		rows = append(rows, lines[1:]...)
+	}
+	if strings.TrimSpace(risk) != "" {
+		rows = append(rows, strings.Repeat(" ", column+2)+r.RenderWarning("⚠ "+risk))
+	}
+
+	return strings.Join(rows, "\n") + "\n"
+}
+
+// explainLabelWidth returns the width of the first line of a stage or a part.
+func explainLabelWidth(label string) int {
+	return lipgloss.Width(strings.Split(label, "\n")[0])
+}
+
 // RenderConfigMessage is a method on the Renderer struct that renders a configuration message.
 func (r *Renderer) RenderConfigMessage() string {
 	welcome := "Welcome! 👋  \n\n"
@@ -91,16 +172,20 @@ func (r *Renderer) RenderConfigMessage() string {
 }
 
 //these are all the ways you can interact with the terminal ai assistant, displayed in help msg
-// RenderHelpMessage is a method on the Renderer struct that renders a help message.
-func (r *Renderer) RenderHelpMessage() string {
+// RenderHelpMessage is a method on the Renderer struct that renders a help message, generated from
+//the registry of the commands and the keys which don't run one.
+func (r *Renderer) RenderHelpMessage(commands *Commands) string {
 	help := "**Help**\n"
-	help += "- `↑`/`↓` : navigate in history\n"
-	help += "- `tab`   : switch between `🚀 exec` and `💬 chat` prompt modes\n"
-	help += "- `ctrl+h`: show help\n"
-	help += "- `ctrl+s`: edit settings\n"
-	help += "- `ctrl+r`: clear terminal and reset discussion history\n"
-	help += "- `ctrl+l`: clear terminal but keep discussion history\n"
-	help += "- `ctrl+c`: exit or interrupt command execution\n"
+	for _, command := range commands.GetCommands() {
+		help += fmt.Sprintf("- `%s`", command.GetSyntax())
+		if command.GetKey() != "" {
+			help += fmt.Sprintf(" or `%s`", command.GetKey())
+		}
+		help += fmt.Sprintf(": %s\n", command.GetHelp())
+	}
+	for _, key := range commands.GetKeys() {
+		help += fmt.Sprintf("- `%s`: %s\n", key.Key, key.Help)
+	}
 
 	return help
 }
@@ -1,8 +1,11 @@
 package ui
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/akhilsharma90/terminal-assistant/ai"
+
 	"github.com/charmbracelet/glamour"
 	"github.com/stretchr/testify/assert"
 )
@@ -16,6 +19,7 @@ func TestUIRenderer(t *testing.T) {
 	t.Run("RenderHelp", testRenderHelp)
 	t.Run("RenderConfigMessage", testRenderConfigMessage)
 	t.Run("RenderHelpMessage", testRenderHelpMessage)
+	t.Run("RenderExplanation", testRenderExplanation)
 }
 
 // testRenderer tests the NewRenderer function.
@@ -74,6 +78,31 @@ func testRenderConfigMessage(t *testing.T) {
 // testRenderHelpMessage tests the RenderHelpMessage function.
 func testRenderHelpMessage(t *testing.T) {
 	r := NewRenderer(glamour.WithAutoStyle())
-	output := r.RenderHelpMessage()
+	output := r.RenderHelpMessage(NewCommands())
 	assert.NotEmpty(t, output, "Rendered help message should not be empty.")
 }
+
+// testRenderExplanation tests the RenderExplanation function.
+// It verifies that the explanations of the stages and parts start in the same column, and that the risks are shown.
+func testRenderExplanation(t *testing.T) {
+	r := NewRenderer(glamour.WithAutoStyle())
+	output := r.RenderExplanation(ai.EngineExplainOutput{
+		Summary: "delete the tmp files",
+		Stages: []ai.EngineExplainStage{
+			{Command: "find . -name '*.tmp'", Explanation: "list the tmp files", Parts: []ai.EngineExplainPart{{Text: "find", Explanation: "search files"}}},
+			{Command: "xargs rm", Explanation: "delete them", Parts: []ai.EngineExplainPart{{Text: "rm", Explanation: "remove files", Risk: "the files are gone for good"}}},
+		},
+	})
+
+	columns := map[int]bool{}
+	for _, line := range strings.Split(output, "\n") {
+		for _, explanation := range []string{"list the tmp files", "search files", "delete them", "remove files"} {
+			if index := strings.Index(line, explanation); index >= 0 {
+				columns[index] = true
+			}
+		}
+	}
+	assert.LessOrEqual(t, len(columns), 1, "The explanations should be aligned.")
+	assert.Contains(t, output, "⚠ the files are gone for good", "The risk should be shown.")
+	assert.Contains(t, output, "[risky", "The command should be flagged as risky.")
+}
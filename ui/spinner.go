@@ -26,6 +26,7 @@ var loadingMessages = []string{
 // Spinner is a struct that represents a spinner in the user interface.
 type Spinner struct {
 	message string        // The message to display while the spinner is spinning.
+	status  string        // What the engine is doing, like which attempt is running, shown after the message.
 	spinner spinner.Model // The spinner model, got from the bubbles package of charm.sh
 }
 
@@ -57,8 +58,25 @@ func (s *Spinner) Update(msg tea.Msg) (*Spinner, tea.Cmd) {
 	return s, updateCmd
 }
 
+// SetStatus is a method on the Spinner struct that sets the status shown after the message.
+func (s *Spinner) SetStatus(status string) *Spinner {
+	s.status = status
+
+	return s
+}
+
 // View is a method on the Spinner struct that returns a string representation of the spinner.
 func (s *Spinner) View() string {
+	//when the engine has something to say, like a retry, we show it next to the message
+	if s.status != "" {
+		return fmt.Sprintf(
+			"\n  %s %s... %s",
+			s.spinner.View(),
+			s.spinner.Style.Render(s.message),
+			s.spinner.Style.Render(fmt.Sprintf("(%s)", s.status)),
+		)
+	}
+
 	// Return a string representation of the spinner with the spinner view and the message.
 	return fmt.Sprintf(
 		"\n  %s %s...",
@@ -10,6 +10,7 @@ func TestUISpinner(t *testing.T) {
 	// Test cases
 	t.Run("NewSpinner", testNewSpinner)
 	t.Run("View", testSpinnerView)
+	t.Run("ViewWithStatus", testSpinnerViewWithStatus)
 }
 
 // testNewSpinner tests the NewSpinner function.
@@ -24,3 +25,10 @@ func testSpinnerView(t *testing.T) {
 	view := s.View()
 	assert.NotEmpty(t, view, "Spinner view should not be empty.")
 }
+
+// testSpinnerViewWithStatus tests that the View method shows the status set with SetStatus.
+func testSpinnerViewWithStatus(t *testing.T) {
+	s := NewSpinner().SetStatus("attempt 2/4 in 1s")
+	view := s.View()
+	assert.Contains(t, view, "attempt 2/4 in 1s", "Spinner view should contain the status.")
+}
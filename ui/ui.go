@@ -1,13 +1,20 @@
 package ui
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"os/exec"
 	"strings"
 
 	"github.com/akhilsharma90/terminal-assistant/ai"
 	"github.com/akhilsharma90/terminal-assistant/config"
+	"github.com/akhilsharma90/terminal-assistant/export"
 	"github.com/akhilsharma90/terminal-assistant/history"
 	"github.com/akhilsharma90/terminal-assistant/run"
+	"github.com/akhilsharma90/terminal-assistant/cache"
+	"github.com/akhilsharma90/terminal-assistant/session"
+	"github.com/akhilsharma90/terminal-assistant/usage"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -16,19 +23,92 @@ import (
 	"github.com/spf13/viper"
 )
 
+// compactedNotice tells the user that the older turns were compacted to fit in the context window.
+const compactedNotice = "[older messages were compacted to fit the context window]\n"
+
+// pipeChunksNotice tells the user that the piped input was too large to be sent whole and how many chunks were read.
+const pipeChunksNotice = "[the piped input was too large to be sent whole, it was read in %d chunks]\n"
+
+//the tea.Cmd functions run on other goroutines than Update and View, so they never touch the state of
+//the UI: they capture what they need when they are created, and what they produce comes back to Update
+//as a message, the state only changes there
+
+// engineReady is sent when the engine of the REPL is ready.
+type engineReady struct {
+	engine *ai.Engine // Engine answering in the REPL
+}
+
+// commandDone is sent when an executed command is over, with what it printed.
+type commandDone struct {
+	output    run.RunOutput // Feedback of the run
+	command   string        // Command executed
+	exitCode  int           // Exit code of the command
+	stdout    string        // What the command printed on stdout
+	stderr    string        // What the command printed on stderr
+	truncated bool          // Indicates if the outputs were truncated
+}
+
+// settingsDone is sent when the settings were edited, with the config and the engine built from them.
+type settingsDone struct {
+	output run.RunOutput  // Feedback of the edition
+	config *config.Config // Config read from the edited file, nil on error
+	engine *ai.Engine     // Engine built from the config, nil on error
+}
+
+// settingsEdited is sent when the settings file was edited, with the config read from it.
+type settingsEdited struct {
+	config *config.Config // Config read from the edited file
+}
+
+// modelsListed is sent when the models available for the picker were listed.
+type modelsListed struct {
+	models []string // Models available with the provider, sorted
+	err    error    // Why the models could not be listed, nil when they were
+}
+
+// modelChecked is sent when the model given to /model was checked against the available ones.
+type modelChecked struct {
+	model string // Model to switch to
+	err   error  // Why the model can't be used, nil when it can
+}
+
 // UiState is a struct that represents the state of the user interface.
 type UiState struct {
-	error       error      // Any error that occurred.
-	runMode     RunMode    // The mode in which the program is running.
-	promptMode  PromptMode // The mode of the prompt.
-	configuring bool       // Whether the program is in configuration mode.
-	querying    bool       // Whether the program is in querying mode.
-	confirming  bool       // Whether the program is in confirming mode.
-	executing   bool       // Whether the program is in executing mode.
-	args        string     // The arguments passed to the program.
-	pipe        string     // The pipe used by the program.
-	buffer      string     // The buffer of the program.
-	command     string     // The command being executed by the program.
+	error       error                      // Any error that occurred.
+	runMode     RunMode                    // The mode in which the program is running.
+	promptMode  PromptMode                 // The mode of the prompt.
+	configuring bool                       // Whether the program is in configuration mode.
+	querying    bool                       // Whether the program is in querying mode.
+	confirming  bool                       // Whether the program is in confirming mode.
+	executing   bool                       // Whether the program is in executing mode.
+	args        string                     // The arguments passed to the program.
+	pipe        string                     // The pipe used by the program.
+	pipeLimit   int64                      // The size in bytes of the largest piped input, 0 means no limit.
+	buffer      string                     // The buffer of the program.
+	command     string                     // The command being executed by the program.
+	plan        []ai.EngineExecStep        // The steps of the plan being confirmed one by one.
+	step        int                        // The index of the plan step being confirmed or executed.
+	candidates  []ai.EngineExecAlternative // The alternative commands the user picks from.
+	candidate   int                        // The index of the picked alternative command.
+	partial     ai.EnginePartialExecOutput // What was received so far of the exec answer being streamed.
+	executed    string                     // The last command executed.
+	fixes       int                        // The corrected commands asked in a row since the last command failed.
+	usage       bool                       // Whether the usage report is shown instead of a prompt.
+	printPrompt bool                       // Whether the rendered system prompt is printed instead of a prompt.
+	warned      bool                       // Whether the soft budget warning was already shown in this session.
+	sampling    config.SamplingConfig      // The sampling parameters of this invocation.
+	noCache     bool                       // Whether the cache of the exec answers is bypassed.
+	offline     bool                       // Whether only the cached answers are used, nothing is sent.
+	session     string                     // The session to resume, or to start with this name.
+	sessions    SessionAction              // What is done with the saved sessions instead of starting a prompt.
+	target      string                     // The session the action applies to.
+	model       string                     // The model given with -model or picked in the REPL, empty means the ones of the config.
+	listModels  bool                       // Whether the available models are listed instead of a prompt.
+	picking     bool                       // Whether the model is being picked from the available ones.
+	models      []string                   // The models the user picks from.
+	pick        int                        // The index of the model being picked.
+	listed      []string                   // The models listed last, completing /model.
+	failed      chan error                 // The error ending the chat stream in flight, awaited along with its chunks.
 }
 
 // UiDimensions is a struct that represents the dimensions of the user interface.
@@ -53,6 +133,10 @@ type Ui struct {
 	config     *config.Config   // Config struct in the config package has system config, user config etc.
 	engine     *ai.Engine       // Engine is actually a struct we have in the ai package of this project
 	history    *history.History // History is a struct in the history package of this project
+	sessions   *session.Store   // Store of the saved sessions, nil until the engine is created
+	session    *session.Session // Session the conversation is saved in, nil until there is one
+	commands   *Commands        // Registry of the /commands of the REPL
+	ledger     *usage.Ledger    // Ledger of the whole process, shared by the engines so the session total goes on
 }
 
 //this function gets called from main.go
@@ -60,7 +144,7 @@ type Ui struct {
 func NewUi(input *UiInput) *Ui {
 	// Create a new Ui instance with the input run mode and prompt mode, a new prompt, renderer, and spinner, and a new history.
 	//config and engine are not yet initialized
-	return &Ui{
+	u := &Ui{
 		state: UiState{
 			error:       nil,
 			runMode:     input.GetRunMode(),
@@ -71,6 +155,15 @@ func NewUi(input *UiInput) *Ui {
 			executing:   false,
 			args:        input.GetArgs(),
 			pipe:        input.GetPipe(),
+			pipeLimit:   input.GetPipeLimit(),
+			usage:       input.IsUsage(),
+			printPrompt: input.IsPrintPrompt(),
+			sampling:    input.GetSampling(),
+			noCache:     input.IsNoCache(),
+			offline:     input.IsOffline(),
+			session:     input.GetSession(),
+			model:       input.GetModel(),
+			listModels:  input.IsListModels(),
 			//buffer is the temporary storage, making it empty
 			buffer:      "",
 			command:     "",
@@ -87,8 +180,12 @@ func NewUi(input *UiInput) *Ui {
 			),
 			spinner: NewSpinner(), //spinner.go has this func
 		},
-		history: history.NewHistory(), //calls the helper function NewHistory in the history package 
+		history:  history.NewHistory(), //calls the helper function NewHistory in the history package 
+		commands: NewCommands(),
 	}
+	u.state.sessions, u.state.target = input.GetSessionAction()
+
+	return u
 }
 
 
@@ -124,6 +221,26 @@ func (u *Ui) Init() tea.Cmd {
 		}
 	}
 
+	// The usage report is printed without starting any prompt
+	if u.state.usage {
+		return u.showUsage(config)
+	}
+
+	// The rendered system prompt is printed without starting any prompt
+	if u.state.printPrompt {
+		return u.showPrompt(config)
+	}
+
+	// The available models are listed without starting any prompt
+	if u.state.listModels {
+		return u.showModels(config)
+	}
+
+	// The saved sessions are listed, renamed, deleted or exported without starting any prompt, a fork goes on in one
+	if u.state.sessions != NoSessionAction && u.state.sessions != ForkSessionAction {
+		return u.manageSessions(config)
+	}
+
 	// Determine whether to start in REPL mode or CLI mode
 	if u.state.runMode == ReplMode {
 		// Start in REPL mode
@@ -148,6 +265,11 @@ func (u *Ui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	//sinner update function is called with the msg 
 	case spinner.TickMsg:
 		if u.state.querying {
+			//each tick picks up what the engine is doing, like which attempt is running
+			if u.engine != nil {
+				u.components.spinner.SetStatus(u.engine.GetStatus())
+				u.state.partial = u.engine.GetPartialExecOutput()
+			}
 			u.components.spinner, spinnerCmd = u.components.spinner.Update(msg)
 			cmds = append(
 				cmds,
@@ -165,17 +287,51 @@ func (u *Ui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		)
 	// Handle keyboard inputs of various kinds
 	case tea.KeyMsg:
+		//the keys bound to a command run it, when the UI waits for a prompt
+		if command := u.commands.FindKey(msg.String()); command != nil {
+			if u.canRunCommand(command) {
+				cmds = append(cmds, command.run(u, nil))
+			}
+			return u, tea.Batch(cmds...)
+		}
 		switch msg.Type {
 	//we are fixing the actions based on the key pressed by the user, like ctrlc, tab etc.
-		// Quit the program
+		// Quit the program, or interrupt the generation in flight and go back to the prompt
 		case tea.KeyCtrlC:
+			if u.state.querying && u.engine != nil {
+				u.engine.Interrupt()
+				return u, nil
+			}
 			return u, tea.Quit
+		// Interrupt the generation in flight and go back to the prompt
+		case tea.KeyEsc:
+			if u.state.querying && u.engine != nil {
+				u.engine.Interrupt()
+			} else if u.state.picking {
+				return u, u.endModelPicker(u.components.renderer.RenderWarning("[model unchanged]"))
+			}
 		// Navigate command history with up and down keys
 		//every command is divided into categories like querying, confirming etc. 4 stages are there
 		case tea.KeyUp, tea.KeyDown:
 			//before going up and down and showing previous and next commands to user, we are just checking
 			//whether we are in querying or confirming mode
-			if !u.state.querying && !u.state.confirming {
+			//while confirming alternative commands, the arrows move between them, and between the models while picking one
+			if u.state.picking {
+				if msg.Type == tea.KeyUp {
+					u.state.pick = (u.state.pick + len(u.state.models) - 1) % len(u.state.models)
+				} else {
+					u.state.pick = (u.state.pick + 1) % len(u.state.models)
+				}
+				u.state.buffer = u.renderModels()
+			} else if u.state.confirming && len(u.state.candidates) > 1 {
+				if msg.Type == tea.KeyUp {
+					u.state.candidate = (u.state.candidate + len(u.state.candidates) - 1) % len(u.state.candidates)
+				} else {
+					u.state.candidate = (u.state.candidate + 1) % len(u.state.candidates)
+				}
+				u.state.command = u.state.candidates[u.state.candidate].GetCommand()
+				u.state.buffer = u.renderCandidates()
+			} else if !u.state.querying && !u.state.confirming {
 				var input *string
 				if msg.Type == tea.KeyUp {
 					input = u.history.GetPrevious()
@@ -191,19 +347,32 @@ func (u *Ui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					)
 				}
 			}
-		// Switch between chat and execution mode
+		// Switch between execution, chat and explain mode, in turn
 		case tea.KeyTab:
-			if !u.state.querying && !u.state.confirming {
-				if u.state.promptMode == ChatPromptMode {
-					u.state.promptMode = ExecPromptMode
-					u.components.prompt.SetMode(ExecPromptMode)
-					u.engine.SetMode(ai.ExecEngineMode)
-				} else {
-					u.state.promptMode = ChatPromptMode
-					u.components.prompt.SetMode(ChatPromptMode)
-					u.engine.SetMode(ai.ChatEngineMode)
+			//tab completes the /command or the @path reference being typed, and switches the prompt mode otherwise
+			if !u.state.querying && !u.state.confirming && !u.state.configuring && u.engine != nil && u.components.prompt.CompleteCommand(u.commands, func(line string) string {
+				return u.commands.Complete(u, line)
+			}) {
+				cmds = append(
+					cmds,
+					textinput.Blink,
+				)
+			} else if !u.state.querying && !u.state.confirming && !u.state.configuring && u.components.prompt.CompletePath() {
+				u.components.prompt, promptCmd = u.components.prompt.Update(msg)
+				cmds = append(
+					cmds,
+					promptCmd,
+					textinput.Blink,
+				)
+			} else if !u.state.querying && !u.state.confirming && u.engine != nil {
+				switch u.state.promptMode {
+				case ExecPromptMode:
+					u.setPromptMode(ChatPromptMode)
+				case ChatPromptMode:
+					u.setPromptMode(ExplainPromptMode)
+				default:
+					u.setPromptMode(ExecPromptMode)
 				}
-				u.engine.Reset()
 				u.components.prompt, promptCmd = u.components.prompt.Update(msg)
 				cmds = append(
 					cmds,
@@ -217,14 +386,31 @@ func (u *Ui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if u.state.configuring {
 				return u, u.finishConfig(u.components.prompt.GetValue())
 			}
-			if !u.state.querying && !u.state.confirming {
+			//the picked model answers the next questions, the conversation goes on
+			if u.state.picking {
+				return u, u.switchModel(u.state.models[u.state.pick])
+			}
+			//nothing is sent until the engine is ready
+			if !u.state.querying && !u.state.confirming && u.engine != nil {
 				input := u.components.prompt.GetValue()
+				//a command runs right away, nothing is sent
+				if u.commands.IsCommandLine(input) {
+					inputPrint := u.components.prompt.AsString()
+					u.history.Add(input)
+					u.components.prompt.SetValue("")
+					return u, tea.Sequence(
+						tea.Println(inputPrint),
+						u.runCommandLine(input),
+					)
+				}
 				if input != "" {
 					inputPrint := u.components.prompt.AsString()
 					u.history.Add(input)
 					u.components.prompt.SetValue("")
 					u.components.prompt.Blur()
 					u.components.prompt, promptCmd = u.components.prompt.Update(msg)
+					//querying is set right away so the spinner keeps ticking and esc/ctrl+c can interrupt
+					u.state.querying = true
 					if u.state.promptMode == ChatPromptMode {
 //creating sequence of commands to be executed
 						cmds = append(
@@ -234,6 +420,15 @@ func (u *Ui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 							u.startChatStream(input),
 //if we are in chatpromptMode, then we will await the chat stream
 							u.awaitChatStream(),
+							u.components.spinner.Tick,
+						)
+					} else if u.state.promptMode == ExplainPromptMode {
+						cmds = append(
+							cmds,
+							promptCmd,
+							tea.Println(inputPrint),
+							u.startExplain(input),
+							u.components.spinner.Tick,
 						)
 					} else {
 						cmds = append(
@@ -247,77 +442,50 @@ func (u *Ui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					}
 				}
 			}
-		// [user presses ctrl + h] Show help message
-		case tea.KeyCtrlH:
-			if !u.state.configuring && !u.state.querying && !u.state.confirming {
-				u.components.prompt, promptCmd = u.components.prompt.Update(msg)
-				cmds = append(
-					cmds,
-					promptCmd,
-					tea.Println(u.components.renderer.RenderContent(u.components.renderer.RenderHelpMessage())),
-					textinput.Blink,
-				)
-			}
-		// [Ctrl + l] Clear the screen
-		case tea.KeyCtrlL:
-			if !u.state.querying && !u.state.confirming {
-				u.components.prompt, promptCmd = u.components.prompt.Update(msg)
-				//order of commands to be executed, clears screen and blinks for text input
-				cmds = append(
-					cmds,
-					promptCmd,
-					tea.ClearScreen,
-					textinput.Blink,
-				)
-			}
-		// [ctrl + R] Reset the program
-		case tea.KeyCtrlR:
-			if !u.state.querying && !u.state.confirming {
-//difference between clear and reset is that we reset the history and engine
-//as well as set "" empty string for prompt
-				u.history.Reset()
-				u.engine.Reset()
-				u.components.prompt.SetValue("")
-				u.components.prompt, promptCmd = u.components.prompt.Update(msg)
-//command sequence same as clear screen
-				cmds = append(
-					cmds,
-					promptCmd,
-					tea.ClearScreen,
-					textinput.Blink,
-				)
-			}
-		// [Ctrl + S] Edit settings
-		case tea.KeyCtrlS:
-			if !u.state.querying && !u.state.confirming && !u.state.configuring && !u.state.executing {
-				u.state.executing = true
-				u.state.buffer = ""
-				u.state.command = ""
-				u.components.prompt.Blur()
-				u.components.prompt, promptCmd = u.components.prompt.Update(msg)
-				cmds = append(
-					cmds,
-					promptCmd,
-//this is where the logic is, calling edit settings function
-					u.editSettings(), //calling the editSettings function defined below
-				)
-			}
 		default:
 //in default case, doing a few checks and executing commands accordingly
 //for example where user entered "y" in the cli, meaning for yes
 //we checked for confirming state because this requires user to say y or n
-			if u.state.confirming {
+			if u.state.confirming && len(u.state.plan) > 0 {
+				//a plan is confirmed step by step, each one can be run, skipped, or the whole plan aborted
+				u.components.prompt.SetValue("")
+				switch strings.ToLower(msg.String()) {
+				case "r", "y":
+					u.state.confirming = false
+					u.state.buffer = ""
+					return u, u.execCommand(u.state.plan[u.state.step].GetCommand())
+				case "s":
+					return u.nextPlanStep(u.components.renderer.RenderWarning(fmt.Sprintf("\n[skipped step %d/%d]\n", u.state.step+1, len(u.state.plan))))
+				case "a":
+					//an aborted plan is not proposed again from the cache
+					u.engine.ForgetAnswer()
+					return u.endPlan(u.components.renderer.RenderWarning(fmt.Sprintf("\n[plan aborted at step %d/%d]\n", u.state.step+1, len(u.state.plan))))
+				default:
+					//any other key is ignored, a stray key must not abort the plan
+					return u, nil
+				}
+			} else if u.state.confirming {
 				if strings.ToLower(msg.String()) == "y" {
+					//the picker goes away with the buffer, the picked command stays printed above its output
+					var picked tea.Cmd
+					if len(u.state.candidates) > 1 {
+						picked = tea.Println(u.components.renderer.RenderContent(fmt.Sprintf("`%s`", u.state.command)))
+					}
+					u.state.candidates = nil
 					u.state.confirming = false
 					u.state.executing = true
 					u.state.buffer = ""
 					u.components.prompt.SetValue("")
 					return u, tea.Sequence(
 						promptCmd,
+						picked,
 						u.execCommand(u.state.command),
 					)
 				} else {
 //where the user did not select "y", anything else					
+					//a rejected command is not proposed again from the cache
+					u.engine.ForgetAnswer()
+					u.state.candidates = nil
 					u.state.confirming = false
 					u.state.executing = false
 					u.state.buffer = ""
@@ -340,7 +508,7 @@ func (u *Ui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					}
 				}
 				u.state.command = ""
-			} else {
+			} else if !u.state.picking {
 				u.components.prompt.Focus()
 				u.components.prompt, promptCmd = u.components.prompt.Update(msg)
 				cmds = append(
@@ -352,17 +520,45 @@ func (u *Ui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		} // this is where the key commands end, now entering other types of msgs
 	// Handle if the msg is AI engine execution output
 	case ai.EngineExecOutput:
-		var output string
+		u.state.querying = false
+		u.state.partial = ai.EnginePartialExecOutput{}
+		output := u.saveSession() + u.renderNotices(msg.IsCompacted(), msg.GetPipeChunks()) + u.renderProbes(msg.GetProbes())
 		//checking if the msg is executable
-		if msg.IsExecutable() {
+		if msg.IsPlan() {
+			u.state.confirming = true
+			u.state.plan = msg.GetSteps()
+			u.state.step = 0
+			output += u.components.renderer.RenderContent(msg.GetExplanation())
+			for i, step := range u.state.plan {
+				output += fmt.Sprintf("  %d. `%s`\n", i+1, step.GetCommand())
+			}
+			output += "\n" + u.renderPlanStep()
+			u.components.prompt.Blur()
+		} else if msg.HasAlternatives() {
+			//the alternatives are shown in the view, so the picked one can be moved with the arrows
+			u.state.confirming = true
+			u.state.candidates = msg.GetCandidates()
+			u.state.candidate = 0
+			u.state.command = u.state.candidates[0].GetCommand()
+			u.state.buffer = u.renderCandidates()
+			u.components.prompt.Blur()
+			u.components.prompt, promptCmd = u.components.prompt.Update(msg)
+			if output == "" {
+				return u, promptCmd
+			}
+			return u, tea.Sequence(
+				promptCmd,
+				tea.Println(output),
+			)
+		} else if msg.IsExecutable() {
 			u.state.confirming = true
 			u.state.command = msg.GetCommand()
-			output = u.components.renderer.RenderContent(fmt.Sprintf("`%s`", u.state.command))
+			output += u.components.renderer.RenderContent(fmt.Sprintf("`%s`", u.state.command))
 			output += fmt.Sprintf("  %s\n\n  confirm execution? [y/N]", u.components.renderer.RenderHelp(msg.GetExplanation()))
 			u.components.prompt.Blur()
 		} else {
 			//if the msg isn't executable, get explanation for the msg
-			output = u.components.renderer.RenderContent(msg.GetExplanation())
+			output += u.components.renderer.RenderContent(msg.GetExplanation())
 			u.components.prompt.Focus()
 			if u.state.runMode == CliMode {
 				return u, tea.Sequence(
@@ -377,11 +573,35 @@ func (u *Ui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			textinput.Blink,
 			tea.Println(output),
 		)
+	// Handle AI engine explain output, it is printed as it is, there is nothing to confirm
+	case ai.EngineExplainOutput:
+		u.state.querying = false
+		output := u.saveSession() + u.renderNotices(msg.IsCompacted(), msg.GetPipeChunks()) + u.components.renderer.RenderExplanation(msg)
+		u.components.prompt.Focus()
+		if u.state.runMode == CliMode {
+			return u, tea.Sequence(
+				tea.Println(output),
+				tea.Quit,
+			)
+		}
+		u.components.prompt, promptCmd = u.components.prompt.Update(msg)
+		return u, tea.Sequence(
+			promptCmd,
+			textinput.Blink,
+			tea.Println(output),
+		)
 	// Handle AI engine chat stream output
 	case ai.EngineChatStreamOutput:
+		u.state.buffer += msg.GetContent()
+		u.state.querying = !msg.IsLast()
 		//checking if this is the last message in the chatStreamOutput
 		if msg.IsLast() {
 			output := u.components.renderer.RenderContent(u.state.buffer)
+			//an interrupted answer is printed as far as it went, followed by a warning
+			if msg.IsInterrupt() {
+				output += u.components.renderer.RenderWarning("[interrupted]\n")
+			}
+			output = u.saveSession() + u.renderNotices(msg.IsCompacted(), msg.GetPipeChunks()) + output
 			u.state.buffer = ""
 			u.components.prompt.Focus()
 			if u.state.runMode == CliMode {
@@ -401,6 +621,73 @@ func (u *Ui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			//if not the last message
 			return u, u.awaitChatStream()
 		}
+	// Handle the models listed for the picker
+	case modelsListed:
+		u.state.querying = false
+		if msg.err != nil {
+			return u, u.endModelPicker(u.components.renderer.RenderError(fmt.Sprintf("[the models could not be listed: %s]", msg.err)))
+		}
+		if len(msg.models) == 0 {
+			return u, u.endModelPicker(u.components.renderer.RenderWarning("[no model is available]"))
+		}
+		u.state.listed = msg.models
+		u.state.picking = true
+		u.state.models = msg.models
+		u.state.pick = 0
+		for i, model := range msg.models {
+			if model == u.engine.GetModel() {
+				u.state.pick = i
+			}
+		}
+		u.state.buffer = u.renderModels()
+	// Handle the model given to /model, once it was checked
+	case modelChecked:
+		u.state.querying = false
+		if msg.err != nil {
+			return u, u.endModelPicker(u.components.renderer.RenderError(fmt.Sprintf("[%s]", msg.err)))
+		}
+		return u, u.switchModel(msg.model)
+	// Handle the engine of the REPL being ready
+	case engineReady:
+		u.engine = msg.engine
+		u.state.buffer = "Welcome \n\n"
+		u.state.command = ""
+		u.components.prompt = NewPrompt(u.state.promptMode)
+		if notice := u.renderResumedSession(); notice != "" {
+			return u, tea.Println(notice)
+		}
+	// Handle the end of an executed command, the engine is told what happened so the follow-ups can refer
+	//to the results
+	case commandDone:
+		u.state.executing = false
+		u.state.command = ""
+		if u.engine != nil {
+			u.engine.AppendCommandResult(msg.command, msg.exitCode, msg.stdout, msg.stderr, msg.truncated)
+		}
+		warning := u.saveSession()
+		model, cmd := u.Update(msg.output)
+		if warning != "" {
+			return model, tea.Sequence(tea.Println(warning), cmd)
+		}
+		return model, cmd
+	// Handle the edited settings, their engine is built in the background
+	case settingsEdited:
+		return u, u.reloadSettings(msg.config)
+	// Handle the end of the edition of the settings
+	case settingsDone:
+		u.state.executing = false
+		u.state.command = ""
+		if msg.config != nil {
+			//the conversation goes on with the new settings
+			if u.engine != nil {
+				conversation := &session.Session{}
+				u.engine.SaveSession(conversation)
+				msg.engine.RestoreSession(conversation)
+			}
+			u.config = msg.config
+			u.engine = msg.engine
+		}
+		return u.Update(msg.output)
 	// Handle runner feedback (success, fail feedback msg)
 	case run.RunOutput:
 		u.state.querying = false
@@ -413,6 +700,28 @@ func (u *Ui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			//getting the error msg if there's an error
 			output = u.components.renderer.RenderError(fmt.Sprintf("\n%s\n", msg.GetErrorMessage()))
 		}
+		//a command which failed is not proposed again from the cache
+		if msg.HasError() && u.engine != nil {
+			u.engine.ForgetAnswer()
+		}
+		//while running a plan, a successful step moves on to the next one and a failed step stops it
+		if len(u.state.plan) > 0 {
+			if msg.HasError() {
+				step := u.state.plan[u.state.step]
+				return u.endPlan(output + u.components.renderer.RenderError(fmt.Sprintf("[plan stopped at step %d/%d: %s]\n", u.state.step+1, len(u.state.plan), step.GetCommand())))
+			}
+			return u.nextPlanStep(output)
+		}
+		//a failed command can be sent back to the engine to get a corrected one, up to the configured attempts
+		if msg.HasError() && u.config != nil && u.engine != nil && u.state.promptMode == ExecPromptMode {
+			if u.state.fixes < u.config.GetUserConfig().GetFixAttempts() {
+				return u, u.startFix(output)
+			}
+			if u.state.fixes > 0 {
+				output += u.components.renderer.RenderWarning(fmt.Sprintf("[still failing after %d fixes]\n", u.state.fixes))
+			}
+		}
+		u.state.fixes = 0
 		if u.state.runMode == CliMode {
 			return u, tea.Sequence(
 				tea.Println(output),
@@ -427,6 +736,32 @@ func (u *Ui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	// Handle errors
 	case error:
+		u.state.partial = ai.EnginePartialExecOutput{}
+		//an interrupted exec request is not an error, we just go back to the prompt
+		if errors.Is(msg, ai.ErrInterrupted) {
+			u.state.querying = false
+			u.components.prompt.Focus()
+			output := u.saveSession() + fmt.Sprintf("\n%s\n", u.components.renderer.RenderWarning("[interrupted]"))
+			if u.state.runMode == CliMode {
+				return u, tea.Sequence(
+					tea.Println(output),
+					tea.Quit,
+				)
+			}
+			return u, tea.Sequence(
+				tea.Println(output),
+				textinput.Blink,
+			)
+		}
+		//in the REPL a failed request doesn't end the session, the error is printed and we go back to the prompt
+		if u.state.runMode == ReplMode && u.engine != nil && !u.state.configuring {
+			u.state.querying = false
+			u.components.prompt.Focus()
+			return u, tea.Sequence(
+				tea.Println(fmt.Sprintf("\n%s\n", u.components.renderer.RenderError(fmt.Sprintf("[error] %s", msg)))),
+				textinput.Blink,
+			)
+		}
 		u.state.error = msg
 		return u, nil
 	}
@@ -451,6 +786,10 @@ func (u *Ui) View() string {
 			u.components.prompt.View(),
 		)
 	}
+	//the models being picked replace the prompt
+	if u.state.picking {
+		return u.components.renderer.RenderContent(u.state.buffer)
+	}
 //querying, confirming, executing are UI states defined in the struct on top of this file
 	if !u.state.querying && !u.state.confirming && !u.state.executing {
 		// Render prompt view
@@ -459,10 +798,19 @@ func (u *Ui) View() string {
 
 	if u.state.promptMode == ChatPromptMode {
 		// if we are in the promptMode state, we will render chat mode view
-		// Render chat mode view
+		// Render chat mode view, with the spinner until the first chunk of the answer arrives
+		if u.state.querying && u.state.buffer == "" {
+			return u.components.spinner.View()
+		}
 		return u.components.renderer.RenderContent(u.state.buffer)
 	} else {
 		if u.state.querying {
+			//the command of a streamed exec answer is shown as soon as it is complete, with the
+			//explanation as far as it arrived
+			if u.state.promptMode == ExecPromptMode && u.state.partial.HasCommand() {
+				return u.components.renderer.RenderContent(fmt.Sprintf("`%s`", u.state.partial.GetCommand())) +
+					fmt.Sprintf("  %s\n%s", u.components.renderer.RenderHelp(u.state.partial.GetExplanation()), u.components.spinner.View())
+			}
 			// Call spinner.View() function from spinner.go file
 			return u.components.spinner.View()
 		} else {
@@ -478,39 +826,48 @@ func (u *Ui) View() string {
 
 // startRepl is a method of the Ui struct that starts the REPL (Read-Eval-Print Loop) mode.
 func (u *Ui) startRepl(config *config.Config) tea.Cmd {
+	u.config = config
+
+	// Open the session to resume, its conversation is restored once the engine is created
+	if err := u.openSession(config); err != nil {
+		u.state.error = err
+		return nil
+	}
+	resumed := u.session
+
+	// A resumed session goes on in the mode it was left in, unless one was asked for
+	if u.state.promptMode == DefaultPromptMode && u.session != nil {
+		u.state.promptMode = GetPromptModeFromString(u.session.Mode)
+	}
+
+	// Set the prompt mode based on the default prompt mode in the configuration
+	if u.state.promptMode == DefaultPromptMode {
+		u.state.promptMode = GetPromptModeFromString(config.GetUserConfig().GetDefaultPromptMode())
+	}
+	mode, model := engineModeOf(u.state.promptMode), u.state.model
+
+	// Open the ledger and the cache here, the engine created in the background only gets them
+	settings, err := u.prepareEngine(config)
+	if err != nil {
+		u.state.error = err
+		return nil
+	}
+
 	return tea.Sequence(
 		tea.ClearScreen,
-		tea.Println(u.components.renderer.RenderContent(u.components.renderer.RenderHelpMessage())),
+		tea.Println(u.components.renderer.RenderContent(u.components.renderer.RenderHelpMessage(u.commands))),
 		textinput.Blink,
 		func() tea.Msg {
-			u.config = config
-
-			// Set the prompt mode based on the default prompt mode in the configuration
-			if u.state.promptMode == DefaultPromptMode {
-				u.state.promptMode = GetPromptModeFromString(config.GetUserConfig().GetDefaultPromptMode())
-			}
-
-			engineMode := ai.ExecEngineMode
-			if u.state.promptMode == ChatPromptMode {
-				engineMode = ai.ChatEngineMode
-			}
-
-			// Create a new engine with the specified engine mode and configuration
-			engine, err := ai.NewEngine(engineMode, config)
+			// Create a new engine with the engine mode of the prompt mode and configuration
+			engine, err := buildEngine(config, mode, model, settings)
 			if err != nil {
 				return err
 			}
-
-			if u.state.pipe != "" {
-				engine.SetPipe(u.state.pipe)
+			if resumed != nil {
+				engine.RestoreSession(resumed)
 			}
 
-			u.engine = engine
-			u.state.buffer = "Welcome \n\n"
-			u.state.command = ""
-			u.components.prompt = NewPrompt(u.state.promptMode)
-
-			return nil
+			return engineReady{engine: engine}
 		},
 	)
 }
@@ -520,78 +877,140 @@ func (u *Ui) startRepl(config *config.Config) tea.Cmd {
 func (u *Ui) startCli(config *config.Config) tea.Cmd {
 	u.config = config
 
+	// Open the session to go on with, if any
+	if err := u.openSession(config); err != nil {
+		u.state.error = err
+		return nil
+	}
+
+	// A resumed session goes on in the mode it was left in, unless one was asked for
+	if u.state.promptMode == DefaultPromptMode && u.session != nil {
+		u.state.promptMode = GetPromptModeFromString(u.session.Mode)
+	}
+
 	// Set the prompt mode based on the default prompt mode in the configuration
 	if u.state.promptMode == DefaultPromptMode {
 		u.state.promptMode = GetPromptModeFromString(config.GetUserConfig().GetDefaultPromptMode())
 	}
 
-	engineMode := ai.ExecEngineMode
-	if u.state.promptMode == ChatPromptMode {
-		engineMode = ai.ChatEngineMode
-	}
-
-	// Create a new engine with the specified engine mode and configuration
-	engine, err := ai.NewEngine(engineMode, config)
+	// Create a new engine with the engine mode of the prompt mode and configuration
+	engine, err := u.newEngine(config, engineModeOf(u.state.promptMode), u.state.model)
 	if err != nil {
 		u.state.error = err
 		return nil
 	}
-
-	if u.state.pipe != "" {
-		engine.SetPipe(u.state.pipe)
+	if u.session != nil {
+		engine.RestoreSession(u.session)
 	}
-
 	u.engine = engine
-	u.state.querying = true
-	u.state.confirming = false
-	u.state.buffer = ""
-	u.state.command = ""
 
 	if u.state.promptMode == ExecPromptMode {
 		// If the prompt mode is ExecPromptMode, execute the completion command
 		return tea.Batch(
 			u.components.spinner.Tick,
-			func() tea.Msg {
-				output, err := u.engine.ExecCompletion(u.state.args)
-				u.state.querying = false
-				if err != nil {
-					return err
-				}
-
-				return *output
-			},
+			u.startExec(u.state.args),
+		)
+	} else if u.state.promptMode == ExplainPromptMode {
+		// If the prompt mode is ExplainPromptMode, explain the command, or the piped script without one
+		return tea.Batch(
+			u.components.spinner.Tick,
+			u.startExplain(u.state.args),
 		)
 	} else {
 		// If the prompt mode is ChatPromptMode, start the chat stream and await the response
 		return tea.Batch(
 			u.startChatStream(u.state.args),
 			u.awaitChatStream(),
+			u.components.spinner.Tick,
 		)
 	}
 }
 
+// engineSettings are what an engine gets from the UI, read on the event loop so that the engine can be
+//built in a command
+type engineSettings struct {
+	ledger   *usage.Ledger         // Ledger shared by the engines of the process
+	answers  *cache.Cache          // Cache of the exec answers, nil when disabled
+	sampling config.SamplingConfig // Sampling parameters given with the flags
+	offline  bool                  // Indicates if the answers only come from the cache
+	pipe     string                // Input piped to the assistant, if any
+}
+
+// newEngine creates an engine in the given mode with the model, the ledger, the sampling, the cache and the pipe of
+//this invocation
+func (u *Ui) newEngine(config *config.Config, mode ai.EngineMode, model string) (*ai.Engine, error) {
+	settings, err := u.prepareEngine(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildEngine(config, mode, model, settings)
+}
+
+// prepareEngine opens the ledger and the cache of an engine and reads the settings of this invocation, it
+//is called from Update since it changes the state of the UI
+func (u *Ui) prepareEngine(config *config.Config) (engineSettings, error) {
+	ledger, err := u.openLedger(config)
+	if err != nil {
+		return engineSettings{}, err
+	}
+	answers, err := u.newCache(config)
+	if err != nil {
+		return engineSettings{}, err
+	}
+
+	return engineSettings{
+		ledger:   ledger,
+		answers:  answers,
+		sampling: u.state.sampling,
+		offline:  u.state.offline,
+		pipe:     u.state.pipe,
+	}, nil
+}
+
+// buildEngine creates an engine in the given mode with the model and the settings, and checks the models
+//with the provider. it doesn't touch the UI, so it can run in a command
+func buildEngine(config *config.Config, mode ai.EngineMode, model string, settings engineSettings) (*ai.Engine, error) {
+	engine, err := ai.NewEngine(mode, config)
+	if err != nil {
+		return nil, err
+	}
+	engine.SetLedger(settings.ledger).SetSampling(settings.sampling).SetCache(settings.answers).SetOffline(settings.offline)
+
+	if settings.pipe != "" {
+		engine.SetPipe(settings.pipe)
+	}
+
+	//the model given with -model and the ones of the modes are checked against the available ones
+	aiConfig := config.GetAiConfig()
+	if err := engine.CheckModels(model, aiConfig.GetExecModel(), aiConfig.GetChatModel(), aiConfig.GetExplainModel()); err != nil {
+		return nil, err
+	}
+	engine.SetModel(model)
+
+	return engine, nil
+}
+
 // startConfig is a method of the Ui struct that starts the configuration mode.
 //when user has not provided the config file and we're placing the terminal into
 //REPL mode, we then call this function to accept config values from user while chatting
 func (u *Ui) startConfig() tea.Cmd {
-	return func() tea.Msg {
-		// Set the UI state
-		//we are keeping only configuring as true, rest everything is false
-		u.state.configuring = true
-		u.state.querying = false
-		u.state.confirming = false
-		u.state.executing = false
+	// Set the UI state
+	//we are keeping only configuring as true, rest everything is false
+	u.state.configuring = true
+	u.state.querying = false
+	u.state.confirming = false
+	u.state.executing = false
 
-		// Update the buffer with the rendered configuration message
-		u.state.buffer = u.components.renderer.RenderConfigMessage()
-		u.state.command = ""
+	// Update the buffer with the rendered configuration message
+	u.state.buffer = u.components.renderer.RenderConfigMessage()
+	u.state.command = ""
 
-		// Initialize a new prompt with ConfigPromptMode
-		//call the newprompt function with configPromptMode
-		u.components.prompt = NewPrompt(ConfigPromptMode) // this function is in prompt.go
+	// Initialize a new prompt with ConfigPromptMode
+	//call the newprompt function with configPromptMode
+	u.components.prompt = NewPrompt(ConfigPromptMode) // this function is in prompt.go
 
-		return nil
-	}
+	return textinput.Blink
 }
 
 // finishConfig is a method of the Ui struct that finishes the configuration process.
@@ -610,57 +1029,66 @@ func (u *Ui) finishConfig(key string) tea.Cmd {
 
 	u.config = config
 
-	// Initialize AI engine
-	engine, err := ai.NewEngine(ai.ExecEngineMode, config)
-	if err != nil {
+	// Open the session to go on with, if any, it goes on in the mode it was left in unless one was asked for
+	if err := u.openSession(config); err != nil {
 		u.state.error = err
 		return nil
 	}
-
-	if u.state.pipe != "" {
-		engine.SetPipe(u.state.pipe)
+	if u.state.promptMode == DefaultPromptMode && u.session != nil {
+		u.state.promptMode = GetPromptModeFromString(u.session.Mode)
+	}
+	if u.state.promptMode == DefaultPromptMode {
+		u.state.promptMode = GetPromptModeFromString(config.GetUserConfig().GetDefaultPromptMode())
+	}
+
+	// Initialize AI engine, like startRepl and startCli do
+	engine, err := u.newEngine(config, engineModeOf(u.state.promptMode), u.state.model)
+	if err != nil {
+		u.state.error = err
+		return nil
+	}
+	if u.session != nil {
+		engine.RestoreSession(u.session)
 	}
 
-	u.engine = engine
-
+	u.engine = engine
+
 	if u.state.runMode == ReplMode {
 		// If in REPL mode, return a sequence of commands
+		u.state.buffer = ""
+		u.state.command = ""
+		u.components.prompt = NewPrompt(u.state.promptMode)
+
 		return tea.Sequence(
 			tea.ClearScreen,
 			tea.Println(u.components.renderer.RenderSuccess("\n[settings ok]\n")),
 			textinput.Blink,
-			func() tea.Msg {
-				u.state.buffer = ""
-				u.state.command = ""
-				u.components.prompt = NewPrompt(ExecPromptMode)
-
-				return nil
-			},
 		)
 	} else {
 		if u.state.promptMode == ExecPromptMode {
 			// If in CLI mode with ExecPromptMode, return a sequence of commands
-			u.state.querying = true
-			u.state.configuring = false
-			u.state.buffer = ""
 			return tea.Sequence(
 				tea.Println(u.components.renderer.RenderSuccess("\n[settings ok]")),
-				u.components.spinner.Tick,
-				func() tea.Msg {
-					output, err := u.engine.ExecCompletion(u.state.args)
-					u.state.querying = false
-					if err != nil {
-						return err
-					}
-
-					return *output
-				},
+				tea.Batch(
+					u.components.spinner.Tick,
+					u.startExec(u.state.args),
+				),
+			)
+		} else if u.state.promptMode == ExplainPromptMode {
+			// If in CLI mode with ExplainPromptMode, explain the command, or the piped script without one
+			return tea.Sequence(
+				tea.Println(u.components.renderer.RenderSuccess("\n[settings ok]")),
+				tea.Batch(
+					u.components.spinner.Tick,
+					u.startExplain(u.state.args),
+				),
 			)
 		} else {
 			// If in CLI mode with ChatPromptMode, return a batch of commands
 			return tea.Batch(
 				u.startChatStream(u.state.args),
 				u.awaitChatStream(),
+				u.components.spinner.Tick,
 			)
 		}
 	}
@@ -668,14 +1096,33 @@ func (u *Ui) finishConfig(key string) tea.Cmd {
 
 // startExec is a method of the Ui struct that starts the execution of a command.
 func (u *Ui) startExec(input string) tea.Cmd {
+	u.state.querying = true
+	u.state.confirming = false
+	u.state.buffer = ""
+	u.state.command = ""
+	//a new question starts over the attempts to fix a failed command
+	u.state.fixes = 0
+	engine := u.engine
+
 	return func() tea.Msg {
-		u.state.querying = true
-		u.state.confirming = false
-		u.state.buffer = ""
-		u.state.command = ""
+		output, err := engine.ExecCompletion(input)
+		if err != nil {
+			return err
+		}
 
-		output, err := u.engine.ExecCompletion(input)
-		u.state.querying = false
+		return *output
+	}
+}
+
+// startExplain is a method of the Ui struct that starts the explanation of a command.
+func (u *Ui) startExplain(input string) tea.Cmd {
+	u.state.querying = true
+	u.state.confirming = false
+	u.state.buffer = ""
+	engine := u.engine
+
+	return func() tea.Msg {
+		output, err := engine.ExplainCompletion(input)
 		if err != nil {
 			return err
 		}
@@ -684,32 +1131,65 @@ func (u *Ui) startExec(input string) tea.Cmd {
 	}
 }
 
+// startFix prints the error of the failed command and asks the engine to diagnose it, the corrected
+//command it proposes goes through the confirmation like any other
+func (u *Ui) startFix(output string) tea.Cmd {
+	u.state.fixes++
+	u.state.querying = true
+	u.components.prompt.Blur()
+	output += u.components.renderer.RenderWarning(fmt.Sprintf("[asking for a fix, attempt %d/%d]\n", u.state.fixes, u.config.GetUserConfig().GetFixAttempts()))
+	command := u.state.executed
+	engine := u.engine
+
+	return tea.Sequence(
+		tea.Println(output),
+		tea.Batch(
+			func() tea.Msg {
+				output, err := engine.FixCompletion(command)
+				if err != nil {
+					return err
+				}
+
+				return *output
+			},
+			u.components.spinner.Tick,
+		),
+	)
+}
+
 // startChatStream is a method of the Ui struct that starts the chat stream.
 func (u *Ui) startChatStream(input string) tea.Cmd {
-	return func() tea.Msg {
-		u.state.querying = true
-		u.state.executing = false
-		u.state.confirming = false
-		u.state.buffer = ""
-		u.state.command = ""
+	u.state.querying = true
+	u.state.executing = false
+	u.state.confirming = false
+	u.state.buffer = ""
+	u.state.command = ""
+	u.state.failed = make(chan error, 1)
+	engine, failed := u.engine, u.state.failed
 
-		err := u.engine.ChatStreamCompletion(input)
-		if err != nil {
-			return err
+	//a stream which fails sends nothing on the channel of the engine, its error is handed to the
+	//reader of the channel instead, so it is reported once and the reader is released
+	return func() tea.Msg {
+		if err := engine.ChatStreamCompletion(input); err != nil {
+			failed <- err
 		}
 
 		return nil
 	}
 }
 
-// awaitChatStream is a method of the Ui struct that awaits the chat stream response.
+// awaitChatStream is a method of the Ui struct that awaits the chat stream response, the chunk is
+//added to the buffer when it is handled, or the error which ended the stream
 func (u *Ui) awaitChatStream() tea.Cmd {
-	return func() tea.Msg {
-		output := <-u.engine.GetChannel()
-		u.state.buffer += output.GetContent()
-		u.state.querying = !output.IsLast()
+	engine, failed := u.engine, u.state.failed
 
-		return output
+	return func() tea.Msg {
+		select {
+		case output := <-engine.GetChannel():
+			return output
+		case err := <-failed:
+			return err
+		}
 	}
 }
 
@@ -719,14 +1199,509 @@ func (u *Ui) execCommand(input string) tea.Cmd {
 	u.state.confirming = false
 	u.state.executing = true
 
+	u.state.executed = input
+
+	return tea.ExecProcess(prepareExecProcess(input))
+}
+
+// prepareExecProcess prepares the process executing a command, and the callback telling what it printed
+//once it is over
+func prepareExecProcess(input string) (*exec.Cmd, tea.ExecCallback) {
 	c := run.PrepareInteractiveCommand(input)
+	//the outputs still go to the terminal, and the engine is told what happened so the follow-ups can
+	//refer to the results
+	stdout, stderr := run.CaptureCommandOutput(c, ai.CommandOutputLimit)
+
+	return c, func(error error) tea.Msg {
+		return commandDone{
+			output:    run.NewRunOutput(error, "[error]", "[ok]"),
+			command:   input,
+			exitCode:  run.ExitCode(error),
+			stdout:    stdout.String(),
+			stderr:    stderr.String(),
+			truncated: stdout.IsTruncated() || stderr.IsTruncated(),
+		}
+	}
+}
 
-	return tea.ExecProcess(c, func(error error) tea.Msg {
-		u.state.executing = false
-		u.state.command = ""
+// openSession opens the store of the sessions and picks the session this invocation goes on with: a fork
+//of a session, the session given with -session, or the last session of the current directory when
+//auto-resume is on. without any, the REPL starts a session with its first answer
+func (u *Ui) openSession(config *config.Config) error {
+	store, err := session.NewStore(config.GetSystemConfig().GetSessionsDirectory())
+	if err != nil {
+		return err
+	}
+	u.sessions = store
+	directory, _ := os.Getwd()
+
+	var current *session.Session
+	switch {
+	case u.state.sessions == ForkSessionAction:
+		current, err = store.Fork(u.state.target, u.state.session)
+	case u.state.session != "":
+		current, err = store.Find(u.state.session)
+		if errors.Is(err, session.ErrNotFound) {
+			current, err = store.New(u.state.session, directory)
+		}
+	case config.GetUserConfig().IsSessionAutoResume():
+		current, err = store.Last(directory)
+		if errors.Is(err, session.ErrNotFound) {
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	u.session = current
 
-		return run.NewRunOutput(error, "[error]", "[ok]")
-	})
+	return nil
+}
+
+// saveSession saves the conversation of the engine in the current session, the REPL starts one if there
+//is none yet. it returns a warning to print when the session can't be saved
+func (u *Ui) saveSession() string {
+	if u.sessions == nil || u.engine == nil {
+		return ""
+	}
+	if u.session == nil {
+		if u.state.runMode != ReplMode {
+			return ""
+		}
+		directory, _ := os.Getwd()
+		current, err := u.sessions.New("", directory)
+		if err != nil {
+			return u.components.renderer.RenderWarning(fmt.Sprintf("[the session could not be saved: %s]\n", err))
+		}
+		u.session = current
+	}
+
+	u.engine.SaveSession(u.session)
+	if err := u.sessions.Save(u.session); err != nil {
+		return u.components.renderer.RenderWarning(fmt.Sprintf("[the session could not be saved: %s]\n", err))
+	}
+
+	return ""
+}
+
+// renderResumedSession renders the notice of a resumed session, nothing when the session is new.
+func (u *Ui) renderResumedSession() string {
+	if u.session == nil || u.session.CountMessages() == 0 {
+		return ""
+	}
+
+	notice := fmt.Sprintf("[resumed session %s, %d messages", u.session.GetLabel(), u.session.CountMessages())
+	if model := u.engine.GetModel(); u.session.Model != "" && u.session.Model != model {
+		notice += fmt.Sprintf(", started with %s and going on with %s", u.session.Model, model)
+	}
+
+	return u.components.renderer.RenderHelp(notice + "]\n")
+}
+
+// manageSessions lists, renames, deletes or exports the saved sessions, prints what was done and quits.
+//the new name of a renamed session is given after the flags
+func (u *Ui) manageSessions(config *config.Config) tea.Cmd {
+	output, err := func() (string, error) {
+		store, err := session.NewStore(config.GetSystemConfig().GetSessionsDirectory())
+		if err != nil {
+			return "", err
+		}
+
+		switch u.state.sessions {
+		case RenameSessionAction:
+			previous, err := store.Find(u.state.target)
+			if err != nil {
+				return "", err
+			}
+			label := previous.GetLabel()
+			renamed, err := store.Rename(previous.ID, u.state.args)
+			if err != nil {
+				return "", err
+			}
+			return u.components.renderer.RenderSuccess(fmt.Sprintf("[session %s renamed to %s]", label, renamed.Name)), nil
+		case DeleteSessionAction:
+			deleted, err := store.Delete(u.state.target)
+			if err != nil {
+				return "", err
+			}
+			return u.components.renderer.RenderSuccess(fmt.Sprintf("[session %s deleted]", deleted.GetLabel())), nil
+		case ExportSessionAction:
+			exported, err := u.exportSession(store, config)
+			if err != nil {
+				return "", err
+			}
+			return u.components.renderer.RenderSuccess(fmt.Sprintf("[session %s exported to %s]", exported.GetLabel(), u.state.target)), nil
+		default:
+			sessions, err := store.List()
+			if err != nil {
+				return "", err
+			}
+			directory, _ := os.Getwd()
+			return u.components.renderer.RenderContent(session.Report(sessions, directory)), nil
+		}
+	}()
+	if err != nil {
+		output = u.components.renderer.RenderError(err.Error())
+	}
+
+	return tea.Sequence(
+		tea.Println(output),
+		tea.Quit,
+	)
+}
+
+// exportSession writes the session given with -session, or the last one of the current directory, to
+//the file given with -export. the API key and anything looking like a secret is redacted first
+func (u *Ui) exportSession(store *session.Store, config *config.Config) (*session.Session, error) {
+	var exported *session.Session
+	var err error
+	if u.state.session != "" {
+		exported, err = store.Find(u.state.session)
+	} else {
+		directory, _ := os.Getwd()
+		exported, err = store.Last(directory)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	transcript := export.Redact(ai.Transcribe(exported), secretsOf(config)...)
+
+	return exported, export.Write(u.state.target, transcript)
+}
+
+// setPromptMode switches the prompt and the engine to the mode, each mode keeps its own conversation so
+//switching goes back to where it was left
+func (u *Ui) setPromptMode(mode PromptMode) {
+	u.state.promptMode = mode
+	u.components.prompt.SetMode(mode)
+	u.engine.SetMode(engineModeOf(mode))
+}
+
+// secretsOf returns the secrets of the config redacted from the exports: the API key and the values of
+//the headers, which can hold the token of a gateway
+func secretsOf(config *config.Config) []string {
+	secrets := []string{config.GetAiConfig().GetKey()}
+	for _, value := range config.GetAiConfig().GetHeaders() {
+		secrets = append(secrets, value)
+	}
+
+	return secrets
+}
+
+// engineModeOf returns the mode of the engine answering in the given prompt mode.
+func engineModeOf(mode PromptMode) ai.EngineMode {
+	switch mode {
+	case ChatPromptMode:
+		return ai.ChatEngineMode
+	case ExplainPromptMode:
+		return ai.ExplainEngineMode
+	default:
+		return ai.ExecEngineMode
+	}
+}
+
+// newLedger opens the usage ledger with the prices and the budgets of the config.
+func newLedger(config *config.Config) (*usage.Ledger, error) {
+	return usage.NewLedger(
+		config.GetSystemConfig().GetUsageFile(),
+		usage.NewPriceTable(config.GetAiConfig().GetPrices()),
+		config.GetAiConfig().GetSoftBudget(),
+		config.GetAiConfig().GetHardBudget(),
+	)
+}
+
+// openLedger returns the ledger of the process, opened with the first engine. the next engines share it
+//with the prices and the budgets of their config, so the total of the session is not started over
+func (u *Ui) openLedger(config *config.Config) (*usage.Ledger, error) {
+	if u.ledger != nil {
+		return u.ledger.SetPricing(
+			usage.NewPriceTable(config.GetAiConfig().GetPrices()),
+			config.GetAiConfig().GetSoftBudget(),
+			config.GetAiConfig().GetHardBudget(),
+		), nil
+	}
+
+	ledger, err := newLedger(config)
+	if err != nil {
+		return nil, err
+	}
+	u.ledger = ledger
+
+	return ledger, nil
+}
+
+// newCache opens the cache of the exec answers, nil when it is disabled by the config or bypassed with
+//-no-cache. the offline mode can't do without it
+func (u *Ui) newCache(config *config.Config) (*cache.Cache, error) {
+	if u.state.noCache || config.GetAiConfig().GetCacheTtl() <= 0 {
+		if u.state.offline {
+			return nil, errors.New("the offline mode needs the cache, which is disabled")
+		}
+		return nil, nil
+	}
+
+	return cache.NewCache(
+		config.GetSystemConfig().GetCacheDirectory(),
+		config.GetAiConfig().GetCacheTtl(),
+		config.GetAiConfig().GetCacheMaxSize(),
+	)
+}
+
+// showUsage prints the usage report of the ledger and quits.
+func (u *Ui) showUsage(config *config.Config) tea.Cmd {
+	ledger, err := newLedger(config)
+	if err != nil {
+		return tea.Sequence(
+			tea.Println(u.components.renderer.RenderError(err.Error())),
+			tea.Quit,
+		)
+	}
+
+	return tea.Sequence(
+		tea.Println(u.components.renderer.RenderContent(ledger.Report())),
+		tea.Quit,
+	)
+}
+
+// showPrompt prints the system prompt rendered for the prompt mode and the pipe, as it would be sent, and quits.
+func (u *Ui) showPrompt(config *config.Config) tea.Cmd {
+	if u.state.promptMode == DefaultPromptMode {
+		u.state.promptMode = GetPromptModeFromString(config.GetUserConfig().GetDefaultPromptMode())
+	}
+
+	engine, err := ai.NewEngine(engineModeOf(u.state.promptMode), config)
+	if err != nil {
+		return tea.Sequence(
+			tea.Println(u.components.renderer.RenderError(err.Error())),
+			tea.Quit,
+		)
+	}
+	engine.SetPipe(u.state.pipe)
+
+	return tea.Sequence(
+		tea.Println(engine.GetSystemPrompt()),
+		tea.Quit,
+	)
+}
+
+// renderProbes renders the read-only probes the model ran before answering, with how each one went.
+func (u *Ui) renderProbes(probes []ai.EngineProbe) string {
+	var rendered string
+	for _, probe := range probes {
+		if probe.GetError() != nil {
+			rendered += u.components.renderer.RenderWarning(fmt.Sprintf("[probe `%s`: %s]\n", probe.GetCommand(), probe.GetError()))
+		} else {
+			rendered += u.components.renderer.RenderHelp(fmt.Sprintf("[probe `%s`]\n", probe.GetCommand()))
+		}
+	}
+
+	return rendered
+}
+
+// renderNotices renders the notices shown before an answer: the piped input read in chunks, the older
+//turns compacted to fit in the context window, and the soft budget being reached, which is only shown
+//once per session
+func (u *Ui) renderNotices(compacted bool, chunks int) string {
+	var notices string
+	if chunks > 0 {
+		notices += u.components.renderer.RenderHelp(fmt.Sprintf(pipeChunksNotice, chunks))
+	}
+	if compacted {
+		notices += u.components.renderer.RenderWarning(compactedNotice)
+	}
+	if ledger := u.engine.GetLedger(); ledger != nil && !u.state.warned && ledger.IsOverSoftBudget() {
+		u.state.warned = true
+		notices += u.components.renderer.RenderWarning(fmt.Sprintf(
+			"[soft budget of $%.2f reached: $%.2f spent this month]\n",
+			ledger.GetSoftBudget(),
+			ledger.GetMonthTotal().Cost,
+		))
+	}
+
+	return notices
+}
+
+// modelPickerHeight is the number of models shown at once in the model picker.
+const modelPickerHeight = 10
+
+// listModels lists the models available with the provider in the background, for the model picker.
+func (u *Ui) listModels() tea.Cmd {
+	engine := u.engine
+
+	return func() tea.Msg {
+		models, err := engine.ListModels()
+		return modelsListed{models: models, err: err}
+	}
+}
+
+// checkModel checks the model given to /model against the available ones in the background.
+func (u *Ui) checkModel(model string) tea.Cmd {
+	engine := u.engine
+
+	return func() tea.Msg {
+		return modelChecked{model: model, err: engine.CheckModels(model)}
+	}
+}
+
+// switchModel switches to the model, the next questions go to it and the conversation goes on.
+func (u *Ui) switchModel(model string) tea.Cmd {
+	u.state.model = model
+	u.engine.SetModel(model)
+
+	return u.endModelPicker(u.components.renderer.RenderSuccess(fmt.Sprintf("[switched to model %s]", model)))
+}
+
+// renderModels renders the models around the one being picked, the current one being marked.
+func (u *Ui) renderModels() string {
+	start := u.state.pick - modelPickerHeight/2
+	if start > len(u.state.models)-modelPickerHeight {
+		start = len(u.state.models) - modelPickerHeight
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + modelPickerHeight
+	if end > len(u.state.models) {
+		end = len(u.state.models)
+	}
+
+	current := u.engine.GetModel()
+	var rendered string
+	for i := start; i < end; i++ {
+		model := u.state.models[i]
+		line := fmt.Sprintf("`%s`", model)
+		if i == u.state.pick {
+			line = "**▸** " + line
+		}
+		if model == current {
+			line += " *(current)*"
+		}
+		rendered += fmt.Sprintf("- %s\n", line)
+	}
+	rendered += fmt.Sprintf("\n*model %d/%d*, `↑`/`↓` to pick, `enter` to switch, `esc` to keep the current one", u.state.pick+1, len(u.state.models))
+
+	return rendered
+}
+
+// endModelPicker leaves the model picker, prints the given output and goes back to the prompt.
+func (u *Ui) endModelPicker(output string) tea.Cmd {
+	u.state.picking = false
+	u.state.models = nil
+	u.state.pick = 0
+	u.state.buffer = ""
+	u.components.prompt.Focus()
+
+	return tea.Sequence(
+		tea.Println(fmt.Sprintf("\n%s\n", output)),
+		textinput.Blink,
+	)
+}
+
+// showModels prints the models available with the provider, the one of the prompt mode being marked, and quits.
+func (u *Ui) showModels(config *config.Config) tea.Cmd {
+	if u.state.promptMode == DefaultPromptMode {
+		u.state.promptMode = GetPromptModeFromString(config.GetUserConfig().GetDefaultPromptMode())
+	}
+
+	output, err := func() (string, error) {
+		engine, err := u.newEngine(config, engineModeOf(u.state.promptMode), u.state.model)
+		if err != nil {
+			return "", err
+		}
+		models, err := engine.ListModels()
+		if err != nil {
+			return "", err
+		}
+		if len(models) == 0 {
+			return u.components.renderer.RenderWarning("[no model is available]"), nil
+		}
+
+		var list string
+		for _, model := range models {
+			if model == engine.GetModel() {
+				list += fmt.Sprintf("- `%s` *(current)*\n", model)
+			} else {
+				list += fmt.Sprintf("- `%s`\n", model)
+			}
+		}
+		return u.components.renderer.RenderContent(list), nil
+	}()
+	if err != nil {
+		output = u.components.renderer.RenderError(err.Error())
+	}
+
+	return tea.Sequence(
+		tea.Println(output),
+		tea.Quit,
+	)
+}
+
+// renderCandidates renders the alternative commands to pick from, with the explanation of the picked one.
+func (u *Ui) renderCandidates() string {
+	var rendered string
+	for i, candidate := range u.state.candidates {
+		if i == u.state.candidate {
+			rendered += fmt.Sprintf("%d. **▸** `%s`\n", i+1, candidate.GetCommand())
+		} else {
+			rendered += fmt.Sprintf("%d. `%s`\n", i+1, candidate.GetCommand())
+		}
+	}
+	rendered += fmt.Sprintf("\n*%s*\n\n", u.state.candidates[u.state.candidate].GetExplanation())
+	rendered += "`↑`/`↓` to pick, confirm execution? [y/N]"
+
+	return rendered
+}
+
+// renderPlanStep renders the confirmation of the current plan step.
+func (u *Ui) renderPlanStep() string {
+	step := u.state.plan[u.state.step]
+	output := u.components.renderer.RenderContent(fmt.Sprintf("step %d/%d: `%s`", u.state.step+1, len(u.state.plan), step.GetCommand()))
+	output += fmt.Sprintf("  %s\n\n  [r]un, [s]kip or [a]bort?", u.components.renderer.RenderHelp(step.GetExplanation()))
+
+	return output
+}
+
+// nextPlanStep prints the given output and moves on to the confirmation of the next plan step, or ends the plan after the last one.
+func (u *Ui) nextPlanStep(output string) (tea.Model, tea.Cmd) {
+	u.state.step++
+	if u.state.step >= len(u.state.plan) {
+		return u.endPlan(output + u.components.renderer.RenderSuccess("[plan done]\n"))
+	}
+
+	u.state.confirming = true
+	u.state.executing = false
+	u.components.prompt.Blur()
+
+	return u, tea.Sequence(
+		tea.Println(output),
+		tea.Println(u.renderPlanStep()),
+	)
+}
+
+// endPlan prints the given output and leaves the plan, going back to the prompt (or quitting in CLI mode).
+func (u *Ui) endPlan(output string) (tea.Model, tea.Cmd) {
+	u.state.plan = nil
+	u.state.step = 0
+	u.state.confirming = false
+	u.state.executing = false
+	u.state.querying = false
+	u.state.command = ""
+	u.state.buffer = ""
+	u.components.prompt.SetValue("")
+	u.components.prompt.Focus()
+
+	if u.state.runMode == CliMode {
+		return u, tea.Sequence(
+			tea.Println(output),
+			tea.Quit,
+		)
+	}
+
+	return u, tea.Sequence(
+		tea.Println(output),
+		textinput.Blink,
+	)
 }
 
 // editSettings is a method of the Ui struct that handles editing the settings.
@@ -744,35 +1719,48 @@ func (u *Ui) editSettings() tea.Cmd {
 	))
 
 	return tea.ExecProcess(c, func(error error) tea.Msg {
-		// Update UI state
-		u.state.executing = false
-		u.state.command = ""
-
 		if error != nil {
 			// Handle error output
-			return run.NewRunOutput(error, "[settings error]", "")
+			return settingsDone{output: run.NewRunOutput(error, "[settings error]", "")}
 		}
 
 		// Create a new config instance
 		config, error := config.NewConfig()
 		if error != nil {
 			// Handle error output
-			return run.NewRunOutput(error, "[settings error]", "")
+			return settingsDone{output: run.NewRunOutput(error, "[settings error]", "")}
 		}
 
-		// Update UI config and engine
-		u.config = config
-		engine, error := ai.NewEngine(ai.ExecEngineMode, config)
-		if u.state.pipe != "" {
-			engine.SetPipe(u.state.pipe)
+		//the engine of the new config is built once Update got it, see reloadSettings
+		return settingsEdited{config: config}
+	})
+}
+
+// reloadSettings opens the ledger and the cache of the edited config, and returns the command building its
+//engine, which checks the models with the provider off the event loop
+func (u *Ui) reloadSettings(config *config.Config) tea.Cmd {
+	mode, model := engineModeOf(u.state.promptMode), u.state.model
+
+	settings, err := u.prepareEngine(config)
+	if err != nil {
+		return func() tea.Msg {
+			return settingsDone{output: run.NewRunOutput(err, "[settings error]", "")}
 		}
-		if error != nil {
+	}
+
+	return func() tea.Msg {
+		// Create the engine of the new config, the UI takes both when it handles the message
+		engine, err := buildEngine(config, mode, model, settings)
+		if err != nil {
 			// Handle error output
-			return run.NewRunOutput(error, "[settings error]", "")
+			return settingsDone{output: run.NewRunOutput(err, "[settings error]", "")}
 		}
-		u.engine = engine
 
 		// Return success output
-		return run.NewRunOutput(nil, "", "[settings ok]")
-	})
+		return settingsDone{
+			output: run.NewRunOutput(nil, "", "[settings ok]"),
+			config: config,
+			engine: engine,
+		}
+	}
 }
@@ -0,0 +1,543 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/akhilsharma90/terminal-assistant/ai"
+	"github.com/akhilsharma90/terminal-assistant/cache"
+	"github.com/akhilsharma90/terminal-assistant/config"
+	"github.com/akhilsharma90/terminal-assistant/run"
+	"github.com/akhilsharma90/terminal-assistant/session"
+	"github.com/akhilsharma90/terminal-assistant/system"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/term"
+)
+
+// TestUi runs the requests of the UI in the background while it keeps being updated and rendered, as
+//bubbletea does, they are meant to be run with -race
+func TestUi(t *testing.T) {
+	t.Run("ConcurrentExec", testUiConcurrentExec)
+	t.Run("ConcurrentChatStream", testUiConcurrentChatStream)
+	t.Run("FailedChatStream", testUiFailedChatStream)
+	t.Run("Session", testUiSession)
+	t.Run("ModelPicker", testUiModelPicker)
+	t.Run("FixFailedCommand", testUiFixFailedCommand)
+	t.Run("FixTerminalCommand", testUiFixTerminalCommand)
+	t.Run("PlanFailedStep", testUiPlanFailedStep)
+	t.Run("ForgetFailedCommand", testUiForgetFailedCommand)
+	t.Run("FinishConfig", testUiFinishConfig)
+	t.Run("FinishConfigExplain", testUiFinishConfigExplain)
+	t.Run("Ledger", testUiLedger)
+	t.Run("EditSettings", testUiEditSettings)
+}
+
+// newTestUi creates a REPL with an engine in the given mode, talking to the given server.
+func newTestUi(t *testing.T, mode PromptMode, url string) *Ui {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("OPENAI_KEY", "test_key")
+	viper.Set("OPENAI_MODEL", "test_model")
+	viper.Set("OPENAI_MAX_TOKENS", 100)
+	viper.Set("OPENAI_BASE_URL", url)
+	cfg := config.BuildConfig(system.Analyse())
+
+	u := NewUi(&UiInput{runMode: ReplMode, promptMode: mode})
+	engine, err := ai.NewEngine(engineModeOf(mode), cfg)
+	require.NoError(t, err)
+	u.config = cfg
+	u.engine = engine
+
+	return u
+}
+
+// newStreamingServer starts a stand-in server streaming the given chunks, the last one waiting for
+//release to be closed or for the client to go away
+func newStreamingServer(t *testing.T, release chan struct{}, chunks ...string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i, chunk := range chunks {
+			if i == len(chunks)-1 {
+				select {
+				case <-release:
+				case <-r.Context().Done():
+					return
+				}
+			}
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", chunk)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// runInBackground runs the command on its own goroutine, like bubbletea does, and sends its message on the channel.
+func runInBackground(cmd tea.Cmd, msgs chan tea.Msg) {
+	go func() {
+		msgs <- cmd()
+	}()
+}
+
+// runCommands runs the command and the ones it sequences or batches, one after the other, and returns
+//the messages they produced
+func runCommands(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+	msg := cmd()
+
+	//tea.Sequence produces an unexported slice of commands, it is run like a tea.BatchMsg
+	value := reflect.ValueOf(msg)
+	if value.Kind() == reflect.Slice && value.Type().Elem() == reflect.TypeOf(tea.Cmd(nil)) {
+		var msgs []tea.Msg
+		for i := 0; i < value.Len(); i++ {
+			msgs = append(msgs, runCommands(value.Index(i).Interface().(tea.Cmd))...)
+		}
+		return msgs
+	}
+
+	return []tea.Msg{msg}
+}
+
+// runFailingCommand runs a command which fails like the UI does, and returns the message of its end.
+func runFailingCommand(t *testing.T, command string) commandDone {
+	t.Helper()
+
+	err := run.PrepareInteractiveCommand(command).Run()
+	require.Error(t, err)
+
+	return commandDone{
+		output:   run.NewRunOutput(err, "[error]", "[ok]"),
+		command:  command,
+		exitCode: run.ExitCode(err),
+	}
+}
+
+// testUiConcurrentExec checks that the command of a streamed exec answer is shown while the request runs
+//in the background, and that the answer is picked up by Update
+func testUiConcurrentExec(t *testing.T) {
+	release := make(chan struct{})
+	server := newStreamingServer(t, release, `{"cmd":"ls ~","exp":"list `, `all files","exec":true}`)
+	u := newTestUi(t, ExecPromptMode, server.URL)
+
+	msgs := make(chan tea.Msg, 1)
+	runInBackground(u.startExec("list all files in my home dir"), msgs)
+	assert.True(t, u.state.querying)
+
+	require.Eventually(t, func() bool {
+		u.Update(spinner.TickMsg{})
+		return u.state.partial.HasCommand()
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, u.View(), "ls ~")
+	close(release)
+
+	msg := <-msgs
+	require.IsType(t, ai.EngineExecOutput{}, msg)
+	u.Update(msg)
+	assert.False(t, u.state.querying)
+	assert.True(t, u.state.confirming)
+	assert.Equal(t, "ls ~", u.state.command)
+	assert.False(t, u.state.partial.HasCommand())
+}
+
+// testUiConcurrentChatStream checks that the chunks of a chat stream are gathered by Update while the
+//stream runs in the background, and that it can be interrupted with esc
+func testUiConcurrentChatStream(t *testing.T) {
+	server := newStreamingServer(t, make(chan struct{}), "The answer", " never arrives")
+	u := newTestUi(t, ChatPromptMode, server.URL)
+
+	msgs := make(chan tea.Msg, 2)
+	runInBackground(u.startChatStream("What is 2+2 ?"), msgs)
+	runInBackground(u.awaitChatStream(), msgs)
+
+	var last ai.EngineChatStreamOutput
+	for !last.IsLast() {
+		select {
+		case msg := <-msgs:
+			output, ok := msg.(ai.EngineChatStreamOutput)
+			if !ok {
+				require.Nil(t, msg)
+				continue
+			}
+			_, cmd := u.Update(output)
+			if output.IsLast() {
+				last = output
+				continue
+			}
+			assert.Equal(t, "The answer", u.state.buffer)
+			runInBackground(cmd, msgs)
+			u.Update(tea.KeyMsg{Type: tea.KeyEsc})
+		case <-time.After(10 * time.Millisecond):
+			u.Update(spinner.TickMsg{})
+			u.View()
+		}
+	}
+
+	assert.True(t, last.IsInterrupt())
+	assert.False(t, u.state.querying)
+	assert.Empty(t, u.state.buffer)
+}
+
+// testUiFailedChatStream checks that the error of a chat stream is handed to the reader of its chunks, and
+//that the REPL goes back to the prompt
+func testUiFailedChatStream(t *testing.T) {
+	u := newTestUi(t, ChatPromptMode, "http://localhost")
+	u.engine.SetOffline(true)
+
+	msgs := make(chan tea.Msg, 2)
+	runInBackground(u.startChatStream("What is 2+2 ?"), msgs)
+	runInBackground(u.awaitChatStream(), msgs)
+	assert.True(t, u.state.querying)
+
+	for i := 0; i < 2; i++ {
+		msg := <-msgs
+		if msg == nil {
+			continue
+		}
+		require.ErrorIs(t, msg.(error), ai.ErrOffline)
+		u.Update(msg)
+	}
+	assert.False(t, u.state.querying)
+	assert.NoError(t, u.state.error)
+}
+
+// testUiSession checks that the REPL saves its conversation in a session started with the first answer,
+//and that a reset leaves it as it was
+func testUiSession(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	server := newStreamingServer(t, release, `{"cmd":"ls","exp":"list files",`, `"exec":true}`)
+	u := newTestUi(t, ExecPromptMode, server.URL)
+	store, err := session.NewStore(filepath.Join(t.TempDir(), "sessions"))
+	require.NoError(t, err)
+	u.sessions = store
+
+	u.Update(u.startExec("list files")())
+	require.NotNil(t, u.session)
+	saved, err := store.Find(u.session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "exec", saved.Mode)
+	require.Len(t, saved.ExecMessages, 2)
+	assert.Equal(t, "list files", saved.ExecMessages[0].Content)
+
+	//a reset starts a new session with the next answer
+	u.state.confirming = false
+	u.Update(tea.KeyMsg{Type: tea.KeyCtrlR})
+	assert.Nil(t, u.session)
+	saved, err = store.Find(saved.ID)
+	require.NoError(t, err)
+	assert.Len(t, saved.ExecMessages, 2)
+}
+
+// testUiModelPicker checks that a model picked among the listed ones answers the next questions, and
+//that esc keeps the current one
+func testUiModelPicker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"object":"list","data":[{"id":"gpt-4o"},{"id":"test_model"},{"id":"gpt-4"}]}`)
+	}))
+	t.Cleanup(server.Close)
+	u := newTestUi(t, ExecPromptMode, server.URL)
+
+	u.Update(tea.KeyMsg{Type: tea.KeyCtrlO})
+	assert.True(t, u.state.querying)
+	u.Update(u.listModels()())
+	assert.False(t, u.state.querying)
+	require.True(t, u.state.picking)
+	assert.Equal(t, []string{"gpt-4", "gpt-4o", "test_model"}, u.state.models)
+	//the current model is picked first
+	assert.Equal(t, 2, u.state.pick)
+	assert.Contains(t, u.View(), "gpt-4o")
+
+	u.Update(tea.KeyMsg{Type: tea.KeyDown})
+	u.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	assert.False(t, u.state.picking)
+	assert.Equal(t, "gpt-4", u.engine.GetModel())
+
+	u.Update(tea.KeyMsg{Type: tea.KeyCtrlO})
+	u.Update(u.listModels()())
+	assert.Equal(t, 0, u.state.pick)
+	u.Update(tea.KeyMsg{Type: tea.KeyUp})
+	u.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	assert.False(t, u.state.picking)
+	assert.Equal(t, "gpt-4", u.engine.GetModel())
+}
+
+// testUiFixFailedCommand checks that a command which failed is sent back to the engine to get a corrected
+//one, and that the prompt is back once the attempts are used
+func testUiFixFailedCommand(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	server := newStreamingServer(t, release, `{"cmd":"ls /tmp","exp":"the directory does not exist",`, `"exec":true}`)
+	u := newTestUi(t, ExecPromptMode, server.URL)
+	viper.Set("USER_FIX_ATTEMPTS", 1)
+	u.config = config.BuildConfig(system.Analyse())
+
+	u.state.executed = "ls /nonexistent-path"
+	_, cmd := u.Update(runFailingCommand(t, "ls /nonexistent-path"))
+	assert.Equal(t, 1, u.state.fixes)
+	assert.True(t, u.state.querying)
+
+	var answer tea.Msg
+	for _, msg := range runCommands(cmd) {
+		if _, ok := msg.(ai.EngineExecOutput); ok {
+			answer = msg
+		}
+	}
+	require.NotNil(t, answer, "A corrected command should be asked.")
+	u.Update(answer)
+	assert.True(t, u.state.confirming)
+	assert.Equal(t, "ls /tmp", u.state.command)
+
+	conversation := &session.Session{}
+	u.engine.SaveSession(conversation)
+	messages := conversation.ExecMessages
+	require.Len(t, messages, 3)
+	assert.Contains(t, messages[0].Content, "exited with code 2")
+	assert.Contains(t, messages[1].Content, "The command `ls /nonexistent-path` failed.")
+
+	//the next failure goes back to the prompt
+	u.state.confirming = false
+	u.state.executed = "ls /tmp/nonexistent-path"
+	u.Update(runFailingCommand(t, "ls /tmp/nonexistent-path"))
+	assert.Equal(t, 0, u.state.fixes)
+	assert.False(t, u.state.querying)
+}
+
+// testUiFixTerminalCommand checks that the error output of a command failing in a terminal is sent with
+//the request for a corrected command
+func testUiFixTerminalCommand(t *testing.T) {
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bodies <- string(body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", `{"cmd":"ls /tmp","exp":"it does not exist","exec":true}`)
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+	u := newTestUi(t, ExecPromptMode, server.URL)
+	viper.Set("USER_FIX_ATTEMPTS", 1)
+	u.config = config.BuildConfig(system.Analyse())
+
+	//the outputs of the command go to a terminal, like in the REPL
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = openTerminal(t), openTerminal(t)
+	process, done := prepareExecProcess("ls /nonexistent-path")
+	os.Stdout, os.Stderr = stdout, stderr
+
+	u.state.executed = "ls /nonexistent-path"
+	_, cmd := u.Update(done(process.Run()))
+	require.Equal(t, 1, u.state.fixes)
+	runCommands(cmd)
+
+	body := <-bodies
+	assert.Contains(t, body, "The command `ls /nonexistent-path` failed.")
+	assert.Contains(t, body, "No such file or directory")
+}
+
+// openTerminal opens the master side of a new pseudo terminal, standing for the terminal of the user.
+func openTerminal(t *testing.T) *os.File {
+	t.Helper()
+
+	terminal, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("no pseudo terminal: %v", err)
+	}
+	t.Cleanup(func() { terminal.Close() })
+	require.True(t, term.IsTerminal(int(terminal.Fd())))
+
+	return terminal
+}
+
+// testUiPlanFailedStep checks that the keys other than run, skip and abort are ignored while a plan step is
+//confirmed, and that a failed step stops the plan
+func testUiPlanFailedStep(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	server := newStreamingServer(t, release,
+		`{"cmd":"","exp":"clean up","exec":true,"steps":[{"cmd":"ls /nonexistent-path","exp":"list it"},`,
+		`{"cmd":"echo done","exp":"say it is done"}]}`,
+	)
+	u := newTestUi(t, ExecPromptMode, server.URL)
+	viper.Set("USER_FIX_ATTEMPTS", 1)
+	u.config = config.BuildConfig(system.Analyse())
+
+	u.Update(u.startExec("clean up")())
+	require.Len(t, u.state.plan, 2)
+	assert.True(t, u.state.confirming)
+
+	u.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	u.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	assert.True(t, u.state.confirming, "A stray key should not abort the plan.")
+	assert.Len(t, u.state.plan, 2)
+
+	u.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	assert.False(t, u.state.confirming)
+	assert.Equal(t, "ls /nonexistent-path", u.state.executed)
+
+	//the failed step stops the plan, without asking for a fix
+	u.Update(runFailingCommand(t, u.state.executed))
+	assert.Empty(t, u.state.plan)
+	assert.Equal(t, 0, u.state.step)
+	assert.Equal(t, 0, u.state.fixes)
+	assert.False(t, u.state.confirming)
+	assert.False(t, u.state.querying)
+}
+
+// testUiForgetFailedCommand checks that a cached command which fails once executed is not proposed again
+//from the cache
+func testUiForgetFailedCommand(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	server := newStreamingServer(t, release, `{"cmd":"ls /nonexistent-path","exp":"list it",`, `"exec":true}`)
+	u := newTestUi(t, ExecPromptMode, server.URL)
+	answers, err := cache.NewCache(filepath.Join(t.TempDir(), "cache"), time.Hour, 0)
+	require.NoError(t, err)
+	u.engine.SetCache(answers)
+	//an engine answering only from the cache tells if the answer is still there
+	cached := func() bool {
+		engine, err := ai.NewEngine(ai.ExecEngineMode, u.config)
+		require.NoError(t, err)
+		_, err = engine.SetCache(answers).SetOffline(true).ExecCompletion("list it")
+		return err == nil
+	}
+
+	u.Update(u.startExec("list it")())
+	require.True(t, u.state.confirming)
+	require.True(t, cached(), "The answer should be cached.")
+
+	u.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	require.Equal(t, "ls /nonexistent-path", u.state.executed)
+	u.Update(runFailingCommand(t, u.state.executed))
+	assert.False(t, cached(), "The failed command should be forgotten.")
+}
+
+// newConfigHome sets a temporary home directory, where the config file entered in the UI is written, and
+//the URL of the stand-in server the config will hold
+func newConfigHome(t *testing.T, url string) string {
+	t.Helper()
+
+	home := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(home, ".config"), 0755))
+	t.Setenv("HOME", home)
+	homedir.DisableCache = true
+	t.Cleanup(func() { homedir.DisableCache = false })
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("OPENAI_BASE_URL", url)
+	viper.Set("OPENAI_CACHE_TTL", 0)
+
+	return home
+}
+
+// testUiFinishConfig checks that once the key is entered, the engine is created like the ones of the REPL
+//and the CLI, in the mode of the invocation
+func testUiFinishConfig(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	server := newStreamingServer(t, release, `{"cmd":"ls -la","exp":"list the files",`, `"exec":true}`)
+	home := newConfigHome(t, server.URL)
+
+	u := NewUi(&UiInput{runMode: ReplMode, promptMode: ChatPromptMode})
+	u.finishConfig("test_key")
+	require.NoError(t, u.state.error)
+	assert.Equal(t, ai.ChatEngineMode, u.engine.GetMode())
+	assert.Equal(t, ChatPromptMode, u.components.prompt.GetMode())
+	assert.FileExists(t, filepath.Join(home, ".config", "terminal-assistant.json"))
+}
+
+// testUiFinishConfigExplain checks that once the key is entered, a CLI invocation in explain mode explains
+//the command
+func testUiFinishConfigExplain(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	server := newStreamingServer(t, release, `{"summary":"lists the files",`, `"stages":[]}`)
+	newConfigHome(t, server.URL)
+
+	u := NewUi(&UiInput{runMode: CliMode, promptMode: ExplainPromptMode, args: "ls -la"})
+	msgs := runCommands(u.finishConfig("test_key"))
+	require.NoError(t, u.state.error)
+	assert.Equal(t, ai.ExplainEngineMode, u.engine.GetMode())
+
+	var explained bool
+	for _, msg := range msgs {
+		if output, ok := msg.(ai.EngineExplainOutput); ok {
+			explained = true
+			assert.Equal(t, "lists the files", output.GetSummary())
+		}
+	}
+	assert.True(t, explained, "The command should be explained.")
+}
+
+// testUiLedger checks that the engines share the ledger of the process, with the prices and the budgets
+//of their config, so the total of the session goes on when the settings are edited
+func testUiLedger(t *testing.T) {
+	newConfigHome(t, "http://localhost")
+	viper.Set("OPENAI_KEY", "test_key")
+	u := NewUi(&UiInput{runMode: ReplMode, promptMode: ExecPromptMode})
+
+	engine, err := u.newEngine(config.BuildConfig(system.Analyse()), ai.ExecEngineMode, "")
+	require.NoError(t, err)
+	_, err = engine.GetLedger().Add("test_model", "exec", 10, 10, false)
+	require.NoError(t, err)
+
+	viper.Set("OPENAI_HARD_BUDGET", 5)
+	other, err := u.newEngine(config.BuildConfig(system.Analyse()), ai.ChatEngineMode, "")
+	require.NoError(t, err)
+	assert.Same(t, engine.GetLedger(), other.GetLedger())
+	assert.Equal(t, 5.0, other.GetLedger().GetHardBudget())
+	assert.Equal(t, 1, other.GetLedger().GetSessionTotal().Requests)
+}
+
+// testUiEditSettings checks that the engine of the edited settings is built in the background, the models
+//being checked with the provider while the UI keeps being updated
+func testUiEditSettings(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, `{"object":"list","data":[{"id":"gpt-4o"},{"id":"test_model"}]}`)
+	}))
+	t.Cleanup(server.Close)
+	u := newTestUi(t, ExecPromptMode, server.URL)
+	u.state.model = "gpt-4o"
+	engine := u.engine
+
+	viper.Set("OPENAI_HARD_BUDGET", 5)
+	_, cmd := u.Update(settingsEdited{config: config.BuildConfig(system.Analyse())})
+	require.NotNil(t, cmd)
+	require.NotNil(t, u.ledger, "The ledger should be opened by Update.")
+	assert.Equal(t, 5.0, u.ledger.GetHardBudget())
+
+	msgs := make(chan tea.Msg, 1)
+	runInBackground(cmd, msgs)
+	u.Update(spinner.TickMsg{})
+	assert.Same(t, engine, u.engine, "The engine should not change before the models are checked.")
+	close(release)
+
+	msg := <-msgs
+	require.IsType(t, settingsDone{}, msg)
+	u.Update(msg)
+	require.NotSame(t, engine, u.engine)
+	assert.Equal(t, "gpt-4o", u.engine.GetModel())
+	assert.Same(t, u.ledger, u.engine.GetLedger())
+}
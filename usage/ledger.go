@@ -0,0 +1,235 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+//every request sent to the API is recorded in the ledger with the tokens it used and what it cost.
+//the ledger is a local file with one JSON record per line, so the totals of the day and of the month
+//survive between sessions. the monthly spend is checked against the budgets of the config
+
+// ErrHardBudgetExceeded is returned by CheckBudget once the spend of the month reached the hard budget.
+var ErrHardBudgetExceeded = errors.New("hard budget exceeded")
+
+// Record is the usage of a single request.
+type Record struct {
+	Time             time.Time `json:"time"`                // When the request was sent
+	Model            string    `json:"model"`               // Model answering the request
+	Mode             string    `json:"mode"`                // Engine mode the request was sent from (exec, chat)
+	PromptTokens     int       `json:"prompt_tokens"`       // Tokens sent
+	CompletionTokens int       `json:"completion_tokens"`   // Tokens generated
+	Cost             float64   `json:"cost"`                // Cost in dollars, 0 when the price of the model is unknown
+	Estimated        bool      `json:"estimated,omitempty"` // Indicates if the tokens were estimated because the API didn't return them
+}
+
+// Total sums the usage of several requests.
+type Total struct {
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+}
+
+// add returns the total with the given record added.
+func (t Total) add(record Record) Total {
+	t.Requests++
+	t.PromptTokens += record.PromptTokens
+	t.CompletionTokens += record.CompletionTokens
+	t.Cost += record.Cost
+
+	return t
+}
+
+// GetTokens returns the prompt and completion tokens of the total.
+func (t Total) GetTokens() int {
+	return t.PromptTokens + t.CompletionTokens
+}
+
+// Ledger records the usage of the requests and checks the spend against the budgets.
+type Ledger struct {
+	file         string           // File the records are appended to, empty keeps them in memory only
+	prices       *PriceTable      // Prices used to compute the cost of the requests
+	softBudget   float64          // Monthly spend in dollars above which the user is warned, 0 means none
+	hardBudget   float64          // Monthly spend in dollars above which requests are blocked, 0 means none
+	records      []Record         // All the records of the ledger
+	sessionStart time.Time        // When the ledger was opened, the records after it belong to this session
+	now          func() time.Time // Returns the current time, replaced in tests
+	mu           sync.Mutex       // Guards records, the prices and the budgets, requests are recorded from the engine goroutines
+}
+
+// NewLedger opens the ledger stored in the given file, it is created with the first record if missing.
+func NewLedger(file string, prices *PriceTable, softBudget float64, hardBudget float64) (*Ledger, error) {
+	ledger := &Ledger{
+		file:         file,
+		prices:       prices,
+		softBudget:   softBudget,
+		hardBudget:   hardBudget,
+		records:      []Record{},
+		sessionStart: time.Now(),
+		now:          time.Now,
+	}
+	if file == "" {
+		return ledger, nil
+	}
+
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return ledger, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record Record
+		//a broken line, like one cut short by a crash, is skipped rather than losing the whole ledger
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		ledger.records = append(ledger.records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return ledger, nil
+}
+
+// SetPricing replaces the prices and the budgets, like when the settings were edited. the records and the
+//start of the session are kept
+func (l *Ledger) SetPricing(prices *PriceTable, softBudget float64, hardBudget float64) *Ledger {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prices = prices
+	l.softBudget = softBudget
+	l.hardBudget = hardBudget
+
+	return l
+}
+
+// Add records the usage of a request, computing its cost from the price table.
+func (l *Ledger) Add(model string, mode string, promptTokens int, completionTokens int, estimated bool) (Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record := Record{
+		Time:             l.now(),
+		Model:            model,
+		Mode:             mode,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		Cost:             l.prices.GetCost(model, promptTokens, completionTokens),
+		Estimated:        estimated,
+	}
+
+	l.records = append(l.records, record)
+	if l.file == "" {
+		return record, nil
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return record, err
+	}
+	f, err := os.OpenFile(l.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return record, err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+
+	return record, err
+}
+
+// GetRecords returns a copy of all the records of the ledger.
+func (l *Ledger) GetRecords() []Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]Record{}, l.records...)
+}
+
+// GetSoftBudget returns the monthly spend above which the user is warned, 0 means none.
+func (l *Ledger) GetSoftBudget() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.softBudget
+}
+
+// GetHardBudget returns the monthly spend above which requests are blocked, 0 means none.
+func (l *Ledger) GetHardBudget() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.hardBudget
+}
+
+// getTotalSince sums the records made since the given time.
+func (l *Ledger) getTotalSince(since time.Time) Total {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var total Total
+	for _, record := range l.records {
+		if !record.Time.Before(since) {
+			total = total.add(record)
+		}
+	}
+
+	return total
+}
+
+// startOfDay returns the midnight starting the day of the given time.
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// startOfMonth returns the midnight starting the month of the given time.
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// GetSessionTotal returns the usage since the ledger was opened.
+func (l *Ledger) GetSessionTotal() Total {
+	return l.getTotalSince(l.sessionStart)
+}
+
+// GetDayTotal returns the usage of the current day.
+func (l *Ledger) GetDayTotal() Total {
+	return l.getTotalSince(startOfDay(l.now()))
+}
+
+// GetMonthTotal returns the usage of the current month.
+func (l *Ledger) GetMonthTotal() Total {
+	return l.getTotalSince(startOfMonth(l.now()))
+}
+
+// IsOverSoftBudget tells if the spend of the month reached the soft budget.
+func (l *Ledger) IsOverSoftBudget() bool {
+	softBudget := l.GetSoftBudget()
+
+	return softBudget > 0 && l.GetMonthTotal().Cost >= softBudget
+}
+
+// CheckBudget returns an error wrapping ErrHardBudgetExceeded once the spend of the month reached the hard budget.
+func (l *Ledger) CheckBudget() error {
+	hardBudget := l.GetHardBudget()
+	if hardBudget <= 0 {
+		return nil
+	}
+	if spent := l.GetMonthTotal().Cost; spent >= hardBudget {
+		return fmt.Errorf("%w: $%.2f spent this month, the hard budget is $%.2f", ErrHardBudgetExceeded, spent, hardBudget)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestLedger opens a ledger in a temporary file, whose clock is set to the given time.
+func newTestLedger(t *testing.T, now time.Time, softBudget float64, hardBudget float64) *Ledger {
+	t.Helper()
+
+	prices := NewPriceTable(map[string]Price{"test_model": {Prompt: 1000, Completion: 2000}})
+	ledger, err := NewLedger(filepath.Join(t.TempDir(), "usage.jsonl"), prices, softBudget, hardBudget)
+	require.NoError(t, err)
+	ledger.now = func() time.Time { return now }
+
+	return ledger
+}
+
+func TestLedger(t *testing.T) {
+	now := time.Date(2024, time.March, 15, 12, 0, 0, 0, time.Local)
+
+	// TestAdd tests that a record gets its cost and is written to the ledger file.
+	t.Run("Add", func(t *testing.T) {
+		ledger := newTestLedger(t, now, 0, 0)
+
+		record, err := ledger.Add("test_model", "exec", 1000, 500, false)
+		require.NoError(t, err)
+		assert.InDelta(t, 2.0, record.Cost, 1e-9)
+		assert.Equal(t, now, record.Time)
+
+		reopened, err := NewLedger(ledger.file, ledger.prices, 0, 0)
+		require.NoError(t, err)
+		require.Len(t, reopened.GetRecords(), 1)
+		assert.Equal(t, "exec", reopened.GetRecords()[0].Mode)
+	})
+
+	// TestBrokenLine tests that a broken line of the ledger file is skipped.
+	t.Run("BrokenLine", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "usage.jsonl")
+		content := "{\"model\":\"a\",\"prompt_tokens\":1}\n{\"model\":\n{\"model\":\"b\",\"prompt_tokens\":2}\n"
+		require.NoError(t, os.WriteFile(file, []byte(content), 0600))
+
+		ledger, err := NewLedger(file, NewPriceTable(nil), 0, 0)
+		require.NoError(t, err)
+		assert.Len(t, ledger.GetRecords(), 2)
+	})
+
+	// TestTotals tests the totals of the session, the day and the month.
+	t.Run("Totals", func(t *testing.T) {
+		ledger := newTestLedger(t, now, 0, 0)
+		ledger.records = []Record{
+			{Time: now.AddDate(0, -1, 0), PromptTokens: 100, Cost: 1},
+			{Time: now.AddDate(0, 0, -2), PromptTokens: 10, Cost: 0.1},
+		}
+		ledger.sessionStart = now
+		_, err := ledger.Add("test_model", "chat", 1, 1, true)
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, ledger.GetSessionTotal().Requests)
+		assert.Equal(t, 1, ledger.GetDayTotal().Requests)
+		assert.Equal(t, 2, ledger.GetMonthTotal().Requests)
+		assert.Equal(t, 12, ledger.GetMonthTotal().GetTokens())
+	})
+
+	// TestBudgets tests the soft and hard budgets.
+	t.Run("Budgets", func(t *testing.T) {
+		ledger := newTestLedger(t, now, 1, 2)
+		assert.False(t, ledger.IsOverSoftBudget())
+		assert.NoError(t, ledger.CheckBudget())
+
+		_, err := ledger.Add("test_model", "exec", 1000, 0, false)
+		require.NoError(t, err)
+		assert.True(t, ledger.IsOverSoftBudget())
+		assert.NoError(t, ledger.CheckBudget())
+
+		_, err = ledger.Add("test_model", "exec", 1000, 0, false)
+		require.NoError(t, err)
+		err = ledger.CheckBudget()
+		assert.ErrorIs(t, err, ErrHardBudgetExceeded)
+		assert.Contains(t, err.Error(), "$2.00 spent this month")
+	})
+
+	// TestSetPricing tests that new prices and budgets apply to the next records, the session going on.
+	t.Run("SetPricing", func(t *testing.T) {
+		ledger := newTestLedger(t, now, 0, 0)
+		ledger.sessionStart = now
+		_, err := ledger.Add("test_model", "exec", 1000, 0, false)
+		require.NoError(t, err)
+
+		ledger.SetPricing(NewPriceTable(map[string]Price{"test_model": {Prompt: 3000}}), 0, 4)
+		record, err := ledger.Add("test_model", "exec", 1000, 0, false)
+		require.NoError(t, err)
+		assert.InDelta(t, 3.0, record.Cost, 1e-9)
+		assert.Equal(t, 2, ledger.GetSessionTotal().Requests)
+		assert.Equal(t, 4.0, ledger.GetHardBudget())
+		assert.ErrorIs(t, ledger.CheckBudget(), ErrHardBudgetExceeded)
+	})
+}
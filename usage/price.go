@@ -0,0 +1,74 @@
+package usage
+
+import "strings"
+
+//the APIs bill the prompt tokens (what we send) and the completion tokens (what the model writes)
+//at a different price, the prices below are in dollars for one million tokens
+
+// Price is the price of a model, in dollars per million tokens.
+type Price struct {
+	Prompt     float64 `json:"prompt" mapstructure:"prompt"`         // Price of a million prompt tokens
+	Completion float64 `json:"completion" mapstructure:"completion"` // Price of a million completion tokens
+}
+
+// DefaultPrices is the price table used for the models missing from the config.
+var DefaultPrices = map[string]Price{
+	"gpt-3.5-turbo":   {Prompt: 0.5, Completion: 1.5},
+	"gpt-4":           {Prompt: 30, Completion: 60},
+	"gpt-4-32k":       {Prompt: 60, Completion: 120},
+	"gpt-4-turbo":     {Prompt: 10, Completion: 30},
+	"gpt-4o":          {Prompt: 2.5, Completion: 10},
+	"gpt-4o-mini":     {Prompt: 0.15, Completion: 0.6},
+	"claude-3-haiku":  {Prompt: 0.25, Completion: 1.25},
+	"claude-3-sonnet": {Prompt: 3, Completion: 15},
+	"claude-3-opus":   {Prompt: 15, Completion: 75},
+}
+
+// PriceTable finds the price of a model, the prices of the config win over the default ones.
+type PriceTable struct {
+	prices map[string]Price
+}
+
+// NewPriceTable creates a new PriceTable from the default prices overridden by the given ones.
+func NewPriceTable(prices map[string]Price) *PriceTable {
+	table := &PriceTable{
+		prices: map[string]Price{},
+	}
+	for model, price := range DefaultPrices {
+		table.prices[model] = price
+	}
+	//viper lower cases the keys of the config, so do we
+	for model, price := range prices {
+		table.prices[strings.ToLower(model)] = price
+	}
+
+	return table
+}
+
+// GetPrice returns the price of a model. models are matched on the longest known prefix, so
+//dated versions like gpt-4-0613 get the price of their family. false is returned for unknown models
+func (t *PriceTable) GetPrice(model string) (Price, bool) {
+	model = strings.ToLower(model)
+
+	var found string
+	for name := range t.prices {
+		if strings.HasPrefix(model, name) && len(name) > len(found) {
+			found = name
+		}
+	}
+	if found == "" {
+		return Price{}, false
+	}
+
+	return t.prices[found], true
+}
+
+// GetCost returns the cost in dollars of a request to the model, 0 for unknown models.
+func (t *PriceTable) GetCost(model string, promptTokens int, completionTokens int) float64 {
+	price, ok := t.GetPrice(model)
+	if !ok {
+		return 0
+	}
+
+	return (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1000000
+}
@@ -0,0 +1,48 @@
+package usage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriceTable(t *testing.T) {
+	// TestGetPrice tests that models are matched on the longest known prefix.
+	t.Run("GetPrice", func(t *testing.T) {
+		table := NewPriceTable(nil)
+
+		price, ok := table.GetPrice("gpt-4o-mini-2024-07-18")
+		assert.True(t, ok)
+		assert.Equal(t, DefaultPrices["gpt-4o-mini"], price)
+
+		price, ok = table.GetPrice("gpt-4-0613")
+		assert.True(t, ok)
+		assert.Equal(t, DefaultPrices["gpt-4"], price)
+
+		_, ok = table.GetPrice("llama3")
+		assert.False(t, ok)
+	})
+
+	// TestConfigPrices tests that the prices of the config win over the default ones.
+	t.Run("ConfigPrices", func(t *testing.T) {
+		table := NewPriceTable(map[string]Price{
+			"GPT-4":  {Prompt: 1, Completion: 2},
+			"llama3": {Prompt: 0, Completion: 0},
+		})
+
+		price, ok := table.GetPrice("gpt-4")
+		assert.True(t, ok)
+		assert.Equal(t, Price{Prompt: 1, Completion: 2}, price)
+
+		_, ok = table.GetPrice("llama3:8b")
+		assert.True(t, ok)
+	})
+
+	// TestGetCost tests the cost of a request.
+	t.Run("GetCost", func(t *testing.T) {
+		table := NewPriceTable(map[string]Price{"test_model": {Prompt: 2, Completion: 4}})
+
+		assert.InDelta(t, 0.004, table.GetCost("test_model", 1000, 500), 1e-9)
+		assert.Equal(t, 0.0, table.GetCost("unknown", 1000, 500))
+	})
+}
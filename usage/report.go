@@ -0,0 +1,72 @@
+package usage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Report summarises the spend in markdown: the totals of the session, the day and the month, then
+//the usage of the month by day, by model and by mode.
+func (l *Ledger) Report() string {
+	report := "**Usage**\n\n"
+	report += fmt.Sprintf("- this session: %s\n", formatTotal(l.GetSessionTotal()))
+	report += fmt.Sprintf("- today: %s\n", formatTotal(l.GetDayTotal()))
+	report += fmt.Sprintf("- this month: %s\n", formatTotal(l.GetMonthTotal()))
+	//the budgets are read under the lock, the settings can change them while the report is built
+	if softBudget := l.GetSoftBudget(); softBudget > 0 {
+		report += fmt.Sprintf("- soft budget: $%.2f\n", softBudget)
+	}
+	if hardBudget := l.GetHardBudget(); hardBudget > 0 {
+		report += fmt.Sprintf("- hard budget: $%.2f\n", hardBudget)
+	}
+
+	monthStart := startOfMonth(l.now())
+	byDay := map[string]Total{}
+	byModel := map[string]Total{}
+	byMode := map[string]Total{}
+	for _, record := range l.GetRecords() {
+		if record.Time.Before(monthStart) {
+			continue
+		}
+		day := record.Time.In(monthStart.Location()).Format("2006-01-02")
+		byDay[day] = byDay[day].add(record)
+		byModel[record.Model] = byModel[record.Model].add(record)
+		byMode[record.Mode] = byMode[record.Mode].add(record)
+	}
+
+	report += formatTotals("By day", "day", byDay)
+	report += formatTotals("By model", "model", byModel)
+	report += formatTotals("By mode", "mode", byMode)
+
+	return report
+}
+
+// formatTotal formats a total on a single line.
+func formatTotal(total Total) string {
+	return fmt.Sprintf("%d requests, %d tokens, $%.4f", total.Requests, total.GetTokens(), total.Cost)
+}
+
+// formatTotals formats the totals as a markdown table sorted by key, nothing is returned without totals.
+func formatTotals(title string, column string, totals map[string]Total) string {
+	if len(totals) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(totals))
+	for key := range totals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var table strings.Builder
+	fmt.Fprintf(&table, "\n**%s**\n\n", title)
+	fmt.Fprintf(&table, "| %s | requests | prompt tokens | completion tokens | cost |\n", column)
+	table.WriteString("|---|---:|---:|---:|---:|\n")
+	for _, key := range keys {
+		total := totals[key]
+		fmt.Fprintf(&table, "| %s | %d | %d | %d | $%.4f |\n", key, total.Requests, total.PromptTokens, total.CompletionTokens, total.Cost)
+	}
+
+	return table.String()
+}
@@ -0,0 +1,58 @@
+package usage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReport(t *testing.T) {
+	now := time.Date(2024, time.March, 15, 12, 0, 0, 0, time.Local)
+
+	// TestEmpty tests the report of an empty ledger.
+	t.Run("Empty", func(t *testing.T) {
+		ledger := newTestLedger(t, now, 0, 0)
+		report := ledger.Report()
+
+		assert.Contains(t, report, "- this month: 0 requests, 0 tokens, $0.0000")
+		assert.NotContains(t, report, "By day")
+	})
+
+	// TestByDayModelMode tests that the month is summarised by day, model and mode.
+	t.Run("ByDayModelMode", func(t *testing.T) {
+		ledger := newTestLedger(t, now, 5, 10)
+		ledger.records = []Record{
+			{Time: now.AddDate(0, -1, 0), Model: "old_model", Mode: "exec", PromptTokens: 100, Cost: 1},
+			{Time: now.AddDate(0, 0, -1), Model: "gpt-4", Mode: "exec", PromptTokens: 10, CompletionTokens: 5, Cost: 0.5},
+			{Time: now, Model: "gpt-4", Mode: "chat", PromptTokens: 20, CompletionTokens: 10, Cost: 0.25},
+		}
+		report := ledger.Report()
+
+		assert.Contains(t, report, "- this month: 2 requests, 45 tokens, $0.7500")
+		assert.Contains(t, report, "- soft budget: $5.00")
+		assert.Contains(t, report, "- hard budget: $10.00")
+		assert.Contains(t, report, "| 2024-03-14 | 1 | 10 | 5 | $0.5000 |")
+		assert.Contains(t, report, "| 2024-03-15 | 1 | 20 | 10 | $0.2500 |")
+		assert.Contains(t, report, "| gpt-4 | 2 | 30 | 15 | $0.7500 |")
+		assert.Contains(t, report, "| chat | 1 | 20 | 10 | $0.2500 |")
+		assert.NotContains(t, report, "old_model")
+	})
+
+	// TestSetPricing tests that the report can be built while the budgets are changed, run with -race.
+	t.Run("SetPricing", func(t *testing.T) {
+		ledger := newTestLedger(t, now, 5, 10)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				ledger.SetPricing(NewPriceTable(nil), 5, 10)
+			}
+		}()
+		for i := 0; i < 100; i++ {
+			assert.Contains(t, ledger.Report(), "- soft budget: $5.00")
+		}
+		<-done
+	})
+}